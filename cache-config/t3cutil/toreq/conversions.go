@@ -51,7 +51,7 @@ func dsesToLatest(dses []tc.DeliveryServiceV4) []atscfg.DeliveryService {
 }
 
 func jobsToLatest(jobs []tc.InvalidationJobV4) []atscfg.InvalidationJob {
-	return atscfg.ToInvalidationJobs(jobs)
+	return atscfg.V4ToInvalidationJobs(jobs)
 }
 
 func serverUpdateStatusesToLatest(statuses []tc.ServerUpdateStatusV40) []atscfg.ServerUpdateStatus {
@@ -64,7 +64,7 @@ type DeliveryService tc.DeliveryServiceV4
 // InvalidationJob is a tc.InvalidationJob for the latest lib/go-tc and traffic_ops/vx-client type.
 // This allows atscfg to not have to change the type everywhere it's used, every time ATC changes the base type,
 // but to only have to change it here, and the places where breaking symbol changes were made.
-type InvalidationJob tc.InvalidationJobV4
+type InvalidationJob tc.InvalidationJobV5
 
 // ServerUdpateStatus is a tc.ServerUdpateStatus for the latest lib/go-tc and traffic_ops/vx-client type.
 // This allows atscfg to not have to change the type everywhere it's used, every time ATC changes the base type,
@@ -90,7 +90,7 @@ func V4ToDeliveryServices(dses []tc.DeliveryServiceV4) []DeliveryService {
 }
 
 // ToInvalidationJobs converts a slice of the latest lib/go-tc and traffic_ops/vx-client type to the local alias.
-func ToInvalidationJobs(jobs []tc.InvalidationJobV4) []InvalidationJob {
+func ToInvalidationJobs(jobs []tc.InvalidationJobV5) []InvalidationJob {
 	aj := make([]InvalidationJob, 0, len(jobs))
 	for _, job := range jobs {
 		aj = append(aj, InvalidationJob(job))
@@ -98,6 +98,15 @@ func ToInvalidationJobs(jobs []tc.InvalidationJobV4) []InvalidationJob {
 	return aj
 }
 
+// V4ToInvalidationJobs converts a slice of the old traffic_ops/v4-client type to the local alias.
+func V4ToInvalidationJobs(jobs []tc.InvalidationJobV4) []InvalidationJob {
+	aj := make([]InvalidationJob, 0, len(jobs))
+	for _, job := range jobs {
+		aj = append(aj, InvalidationJob(job.Upgrade()))
+	}
+	return aj
+}
+
 // ToServers converts a slice of the latest lib/go-tc and traffic_ops/vx-client type to the local alias.
 func ToServers(servers []tc.ServerV40) []Server {
 	as := make([]Server, 0, len(servers))
@@ -742,7 +751,7 @@ func JobToInvalidationJob(jb tc.Job) (InvalidationJob, error) {
 	if err := json.Unmarshal([]byte(`"`+jb.StartTime+`"`), &startTime); err != nil {
 		return InvalidationJob{}, errors.New("unmarshalling time: " + err.Error())
 	}
-	ttl, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(jb.Parameters, "TTL:"), "h"))
+	ttl, err := tc.ParseTTLParameter(jb.Parameters)
 	if err != nil {
 		return InvalidationJob{}, errors.New("unmarshalling ttl: " + err.Error())
 	}
@@ -756,7 +765,7 @@ func JobToInvalidationJob(jb tc.Job) (InvalidationJob, error) {
 		CreatedBy:        jb.CreatedBy,
 		DeliveryService:  jb.DeliveryService,
 		ID:               uint64(jb.ID),
-		TTLHours:         uint(ttl),
+		TTLHours:         ttl,
 		InvalidationType: invalType,
 		StartTime:        startTime.Time,
 	}, nil
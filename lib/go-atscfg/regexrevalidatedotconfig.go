@@ -115,11 +115,7 @@ func MakeRegexRevalidateDotConfig(
 
 	txt := makeHdrComment(opt.HdrComment)
 	for _, job := range cfgJobs {
-		txt += job.AssetURL + " " + strconv.FormatInt(job.PurgeEnd.Unix(), 10)
-		if job.Type != "" && job.Type != RevalTypeDefault {
-			txt += " " + string(job.Type)
-		}
-		txt += "\n"
+		txt += job.String() + "\n"
 	}
 
 	return Cfg{
@@ -134,6 +130,36 @@ type revalJob struct {
 	AssetURL string
 	PurgeEnd time.Time
 	Type     RevalType // RevalTypeMiss or RevalTypeStale (default)
+	Priority int
+}
+
+// String returns the job's line of regex_revalidate.config, without a
+// trailing newline.
+func (job revalJob) String() string {
+	line := job.AssetURL + " " + strconv.FormatInt(job.PurgeEnd.Unix(), 10)
+	if job.Type != "" && job.Type != RevalTypeDefault {
+		line += " " + string(job.Type)
+	}
+	return line
+}
+
+// MakeRegexRevalidateLine returns the line of regex_revalidate.config that the
+// given job produces on its own, when the maxRevalDurationDays Parameter is
+// the given number of days (DefaultMaxRevalDurationDays if it isn't
+// positive). The returned bool is false if the job is left out of the file
+// entirely, because it has already ended or it started longer ago than that.
+//
+// Note that in the generated file, jobs for the same asset URL are combined
+// into one line, with the latest expiry of any of them.
+func MakeRegexRevalidateLine(job InvalidationJob, maxRevalDurationDays int) (string, bool) {
+	if maxRevalDurationDays <= 0 {
+		maxRevalDurationDays = DefaultMaxRevalDurationDays
+	}
+	jobs := filterJobs([]InvalidationJob{job}, time.Duration(maxRevalDurationDays)*time.Hour*24, RegexRevalidateMinTTL)
+	if len(jobs) == 0 {
+		return "", false
+	}
+	return jobs[0].String(), true
 }
 
 type jobsSort []revalJob
@@ -141,6 +167,9 @@ type jobsSort []revalJob
 func (jb jobsSort) Len() int      { return len(jb) }
 func (jb jobsSort) Swap(i, j int) { jb[i], jb[j] = jb[j], jb[i] }
 func (jb jobsSort) Less(i, j int) bool {
+	if jb[i].Priority != jb[j].Priority {
+		return jb[i].Priority > jb[j].Priority
+	}
 	if jb[i].AssetURL == jb[j].AssetURL {
 		return jb[i].PurgeEnd.Before(jb[j].PurgeEnd)
 	}
@@ -152,7 +181,8 @@ func (jb jobsSort) Less(i, j int) bool {
 //   - have a start time later than (now + maxReval days). That is, we don't query jobs older than maxReval in the past.
 //   - have a start_time+ttl > now. That is, jobs that haven't expired yet.
 //
-// Returns the filtered jobs.
+// Returns the filtered jobs, highest priority first. Jobs for the same asset
+// URL are combined, taking the latest purge end and the highest priority.
 func filterJobs(tcJobs []InvalidationJob, maxReval time.Duration, minTTL time.Duration) []revalJob {
 
 	jobMap := map[string]revalJob{}
@@ -181,8 +211,16 @@ func filterJobs(tcJobs []InvalidationJob, maxReval time.Duration, minTTL time.Du
 
 		purgeEnd := tcJob.StartTime.Add(ttl)
 
-		if rjob, ok := jobMap[assetURL]; !ok || purgeEnd.After(rjob.PurgeEnd) {
-			jobMap[assetURL] = revalJob{AssetURL: assetURL, PurgeEnd: purgeEnd, Type: jobType}
+		rjob, ok := jobMap[assetURL]
+		if !ok || purgeEnd.After(rjob.PurgeEnd) {
+			priority := tcJob.Priority
+			if ok && rjob.Priority > priority {
+				priority = rjob.Priority
+			}
+			jobMap[assetURL] = revalJob{AssetURL: assetURL, PurgeEnd: purgeEnd, Type: jobType, Priority: priority}
+		} else if tcJob.Priority > rjob.Priority {
+			rjob.Priority = tcJob.Priority
+			jobMap[assetURL] = rjob
 		}
 	}
 
@@ -20,6 +20,7 @@ package atscfg
  */
 
 import (
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -126,3 +127,60 @@ func TestMakeRegexRevalidateDotConfig(t *testing.T) {
 		t.Errorf("##REFRESH## directive not properly handled '%v'", txt)
 	}
 }
+
+func TestFilterJobsPriority(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	jobs := []InvalidationJob{
+		{AssetURL: "a", StartTime: start, DeliveryService: "myds", TTLHours: 24, InvalidationType: tc.REFRESH},
+		{AssetURL: "b", StartTime: start, DeliveryService: "myds", TTLHours: 24, InvalidationType: tc.REFRESH, Priority: 5},
+		{AssetURL: "c", StartTime: start, DeliveryService: "myds", TTLHours: 24, InvalidationType: tc.REFRESH, Priority: 10},
+		// A later job for the same asset URL with a lower priority shouldn't
+		// lower its priority.
+		{AssetURL: "c", StartTime: start, DeliveryService: "myds", TTLHours: 48, InvalidationType: tc.REFRESH, Priority: 1},
+	}
+
+	filtered := filterJobs(jobs, 90*24*time.Hour, RegexRevalidateMinTTL)
+	if len(filtered) != 3 {
+		t.Fatalf("expected 3 jobs, actual %d: %+v", len(filtered), filtered)
+	}
+	for i, expected := range []string{"c", "b", "a"} {
+		if filtered[i].AssetURL != expected {
+			t.Errorf("expected job %d to be for '%s', actual '%s'", i, expected, filtered[i].AssetURL)
+		}
+	}
+	if filtered[0].Priority != 10 {
+		t.Errorf("expected combined job priority 10, actual %d", filtered[0].Priority)
+	}
+	if expected := start.Add(48 * time.Hour); !filtered[0].PurgeEnd.Equal(expected) {
+		t.Errorf("expected combined job purge end %v, actual %v", expected, filtered[0].PurgeEnd)
+	}
+}
+
+func TestMakeRegexRevalidateLine(t *testing.T) {
+	start := time.Unix(time.Now().Unix(), 0).Add(-time.Hour)
+	job := InvalidationJob{AssetURL: "http://origin.example/.+\\.png", StartTime: start, DeliveryService: "myds", TTLHours: 24, InvalidationType: tc.REFETCH}
+
+	line, ok := MakeRegexRevalidateLine(job, 0)
+	if !ok {
+		t.Fatal("expected a current job to produce a line")
+	}
+	expected := "http://origin.example/.+\\.png " + strconv.FormatInt(start.Add(24*time.Hour).Unix(), 10) + " MISS"
+	if line != expected {
+		t.Errorf("expected line '%s', actual '%s'", expected, line)
+	}
+
+	// The TTL is capped at maxRevalDurationDays.
+	job.TTLHours = 24 * 30
+	job.InvalidationType = tc.REFRESH
+	line, ok = MakeRegexRevalidateLine(job, 2)
+	expected = "http://origin.example/.+\\.png " + strconv.FormatInt(start.Add(48*time.Hour).Unix(), 10)
+	if !ok || line != expected {
+		t.Errorf("expected line '%s', actual '%s' (%t)", expected, line, ok)
+	}
+
+	job.StartTime = time.Now().Add(-48 * time.Hour)
+	job.TTLHours = 24
+	if line, ok := MakeRegexRevalidateLine(job, 0); ok {
+		t.Errorf("expected an ended job to produce no line, actual '%s'", line)
+	}
+}
@@ -32,6 +32,7 @@ const (
 	LastModified      = "Last-Modified"     // RFC7232§2.2
 	ETagHeader        = "ETag"
 	IfMatch           = "If-Match"
+	IfNoneMatch       = "If-None-Match" // RFC7232§3.2
 	IfUnmodifiedSince = "If-Unmodified-Since"
 	Date              = "Date"
 	ETagVersion       = 1
@@ -110,3 +111,24 @@ func ParseETags(eTags []string) (time.Time, bool) {
 	}
 	return latestTime, latestTime != time.Time{}
 }
+
+// ETagMatchesIfNoneMatch returns whether the given ETag (which must be quoted)
+// matches the If-None-Match header in h, if any, i.e. whether a 304 Not
+// Modified response should be sent instead of the representation with that
+// ETag. As required by RFC7232§3.2, this uses weak comparison, so a "W/"
+// prefix on either ETag is ignored.
+func ETagMatchesIfNoneMatch(h http.Header, etag string) bool {
+	if h == nil || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, header := range h.Values(IfNoneMatch) {
+		for _, tag := range strings.Split(header, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -20,6 +20,7 @@ package rfc
  */
 
 import (
+	"net/http"
 	"testing"
 	"time"
 )
@@ -42,3 +43,31 @@ func TestETag(t *testing.T) {
 		t.Errorf("Expected time %v, actual %v", "2020-08-06 18:11:22.278418 +0000 UTC", ans.UTC().String())
 	}
 }
+
+func TestETagMatchesIfNoneMatch(t *testing.T) {
+	etag := `"abc"`
+	tests := []struct {
+		ifNoneMatch string
+		expected    bool
+	}{
+		{"", false},
+		{`"abc"`, true},
+		{`W/"abc"`, true},
+		{`"xyz", "abc"`, true},
+		{`"xyz"`, false},
+		{`abc`, false},
+		{"*", true},
+	}
+	for _, test := range tests {
+		h := http.Header{}
+		if test.ifNoneMatch != "" {
+			h.Set(IfNoneMatch, test.ifNoneMatch)
+		}
+		if actual := ETagMatchesIfNoneMatch(h, etag); actual != test.expected {
+			t.Errorf("Expected ETag %s matching If-None-Match '%s' to be %t, got %t", etag, test.ifNoneMatch, test.expected, actual)
+		}
+	}
+	if ETagMatchesIfNoneMatch(nil, etag) {
+		t.Error("Expected no match for nil headers")
+	}
+}
@@ -31,6 +31,7 @@ import (
 // These are the names of HTTP Headers, for convenience and so that typos are
 // caught at compile-time.
 const (
+	Accept             = "Accept"              // RFC7231§5.3.2
 	AcceptEncoding     = "Accept-Encoding"     // RFC7231§5.3.4
 	CacheControl       = "Cache-Control"       // RFC7234§5.2
 	ContentDisposition = "Content-Disposition" // RFC6266
@@ -44,6 +45,7 @@ const (
 	Location           = "Location"            // RFC7231§7.1.2
 	Authorization      = "Authorization"       // RFC7235§4.2
 	Cookie             = "Cookie"              // RFC7873
+	IdempotencyKey     = "Idempotency-Key"     // IETF draft-ietf-httpapi-idempotency-key-header
 )
 
 // These are (some) valid values for content encoding and MIME types, for
@@ -52,6 +54,7 @@ const (
 	ApplicationJSON           = "application/json"         // RFC4627§6
 	ApplicationOctetStream    = "application/octet-stream" // RFC2046§4.5.2
 	ContentTypeMultiPartMixed = "multipart/mixed"          // RFC1341§7.2
+	ContentTypeTextCSV        = "text/csv"                 // RFC4180§3
 	ContentTypeTextPlain      = "text/plain"               // RFC2046§4.1
 	ContentTypeURIList        = "text/uri-list"            // RFC2483§5
 	Gzip                      = "gzip"                     // RFC7230§4.2.3
@@ -20,9 +20,63 @@ package tc
  */
 
 import (
+	"errors"
 	"strings"
 )
 
+// These are the stable, machine-readable codes that may appear in the Code
+// field of an Alert. Unlike alert text, these are not subject to change.
+const (
+	// AlertCodeNotAuthorized indicates that the requesting user lacks the
+	// Tenancy, Permissions, or lock necessary to act on the requested object.
+	AlertCodeNotAuthorized = "NOT_AUTHORIZED"
+	// AlertCodeNotFound indicates that the requested object, or an object it
+	// references, does not exist.
+	AlertCodeNotFound = "NOT_FOUND"
+	// AlertCodeAlreadyStarted indicates that the requested modification is not
+	// allowed because the object in question has already begun taking effect.
+	AlertCodeAlreadyStarted = "ALREADY_STARTED"
+	// AlertCodeConflict indicates that the request conflicts with the current
+	// state of the object in question.
+	AlertCodeConflict = "CONFLICT"
+	// AlertCodeAlreadyExists indicates that nothing was created because an
+	// identical object already exists. Unlike the other codes, this may be
+	// given on non-error-level Alerts of successful requests.
+	AlertCodeAlreadyExists = "ALREADY_EXISTS"
+)
+
+// CodedError is an error that carries one of the stable AlertCode* codes, so
+// that it may be reported to clients in a machine-readable way.
+type CodedError struct {
+	// Code is the machine-readable code, e.g. AlertCodeNotFound.
+	Code string
+	// Err is the wrapped error, which provides the human-readable text.
+	Err error
+}
+
+// Error implements the error interface by returning the text of the wrapped
+// error.
+func (e CodedError) Error() string {
+	if e.Err == nil {
+		return ""
+	}
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e CodedError) Unwrap() error {
+	return e.Err
+}
+
+// NewCodedError wraps err with the given machine-readable code. If err is
+// nil, nil is returned.
+func NewCodedError(code string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return CodedError{Code: code, Err: err}
+}
+
 // Alert represents an informational message, typically returned through the Traffic Ops API.
 type Alert struct {
 	// Text is the actual message being conveyed.
@@ -30,6 +84,10 @@ type Alert struct {
 	// Level describes what kind of message is being relayed. In practice, it should be the string
 	// representation of one of ErrorLevel, WarningLevel, InfoLevel or SuccessLevel.
 	Level string `json:"level"`
+	// Code is an optional, stable, machine-readable identifier of the kind of
+	// problem being reported - one of the AlertCode* constants - for clients
+	// that shouldn't need to parse Text.
+	Code string `json:"code,omitempty"`
 }
 
 // Alerts is merely a collection of arbitrary "Alert"s for ease of use in other structures, most
@@ -39,12 +97,18 @@ type Alerts struct {
 }
 
 // CreateErrorAlerts creates and returns an Alerts structure filled with ErrorLevel-level "Alert"s
-// using the errors to provide text.
+// using the errors to provide text. Errors that are (or wrap) a CodedError
+// also provide the Alert's Code.
 func CreateErrorAlerts(errs ...error) Alerts {
 	alerts := []Alert{}
 	for _, err := range errs {
 		if err != nil {
-			alerts = append(alerts, Alert{err.Error(), ErrorLevel.String()})
+			alert := Alert{Text: err.Error(), Level: ErrorLevel.String()}
+			var coded CodedError
+			if errors.As(err, &coded) {
+				alert.Code = coded.Code
+			}
+			alerts = append(alerts, alert)
 		}
 	}
 	return Alerts{alerts}
@@ -55,7 +119,7 @@ func CreateErrorAlerts(errs ...error) Alerts {
 func CreateAlerts(level AlertLevel, messages ...string) Alerts {
 	alerts := []Alert{}
 	for _, message := range messages {
-		alerts = append(alerts, Alert{message, level.String()})
+		alerts = append(alerts, Alert{Text: message, Level: level.String()})
 	}
 	return Alerts{alerts}
 }
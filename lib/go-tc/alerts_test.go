@@ -29,7 +29,7 @@ import (
 func ExampleCreateErrorAlerts() {
 	alerts := CreateErrorAlerts(errors.New("foo"))
 	fmt.Printf("%v\n", alerts)
-	// Output: {[{foo error}]}
+	// Output: {[{foo error }]}
 }
 
 func ExampleCreateAlerts() {
@@ -120,6 +120,23 @@ func ExampleAlerts_ErrorString() {
 	//
 }
 
+func TestCreateErrorAlertsCoded(t *testing.T) {
+	notFound := NewCodedError(AlertCodeNotFound, errors.New("no such thing"))
+	wrapped := fmt.Errorf("outer: %w", NewCodedError(AlertCodeConflict, errors.New("inner")))
+	alerts := CreateErrorAlerts(notFound, errors.New("plain"), nil, wrapped)
+	expected := Alerts{[]Alert{
+		{Text: "no such thing", Level: ErrorLevel.String(), Code: AlertCodeNotFound},
+		{Text: "plain", Level: ErrorLevel.String()},
+		{Text: "outer: inner", Level: ErrorLevel.String(), Code: AlertCodeConflict},
+	}}
+	if !reflect.DeepEqual(expected, alerts) {
+		t.Errorf("Expected %v Got %v", expected, alerts)
+	}
+	if NewCodedError(AlertCodeNotFound, nil) != nil {
+		t.Error("Expected wrapping a nil error to produce a nil error")
+	}
+}
+
 func TestCreateAlerts(t *testing.T) {
 	expected := Alerts{[]Alert{}}
 	alerts := CreateAlerts(WarnLevel)
@@ -127,7 +144,7 @@ func TestCreateAlerts(t *testing.T) {
 		t.Errorf("Expected %v Got %v", expected, alerts)
 	}
 
-	expected = Alerts{[]Alert{{"message 1", WarnLevel.String()}, {"message 2", WarnLevel.String()}, {"message 3", WarnLevel.String()}}}
+	expected = Alerts{[]Alert{{Text: "message 1", Level: WarnLevel.String()}, {Text: "message 2", Level: WarnLevel.String()}, {Text: "message 3", Level: WarnLevel.String()}}}
 	alerts = CreateAlerts(WarnLevel, "message 1", "message 2", "message 3")
 	if !reflect.DeepEqual(expected, alerts) {
 		t.Errorf("Expected %v Got %v", expected, alerts)
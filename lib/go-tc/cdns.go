@@ -155,4 +155,46 @@ type CDNQueueUpdateRequest ServerQueueUpdateRequest
 type CDNQueueUpdateResponse struct {
 	Action string `json:"action"`
 	CDNID  int64  `json:"cdnId"`
+	// Servers are the servers on which updates were queued or dequeued. This
+	// is only given in API version 5.0 and later.
+	Servers []CDNQueueUpdateServer `json:"servers,omitempty"`
+}
+
+// ServerIDs returns the IDs of the servers on which updates were queued or
+// dequeued, in the order in which they appear in the response.
+func (r CDNQueueUpdateResponse) ServerIDs() []int {
+	ids := make([]int, 0, len(r.Servers))
+	for _, server := range r.Servers {
+		ids = append(ids, server.ID)
+	}
+	return ids
+}
+
+// HostNames returns the host names of the servers on which updates were
+// queued or dequeued, in the order in which they appear in the response.
+func (r CDNQueueUpdateResponse) HostNames() []string {
+	names := make([]string, 0, len(r.Servers))
+	for _, server := range r.Servers {
+		names = append(names, server.HostName)
+	}
+	return names
+}
+
+// Queued returns whether updates were queued, rather than dequeued.
+func (r CDNQueueUpdateResponse) Queued() bool {
+	return r.Action == "queue"
+}
+
+// CDNQueueUpdateServer identifies a server on which updates were queued or
+// dequeued by a POST request to the cdns/{{ID}}/queue_update endpoint.
+type CDNQueueUpdateServer struct {
+	ID       int    `json:"id"`
+	HostName string `json:"hostName"`
+}
+
+// CDNQueueUpdateAPIResponse decodes the full response with alerts from the
+// POST cdns/{{ID}}/queue_update endpoint.
+type CDNQueueUpdateAPIResponse struct {
+	Response CDNQueueUpdateResponse `json:"response"`
+	Alerts
 }
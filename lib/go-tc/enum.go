@@ -237,6 +237,16 @@ const UseRevalPendingParameterName = ParameterName("use_reval_pending")
 // a boolean Value, this it not gauranteed either.
 const RefetchEnabled = ParameterName("refetch_enabled")
 
+// DefaultJobTTLParameterName is the name of a Parameter which, assigned - with
+// the ConfigFile "regex_revalidate.config" - to the Profile of a Delivery
+// Service, gives the TTL, in hours, of new Content Invalidation Jobs on that
+// Delivery Service that are created without one.
+//
+// Note that there is no guarantee that a Parameter with this name exists in
+// Traffic Ops at any given time, nor that its Value will be a valid number of
+// hours.
+const DefaultJobTTLParameterName = ParameterName("default_job_ttl_hours")
+
 // ConfigFileName is a Parameter ConfigFile value.
 //
 // This has no additional attached semantics, and so while it is known to most
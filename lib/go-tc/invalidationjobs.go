@@ -21,13 +21,17 @@ package tc
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
 
@@ -45,6 +49,232 @@ const twoDays = time.Hour * 48
 // Content Invalidation Job regular expression.
 var ValidJobRegexPrefix = regexp.MustCompile(`^\?/.*$`)
 
+// BuildAssetURL constructs the asset URL of a Content Invalidation Job from the
+// protocol, FQDN, and (optional) port of its Delivery Service's primary Origin
+// and the job's regular expression, exactly as Traffic Ops does in SQL when the
+// job is created, i.e.:
+//
+//	o.protocol::text || '://' || o.fqdn || rtrim(concat(':', o.port::text), ':') || regex
+//
+// A nil port is omitted entirely, along with its separating colon. Ports aren't
+// checked; see ValidateInvalidationJobOriginPort.
+func BuildAssetURL(protocol, fqdn string, port *int, regex string) string {
+	var portStr string
+	if port != nil {
+		portStr = ":" + strconv.Itoa(*port)
+	}
+	return protocol + "://" + fqdn + portStr + regex
+}
+
+// ValidateInvalidationJobOriginProtocol checks that an Origin with the given
+// protocol can be the target of Content Invalidation Jobs, i.e. that the ATS
+// regex_revalidate plugin can match asset URLs built from it. Only http and
+// https are supported.
+func ValidateInvalidationJobOriginProtocol(protocol string) error {
+	switch Protocol(protocol) {
+	case ProtocolHTTP, ProtocolHTTPS:
+		return nil
+	}
+	return fmt.Errorf("origin protocol '%s' is not supported by Content Invalidation Jobs; only %s and %s are", protocol, ProtocolHTTP, ProtocolHTTPS)
+}
+
+// MaxOriginPort is the greatest valid port of an Origin.
+const MaxOriginPort = 65535
+
+// ValidateInvalidationJobOriginPort checks that the port of an Origin - which
+// may be nil, as it's optional - can be written into the asset URLs of
+// Content Invalidation Jobs, i.e. that it's from 1 to MaxOriginPort. Origins
+// with other ports can only be the result of bad data, and would produce
+// asset URLs that cache servers can't match.
+func ValidateInvalidationJobOriginPort(port *int) error {
+	if port != nil && (*port < 1 || *port > MaxOriginPort) {
+		return fmt.Errorf("origin port %d is invalid; it must be from 1 to %d, or not set", *port, MaxOriginPort)
+	}
+	return nil
+}
+
+// MaxInvalidationJobCommentLength is the maximum length, in characters, of a
+// Content Invalidation Job's comment.
+const MaxInvalidationJobCommentLength = 256
+
+// MaxInvalidationJobExpiryWebhookLength is the longest allowed expiry
+// webhook URL of a Content Invalidation Job.
+const MaxInvalidationJobExpiryWebhookLength = 2048
+
+// SanitizeInvalidationJobComment returns the given Content Invalidation Job
+// comment with leading and trailing whitespace removed, and every other
+// non-printable character (e.g. newlines and terminal escape sequences)
+// replaced by a space, so that it's safe to include in e.g. change log
+// entries.
+func SanitizeInvalidationJobComment(comment string) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsPrint(r) {
+			return r
+		}
+		return ' '
+	}, comment))
+}
+
+// ValidateInvalidationJobComment checks that the given Content Invalidation
+// Job comment - which may be nil, as it's optional - isn't too long.
+func ValidateInvalidationJobComment(comment *string) error {
+	if comment != nil && utf8.RuneCountInString(*comment) > MaxInvalidationJobCommentLength {
+		return fmt.Errorf("comment: cannot be longer than %d characters", MaxInvalidationJobCommentLength)
+	}
+	return nil
+}
+
+// The bounds of a Content Invalidation Job's priority. Jobs with higher
+// priorities are listed first in the regex_revalidate.config files generated
+// for cache servers.
+const (
+	MinInvalidationJobPriority = 0
+	MaxInvalidationJobPriority = 10
+)
+
+// ValidateInvalidationJobPriority checks that the given Content Invalidation
+// Job priority, if any, is within the allowed bounds.
+func ValidateInvalidationJobPriority(priority *int) error {
+	if priority != nil && (*priority < MinInvalidationJobPriority || *priority > MaxInvalidationJobPriority) {
+		return fmt.Errorf("priority: must be between %d and %d (inclusive)", MinInvalidationJobPriority, MaxInvalidationJobPriority)
+	}
+	return nil
+}
+
+// These are the approval states of a Content Invalidation Job.
+const (
+	// InvalidationJobApproved is the state of jobs that are in effect
+	// (subject to their start times and TTLs).
+	InvalidationJobApproved = "APPROVED"
+	// InvalidationJobPendingApproval is the state of jobs that have been
+	// created but won't take effect until approved by another user.
+	InvalidationJobPendingApproval = "PENDING_APPROVAL"
+)
+
+// MaxInvalidationJobStartIn is the furthest in the future that a Content
+// Invalidation Job may be scheduled to start using a relative start time
+// (startIn).
+const MaxInvalidationJobStartIn = 30 * 24 * time.Hour
+
+// ParseInvalidationJobStartIn parses the relative start time (startIn) of a
+// Content Invalidation Job - a duration string like "10m" or "1h30m", as
+// accepted by time.ParseDuration - checking that it is neither negative nor
+// greater than MaxInvalidationJobStartIn.
+func ParseInvalidationJobStartIn(startIn string) (time.Duration, error) {
+	d, err := time.ParseDuration(startIn)
+	if err != nil {
+		return 0, fmt.Errorf("startIn: must be a duration, e.g. '10m' or '1h30m'")
+	}
+	if d < 0 {
+		return 0, errors.New("startIn: must not be negative")
+	}
+	if d > MaxInvalidationJobStartIn {
+		return 0, fmt.Errorf("startIn: cannot exceed %s", MaxInvalidationJobStartIn)
+	}
+	return d, nil
+}
+
+// The limits on a Content Invalidation Job's labels.
+const (
+	// MaxInvalidationJobLabels is the most labels that a job may have.
+	MaxInvalidationJobLabels = 16
+	// MaxInvalidationJobLabelLength is the maximum length of both label keys
+	// and label values.
+	MaxInvalidationJobLabelLength = 63
+)
+
+// invalidationJobLabelPattern is what label keys - and non-empty label values -
+// must look like: alphanumeric characters, possibly separated by dots,
+// underscores, and hyphens.
+var invalidationJobLabelPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?$`)
+
+// ValidateInvalidationJobLabels checks that the given Content Invalidation Job
+// labels aren't too many, and that their keys and values are well-formed.
+// Keys must be non-empty; values may be empty.
+func ValidateInvalidationJobLabels(labels map[string]string) error {
+	if len(labels) > MaxInvalidationJobLabels {
+		return fmt.Errorf("labels: cannot have more than %d labels", MaxInvalidationJobLabels)
+	}
+
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	errs := []string{}
+	for _, key := range keys {
+		if len(key) > MaxInvalidationJobLabelLength || !invalidationJobLabelPattern.MatchString(key) {
+			errs = append(errs, fmt.Sprintf("'%s' is not a valid key", key))
+		}
+		if value := labels[key]; value != "" && (len(value) > MaxInvalidationJobLabelLength || !invalidationJobLabelPattern.MatchString(value)) {
+			errs = append(errs, fmt.Sprintf("'%s' is not a valid value for '%s'", value, key))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("labels: %s; keys and values must be at most %d alphanumeric characters, dots, underscores, or hyphens, beginning and ending with an alphanumeric character", strings.Join(errs, ", "), MaxInvalidationJobLabelLength)
+	}
+	return nil
+}
+
+// ParseInvalidationJobLabelFilter parses the value of a 'label' query string
+// parameter, which is one or more comma-separated 'key:value' pairs, into the
+// labels that matching Content Invalidation Jobs must all have.
+func ParseInvalidationJobLabelFilter(filter string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, pair := range strings.Split(filter, ",") {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("label: '%s' must be of the form 'key:value'", pair)
+		}
+		labels[parts[0]] = parts[1]
+	}
+	if err := ValidateInvalidationJobLabels(labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// InvalidationJobRecurrence describes how a recurring Content Invalidation
+// Job repeats. When an occurrence of a recurring job starts, Traffic Ops
+// creates the next occurrence - identical but for its start time, which is
+// IntervalHours later - unless that would start after EndTime.
+type InvalidationJobRecurrence struct {
+	// IntervalHours is the number of hours between the start of one
+	// occurrence of the job and the start of the next. Must be positive.
+	IntervalHours uint `json:"intervalHours"`
+	// EndTime is the time after which no more occurrences of the job will
+	// start. Must be after the job's start time.
+	EndTime time.Time `json:"endTime"`
+}
+
+// Validate checks that the recurrence is valid for a job starting at the
+// given time.
+func (r InvalidationJobRecurrence) Validate(startTime time.Time) error {
+	errs := []string{}
+	if r.IntervalHours == 0 {
+		errs = append(errs, "recurrence.intervalHours: must be positive")
+	}
+	if !r.EndTime.After(startTime) {
+		errs = append(errs, "recurrence.endTime: must be after startTime")
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// NextRun returns the start time of the occurrence of a job with this
+// recurrence after the one starting at the given time, or nil if there isn't
+// one.
+func (r InvalidationJobRecurrence) NextRun(startTime time.Time) *time.Time {
+	next := startTime.Add(time.Duration(r.IntervalHours) * time.Hour)
+	if next.After(r.EndTime) {
+		return nil
+	}
+	return &next
+}
+
 // InvalidationJob represents a content invalidation job as returned by the API.
 type InvalidationJob struct {
 	AssetURL        *string `json:"assetUrl"`
@@ -88,8 +318,72 @@ type InvalidationJobInput struct {
 	// number
 	TTL *interface{} `json:"ttl"`
 
+	// Recurrence optionally makes the job recur. If this is nil, the job
+	// happens once.
+	Recurrence *InvalidationJobRecurrence `json:"recurrence,omitempty"`
+
+	// Comment is an optional free-text note - e.g. a ticket reference -
+	// explaining why the job was created. It may be at most
+	// MaxInvalidationJobCommentLength characters long.
+	Comment *string `json:"comment,omitempty"`
+
+	// Priority optionally orders the job relative to others; higher
+	// priority jobs are listed first in regex_revalidate.config. It must be
+	// between MinInvalidationJobPriority and MaxInvalidationJobPriority, and
+	// defaults to MinInvalidationJobPriority.
+	Priority *int `json:"priority,omitempty"`
+
+	// Labels are optional arbitrary key/value pairs - e.g. a release train -
+	// by which related jobs may be grouped and filtered. See
+	// ValidateInvalidationJobLabels for the allowed keys and values.
+	Labels map[string]string `json:"labels,omitempty"`
+
 	dsid *uint
 	ttl  *time.Duration
+
+	// startTimeZoneless records that StartTime was given without a UTC
+	// offset, which Validate rejects.
+	startTimeZoneless bool
+}
+
+// UnmarshalJSON implements the encoding/json.Unmarshaler interface. It
+// behaves exactly like the default decoding, except that it also notes
+// whether the given startTime lacked an explicit UTC offset, as such times
+// would otherwise be silently treated as UTC regardless of the client's
+// intended time zone.
+func (j *InvalidationJobInput) UnmarshalJSON(b []byte) error {
+	type alias InvalidationJobInput
+	aux := struct {
+		*alias
+		StartTime json.RawMessage `json:"startTime"`
+	}{alias: (*alias)(j)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+
+	j.StartTime = nil
+	j.startTimeZoneless = false
+	if len(aux.StartTime) == 0 || string(aux.StartTime) == "null" {
+		return nil
+	}
+	var startTime Time
+	if err := json.Unmarshal(aux.StartTime, &startTime); err != nil {
+		return err
+	}
+	j.StartTime = &startTime
+
+	var raw string
+	if err := json.Unmarshal(aux.StartTime, &raw); err == nil {
+		j.startTimeZoneless = isZonelessTime(raw)
+	}
+	return nil
+}
+
+// isZonelessTime checks whether the given string is a date/time which Time
+// will accept but which doesn't specify its UTC offset.
+func isZonelessTime(s string) bool {
+	_, err := time.Parse(legacyLayout, s)
+	return err == nil
 }
 
 // UserInvalidationJobInput Represents legacy-style user input to the /user/current/jobs API endpoint.
@@ -187,14 +481,25 @@ func (j *InvalidationJobInput) DSID(tx *sql.Tx) (uint, error) {
 	}
 }
 
-// Validate validates that the user input is correct, given a transaction
-// connected to the Traffic Ops database. In particular, it enforces the
-// constraints described on each field, as well as ensuring they actually exist.
-// This method calls InvalidationJobInput.DSID to validate the DeliveryService
-// field.
+// ValidateSyntax validates the parts of the user input that can be checked
+// without a database: that the required fields are present, that the regex
+// compiles, that the start time is in the future with an explicit UTC offset,
+// that the TTL is a valid number of hours or duration, and the constraints on
+// each of the optional fields. It doesn't check that the DeliveryService
+// exists, nor that the TTL is within the maxRevalDurationDays Parameter, for
+// which see Validate.
 //
 // This returns an error describing any and all problematic fields encountered during validation.
-func (job *InvalidationJobInput) Validate(tx *sql.Tx) error {
+func (job *InvalidationJobInput) ValidateSyntax() error {
+	if errs := job.syntaxErrors(); len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// syntaxErrors returns a description of each of the problems that
+// ValidateSyntax finds.
+func (job *InvalidationJobInput) syntaxErrors() []string {
 	errs := []string{}
 	err := validation.ValidateStruct(job,
 		validation.Field(&job.DeliveryService, validation.Required),
@@ -208,12 +513,6 @@ func (job *InvalidationJobInput) Validate(tx *sql.Tx) error {
 		errs = append(errs, err.Error())
 	}
 
-	if job.DeliveryService != nil {
-		if _, err = job.DSID(tx); err != nil {
-			errs = append(errs, err.Error())
-		}
-	}
-
 	if job.Regex != nil && *job.Regex != "" {
 		if _, err := regexp.Compile(*job.Regex); err != nil {
 			errs = append(errs, "regex: is not a valid Regular Expression: "+err.Error())
@@ -222,17 +521,60 @@ func (job *InvalidationJobInput) Validate(tx *sql.Tx) error {
 
 	if job.StartTime == nil {
 		errs = append(errs, "startTime: cannot be blank")
+	} else if job.startTimeZoneless {
+		errs = append(errs, "startTime: must include an explicit UTC offset, e.g. 'Z' or '+05:30'")
 	} else if job.StartTime.Time.Before(time.Now()) {
 		errs = append(errs, "startTime: must be in the future")
 	}
 
+	if job.Recurrence != nil && job.StartTime != nil {
+		if err := job.Recurrence.Validate(job.StartTime.Time); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if err := ValidateInvalidationJobComment(job.Comment); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if err := ValidateInvalidationJobPriority(job.Priority); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if err := ValidateInvalidationJobLabels(job.Labels); err != nil {
+		errs = append(errs, err.Error())
+	}
+
 	if job.TTL != nil {
-		hours, err := job.TTLHours()
-		if err != nil {
+		if _, err := job.TTLHours(); err != nil {
 			errs = append(errs, "ttl: must be a number of hours, or a duration string e.g. '48h'")
 		}
+	}
+
+	return errs
+}
+
+// Validate validates that the user input is correct, given a transaction
+// connected to the Traffic Ops database. In particular, it enforces the
+// constraints described on each field, as well as ensuring they actually exist.
+// It checks everything that ValidateSyntax does first, then calls
+// InvalidationJobInput.DSID to validate the DeliveryService field.
+//
+// This returns an error describing any and all problematic fields encountered during validation.
+func (job *InvalidationJobInput) Validate(tx *sql.Tx) error {
+	errs := job.syntaxErrors()
+
+	if job.DeliveryService != nil {
+		if _, err := job.DSID(tx); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if job.TTL != nil {
+		// Any error from TTLHours was already reported by syntaxErrors.
+		hours, _ := job.TTLHours()
 		var maxDays uint
-		err = tx.QueryRow(`SELECT value FROM parameter WHERE name='maxRevalDurationDays' AND config_file='regex_revalidate.config'`).Scan(&maxDays)
+		err := tx.QueryRow(`SELECT value FROM parameter WHERE name='maxRevalDurationDays' AND config_file='regex_revalidate.config'`).Scan(&maxDays)
 		maxHours := maxDays * 24
 		if err == nil && hours > maxHours { // silently ignore other errors too
 			errs = append(errs, "ttl: cannot exceed "+strconv.FormatUint(uint64(maxHours), 10)+"!")
@@ -346,22 +688,161 @@ func (j *InvalidationJobInput) TTLHours() (uint, error) {
 	return ret, nil
 }
 
+// The prefix and suffix that surround the number of hours in the legacy
+// 'parameters' representation of a Content Invalidation Job's TTL.
+const (
+	ttlParameterPrefix = "TTL:"
+	ttlParameterSuffix = "h"
+)
+
+// ParseTTLParameter parses the number of hours out of a legacy Content
+// Invalidation Job 'parameters' string of the form 'TTL:##h'.
+func ParseTTLParameter(param string) (uint, error) {
+	if !strings.HasPrefix(param, ttlParameterPrefix) || !strings.HasSuffix(param, ttlParameterSuffix) {
+		return 0, fmt.Errorf("malformed TTL parameter '%s', must be of the form '%s##%s'", param, ttlParameterPrefix, ttlParameterSuffix)
+	}
+	hours, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(param, ttlParameterPrefix), ttlParameterSuffix), 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("malformed TTL parameter '%s': %w", param, err)
+	}
+	return uint(hours), nil
+}
+
+// FormatTTLParameter formats a number of hours as a legacy Content
+// Invalidation Job 'parameters' string of the form 'TTL:##h'.
+func FormatTTLParameter(hours uint) string {
+	return ttlParameterPrefix + strconv.FormatUint(uint64(hours), 10) + ttlParameterSuffix
+}
+
+// legacyJobKeyword is the only Keyword that legacy Content Invalidation Jobs
+// were ever given.
+const legacyJobKeyword = "PURGE"
+
+// ToInvalidationJobInput converts a legacy Content Invalidation Job - in the
+// shape returned by the deprecated /user/current/jobs API endpoint - into an
+// InvalidationJobInput that creates an equivalent job starting at startTime.
+// Legacy jobs record the full asset URL, so the new job's regular expression is
+// whatever follows the Origin's scheme and host.
+//
+// The returned strings describe fields that were given but have no equivalent
+// in an InvalidationJobInput, and so were ignored; the job's ID and entered
+// time are never reported, since a new job always gets new ones. The returned
+// error describes any and all fields that prevented conversion.
+func (job UserInvalidationJob) ToInvalidationJobInput(startTime Time) (InvalidationJobInput, []string, error) {
+	input := InvalidationJobInput{StartTime: &startTime}
+	errs := []string{}
+
+	if job.DeliveryService == nil || *job.DeliveryService == "" {
+		errs = append(errs, "deliveryService: cannot be blank")
+	} else {
+		var ds interface{} = *job.DeliveryService
+		input.DeliveryService = &ds
+	}
+
+	if job.Keyword != nil && *job.Keyword != legacyJobKeyword {
+		errs = append(errs, fmt.Sprintf("keyword: '%s' cannot be converted, only '%s' is supported", *job.Keyword, legacyJobKeyword))
+	}
+
+	if job.Parameters == nil {
+		errs = append(errs, "parameters: cannot be blank")
+	} else if hours, err := ParseTTLParameter(*job.Parameters); err != nil {
+		errs = append(errs, "parameters: "+err.Error())
+	} else {
+		var ttl interface{} = float64(hours)
+		input.TTL = &ttl
+	}
+
+	if job.AssetURL == nil {
+		errs = append(errs, "assetUrl: cannot be blank")
+	} else if regex, err := assetURLRegex(*job.AssetURL); err != nil {
+		errs = append(errs, "assetUrl: "+err.Error())
+	} else {
+		input.Regex = &regex
+	}
+
+	if len(errs) > 0 {
+		return input, nil, errors.New(strings.Join(errs, ", "))
+	}
+
+	ignored := []string{}
+	if job.Agent != nil {
+		ignored = append(ignored, "agent: has no equivalent and was ignored")
+	}
+	if job.AssetType != nil {
+		ignored = append(ignored, "assetType: has no equivalent and was ignored")
+	}
+	if job.ObjectName != nil {
+		ignored = append(ignored, "objectName: has no equivalent and was ignored")
+	}
+	if job.ObjectType != nil {
+		ignored = append(ignored, "objectType: has no equivalent and was ignored")
+	}
+	if job.Username != nil {
+		ignored = append(ignored, "username: was ignored, the new job will belong to the user who creates it")
+	}
+	return input, ignored, nil
+}
+
+// assetURLRegex extracts the regular expression from a Content Invalidation
+// Job's asset URL, i.e. everything from the first (possibly escaped) slash
+// after the Origin's scheme and host.
+func assetURLRegex(assetURL string) (string, error) {
+	schemeEnd := strings.Index(assetURL, "://")
+	if schemeEnd < 1 {
+		return "", fmt.Errorf("'%s' is not a full URL", assetURL)
+	}
+	rest := assetURL[schemeEnd+len("://"):]
+	slash := strings.Index(rest, "/")
+	if slash < 1 {
+		return "", fmt.Errorf("'%s' has no host or no path", assetURL)
+	}
+	if rest[slash-1] == '\\' {
+		slash--
+	}
+	if slash < 1 {
+		return "", fmt.Errorf("'%s' has no host", assetURL)
+	}
+	return rest[slash:], nil
+}
+
+// ToInvalidationJobInput converts legacy-style user input to the deprecated
+// /user/current/jobs API endpoint into the equivalent InvalidationJobInput.
+// The returned strings describe fields that were given but have no equivalent
+// in an InvalidationJobInput, and so were ignored.
+//
+// No validation is done; the result should be validated as usual.
+func (job UserInvalidationJobInput) ToInvalidationJobInput() (InvalidationJobInput, []string) {
+	input := InvalidationJobInput{
+		Regex:     job.Regex,
+		StartTime: job.StartTime,
+	}
+	if job.DSID != nil {
+		var ds interface{} = float64(*job.DSID)
+		input.DeliveryService = &ds
+	}
+	if job.TTL != nil {
+		var ttl interface{} = float64(*job.TTL)
+		input.TTL = &ttl
+	}
+
+	ignored := []string{}
+	if job.Urgent != nil {
+		ignored = append(ignored, "urgent: has no equivalent and was ignored")
+	}
+	return input, ignored
+}
+
 // TTLHours will parse job.Parameters to find TTL, returns an int representing
 // number of hours. Returns 0 in case of issue (0 is an invalid TTL).
 func (job *InvalidationJob) TTLHours() uint {
 	if job.Parameters == nil {
 		return 0
 	}
-	ttl := strings.Split(*job.Parameters, ":")
-	if len(ttl) != 2 {
-		return 0
-	}
-
-	hours, err := strconv.Atoi(ttl[1][:len(ttl[1])-1])
+	hours, err := ParseTTLParameter(*job.Parameters)
 	if err != nil {
 		return 0
 	}
-	return uint(hours)
+	return hours
 }
 
 // Validate checks that the InvalidationJob is valid, by ensuring all of its fields are well-defined.
@@ -477,6 +958,20 @@ type InvalidationJobsResponseV4 struct {
 	Alerts
 }
 
+// InvalidationJobsResponseV5 is the type of a response from Traffic Ops to a
+// request made to its /jobs API endpoint for v 5.0+
+type InvalidationJobsResponseV5 struct {
+	Response []InvalidationJobV5 `json:"response"`
+	Alerts
+}
+
+// InvalidationJobResponseV5 is the type of a response from Traffic Ops to a
+// request that acts on a single Content Invalidation Job, e.g. to cancel it.
+type InvalidationJobResponseV5 struct {
+	Response InvalidationJobV5 `json:"response"`
+	Alerts
+}
+
 // InvalidationJobCreateV4 is an alias for the InvalidationJobCreateV40 struct used for the latest minor version associated with api major version 4.
 type InvalidationJobCreateV4 InvalidationJobCreateV40
 
@@ -489,15 +984,95 @@ type InvalidationJobCreateV40 struct {
 	// (or escaped: '\/')
 	Regex string `json:"regex"`
 
+	// Variables are optionally the values of variables referenced - as
+	// "{name}" - in Regex, which Traffic Ops substitutes, matching each value
+	// literally, before the job is created. Only variables allowed by Traffic
+	// Ops's configuration may be used. Only supported in API version 5.0 and
+	// later.
+	Variables map[string]string `json:"variables,omitempty"`
+
 	// StartTime is the time at which the job will come into effect. Must be in the future.
 	StartTime time.Time `json:"startTime"`
 
+	// StartIn is optionally a duration - see ParseInvalidationJobStartIn -
+	// after the time at which Traffic Ops receives the request at which the
+	// job comes into effect, instead of StartTime; the two are mutually
+	// exclusive. Only supported in API version 5.0 and later.
+	StartIn *string `json:"startIn,omitempty"`
+
+	// Immediate, if true, makes the job come into effect as soon as it's
+	// created, at a start time set by Traffic Ops, instead of StartTime or
+	// StartIn, with which it's mutually exclusive. Only supported in API
+	// version 5.0 and later.
+	Immediate bool `json:"immediate,omitempty"`
+
 	// TTLHours indicates the Time-to-Live of the job in hours. Must be a positive integer value.
 	TTLHours uint32 `json:"ttlHours"`
 
 	// InvalidationType must be either REFRESH (default behavior) or REFETCH. If REFETCH, must
 	// also comply with global parameter setting
 	InvalidationType string `json:"invalidationType"`
+
+	// Recurrence optionally makes the job recur. If this is nil, the job
+	// happens once.
+	Recurrence *InvalidationJobRecurrence `json:"recurrence,omitempty"`
+
+	// Comment is an optional free-text note - e.g. a ticket reference -
+	// explaining why the job was created. It may be at most
+	// MaxInvalidationJobCommentLength characters long.
+	Comment *string `json:"comment,omitempty"`
+
+	// Priority optionally orders the job relative to others; higher
+	// priority jobs are listed first in regex_revalidate.config. It must be
+	// between MinInvalidationJobPriority and MaxInvalidationJobPriority, and
+	// defaults to MinInvalidationJobPriority.
+	Priority *int `json:"priority,omitempty"`
+
+	// Labels are optional arbitrary key/value pairs - e.g. a release train -
+	// by which related jobs may be grouped and filtered. See
+	// ValidateInvalidationJobLabels for the allowed keys and values.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// AllOrigins, if true, creates one job for each of the Delivery Service's
+	// Origins - primary or not - instead of only for its primary Origin.
+	// Only supported in API version 5.0 and later.
+	AllOrigins bool `json:"allOrigins,omitempty"`
+
+	// OnBehalfOf is optionally the username of the user to whom the job is
+	// attributed, instead of the user creating it. Only users with the
+	// JOB:CREATE-ON-BEHALF Permission may use it. Only supported in API
+	// version 5.0 and later.
+	OnBehalfOf *string `json:"onBehalfOf,omitempty"`
+
+	// PendingApproval, if true, creates the job in the
+	// InvalidationJobPendingApproval state, so that it has no effect until
+	// another user approves it. Jobs on CDNs that require approval are always
+	// created that way. Only supported in API version 5.0 and later.
+	PendingApproval bool `json:"pendingApproval,omitempty"`
+
+	// CacheGroup, if given, limits the servers flagged for revalidation -
+	// when the job is created, updated, or deleted - to those in the named
+	// Cache Group, which must have servers on the Delivery Service's CDN.
+	// Only supported in API version 5.0 and later.
+	CacheGroup *string `json:"cacheGroup,omitempty"`
+
+	// ServerType, if given, limits the servers flagged for revalidation to
+	// those of the named Type, e.g. "EDGE". Only supported in API version 5.0
+	// and later.
+	ServerType *string `json:"serverType,omitempty"`
+
+	// ExpiryWebhook is optionally an http or https URL to which Traffic Ops
+	// POSTs the job once its window has elapsed. Its host must be one that
+	// Traffic Ops's configuration allows. It may be at most
+	// MaxInvalidationJobExpiryWebhookLength characters long. Only supported
+	// in API version 5.0 and later.
+	ExpiryWebhook *string `json:"expiryWebhook,omitempty"`
+
+	// Origin is optionally the base URL - e.g. "https://origin.example.com" -
+	// of the Origin to which Regex is appended, for Delivery Services that
+	// have no primary Origin. Only users with the JOB:CREATE-EXPLICIT-ORIGIN
+	// Permission may use it. Only supported in API version 5.0 and later.
+	Origin *string `json:"origin,omitempty"`
 }
 
 // InvalidationJobV4 is an alias for the InvalidationJobV4 struct used for the latest minor version associated with api major version 4.
@@ -515,6 +1090,18 @@ type InvalidationJobV40 struct {
 	StartTime        time.Time `json:"startTime"`
 }
 
+// MarshalJSON implements the encoding/json.Marshaler interface by encoding the
+// job with its StartTime in UTC. Times read from the database are in the time
+// zone of the database session, so otherwise the same instant could be given
+// with different offsets by different Traffic Ops instances - or none at all
+// of the offset with which the job was created.
+func (job InvalidationJobV4) MarshalJSON() ([]byte, error) {
+	type alias InvalidationJobV4
+	utc := alias(job)
+	utc.StartTime = utc.StartTime.UTC()
+	return json.Marshal(utc)
+}
+
 // String implements the fmt.Stringer interface by providing a textual
 // representation of the InvalidationJobV4.
 func (job InvalidationJobV4) String() string {
@@ -528,3 +1115,412 @@ func (job InvalidationJobV4) String() string {
 		job.StartTime.Format(time.RFC3339),
 	)
 }
+
+// Upgrade converts the InvalidationJobV4 to an InvalidationJobV5. Properties
+// that don't exist in API version 4 are left at their zero values, except
+// that the job is taken to be approved, since jobs pending approval can't be
+// represented in API version 4.
+func (job InvalidationJobV4) Upgrade() InvalidationJobV5 {
+	return InvalidationJobV5{
+		ID:               job.ID,
+		AssetURL:         job.AssetURL,
+		CreatedBy:        job.CreatedBy,
+		DeliveryService:  job.DeliveryService,
+		TTLHours:         job.TTLHours,
+		InvalidationType: job.InvalidationType,
+		StartTime:        job.StartTime,
+		ApprovalState:    InvalidationJobApproved,
+	}
+}
+
+// InvalidationJobV5 is an alias for the InvalidationJob struct used for the latest minor version associated with api major version 5.
+type InvalidationJobV5 = InvalidationJobV50
+
+// InvalidationJobV50 represents a content invalidation job as returned by the
+// API in version 5.0.
+type InvalidationJobV50 struct {
+	ID               uint64    `json:"id"`
+	AssetURL         string    `json:"assetUrl"`
+	CreatedBy        string    `json:"createdBy"`
+	DeliveryService  string    `json:"deliveryService"`
+	TTLHours         uint      `json:"ttlHours"`
+	InvalidationType string    `json:"invalidationType"`
+	StartTime        time.Time `json:"startTime"`
+
+	// Recurrence is how the job repeats, if it's recurring.
+	Recurrence *InvalidationJobRecurrence `json:"recurrence,omitempty"`
+	// NextRun is the start time of the job's next occurrence, if it's
+	// recurring and there is one.
+	NextRun *time.Time `json:"nextRun,omitempty"`
+
+	// LastUpdated is the time at which the job was last modified. It's
+	// omitted for jobs for which that isn't known.
+	LastUpdated *time.Time `json:"lastUpdated,omitempty"`
+
+	// Comment is the note given when the job was created, if any.
+	Comment *string `json:"comment,omitempty"`
+
+	// Priority orders the job relative to others; higher priority jobs are
+	// listed first in regex_revalidate.config.
+	Priority int `json:"priority"`
+
+	// Labels are the arbitrary key/value pairs given to the job, if any.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// ApprovalState is either InvalidationJobApproved or
+	// InvalidationJobPendingApproval. Jobs pending approval have no effect
+	// on cache servers.
+	ApprovalState string `json:"approvalState,omitempty"`
+
+	// CacheGroup and ServerType are the Cache Group and Type to which the
+	// servers flagged for revalidation by the job are limited, if any.
+	CacheGroup *string `json:"cacheGroup,omitempty"`
+	ServerType *string `json:"serverType,omitempty"`
+
+	// Active tells whether the current time is within the job's window and
+	// it's approved, i.e. whether it's in effect. It's only given in the
+	// responses to GET requests.
+	Active *bool `json:"active,omitempty"`
+
+	// EndTime is the time at which the job stops being in effect, i.e. its
+	// StartTime plus its TTL. It's only given in the responses to requests
+	// that create jobs.
+	EndTime *time.Time `json:"endTime,omitempty"`
+}
+
+// MarshalJSON implements the encoding/json.Marshaler interface by encoding the
+// job with all of its times in UTC, as InvalidationJobV4's MarshalJSON does.
+func (job InvalidationJobV5) MarshalJSON() ([]byte, error) {
+	type alias InvalidationJobV5
+	utc := alias(job)
+	utc.StartTime = utc.StartTime.UTC()
+	for _, t := range []**time.Time{&utc.NextRun, &utc.LastUpdated, &utc.EndTime} {
+		if *t != nil {
+			u := (*t).UTC()
+			*t = &u
+		}
+	}
+	return json.Marshal(utc)
+}
+
+// Downgrade converts the InvalidationJobV5 to an InvalidationJobV4, dropping
+// the properties that don't exist in API version 4.
+func (job InvalidationJobV5) Downgrade() InvalidationJobV4 {
+	return InvalidationJobV4{
+		ID:               job.ID,
+		AssetURL:         job.AssetURL,
+		CreatedBy:        job.CreatedBy,
+		DeliveryService:  job.DeliveryService,
+		TTLHours:         job.TTLHours,
+		InvalidationType: job.InvalidationType,
+		StartTime:        job.StartTime,
+	}
+}
+
+// ExpiredInvalidationJobsPurged is the response object of a request to purge
+// expired Content Invalidation Jobs.
+type ExpiredInvalidationJobsPurged struct {
+	// Count is the number of Content Invalidation Jobs that were deleted - or,
+	// for a dry run, that would have been.
+	Count uint64 `json:"count"`
+	// DryRun tells whether the request was a dry run, in which nothing was
+	// deleted.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// ExpiredInvalidationJobsPurgedResponse is the type of a response from Traffic
+// Ops to a request to purge expired Content Invalidation Jobs.
+type ExpiredInvalidationJobsPurgedResponse struct {
+	Response ExpiredInvalidationJobsPurged `json:"response"`
+	Alerts
+}
+
+// DeferredRevalFlushed is the response object of a request to set the
+// revalidation flags whose setting was deferred when Content Invalidation Jobs
+// were deleted.
+type DeferredRevalFlushed struct {
+	// DeliveryServices is the XMLIDs of the Delivery Services whose servers
+	// had their revalidation flags set.
+	DeliveryServices []string `json:"deliveryServices"`
+}
+
+// DeferredRevalFlushedResponse is the type of a response from Traffic Ops to a
+// request to flush deferred revalidations.
+type DeferredRevalFlushedResponse struct {
+	Response DeferredRevalFlushed `json:"response"`
+	Alerts
+}
+
+// InvalidationJobRevalReflagged is the response object of a request to set the
+// revalidation flags again for every Content Invalidation Job in effect on a
+// CDN, e.g. so that servers that were offline when the jobs were created pick
+// them up.
+type InvalidationJobRevalReflagged struct {
+	// CDN is the name of the CDN.
+	CDN string `json:"cdn"`
+	// Jobs is the number of jobs in effect on the CDN's Delivery Services
+	// for which revalidation flags were set.
+	Jobs int `json:"jobs"`
+	// Servers is the number of distinct servers that were flagged.
+	Servers int `json:"servers"`
+}
+
+// InvalidationJobRevalReflaggedResponse is the type of a response from Traffic
+// Ops to a request to set the revalidation flags of a CDN's jobs again.
+type InvalidationJobRevalReflaggedResponse struct {
+	Response InvalidationJobRevalReflagged `json:"response"`
+	Alerts
+}
+
+// InvalidationJobRevalProgress is the data of each event in the stream of the
+// revalidation progress of a Content Invalidation Job.
+type InvalidationJobRevalProgress struct {
+	// JobID is the ID of the Content Invalidation Job.
+	JobID uint64 `json:"jobId"`
+	// Total is the number of servers that were flagged for revalidation.
+	Total int `json:"total"`
+	// Applied is the number of those servers that have since revalidated.
+	Applied int `json:"applied"`
+	// Pending is the host names of the servers that have yet to revalidate.
+	Pending []string `json:"pending"`
+}
+
+// InvalidationJobRevalDiagnosis explains whether or not creating a Content
+// Invalidation Job on a Delivery Service would flag a particular server for
+// revalidation.
+type InvalidationJobRevalDiagnosis struct {
+	// DeliveryService is the XMLID of the Delivery Service.
+	DeliveryService string `json:"deliveryService"`
+	// ServerID is the integral, unique identifier of the server.
+	ServerID int `json:"serverId"`
+	// HostName is the host name of the server.
+	HostName string `json:"hostName"`
+	// Flagged is whether or not the server would be flagged, i.e. whether it
+	// passes every one of the Checks.
+	Flagged bool `json:"flagged"`
+	// Flag is the server property that would be set: either "revalPending"
+	// or, if the global use_reval_pending Parameter disables that,
+	// "updPending".
+	Flag string `json:"flag"`
+	// Checks are the conditions that a server must meet to be flagged.
+	Checks []InvalidationJobRevalCheck `json:"checks"`
+}
+
+// InvalidationJobRevalCheck is one of the conditions that a server must meet
+// in order to be flagged for revalidation by a Content Invalidation Job.
+type InvalidationJobRevalCheck struct {
+	// Name identifies the condition, e.g. "status".
+	Name string `json:"name"`
+	// Passed is whether or not the server meets the condition.
+	Passed bool `json:"passed"`
+	// Detail explains the outcome in human-readable terms.
+	Detail string `json:"detail"`
+}
+
+// InvalidationJobRevalDiagnosesResponse is the type of a response from Traffic
+// Ops to a request for revalidation diagnoses.
+type InvalidationJobRevalDiagnosesResponse struct {
+	Response []InvalidationJobRevalDiagnosis `json:"response"`
+	Alerts
+}
+
+// Names of the events in the stream of the revalidation progress of a
+// Content Invalidation Job.
+const (
+	// InvalidationJobRevalProgressEvent is sent each time the number of
+	// servers that have revalidated changes.
+	InvalidationJobRevalProgressEvent = "progress"
+	// InvalidationJobRevalCompleteEvent is sent - ending the stream - once
+	// every flagged server has revalidated.
+	InvalidationJobRevalCompleteEvent = "complete"
+	// InvalidationJobRevalTimeoutEvent is sent - ending the stream - if not
+	// every flagged server has revalidated before the stream times out.
+	InvalidationJobRevalTimeoutEvent = "timeout"
+)
+
+// MaxInvalidationJobManifestPaths is the largest number of paths that may be
+// given in a single Content Invalidation Job manifest.
+const MaxInvalidationJobManifestPaths = 500
+
+// InvalidationJobManifest is the request body of a request to create Content
+// Invalidation Jobs for many assets of one Delivery Service at once, all
+// sharing the same start time, TTL, and type.
+type InvalidationJobManifest struct {
+	// DeliveryService is the XMLID of the Delivery Service.
+	DeliveryService string `json:"deliveryService"`
+	// Manifest is the paths of the assets to invalidate, relative to the
+	// Delivery Service's Origin. It may be given either as a JSON array of
+	// strings or as a single string of newline-delimited paths; use Paths to
+	// read it. Paths are literal, not regular expressions.
+	Manifest json.RawMessage `json:"manifest"`
+	// StartTime is the time at which the jobs will come into effect.
+	StartTime time.Time `json:"startTime"`
+	// TTLHours is the Time-to-Live of each job in hours.
+	TTLHours uint32 `json:"ttlHours"`
+	// InvalidationType is the type of each job, either REFRESH or REFETCH.
+	InvalidationType string `json:"invalidationType"`
+	// Combine, if true, creates a single job whose regular expression matches
+	// every path in the manifest, instead of one job per path.
+	Combine bool `json:"combine,omitempty"`
+	// Comment is an optional note given to each job.
+	Comment *string `json:"comment,omitempty"`
+	// Priority optionally orders the jobs relative to others.
+	Priority *int `json:"priority,omitempty"`
+	// Labels are optional key/value pairs given to each job.
+	Labels map[string]string `json:"labels,omitempty"`
+	// PendingApproval, if true, leaves the jobs pending approval, as
+	// InvalidationJobCreateV4's PendingApproval does.
+	PendingApproval bool `json:"pendingApproval,omitempty"`
+	// OnBehalfOf is optionally the username of the user to whom the jobs are
+	// attributed, as InvalidationJobCreateV4's OnBehalfOf is.
+	OnBehalfOf *string `json:"onBehalfOf,omitempty"`
+	// CacheGroup optionally limits the servers flagged for revalidation to
+	// those in the named Cache Group, as InvalidationJobCreateV4's CacheGroup
+	// does.
+	CacheGroup *string `json:"cacheGroup,omitempty"`
+	// ServerType optionally limits the servers flagged for revalidation to
+	// those of the named Type, as InvalidationJobCreateV4's ServerType does.
+	ServerType *string `json:"serverType,omitempty"`
+	// ExpiryWebhook is optionally a URL to notify when each job expires, as
+	// InvalidationJobCreateV4's ExpiryWebhook is.
+	ExpiryWebhook *string `json:"expiryWebhook,omitempty"`
+}
+
+// Paths returns the paths in the manifest, with surrounding whitespace - and
+// any leading slash - removed and blank lines skipped. It returns an error if
+// the manifest is neither a string nor an array of strings.
+func (m InvalidationJobManifest) Paths() ([]string, error) {
+	var raw []string
+	var manifest string
+	if err := json.Unmarshal(m.Manifest, &raw); err != nil {
+		if err := json.Unmarshal(m.Manifest, &manifest); err != nil {
+			return nil, errors.New("manifest: must be an array of paths or a string of newline-delimited paths")
+		}
+		raw = strings.Split(manifest, "\n")
+	}
+
+	paths := make([]string, 0, len(raw))
+	for _, path := range raw {
+		path = strings.TrimPrefix(strings.TrimSpace(path), "/")
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// InvalidationJobManifestSummary is the response object of a request to
+// create Content Invalidation Jobs from a manifest.
+type InvalidationJobManifestSummary struct {
+	// DeliveryService is the XMLID of the Delivery Service.
+	DeliveryService string `json:"deliveryService"`
+	// Paths is the number of paths in the manifest.
+	Paths int `json:"paths"`
+	// Combined tells whether the paths were combined into a single job.
+	Combined bool `json:"combined"`
+	// Jobs is the Content Invalidation Jobs that were created.
+	Jobs []InvalidationJobV5 `json:"jobs"`
+}
+
+// InvalidationJobManifestSummaryResponse is the type of a response from
+// Traffic Ops to a request to create Content Invalidation Jobs from a
+// manifest.
+type InvalidationJobManifestSummaryResponse struct {
+	Response InvalidationJobManifestSummary `json:"response"`
+	Alerts
+}
+
+// MaxInvalidationJobBulkDeleteIDs is the largest number of Content
+// Invalidation Jobs that may be deleted in a single request.
+const MaxInvalidationJobBulkDeleteIDs = 500
+
+// InvalidationJobBulkDelete is the request body of a request to delete many
+// Content Invalidation Jobs at once.
+type InvalidationJobBulkDelete struct {
+	// IDs identifies the jobs to delete.
+	IDs []uint64 `json:"ids"`
+}
+
+// InvalidationJobBulkDeleteResult is the outcome of deleting one of the
+// Content Invalidation Jobs in a bulk deletion.
+type InvalidationJobBulkDeleteResult struct {
+	// ID is the ID of the job, as given in the request.
+	ID uint64 `json:"id"`
+	// Deleted tells whether the job was deleted.
+	Deleted bool `json:"deleted"`
+	// CDN is the name of the CDN of the job's Delivery Service. It's empty
+	// for jobs that don't exist, or that the user can't see.
+	CDN string `json:"cdn,omitempty"`
+	// Reason explains why a job was skipped, e.g. because it doesn't exist
+	// or the user isn't allowed to delete it. It's empty for deleted jobs.
+	Reason string `json:"reason,omitempty"`
+	// Job is the job that was deleted, if it was.
+	Job *InvalidationJobV5 `json:"job,omitempty"`
+}
+
+// InvalidationJobBulkDeleteResponse is the type of a response from Traffic
+// Ops to a request to delete many Content Invalidation Jobs at once. It has
+// one result for each requested ID, in the order in which they were given.
+type InvalidationJobBulkDeleteResponse struct {
+	Response []InvalidationJobBulkDeleteResult `json:"response"`
+	Alerts
+}
+
+// InvalidationJobActiveDeliveryService is a Delivery Service that has
+// Content Invalidation Jobs in effect.
+type InvalidationJobActiveDeliveryService struct {
+	// DSID is the Delivery Service's ID.
+	DSID int `json:"dsId"`
+	// XMLID is the Delivery Service's XMLID.
+	XMLID string `json:"xmlId"`
+	// ActiveJobCount is the number of the Delivery Service's approved jobs
+	// whose windows include the current time.
+	ActiveJobCount uint64 `json:"activeJobCount"`
+}
+
+// InvalidationJobActiveDeliveryServicesResponse is the type of a response
+// from Traffic Ops to a request for the Delivery Services that have Content
+// Invalidation Jobs in effect.
+type InvalidationJobActiveDeliveryServicesResponse struct {
+	Response []InvalidationJobActiveDeliveryService `json:"response"`
+	Alerts
+}
+
+// InvalidationJobMaxRevalDuration is the longest time for which Content
+// Invalidation Jobs on a CDN are effective, as given by the
+// maxRevalDurationDays Parameter - or the default t3c uses without one.
+// Clients can use it to cap the TTLs of new jobs before they're submitted.
+type InvalidationJobMaxRevalDuration struct {
+	// CDN is the name of the CDN.
+	CDN string `json:"cdn"`
+	// MaxRevalDurationDays is the effective maximum duration, in days.
+	MaxRevalDurationDays int `json:"maxRevalDurationDays"`
+	// MaxTTLHours is MaxRevalDurationDays in hours, i.e. the largest useful
+	// TTL of a new job.
+	MaxTTLHours int `json:"maxTTLHours"`
+	// IsDefault tells whether the default was used, because the Parameter
+	// doesn't exist or isn't an integer.
+	IsDefault bool `json:"isDefault"`
+}
+
+// InvalidationJobMaxRevalDurationResponse is the type of a response from
+// Traffic Ops to a request for the effective maximum duration of the Content
+// Invalidation Jobs on a CDN.
+type InvalidationJobMaxRevalDurationResponse struct {
+	Response InvalidationJobMaxRevalDuration `json:"response"`
+	Alerts
+}
+
+// InvalidationJobsCount is the number of Content Invalidation Jobs that match
+// the filters of a request, so that paginating clients can learn the total
+// without listing them all.
+type InvalidationJobsCount struct {
+	Count uint64 `json:"count"`
+}
+
+// InvalidationJobsCountResponse is the type of a response from Traffic Ops to
+// a request for the number of matching Content Invalidation Jobs.
+type InvalidationJobsCountResponse struct {
+	Response InvalidationJobsCount `json:"response"`
+	Alerts
+}
@@ -20,7 +20,9 @@ package tc
  */
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -48,8 +50,225 @@ func TestInvalidationJobGetTTL(t *testing.T) {
 	}
 }
 
+func TestTTLParameter(t *testing.T) {
+	for _, hours := range []uint{0, 1, 24, 672} {
+		param := FormatTTLParameter(hours)
+		parsed, err := ParseTTLParameter(param)
+		if err != nil {
+			t.Errorf("Unexpected error parsing formatted TTL parameter '%s': %v", param, err)
+		} else if parsed != hours {
+			t.Errorf("Expected '%s' to parse to %d hours, got: %d", param, hours, parsed)
+		}
+	}
+	if param := FormatTTLParameter(24); param != "TTL:24h" {
+		t.Errorf("Expected 24 hours to format as 'TTL:24h', got: '%s'", param)
+	}
+
+	for _, param := range []string{"", "24", "TTL:24", "24h", "TTL::24h", "TTL:-1h", "TTL:24h,x:asdf", "TTL:h"} {
+		if _, err := ParseTTLParameter(param); err == nil {
+			t.Errorf("Expected an error parsing malformed TTL parameter '%s', but didn't get one", param)
+		}
+	}
+}
+
+func TestBuildAssetURL(t *testing.T) {
+	// Expected values are what the insertQuery in Traffic Ops produces for the
+	// same Origin properties.
+	cases := []struct {
+		protocol string
+		fqdn     string
+		port     *int
+		regex    string
+		expected string
+	}{
+		{"http", "origin.infra.ciab.test", nil, "/.+", "http://origin.infra.ciab.test/.+"},
+		{"https", "origin.infra.ciab.test", util.IntPtr(443), "/foo/.*\\.png", "https://origin.infra.ciab.test:443/foo/.*\\.png"},
+		{"http", "192.0.2.1", util.IntPtr(8080), "/", "http://192.0.2.1:8080/"},
+		{"http", "origin.infra.ciab.test", util.IntPtr(80), "", "http://origin.infra.ciab.test:80"},
+		{"http", "origin.infra.ciab.test", nil, "", "http://origin.infra.ciab.test"},
+	}
+	for _, c := range cases {
+		if actual := BuildAssetURL(c.protocol, c.fqdn, c.port, c.regex); actual != c.expected {
+			t.Errorf("Expected asset URL '%s', got '%s'", c.expected, actual)
+		}
+	}
+}
+
+func TestValidateInvalidationJobOriginProtocol(t *testing.T) {
+	for _, protocol := range []string{"http", "https"} {
+		if err := ValidateInvalidationJobOriginProtocol(protocol); err != nil {
+			t.Errorf("Unexpected error validating origin protocol '%s': %v", protocol, err)
+		}
+	}
+	for _, protocol := range []string{"", "HTTP", "ftp", "s3", "http and https"} {
+		if err := ValidateInvalidationJobOriginProtocol(protocol); err == nil {
+			t.Errorf("Expected an error validating origin protocol '%s', got none", protocol)
+		}
+	}
+}
+
+func TestValidateInvalidationJobOriginPort(t *testing.T) {
+	cases := []struct {
+		name  string
+		port  *int
+		valid bool
+	}{
+		{"null", nil, true},
+		{"zero", util.IntPtr(0), false},
+		{"negative", util.IntPtr(-443), false},
+		{"lowest", util.IntPtr(1), true},
+		{"443", util.IntPtr(443), true},
+		{"highest", util.IntPtr(65535), true},
+		{"65536", util.IntPtr(65536), false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateInvalidationJobOriginPort(c.port)
+			if c.valid && err != nil {
+				t.Errorf("Unexpected error validating origin port: %v", err)
+			} else if !c.valid && err == nil {
+				t.Error("Expected an error validating origin port, got none")
+			}
+		})
+	}
+}
+
+func TestInvalidationJobInputStartTimeZone(t *testing.T) {
+	start := time.Now().Add(time.Hour).Truncate(time.Second)
+	cases := []struct {
+		name      string
+		startTime string
+		zoneless  bool
+	}{
+		{"UTC", start.UTC().Format(time.RFC3339), false},
+		{"offset", start.In(time.FixedZone("IST", 5*60*60+30*60)).Format(time.RFC3339), false},
+		{"zoneless", start.UTC().Format("2006-01-02 15:04:05"), true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var job InvalidationJobInput
+			if err := json.Unmarshal([]byte(`{"startTime":"`+c.startTime+`"}`), &job); err != nil {
+				t.Fatalf("Unexpected error decoding start time '%s': %v", c.startTime, err)
+			}
+			if job.StartTime == nil {
+				t.Fatal("Expected start time to be decoded, but it was nil")
+			}
+			if !c.zoneless && !job.StartTime.Time.Equal(start) {
+				t.Errorf("Expected start time '%s' to decode to %s, got: %s", c.startTime, start, job.StartTime.Time)
+			}
+
+			err := job.Validate(nil)
+			if err == nil {
+				t.Fatal("Expected an error validating a job without a Delivery Service, but didn't get one")
+			}
+			rejected := strings.Contains(err.Error(), "startTime: must include an explicit UTC offset")
+			if c.zoneless && !rejected {
+				t.Errorf("Expected start time '%s' to be rejected for lacking a UTC offset, got: %v", c.startTime, err)
+			} else if !c.zoneless && rejected {
+				t.Errorf("Expected start time '%s' to be accepted, got: %v", c.startTime, err)
+			}
+		})
+	}
+}
+
+func TestInvalidationJobV5MarshalJSONUTC(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	start := time.Date(2026, 10, 16, 9, 0, 0, 0, tokyo)
+	end := start.Add(24 * time.Hour)
+	job := InvalidationJobV5{ID: 1, StartTime: start, EndTime: &end}
+
+	encoded, err := json.Marshal(job)
+	if err != nil {
+		t.Fatalf("Unexpected error encoding job: %v", err)
+	}
+	if !strings.Contains(string(encoded), `"startTime":"2026-10-16T00:00:00Z"`) || !strings.Contains(string(encoded), `"endTime":"2026-10-17T00:00:00Z"`) {
+		t.Errorf("Expected job's times to be encoded in UTC, got: %s", encoded)
+	}
+	if job.StartTime.Location() != tokyo || job.EndTime.Location() != tokyo {
+		t.Error("Expected encoding a job not to modify its times")
+	}
+
+	var decoded InvalidationJobV5
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Unexpected error decoding job: %v", err)
+	}
+	if !decoded.StartTime.Equal(start) || decoded.EndTime == nil || !decoded.EndTime.Equal(end) {
+		t.Errorf("Expected job's times to round-trip as %s - %s, got: %s - %v", start, end, decoded.StartTime, decoded.EndTime)
+	}
+}
+
+func TestInvalidationJobV5Downgrade(t *testing.T) {
+	start := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	job := InvalidationJobV5{
+		ID:               1,
+		AssetURL:         "http://origin.example/.+",
+		CreatedBy:        "admin",
+		DeliveryService:  "demo1",
+		TTLHours:         24,
+		InvalidationType: REFRESH,
+		StartTime:        start,
+		Comment:          util.StrPtr("ticket 123"),
+		Priority:         5,
+		Labels:           map[string]string{"release": "2026.10"},
+		ApprovalState:    InvalidationJobApproved,
+	}
+
+	downgraded := job.Downgrade()
+	if downgraded.ID != job.ID || downgraded.AssetURL != job.AssetURL || downgraded.TTLHours != job.TTLHours || !downgraded.StartTime.Equal(start) {
+		t.Errorf("Expected the properties in API version 4 to be kept, got: %s", downgraded)
+	}
+	encoded, err := json.Marshal(downgraded)
+	if err != nil {
+		t.Fatalf("Unexpected error encoding job: %v", err)
+	}
+	for _, property := range []string{"priority", "comment", "labels", "approvalState"} {
+		if strings.Contains(string(encoded), `"`+property+`"`) {
+			t.Errorf("Expected no '%s' in an API version 4 job, got: %s", property, encoded)
+		}
+	}
+
+	upgraded := downgraded.Upgrade()
+	if upgraded.ID != job.ID || upgraded.Priority != 0 || upgraded.ApprovalState != InvalidationJobApproved {
+		t.Errorf("Expected upgrading to keep the ID and default the rest, got: %+v", upgraded)
+	}
+}
+
+func TestInvalidationJobInputValidateSyntax(t *testing.T) {
+	start := Time{Time: time.Now().Add(time.Hour)}
+	valid := func() InvalidationJobInput {
+		return InvalidationJobInput{
+			DeliveryService: util.InterfacePtr("demo1"),
+			Regex:           util.StrPtr("/.+"),
+			StartTime:       &start,
+			TTL:             util.InterfacePtr("48h"),
+		}
+	}
+
+	job := valid()
+	if err := job.ValidateSyntax(); err != nil {
+		t.Errorf("Expected a valid job to pass without a database, got: %v", err)
+	}
+
+	for _, test := range []struct {
+		name     string
+		modify   func(*InvalidationJobInput)
+		expected string
+	}{
+		{"no regex", func(j *InvalidationJobInput) { j.Regex = nil }, "regex: cannot be blank"},
+		{"invalid regex", func(j *InvalidationJobInput) { j.Regex = util.StrPtr("/(") }, "regex: is not a valid Regular Expression"},
+		{"invalid TTL", func(j *InvalidationJobInput) { j.TTL = util.InterfacePtr("soon") }, "ttl: must be a number of hours"},
+		{"past start", func(j *InvalidationJobInput) { j.StartTime = &Time{Time: time.Now().Add(-time.Hour)} }, "startTime: must be in the future"},
+	} {
+		job := valid()
+		test.modify(&job)
+		if err := job.ValidateSyntax(); err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%s: expected an error containing '%s', got: %v", test.name, test.expected, err)
+		}
+	}
+}
+
 func ExampleInvalidationJobInput_TTLHours_duration() {
-	j := InvalidationJobInput{nil, nil, nil, util.InterfacePtr("121m"), nil, nil}
+	j := InvalidationJobInput{nil, nil, nil, util.InterfacePtr("121m"), nil, nil, nil, nil, nil, nil, false}
 	ttl, e := j.TTLHours()
 	if e != nil {
 		fmt.Printf("Error: %v\n", e)
@@ -59,7 +278,7 @@ func ExampleInvalidationJobInput_TTLHours_duration() {
 }
 
 func ExampleInvalidationJobInput_TTLHours_number() {
-	j := InvalidationJobInput{nil, nil, nil, util.InterfacePtr(2.1), nil, nil}
+	j := InvalidationJobInput{nil, nil, nil, util.InterfacePtr(2.1), nil, nil, nil, nil, nil, nil, false}
 	ttl, e := j.TTLHours()
 	if e != nil {
 		fmt.Printf("Error: %v\n", e)
@@ -83,3 +302,177 @@ func ExampleInvalidationJobV4_String() {
 	fmt.Println(j)
 	// Output: InvalidationJobV4{ID: 5, AssetURL: "https://example.com/.*", CreatedBy: "noone", DeliveryService: "demo1", TTLHours: 72, InvalidationType: "REFETCH", StartTime: "2021-11-08T01:02:03Z"}
 }
+
+func TestInvalidationJobRecurrence(t *testing.T) {
+	start := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	r := InvalidationJobRecurrence{IntervalHours: 24, EndTime: start.Add(36 * time.Hour)}
+	if err := r.Validate(start); err != nil {
+		t.Errorf("Unexpected error validating recurrence: %v", err)
+	}
+
+	next := r.NextRun(start)
+	if next == nil || !next.Equal(start.Add(24*time.Hour)) {
+		t.Errorf("Expected next run at %s, got: %v", start.Add(24*time.Hour), next)
+	}
+	if next = r.NextRun(start.Add(24 * time.Hour)); next != nil {
+		t.Errorf("Expected no next run after the end time, got: %s", *next)
+	}
+
+	if err := (InvalidationJobRecurrence{EndTime: start.Add(time.Hour)}).Validate(start); err == nil {
+		t.Error("Expected an error validating a recurrence with no interval")
+	}
+	if err := (InvalidationJobRecurrence{IntervalHours: 1, EndTime: start}).Validate(start); err == nil {
+		t.Error("Expected an error validating a recurrence that ends when the job starts")
+	}
+}
+
+func TestInvalidationJobComment(t *testing.T) {
+	sanitized := SanitizeInvalidationJobComment("  TICKET-123:\tpurge\nafter deploy\x1b[31m ")
+	if expected := "TICKET-123: purge after deploy [31m"; sanitized != expected {
+		t.Errorf("Expected sanitized comment %q, got: %q", expected, sanitized)
+	}
+
+	if err := ValidateInvalidationJobComment(nil); err != nil {
+		t.Errorf("Unexpected error validating nil comment: %v", err)
+	}
+	long := strings.Repeat("é", MaxInvalidationJobCommentLength)
+	if err := ValidateInvalidationJobComment(&long); err != nil {
+		t.Errorf("Unexpected error validating comment of maximum length: %v", err)
+	}
+	long += "x"
+	if err := ValidateInvalidationJobComment(&long); err == nil {
+		t.Error("Expected an error validating comment longer than the maximum length, got none")
+	}
+}
+
+func TestUserInvalidationJobToInvalidationJobInput(t *testing.T) {
+	start := Time{Time: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC), Valid: true}
+	job := UserInvalidationJob{
+		AssetType:       util.StrPtr("file"),
+		AssetURL:        util.StrPtr(`https://origin.infra.ciab.test:443\/foo/.*\.png`),
+		DeliveryService: util.StrPtr("demo1"),
+		ID:              util.UIntPtr(1),
+		Keyword:         util.StrPtr("PURGE"),
+		Parameters:      util.StrPtr("TTL:36h"),
+		Username:        util.StrPtr("admin"),
+	}
+	input, ignored, err := job.ToInvalidationJobInput(start)
+	if err != nil {
+		t.Fatalf("Unexpected error converting legacy job: %v", err)
+	}
+	if input.Regex == nil || *input.Regex != `\/foo/.*\.png` {
+		t.Errorf("Expected regex '\\/foo/.*\\.png', got: %v", input.Regex)
+	}
+	if input.DeliveryService == nil || *input.DeliveryService != "demo1" {
+		t.Errorf("Expected Delivery Service 'demo1', got: %v", input.DeliveryService)
+	}
+	if input.TTL == nil || *input.TTL != float64(36) {
+		t.Errorf("Expected TTL of 36 hours, got: %v", input.TTL)
+	}
+	if input.StartTime == nil || !input.StartTime.Equal(start.Time) {
+		t.Errorf("Expected start time %v, got: %v", start, input.StartTime)
+	}
+	if len(ignored) != 2 {
+		t.Errorf("Expected assetType and username to be reported as ignored, got: %v", ignored)
+	}
+
+	job.Keyword = util.StrPtr("REFETCH")
+	job.Parameters = util.StrPtr("TTL:36")
+	job.AssetURL = util.StrPtr("/foo")
+	if _, _, err := job.ToInvalidationJobInput(start); err == nil {
+		t.Error("Expected an error converting a legacy job with an unsupported keyword and malformed parameters and asset URL, got none")
+	} else if msg := err.Error(); !strings.Contains(msg, "keyword") || !strings.Contains(msg, "parameters") || !strings.Contains(msg, "assetUrl") {
+		t.Errorf("Expected the error to report keyword, parameters, and assetUrl, got: %v", err)
+	}
+
+	legacy := UserInvalidationJobInput{
+		DSID:   util.UIntPtr(3),
+		Regex:  util.StrPtr("/.+"),
+		TTL:    util.Uint64Ptr(24),
+		Urgent: util.BoolPtr(true),
+	}
+	converted, ignored := legacy.ToInvalidationJobInput()
+	if converted.DeliveryService == nil || *converted.DeliveryService != float64(3) {
+		t.Errorf("Expected Delivery Service ID 3, got: %v", converted.DeliveryService)
+	}
+	if converted.TTL == nil || *converted.TTL != float64(24) {
+		t.Errorf("Expected TTL of 24 hours, got: %v", converted.TTL)
+	}
+	if len(ignored) != 1 {
+		t.Errorf("Expected urgent to be reported as ignored, got: %v", ignored)
+	}
+}
+
+func TestInvalidationJobLabels(t *testing.T) {
+	if err := ValidateInvalidationJobLabels(nil); err != nil {
+		t.Errorf("Unexpected error validating no labels: %v", err)
+	}
+	valid := map[string]string{"release": "2026.10-rc1", "team": "edge_ops", "urgent": ""}
+	if err := ValidateInvalidationJobLabels(valid); err != nil {
+		t.Errorf("Unexpected error validating labels %v: %v", valid, err)
+	}
+	for _, invalid := range []map[string]string{
+		{"": "x"},
+		{"-release": "x"},
+		{"release": "x y"},
+		{"release": "x."},
+		{strings.Repeat("k", MaxInvalidationJobLabelLength+1): "x"},
+	} {
+		if err := ValidateInvalidationJobLabels(invalid); err == nil {
+			t.Errorf("Expected an error validating labels %v, got none", invalid)
+		}
+	}
+	tooMany := map[string]string{}
+	for i := 0; i <= MaxInvalidationJobLabels; i++ {
+		tooMany[fmt.Sprintf("k%d", i)] = "v"
+	}
+	if err := ValidateInvalidationJobLabels(tooMany); err == nil {
+		t.Errorf("Expected an error validating %d labels, got none", len(tooMany))
+	}
+
+	filter, err := ParseInvalidationJobLabelFilter("release:2026.10,urgent:")
+	if err != nil {
+		t.Fatalf("Unexpected error parsing label filter: %v", err)
+	}
+	if len(filter) != 2 || filter["release"] != "2026.10" || filter["urgent"] != "" {
+		t.Errorf("Expected labels release=2026.10 and urgent=, got: %v", filter)
+	}
+	for _, invalid := range []string{"", "release", "release:a b"} {
+		if _, err := ParseInvalidationJobLabelFilter(invalid); err == nil {
+			t.Errorf("Expected an error parsing label filter '%s', got none", invalid)
+		}
+	}
+}
+
+func TestInvalidationJobManifestPaths(t *testing.T) {
+	expected := []string{"a.js", "dir/b.css"}
+	for _, manifest := range []string{`["/a.js", " dir/b.css", ""]`, `"a.js\r\n\n/dir/b.css\n"`} {
+		paths, err := InvalidationJobManifest{Manifest: json.RawMessage(manifest)}.Paths()
+		if err != nil {
+			t.Errorf("Unexpected error reading manifest %s: %v", manifest, err)
+			continue
+		}
+		if fmt.Sprint(paths) != fmt.Sprint(expected) {
+			t.Errorf("Expected manifest %s to have paths %v, got: %v", manifest, expected, paths)
+		}
+	}
+
+	if _, err := (InvalidationJobManifest{Manifest: json.RawMessage(`{"a": "b"}`)}).Paths(); err == nil {
+		t.Error("Expected an error reading a manifest that's an object, but didn't get one")
+	}
+}
+
+func TestParseInvalidationJobStartIn(t *testing.T) {
+	for startIn, expected := range map[string]time.Duration{"0s": 0, "10m": 10 * time.Minute, "1h30m": 90 * time.Minute, "720h": MaxInvalidationJobStartIn} {
+		if actual, err := ParseInvalidationJobStartIn(startIn); err != nil {
+			t.Errorf("Unexpected error parsing startIn '%s': %v", startIn, err)
+		} else if actual != expected {
+			t.Errorf("Expected startIn '%s' to be %s, got: %s", startIn, expected, actual)
+		}
+	}
+	for _, startIn := range []string{"", "10", "ten minutes", "-1m", "721h"} {
+		if _, err := ParseInvalidationJobStartIn(startIn); err == nil {
+			t.Errorf("Expected an error parsing startIn '%s', got none", startIn)
+		}
+	}
+}
@@ -1068,6 +1068,12 @@ type ServerV40 struct {
 // version 4 of the Traffic Ops API.
 type ServerV4 = ServerV40
 
+// OutOfSync returns whether the server has a configuration update or a
+// revalidation that was queued after it last applied one.
+func (s ServerV40) OutOfSync() bool {
+	return updateNotApplied(s.ConfigUpdateTime, s.ConfigApplyTime) || updateNotApplied(s.RevalUpdateTime, s.RevalApplyTime)
+}
+
 // ServerV30 is the representation of a Server in version 3 of the Traffic Ops API.
 type ServerV30 struct {
 	CommonServerProperties
@@ -1225,6 +1231,22 @@ type ServerUpdateStatusV40 struct {
 	RevalidateApplyTime  *time.Time `json:"revalidate_apply_time"`
 }
 
+// OutOfSync returns whether the server has a configuration update or a
+// revalidation that was queued after it last applied one.
+func (sus ServerUpdateStatusV40) OutOfSync() bool {
+	return updateNotApplied(sus.ConfigUpdateTime, sus.ConfigApplyTime) || updateNotApplied(sus.RevalidateUpdateTime, sus.RevalidateApplyTime)
+}
+
+// updateNotApplied returns whether an update queued at 'updateTime' has yet
+// to be applied, given that the last one was applied at 'applyTime'. Nothing
+// is outstanding if nothing was ever queued.
+func updateNotApplied(updateTime, applyTime *time.Time) bool {
+	if updateTime == nil {
+		return false
+	}
+	return applyTime == nil || updateTime.After(*applyTime)
+}
+
 // Downgrade strips the Config and Revalidate timestamps from
 // ServerUpdateStatusV40 to return previous versions of the struct to ensure
 // previous compatibility.
@@ -1375,3 +1397,14 @@ type ServerQueueUpdate struct {
 	ServerID util.JSONIntStr `json:"serverId"`
 	Action   string          `json:"action"`
 }
+
+// ServerIDs returns the ID of the server on which updates were queued or
+// dequeued, as a list for parity with CDNQueueUpdateResponse.ServerIDs.
+func (u ServerQueueUpdate) ServerIDs() []int {
+	return []int{int(u.ServerID)}
+}
+
+// Queued returns whether updates were queued, rather than dequeued.
+func (u ServerQueueUpdate) Queued() bool {
+	return u.Action == "queue"
+}
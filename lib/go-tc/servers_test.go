@@ -20,6 +20,7 @@ package tc
  */
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"testing"
@@ -1371,3 +1372,74 @@ func TestServerNullableV2_Upgrade(t *testing.T) {
 		t.Errorf("Incorrect XMPPPasswd after upgraded conversion; want: '%s', got: '%s'", *nullable.XMPPPasswd, *upgraded.XMPPPasswd)
 	}
 }
+
+func TestQueueUpdateResponseDecoding(t *testing.T) {
+	var server ServerQueueUpdateResponse
+	if err := json.Unmarshal([]byte(`{"response": {"serverId": "7", "action": "queue"}}`), &server); err != nil {
+		t.Fatalf("Unexpected error decoding server queue_update response: %v", err)
+	}
+	if ids := server.Response.ServerIDs(); len(ids) != 1 || ids[0] != 7 {
+		t.Errorf("Expected server IDs [7], got: %v", ids)
+	}
+	if !server.Response.Queued() {
+		t.Error("Expected server queue_update response to report that updates were queued")
+	}
+
+	var cdn CDNQueueUpdateAPIResponse
+	body := `{"alerts": [{"text": "queued", "level": "success"}], "response": {"action": "dequeue", "cdnId": 2, "servers": [{"id": 3, "hostName": "edge"}, {"id": 5, "hostName": "mid"}]}}`
+	if err := json.Unmarshal([]byte(body), &cdn); err != nil {
+		t.Fatalf("Unexpected error decoding CDN queue_update response: %v", err)
+	}
+	if cdn.Response.CDNID != 2 || cdn.Response.Queued() {
+		t.Errorf("Expected updates dequeued on CDN #2, got: %+v", cdn.Response)
+	}
+	if ids := cdn.Response.ServerIDs(); fmt.Sprint(ids) != "[3 5]" {
+		t.Errorf("Expected server IDs [3 5], got: %v", ids)
+	}
+	if names := cdn.Response.HostNames(); strings.Join(names, ",") != "edge,mid" {
+		t.Errorf("Expected host names edge and mid, got: %v", names)
+	}
+	if len(cdn.Alerts.Alerts) != 1 {
+		t.Errorf("Expected one alert, got: %v", cdn.Alerts.Alerts)
+	}
+
+	var legacy CDNQueueUpdateAPIResponse
+	if err := json.Unmarshal([]byte(`{"response": {"action": "queue", "cdnId": 2}}`), &legacy); err != nil {
+		t.Fatalf("Unexpected error decoding pre-5.0 CDN queue_update response: %v", err)
+	}
+	if ids := legacy.Response.ServerIDs(); ids == nil || len(ids) != 0 {
+		t.Errorf("Expected no server IDs from a response without servers, got: %v", ids)
+	}
+}
+
+func TestServerUpdateStatusV40OutOfSync(t *testing.T) {
+	earlier := time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Minute)
+
+	cases := map[string]struct {
+		status   ServerUpdateStatusV40
+		expected bool
+	}{
+		"nothing ever queued":          {ServerUpdateStatusV40{}, false},
+		"config applied":               {ServerUpdateStatusV40{ConfigUpdateTime: &earlier, ConfigApplyTime: &later}, false},
+		"config applied at queue time": {ServerUpdateStatusV40{ConfigUpdateTime: &earlier, ConfigApplyTime: &earlier}, false},
+		"config pending":               {ServerUpdateStatusV40{ConfigUpdateTime: &later, ConfigApplyTime: &earlier}, true},
+		"config never applied":         {ServerUpdateStatusV40{ConfigUpdateTime: &earlier}, true},
+		"reval pending": {ServerUpdateStatusV40{
+			ConfigUpdateTime:     &earlier,
+			ConfigApplyTime:      &earlier,
+			RevalidateUpdateTime: &later,
+			RevalidateApplyTime:  &earlier,
+		}, true},
+	}
+	for name, c := range cases {
+		if actual := c.status.OutOfSync(); actual != c.expected {
+			t.Errorf("%s: expected OutOfSync to be %t, got %t", name, c.expected, actual)
+		}
+	}
+
+	server := ServerV40{ConfigUpdateTime: &earlier, ConfigApplyTime: &earlier, RevalUpdateTime: &later, RevalApplyTime: &earlier}
+	if !server.OutOfSync() {
+		t.Error("Expected a server with a pending revalidation to be out of sync")
+	}
+}
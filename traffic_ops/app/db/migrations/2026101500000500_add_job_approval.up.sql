@@ -0,0 +1,22 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with this
+ * work for additional information regarding copyright ownership.  The ASF
+ * licenses this file to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+ALTER TABLE public.job
+    ADD COLUMN IF NOT EXISTS approval_state text NOT NULL DEFAULT 'APPROVED',
+    ADD COLUMN IF NOT EXISTS approval_requested_by bigint REFERENCES public.tm_user (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS approved_by bigint REFERENCES public.tm_user (id) ON DELETE SET NULL,
+    ADD CONSTRAINT job_approval_state_valid CHECK (approval_state IN ('APPROVED', 'PENDING_APPROVAL'));
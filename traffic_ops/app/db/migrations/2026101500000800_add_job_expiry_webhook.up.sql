@@ -0,0 +1,26 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with this
+ * work for additional information regarding copyright ownership.  The ASF
+ * licenses this file to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.  See the
+ * License for the specific language governing permissions and limitations under
+ * the License.
+ */
+
+ALTER TABLE public.job
+    ADD COLUMN IF NOT EXISTS expiry_webhook text,
+    ADD COLUMN IF NOT EXISTS expiry_webhook_attempts integer NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS expiry_webhook_retry_at timestamp with time zone,
+    ADD COLUMN IF NOT EXISTS expiry_webhook_done boolean NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS job_expiry_webhook_pending_idx
+    ON public.job (start_time)
+    WHERE expiry_webhook IS NOT NULL AND NOT expiry_webhook_done;
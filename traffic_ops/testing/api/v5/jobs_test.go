@@ -509,7 +509,7 @@ func TestJobs(t *testing.T) {
 			t.Run(method, func(t *testing.T) {
 				for name, testCase := range testCases {
 					job := tc.InvalidationJobCreateV4{}
-					jobUpdate := tc.InvalidationJobV4{}
+					jobUpdate := tc.InvalidationJobV5{}
 
 					if testCase.RequestBody != nil {
 						dat, err := json.Marshal(testCase.RequestBody)
@@ -563,7 +563,7 @@ func TestJobs(t *testing.T) {
 func validateInvalidationJobsFields(expectedResp map[string]interface{}) utils.CkReqFunc {
 	return func(t *testing.T, _ toclientlib.ReqInf, resp interface{}, _ tc.Alerts, _ error) {
 		assert.RequireNotNil(t, resp, "Expected Invalidation Jobs response to not be nil.")
-		jobResp := resp.([]tc.InvalidationJobV4)
+		jobResp := resp.([]tc.InvalidationJobV5)
 		for field, expected := range expectedResp {
 			for _, job := range jobResp {
 				switch field {
@@ -593,7 +593,7 @@ func validateMaxRevalDurationDays() utils.CkReqFunc {
 	return func(t *testing.T, _ toclientlib.ReqInf, resp interface{}, _ tc.Alerts, _ error) {
 		assert.RequireNotNil(t, resp, "Expected Invalidation Jobs response to not be nil.")
 		maxRevalDurationDays := 90
-		jobResp := resp.([]tc.InvalidationJobV4)
+		jobResp := resp.([]tc.InvalidationJobV5)
 		for _, job := range jobResp {
 			if time.Since(job.StartTime) > time.Duration(maxRevalDurationDays)*24*time.Hour {
 				t.Errorf("GET /jobs by maxRevalDurationDays returned job that is older than %d days: %v}", maxRevalDurationDays, time.Since(job.StartTime))
@@ -22,6 +22,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"net"
@@ -644,11 +645,32 @@ func reqFallback(reqF ReqF) ReqF {
 // and this will request '/api/3.1/deliveryservices'.
 func reqAPI(reqF ReqF) ReqF {
 	return func(to *TOClient, method string, path string, body interface{}, header http.Header, response interface{}, raw bool) (ReqInf, error) {
-		path = strings.TrimSuffix(to.APIBase(), "/") + "/" + strings.TrimPrefix(path, "/")
-		return reqF(to, method, path, body, header, response, raw)
+		return reqAPIVersion(to.APIVersion())(reqF)(to, method, path, body, header, response, raw)
 	}
 }
 
+// reqAPIVersion returns a middleware that behaves like reqAPI, but always
+// uses the given API version rather than the one chosen by the Client.
+func reqAPIVersion(version string) MidReqF {
+	return func(reqF ReqF) ReqF {
+		return func(to *TOClient, method string, path string, body interface{}, header http.Header, response interface{}, raw bool) (ReqInf, error) {
+			path = apiBaseStr + version + "/" + strings.TrimPrefix(path, "/")
+			inf, err := reqF(to, method, path, body, header, response, raw)
+			inf.APIVersion = version
+			return inf, err
+		}
+	}
+}
+
+// A StreamDecoder decodes a response body as it's read, rather than after the
+// whole body has been read into memory, which keeps memory bounded for very
+// large responses. Passing one as the response of a request makes it decode
+// the body of a successful response; unsuccessful responses are read and
+// checked for alerts as usual, and not passed to it.
+type StreamDecoder interface {
+	DecodeStream(body io.Reader) error
+}
+
 // makeRequestWithHeader marshals the response body (if non-nil), performs the HTTP request,
 // and decodes the response into the given response pointer.
 //
@@ -661,7 +683,8 @@ func reqAPI(reqF ReqF) ReqF {
 //	Will try to log in again, and try the request again.
 //	The second request is returned, even if it fails.
 //
-// To request the bytes without deserializing, pass a *[]byte response.
+// To request the bytes without deserializing, pass a *[]byte response. To
+// decode the response as it's read, pass a StreamDecoder.
 func makeRequestWithHeader(to *TOClient, method, path string, body interface{}, header http.Header, response interface{}, raw bool) (ReqInf, error) {
 	var remoteAddr net.Addr
 	var resp *http.Response
@@ -687,6 +710,12 @@ func makeRequestWithHeader(to *TOClient, method, path string, body interface{},
 			return reqInf, nil
 		}
 		defer log.Close(resp.Body, "unable to close response body")
+		if stream, ok := response.(StreamDecoder); ok && err == nil {
+			if decodeErr := stream.DecodeStream(resp.Body); decodeErr != nil {
+				err = fmt.Errorf("decoding response body: %w", decodeErr)
+			}
+			return reqInf, err
+		}
 		bts, readErr := ioutil.ReadAll(resp.Body)
 		if readErr != nil {
 			if err != nil {
@@ -734,6 +763,26 @@ func (to *TOClient) Req(method string, path string, body interface{}, header htt
 	return reqF(to, method, path, body, header, response, false)
 }
 
+// ReqWithAPIVersion is like Req, but makes the request to the given version
+// of the Traffic Ops API (e.g. "5.0") instead of the one the client would
+// otherwise choose. Unlike Req, this never falls back to an older version if
+// Traffic Ops doesn't support the requested one. The version must be one of
+// those supported by the client.
+func (to *TOClient) ReqWithAPIVersion(version, method, path string, body interface{}, header http.Header, response interface{}) (ReqInf, error) {
+	supported := false
+	for _, v := range to.apiVersions {
+		if v == version {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return ReqInf{CacheHitStatus: CacheHitStatusMiss}, fmt.Errorf("API version %s is not supported by this client", version)
+	}
+	reqF := composeReqFuncs(makeRequestWithHeader, []MidReqF{reqAPIVersion(version), reqLogin})
+	return reqF(to, method, path, body, header, response, false)
+}
+
 // request performs the HTTP request to Traffic Ops, trying to refresh the
 // cookie if an Unauthorized or Forbidden code is received. It only tries once.
 // If the login fails, the original Unauthorized/Forbidden response is
@@ -827,6 +876,10 @@ type ReqInf struct {
 	RemoteAddr     net.Addr
 	StatusCode     int
 	RespHeaders    http.Header
+	// APIVersion is the version of the Traffic Ops API to which the request
+	// was ultimately made, e.g. "5.0". It's empty for requests that aren't
+	// made to a versioned API path.
+	APIVersion string
 }
 
 // CacheHitStatus is deprecated and will be removed in the next major version.
@@ -48,6 +48,8 @@ const (
 	Updated   = "Updated"
 	Created   = "Created"
 	Deleted   = "Deleted"
+	Cancelled = "Cancelled"
+	Approved  = "Approved"
 )
 
 func CreateChangeLog(level string, action string, i Identifier, user *auth.CurrentUser, tx *sql.Tx) error {
@@ -215,6 +215,25 @@ func readHandlerHelper(reader Reader, errHandler errWriterFunc, successHandler r
 			date := maxTime.Format(rfc.LastModifiedFormat)
 			w.Header().Add(rfc.LastModified, date)
 		}
+		if etagger, ok := obj.(ETagger); ok {
+			if etag := etagger.ETag(); etag != "" {
+				w.Header().Set(rfc.ETagHeader, etag)
+			}
+		}
+		if csvWriter, ok := obj.(CSVWriter); ok {
+			w.Header().Add(rfc.Vary, rfc.Accept)
+			if csvWriter.CSV() {
+				w.Header().Set(rfc.ContentType, rfc.ContentTypeTextCSV+"; charset=utf-8")
+				w.WriteHeader(errCode)
+				if errCode == http.StatusNotModified {
+					return
+				}
+				if err := csvWriter.WriteCSV(w, results); err != nil {
+					log.Errorf("writing CSV response: %v", err)
+				}
+				return
+			}
+		}
 		successHandler(w, r, errCode, results)
 	}
 }
@@ -22,6 +22,8 @@ package api
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
@@ -253,6 +255,81 @@ func TestReadHandlerIMS(t *testing.T) {
 	}
 }
 
+// csvTester writes its results as CSV if they're requested by the Accept
+// header.
+type csvTester struct {
+	tester
+	csv bool
+}
+
+func (c *csvTester) Read(h http.Header, useIMS bool) ([]interface{}, error, error, int, *time.Time) {
+	c.csv = h.Get(rfc.Accept) == rfc.ContentTypeTextCSV
+	return c.tester.Read(h, useIMS)
+}
+
+func (c *csvTester) CSV() bool {
+	return c.csv
+}
+
+func (c *csvTester) WriteCSV(w io.Writer, results []interface{}) error {
+	for _, result := range results {
+		fmt.Fprintf(w, "%d\n", result.(tester).ID)
+	}
+	return nil
+}
+
+func TestReadHandlerCSV(t *testing.T) {
+	for _, asCSV := range []bool{false, true} {
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer mockDB.Close()
+
+		db := sqlx.NewDb(mockDB, "sqlmock")
+		defer db.Close()
+
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("", "", nil)
+		if err != nil {
+			t.Error("Error creating new request")
+		}
+
+		ctx := r.Context()
+		ctx = context.WithValue(ctx, auth.CurrentUserKey,
+			auth.CurrentUser{UserName: "username", ID: 1, PrivLevel: auth.PrivLevelAdmin})
+		ctx = context.WithValue(ctx, PathParamsKey, map[string]string{"id": "1"})
+		ctx = context.WithValue(ctx, DBContextKey, db)
+		ctx = context.WithValue(ctx, ConfigContextKey, &cfg)
+		ctx = context.WithValue(ctx, ReqIDContextKey, uint64(0))
+		var tv trafficvault.TrafficVault = &disabled.Disabled{}
+		ctx = context.WithValue(ctx, TrafficVaultContextKey, tv)
+		r = r.WithContext(ctx)
+
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		if asCSV {
+			r.Header.Set(rfc.Accept, rfc.ContentTypeTextCSV)
+		}
+		ReadHandler(&csvTester{})(w, r)
+
+		body := `{"response":[{"ID":1}]}` + "\n"
+		if asCSV {
+			body = "1\n"
+			if ct := w.Result().Header.Get(rfc.ContentType); ct != rfc.ContentTypeTextCSV+"; charset=utf-8" {
+				t.Errorf("Expected Content-Type %s, got: %s", rfc.ContentTypeTextCSV, ct)
+			}
+		}
+		if w.Body.String() != body {
+			t.Errorf("Expected body %q (CSV: %t), got: %q", body, asCSV, w.Body.String())
+		}
+		if vary := w.Result().Header.Get(rfc.Vary); vary != rfc.Accept {
+			t.Errorf("Expected responses to vary by %s (CSV: %t), got: %s", rfc.Accept, asCSV, vary)
+		}
+	}
+}
+
 func TestUpdateHandler(t *testing.T) {
 	mockDB, mock, err := sqlmock.New()
 	if err != nil {
@@ -20,6 +20,7 @@ package api
  */
 
 import (
+	"io"
 	"net/http"
 	"time"
 
@@ -79,6 +80,23 @@ type Reader interface {
 	APIInfoer
 }
 
+// ETagger is an optional interface for Readers. If a Reader implements it, the
+// non-empty value it returns after Read has been called is sent as the ETag
+// of the response - including a 304 Not Modified response.
+type ETagger interface {
+	ETag() string
+}
+
+// CSVWriter is an optional interface for Readers. If a Reader implements it
+// and CSV returns true after Read has been called, the results of a
+// successful read are written as text/csv by WriteCSV instead of as JSON.
+// Since whether it does may depend on the request's Accept header, responses
+// from such Readers always vary by it.
+type CSVWriter interface {
+	CSV() bool
+	WriteCSV(w io.Writer, results []interface{}) error
+}
+
 type Updater interface {
 	// Update returns any user error, any system error, and the HTTP error code to be returned if there was an error.
 	Update(h http.Header) (error, error, int)
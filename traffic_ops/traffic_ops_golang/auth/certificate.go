@@ -0,0 +1,218 @@
+package auth
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// SubjectOIDFriendlyNames maps the dotted-decimal string form of well-known
+// X.509 subject attribute OIDs to their conventional short names.
+var SubjectOIDFriendlyNames = map[string]string{
+	"2.5.4.3":                    "CN",
+	"2.5.4.4":                    "SN",
+	"2.5.4.5":                    "serialNumber",
+	"2.5.4.6":                    "C",
+	"2.5.4.7":                    "L",
+	"2.5.4.8":                    "ST",
+	"2.5.4.9":                    "street",
+	"2.5.4.10":                   "O",
+	"2.5.4.11":                   "OU",
+	"2.5.4.12":                   "title",
+	"2.5.4.17":                   "postalCode",
+	"2.5.4.42":                   "GN",
+	"0.9.2342.19200300.100.1.1":  "UID",
+	"0.9.2342.19200300.100.1.25": "DC",
+	"1.2.840.113549.1.9.1":       "emailAddress",
+}
+
+// ListClientCertificateSubjectOIDs returns every attribute in the subject of
+// the given certificate, keyed by the dotted-decimal string form of its OID.
+// This is meant for diagnostics, e.g. discovering which attributes a new CA
+// puts in its certificates; SubjectOIDFriendlyNames can be used to label the
+// well-known ones.
+//
+// If an OID appears more than once (e.g. multiple OUs), the values are joined
+// with a comma in the order in which they appear in the subject.
+func ListClientCertificateSubjectOIDs(cert *x509.Certificate) map[string]string {
+	oids := map[string]string{}
+	if cert == nil {
+		return oids
+	}
+	for _, name := range cert.Subject.Names {
+		oid := name.Type.String()
+		val := fmt.Sprint(name.Value)
+		if existing, ok := oids[oid]; ok {
+			val = existing + "," + val
+		}
+		oids[oid] = val
+	}
+	return oids
+}
+
+var (
+	// OIDUID is the OID of the LDAP userid (UID) subject attribute, with which
+	// client certificates identify Traffic Ops users.
+	OIDUID = asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 1}
+	// OIDSubjectAltName is the OID of the X.509 Subject Alternative Name
+	// extension.
+	OIDSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+	// OIDUserPrincipalName is the OID of the Microsoft User Principal Name
+	// otherName type, as used in SmartCard logon certificates.
+	OIDUserPrincipalName = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2, 3}
+)
+
+// ParseClientCertificateUID returns the UID in the subject of the given
+// certificate, which identifies the Traffic Ops user to whom it belongs. The
+// value is returned exactly as it appears, whatever ASN.1 string type it was
+// encoded with (e.g. PrintableString or UTF8String).
+//
+// If the subject has more than one UID - in separate RDNs, or in a single
+// multi-valued RDN - the first, in the order in which they appear in the
+// subject, is used; later ones are ignored. An error is returned if there is
+// no UID, or if the first one is empty or can't be read as text.
+func ParseClientCertificateUID(cert *x509.Certificate) (string, error) {
+	if cert == nil {
+		return "", errors.New("no client certificate")
+	}
+	for _, name := range cert.Subject.Names {
+		if !name.Type.Equal(OIDUID) {
+			continue
+		}
+		uid, err := attributeValueString(name.Value)
+		if err != nil {
+			return "", fmt.Errorf("reading UID of client certificate: %v", err)
+		}
+		if uid == "" {
+			return "", errors.New("client certificate has an empty UID")
+		}
+		return uid, nil
+	}
+	return "", errors.New("client certificate has no UID in its subject")
+}
+
+// attributeValueString returns the text of the value of a subject attribute.
+// crypto/x509 decodes the common string types to Go strings, but a pkix.Name
+// built or decoded some other way may hold raw bytes or an undecoded ASN.1
+// value instead.
+func attributeValueString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		if !utf8.Valid(v) {
+			return "", errors.New("value is not valid UTF-8")
+		}
+		return string(v), nil
+	case asn1.RawValue:
+		if v.Class != asn1.ClassUniversal {
+			return "", fmt.Errorf("unsupported ASN.1 class %d", v.Class)
+		}
+		switch v.Tag {
+		case asn1.TagUTF8String, asn1.TagPrintableString, asn1.TagIA5String, asn1.TagT61String, asn1.TagNumericString:
+			if !utf8.Valid(v.Bytes) {
+				return "", errors.New("value is not valid UTF-8")
+			}
+			return string(v.Bytes), nil
+		case asn1.TagBMPString:
+			if len(v.Bytes)%2 != 0 {
+				return "", errors.New("BMPString has an odd number of bytes")
+			}
+			units := make([]uint16, 0, len(v.Bytes)/2)
+			for i := 0; i < len(v.Bytes); i += 2 {
+				units = append(units, uint16(v.Bytes[i])<<8|uint16(v.Bytes[i+1]))
+			}
+			return string(utf16.Decode(units)), nil
+		}
+		return "", fmt.Errorf("unsupported ASN.1 type %d", v.Tag)
+	case fmt.Stringer:
+		return v.String(), nil
+	}
+	return "", fmt.Errorf("unsupported value type %T", value)
+}
+
+// ParseClientCertificateSAN returns the email addresses and User Principal
+// Names (UPNs) in the Subject Alternative Name of the given certificate. Some
+// PKI deployments identify users this way instead of with a UID in the
+// subject, in which case this can be used to find the user's identity
+// instead.
+//
+// Malformed otherName entries are skipped rather than treated as errors,
+// since Go's own certificate parsing has already accepted the extension.
+func ParseClientCertificateSAN(cert *x509.Certificate) ([]string, []string) {
+	if cert == nil {
+		return nil, nil
+	}
+	emails := append([]string(nil), cert.EmailAddresses...)
+	var upns []string
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(OIDSubjectAltName) {
+			continue
+		}
+		upns = append(upns, parseSANUserPrincipalNames(ext.Value)...)
+	}
+	return emails, upns
+}
+
+// parseSANUserPrincipalNames returns the values of all of the UPN otherName
+// entries in the given DER-encoded SubjectAltName extension value.
+//
+//	GeneralNames ::= SEQUENCE OF GeneralName
+//	GeneralName ::= CHOICE { otherName [0] OtherName, ... }
+//	OtherName ::= SEQUENCE { type-id OBJECT IDENTIFIER, value [0] EXPLICIT ANY }
+func parseSANUserPrincipalNames(der []byte) []string {
+	var names asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &names); err != nil || names.Class != asn1.ClassUniversal || names.Tag != asn1.TagSequence {
+		return nil
+	}
+
+	var upns []string
+	for rest := names.Bytes; len(rest) > 0; {
+		var name asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &name); err != nil {
+			return upns
+		}
+		if name.Class != asn1.ClassContextSpecific || name.Tag != 0 {
+			continue
+		}
+
+		var typeID asn1.ObjectIdentifier
+		value, err := asn1.Unmarshal(name.Bytes, &typeID)
+		if err != nil || !typeID.Equal(OIDUserPrincipalName) {
+			continue
+		}
+		var wrapper asn1.RawValue
+		if _, err := asn1.Unmarshal(value, &wrapper); err != nil || wrapper.Class != asn1.ClassContextSpecific || wrapper.Tag != 0 {
+			continue
+		}
+		var upn string
+		if _, err := asn1.Unmarshal(wrapper.Bytes, &upn); err != nil {
+			continue
+		}
+		upns = append(upns, upn)
+	}
+	return upns
+}
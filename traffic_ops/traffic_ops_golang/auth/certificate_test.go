@@ -0,0 +1,213 @@
+package auth
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// newTestCertificate self-signs the given template and returns the parsed
+// result, so that tests see exactly what a TLS handshake would produce.
+func newTestCertificate(t *testing.T, template *x509.Certificate) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	if template.SerialNumber == nil {
+		template.SerialNumber = big.NewInt(1)
+	}
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = time.Now().Add(time.Hour)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parsing certificate: %v", err)
+	}
+	return cert
+}
+
+var oidUID = asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 1}
+
+func TestListClientCertificateSubjectOIDs(t *testing.T) {
+	cert := newTestCertificate(t, &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:         "Test User",
+			Organization:       []string{"Apache"},
+			OrganizationalUnit: []string{"Traffic", "Control"},
+			ExtraNames: []pkix.AttributeTypeAndValue{
+				{Type: oidUID, Value: "tuser"},
+			},
+		},
+	})
+
+	oids := ListClientCertificateSubjectOIDs(cert)
+	expected := map[string]string{
+		"2.5.4.3":                   "Test User",
+		"2.5.4.10":                  "Apache",
+		"2.5.4.11":                  "Control,Traffic", // DER sorts the members of a SET OF
+		"0.9.2342.19200300.100.1.1": "tuser",
+	}
+	if len(oids) != len(expected) {
+		t.Errorf("expected %d OIDs, got %d: %v", len(expected), len(oids), oids)
+	}
+	for oid, val := range expected {
+		if oids[oid] != val {
+			t.Errorf("expected OID %s (%s) to have value '%s', got '%s'", oid, SubjectOIDFriendlyNames[oid], val, oids[oid])
+		}
+	}
+
+	if oids := ListClientCertificateSubjectOIDs(nil); len(oids) != 0 {
+		t.Errorf("expected no OIDs for a nil certificate, got: %v", oids)
+	}
+}
+
+// otherNameUPN builds a SAN otherName GeneralName holding the given UPN.
+func otherNameUPN(t *testing.T, upn string) asn1.RawValue {
+	t.Helper()
+	val, err := asn1.MarshalWithParams(upn, "utf8")
+	if err != nil {
+		t.Fatalf("marshaling UPN: %v", err)
+	}
+	seq, err := asn1.Marshal(struct {
+		TypeID asn1.ObjectIdentifier
+		Value  asn1.RawValue
+	}{
+		TypeID: OIDUserPrincipalName,
+		Value:  asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: val},
+	})
+	if err != nil {
+		t.Fatalf("marshaling otherName: %v", err)
+	}
+	var otherName asn1.RawValue
+	if _, err := asn1.Unmarshal(seq, &otherName); err != nil {
+		t.Fatalf("unmarshaling otherName: %v", err)
+	}
+	// OtherName is IMPLICITly tagged [0] within GeneralName
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: otherName.Bytes}
+}
+
+func TestParseClientCertificateSAN(t *testing.T) {
+	san, err := asn1.Marshal([]asn1.RawValue{
+		otherNameUPN(t, "jdoe@CORP.EXAMPLE.COM"),
+		{Class: asn1.ClassContextSpecific, Tag: 1, Bytes: []byte("jdoe@example.com")},
+		{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte("ws01.example.com")},
+		otherNameUPN(t, "john.doe@example.com"),
+	})
+	if err != nil {
+		t.Fatalf("marshaling SAN: %v", err)
+	}
+
+	// SmartCard logon certificates typically have nothing identifying in the
+	// subject beyond a CN.
+	cert := newTestCertificate(t, &x509.Certificate{
+		Subject:         pkix.Name{CommonName: "DOE.JOHN.1234567890"},
+		ExtraExtensions: []pkix.Extension{{Id: OIDSubjectAltName, Value: san}},
+	})
+
+	emails, upns := ParseClientCertificateSAN(cert)
+	if len(emails) != 1 || emails[0] != "jdoe@example.com" {
+		t.Errorf("expected emails [jdoe@example.com], got: %v", emails)
+	}
+	if len(upns) != 2 || upns[0] != "jdoe@CORP.EXAMPLE.COM" || upns[1] != "john.doe@example.com" {
+		t.Errorf("expected UPNs [jdoe@CORP.EXAMPLE.COM john.doe@example.com], got: %v", upns)
+	}
+
+	cert = newTestCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "no SAN"}})
+	if emails, upns := ParseClientCertificateSAN(cert); len(emails) != 0 || len(upns) != 0 {
+		t.Errorf("expected no emails or UPNs for a certificate without a SAN, got: %v, %v", emails, upns)
+	}
+
+	if emails, upns := ParseClientCertificateSAN(nil); len(emails) != 0 || len(upns) != 0 {
+		t.Errorf("expected no emails or UPNs for a nil certificate, got: %v, %v", emails, upns)
+	}
+}
+
+func TestParseClientCertificateUID(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		value    asn1.RawValue
+		expected string
+	}{
+		{"UTF8String", asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagUTF8String, Bytes: []byte("jdöe_admin")}, "jdöe_admin"},
+		{"PrintableString", asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagPrintableString, Bytes: []byte("jdoe")}, "jdoe"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cert := newTestCertificate(t, &x509.Certificate{
+				Subject: pkix.Name{
+					CommonName: "Test User",
+					ExtraNames: []pkix.AttributeTypeAndValue{{Type: OIDUID, Value: test.value}},
+				},
+			})
+			uid, err := ParseClientCertificateUID(cert)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if uid != test.expected {
+				t.Errorf("expected UID '%s', got '%s'", test.expected, uid)
+			}
+		})
+	}
+
+	// These can't come out of crypto/x509's own parsing, but shouldn't panic.
+	for _, test := range []struct {
+		name     string
+		names    []pkix.AttributeTypeAndValue
+		expected string
+		err      bool
+	}{
+		{"bytes", []pkix.AttributeTypeAndValue{{Type: OIDUID, Value: []byte("jdoe")}}, "jdoe", false},
+		{"BMPString", []pkix.AttributeTypeAndValue{{Type: OIDUID, Value: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagBMPString, Bytes: []byte{0, 'j', 0, 'd'}}}}, "jd", false},
+		{"first of several", []pkix.AttributeTypeAndValue{{Type: OIDUID, Value: "first"}, {Type: OIDUID, Value: "second"}}, "first", false},
+		{"integer", []pkix.AttributeTypeAndValue{{Type: OIDUID, Value: 42}}, "", true},
+		{"invalid UTF-8", []pkix.AttributeTypeAndValue{{Type: OIDUID, Value: []byte{0xff}}}, "", true},
+		{"empty", []pkix.AttributeTypeAndValue{{Type: OIDUID, Value: ""}}, "", true},
+		{"missing", nil, "", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			uid, err := ParseClientCertificateUID(&x509.Certificate{Subject: pkix.Name{Names: test.names}})
+			if test.err != (err != nil) {
+				t.Fatalf("expected error: %t, got: %v", test.err, err)
+			}
+			if uid != test.expected {
+				t.Errorf("expected UID '%s', got '%s'", test.expected, uid)
+			}
+		})
+	}
+
+	if _, err := ParseClientCertificateUID(nil); err == nil {
+		t.Error("expected an error for a nil certificate")
+	}
+}
@@ -24,8 +24,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 
+	"github.com/apache/trafficcontrol/lib/go-log"
 	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/lib/go-util"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
@@ -136,25 +138,43 @@ UPDATE public.server
 SET config_update_time = config_apply_time`
 		query = query + where
 	}
+	query = query + `
+RETURNING id, host_name`
 
-	rowsAffected, err := queueUpdates(inf.Tx, query, queryValues)
+	servers, err := queueUpdates(inf.Tx, query, queryValues)
 	if err != nil {
 		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("queueing updates: %v", err))
 		return
 	}
 
-	api.CreateChangeLogRawTx(api.ApiChange, "CDN: "+string(cdnName)+", ID: "+strconv.Itoa(inf.IntParams["id"])+str+", ACTION: server updates "+reqObj.Action+"d on "+strconv.Itoa(int(rowsAffected))+" servers", inf.User, inf.Tx.Tx)
-	api.WriteResp(w, r, tc.CDNQueueUpdateResponse{Action: reqObj.Action, CDNID: int64(inf.IntParams["id"])})
+	resp := tc.CDNQueueUpdateResponse{Action: reqObj.Action, CDNID: int64(inf.IntParams["id"])}
+	if inf.Version != nil && inf.Version.Major >= 5 {
+		resp.Servers = servers
+	}
+	api.CreateChangeLogRawTx(api.ApiChange, "CDN: "+string(cdnName)+", ID: "+strconv.Itoa(inf.IntParams["id"])+str+", ACTION: server updates "+reqObj.Action+"d on "+strconv.Itoa(len(servers))+" servers", inf.User, inf.Tx.Tx)
+	api.WriteResp(w, r, resp)
 }
 
-// queueUpdates is the helper function to queue/ dequeue updates on servers for a CDN, optionally filtered by type and/ or profile
-func queueUpdates(tx *sqlx.Tx, query string, queryValues map[string]interface{}) (int64, error) {
-	result, err := tx.NamedExec(query, queryValues)
+// queueUpdates is the helper function to queue/ dequeue updates on servers for a CDN, optionally filtered by type and/ or profile.
+// It returns the servers that were updated, ordered by ID.
+func queueUpdates(tx *sqlx.Tx, query string, queryValues map[string]interface{}) ([]tc.CDNQueueUpdateServer, error) {
+	rows, err := tx.NamedQuery(query, queryValues)
 	if err != nil {
-		return 0, errors.New("querying queue updates: " + err.Error())
-	} else if rc, err := result.RowsAffected(); err != nil {
-		return rc, fmt.Errorf("checking rows updated: %v", err)
-	} else {
-		return rc, nil
+		return nil, errors.New("querying queue updates: " + err.Error())
+	}
+	defer log.Close(rows, "closing queue update rows")
+
+	servers := []tc.CDNQueueUpdateServer{}
+	for rows.Next() {
+		var server tc.CDNQueueUpdateServer
+		if err := rows.Scan(&server.ID, &server.HostName); err != nil {
+			return nil, fmt.Errorf("scanning updated server: %v", err)
+		}
+		servers = append(servers, server)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating over updated servers: %v", err)
 	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].ID < servers[j].ID })
+	return servers, nil
 }
@@ -25,9 +25,11 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -95,6 +97,7 @@ type Config struct {
 	RoleBasedPermissions                      bool                    `json:"role_based_permissions"`
 	DefaultCertificateInfo                    *DefaultCertificateInfo `json:"default_certificate_info"`
 	Cdni                                      *CdniConf               `json:"cdni"`
+	Jobs                                      ConfigJobs              `json:"jobs"`
 }
 
 // ConfigHypnotoad carries http setting for hypnotoad (mojolicious) server
@@ -240,6 +243,92 @@ func (d *DefaultCertificateInfo) Validate() (error, bool) {
 	return nil, true
 }
 
+// ConfigJobs carries settings for Content Invalidation Jobs.
+type ConfigJobs struct {
+	// AllowInactiveDeliveryServices allows creating Content Invalidation Jobs
+	// for INACTIVE Delivery Services, which is otherwise refused because
+	// such jobs have no effect.
+	AllowInactiveDeliveryServices bool `json:"allow_inactive_delivery_services"`
+	// RecurrenceCheckIntervalSec is how often, in seconds, the next
+	// occurrences of recurring Content Invalidation Jobs are created.
+	RecurrenceCheckIntervalSec int `json:"recurrence_check_interval_sec"`
+	// AllowAnyContentType allows the bodies of requests to create or update
+	// Content Invalidation Jobs to be sent with any Content-Type, rather than
+	// only application/json, for legacy clients.
+	AllowAnyContentType bool `json:"allow_any_content_type"`
+	// DisableRevalFlags stops creating, modifying, or deleting Content
+	// Invalidation Jobs from flagging servers for revalidation, so that
+	// non-production instances sharing a copy of a production database can
+	// exercise the jobs API without changing the state of servers.
+	DisableRevalFlags bool `json:"disable_reval_flags"`
+	// AllowRevalColumnOverride allows requests to create Content
+	// Invalidation Jobs to choose, with the revalColumn query string
+	// parameter, which server column is set to flag servers for revalidation,
+	// instead of the use_reval_pending Parameter. It's meant for testing both
+	// ways of flagging servers without changing that global Parameter.
+	AllowRevalColumnOverride bool `json:"allow_reval_column_override"`
+	// MaxRequestBodyBytes is the largest allowed size, in bytes, of the
+	// bodies of requests to create or update Content Invalidation Jobs. If
+	// it isn't positive, a small default is used.
+	MaxRequestBodyBytes int64 `json:"max_request_body_bytes"`
+	// MaxAssetURLLength is the longest allowed asset URL - including the
+	// Origin URL prefix - of a Content Invalidation Job. If it isn't
+	// positive, a default is used.
+	MaxAssetURLLength int `json:"max_asset_url_length"`
+	// StrictUniqueness refuses to create Content Invalidation Jobs that
+	// overlap existing ones for the same asset, instead of only warning about
+	// them, in API version 5.0 and later. Requests may override it with the
+	// strictUniqueness query string parameter.
+	StrictUniqueness bool `json:"strict_uniqueness"`
+	// TemplateVariables are the names of the variables that requests to
+	// create Content Invalidation Jobs may substitute into their regular
+	// expressions. If it's empty, such requests are refused.
+	TemplateVariables []string `json:"template_variables"`
+	// TrustedProxies are the IP addresses and/or CIDR-notation networks of
+	// reverse proxies whose X-Forwarded-Proto and X-Forwarded-Host headers
+	// are used to build the Location headers of responses to requests to
+	// create Content Invalidation Jobs. Those headers are ignored on requests
+	// from anywhere else.
+	TrustedProxies []string `json:"trusted_proxies"`
+	// ApprovalRequiredCDNs are the names of the CDNs on which every new
+	// Content Invalidation Job must be approved by a second user before it
+	// takes effect.
+	ApprovalRequiredCDNs []string `json:"approval_required_cdns"`
+	// ApprovalPermission is the Permission a user needs in order to approve
+	// Content Invalidation Jobs. If it isn't set, JOB:APPROVE is used.
+	ApprovalPermission string `json:"approval_permission"`
+	// IdempotencyKeyTTLSec is how long, in seconds, the Idempotency-Key of a
+	// request to create Content Invalidation Jobs is remembered, so that
+	// retries of it return the jobs it created instead of creating more. If
+	// it isn't positive, a default of one hour is used.
+	IdempotencyKeyTTLSec int `json:"idempotency_key_ttl_sec"`
+	// ExpiryWebhookAllowedHosts are the host names to which the expiry
+	// webhooks of Content Invalidation Jobs may be sent. If it's empty, jobs
+	// can't have expiry webhooks.
+	ExpiryWebhookAllowedHosts []string `json:"expiry_webhook_allowed_hosts"`
+	// ExpiryWebhookCheckIntervalSec is how often, in seconds, Content
+	// Invalidation Jobs whose windows have elapsed are checked for expiry
+	// webhooks to send. If it isn't positive, a default is used.
+	ExpiryWebhookCheckIntervalSec int `json:"expiry_webhook_check_interval_sec"`
+	// ExpiryWebhookMaxPerMinute is the most expiry webhooks of Content
+	// Invalidation Jobs that are sent per minute. If it isn't positive, a
+	// default is used.
+	ExpiryWebhookMaxPerMinute int `json:"expiry_webhook_max_per_minute"`
+	// ChangeLogRedactQueryStrings masks the query strings of the asset URLs
+	// of Content Invalidation Jobs in change log entries. The jobs
+	// themselves keep their full asset URLs.
+	ChangeLogRedactQueryStrings bool `json:"changelog_redact_query_strings"`
+	// ChangeLogRedactPattern is a regular expression, the matches of which
+	// in the asset URLs of Content Invalidation Jobs are masked in change
+	// log entries. If it's empty, nothing is masked by it.
+	ChangeLogRedactPattern string `json:"changelog_redact_pattern"`
+	// RevalProgressMaxTimeoutSec is the longest, in seconds, that a request
+	// may ask for the stream of a Content Invalidation Job's revalidation
+	// progress to last. If it isn't positive, the default timeout of that
+	// stream is also the longest.
+	RevalProgressMaxTimeoutSec int `json:"reval_progress_max_timeout_sec"`
+}
+
 // ConfigDatabase reflects the structure of the database.conf file
 type ConfigDatabase struct {
 	Description string `json:"description"`
@@ -542,9 +631,31 @@ func ParseConfig(cfg Config) (Config, error) {
 		return Config{}, err
 	}
 
+	if err := ValidateTrustedProxies(cfg.Jobs.TrustedProxies); err != nil {
+		return Config{}, err
+	}
+
+	if _, err := regexp.Compile(cfg.Jobs.ChangeLogRedactPattern); err != nil {
+		return Config{}, fmt.Errorf("jobs.changelog_redact_pattern: %v", err)
+	}
+
 	return cfg, nil
 }
 
+// ValidateTrustedProxies checks that each of the given trusted proxies is
+// either an IP address or a CIDR-notation network.
+func ValidateTrustedProxies(proxies []string) error {
+	for _, proxy := range proxies {
+		if net.ParseIP(proxy) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(proxy); err != nil {
+			return fmt.Errorf("jobs.trusted_proxies: '%s' is neither an IP address nor a CIDR-notation network", proxy)
+		}
+	}
+	return nil
+}
+
 func ValidateRoutingBlacklist(blacklist RoutingBlacklist) error {
 	seenDisabledIDs := make(map[int]struct{}, len(blacklist.DisabledRoutes))
 	for _, id := range blacklist.DisabledRoutes {
@@ -318,3 +318,23 @@ func TestValidateRoutingBlacklist(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateTrustedProxies(t *testing.T) {
+	type testCase struct {
+		Input     []string
+		ExpectErr bool
+	}
+	testCases := []testCase{
+		{Input: nil, ExpectErr: false},
+		{Input: []string{"192.0.2.1", "2001:db8::1", "10.0.0.0/8", "2001:db8::/32"}, ExpectErr: false},
+		{Input: []string{"192.0.2.1", "proxy.example.test"}, ExpectErr: true},
+		{Input: []string{"10.0.0.0/33"}, ExpectErr: true},
+	}
+	for _, tc := range testCases {
+		if err := ValidateTrustedProxies(tc.Input); err != nil && !tc.ExpectErr {
+			t.Errorf("Expected: no error, actual: %v", err)
+		} else if err == nil && tc.ExpectErr {
+			t.Errorf("Expected: non-nil error, actual: nil")
+		}
+	}
+}
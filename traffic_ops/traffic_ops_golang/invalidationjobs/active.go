@@ -0,0 +1,107 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/tenant"
+
+	"github.com/lib/pq"
+)
+
+// jobActiveCondition matches the jobs whose windows include the current time.
+// It doesn't consider approval, since jobs pending approval are in their
+// windows all the same; they just have no effect.
+const jobActiveCondition = `NOW() BETWEEN job.start_time AND job.start_time + (job.ttl_hr * INTERVAL '1 hour')`
+
+// Counts the approved jobs whose windows include the current time on each of
+// the Delivery Services within the Tenants $1 - and on the CDN named $3, if
+// it isn't NULL - that has any.
+const selectActiveDeliveryServicesQuery = `
+SELECT ds.id,
+	ds.xml_id,
+	COUNT(job.id)
+FROM job
+JOIN deliveryservice ds ON ds.id = job.job_deliveryservice
+WHERE ds.tenant_id = ANY($1::bigint[])
+AND job.approval_state = $2
+AND ` + jobActiveCondition + `
+AND ($3::text IS NULL OR ds.cdn_id = (SELECT cdn.id FROM cdn WHERE cdn.name = $3::text))
+GROUP BY ds.id, ds.xml_id
+ORDER BY ds.xml_id
+`
+
+// getActiveDeliveryServices returns the Delivery Services within the given
+// Tenants - and on the named CDN, if it isn't nil - that have Content
+// Invalidation Jobs in effect, with how many each has, ordered by XMLID.
+func getActiveDeliveryServices(tx *sql.Tx, tenants []int, cdn *string) ([]tc.InvalidationJobActiveDeliveryService, error) {
+	rows, err := tx.Query(selectActiveDeliveryServicesQuery, pq.Array(tenants), tc.InvalidationJobApproved, cdn)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dses := []tc.InvalidationJobActiveDeliveryService{}
+	for rows.Next() {
+		var ds tc.InvalidationJobActiveDeliveryService
+		if err := rows.Scan(&ds.DSID, &ds.XMLID, &ds.ActiveJobCount); err != nil {
+			return nil, err
+		}
+		dses = append(dses, ds)
+	}
+	return dses, rows.Err()
+}
+
+// GetActiveDeliveryServices is the handler for GET requests to
+// /jobs/active_delivery_services in API version 5.0 and later. It lists the
+// Delivery Services within the user's Tenancy that currently have Content
+// Invalidation Jobs in effect - optionally only those on the CDN named by the
+// 'cdn' query string parameter - with how many each has, without listing the
+// jobs themselves.
+func GetActiveDeliveryServices(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, nil, nil)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+
+	tenants, err := tenant.GetUserTenantIDListTx(inf.Tx.Tx, inf.User.TenantID)
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting tenant list for user: %v", err))
+		return
+	}
+	var cdn *string
+	if name, ok := inf.Params["cdn"]; ok {
+		cdn = &name
+	}
+
+	dses, err := getActiveDeliveryServices(inf.Tx.Tx, tenants, cdn)
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting Delivery Services with active jobs: %v", err))
+		return
+	}
+	api.WriteResp(w, r, dses)
+}
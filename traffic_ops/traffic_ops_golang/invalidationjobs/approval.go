@@ -0,0 +1,279 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/auth"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/dbhelpers"
+
+	"github.com/lib/pq"
+)
+
+// JobApprovePermission is the Permission a user needs in order to approve
+// Content Invalidation Jobs, unless the approval_permission configuration
+// option names another.
+const JobApprovePermission = "JOB:APPROVE"
+
+// Puts newly created jobs into the pending approval state, recording the user
+// who created them so that they can't approve them.
+const markPendingApprovalQuery = `
+UPDATE job
+SET approval_state = 'PENDING_APPROVAL',
+	approval_requested_by = $1
+WHERE id = ANY($2)
+`
+
+// Selects what's needed to decide whether a job may be approved, locking it
+// against concurrent modification.
+const selectApproveInfoQuery = `
+SELECT job_deliveryservice, job_user, approval_requested_by, approval_state
+FROM job
+WHERE id = $1
+FOR UPDATE
+`
+
+const approveJobQuery = `
+UPDATE job
+SET approval_state = 'APPROVED',
+	approved_by = $2
+WHERE job.id = $1
+RETURNING job.id,
+	job.asset_url,
+	(
+		SELECT tm_user.username
+		FROM tm_user
+		WHERE tm_user.id=job.job_user
+	) AS created_by,
+	(
+		SELECT deliveryservice.xml_id
+		FROM deliveryservice
+		WHERE deliveryservice.id=job.job_deliveryservice
+	) AS deliveryservice,
+	job.ttl_hr,
+	job.invalidation_type,
+	job.start_time,
+	job.comment,
+	job.priority,
+	job.labels,
+	job.approval_state
+`
+
+// approvalPermission returns the Permission a user needs in order to approve
+// Content Invalidation Jobs.
+func approvalPermission(inf *api.APIInfo) string {
+	if inf.Config == nil || inf.Config.Jobs.ApprovalPermission == "" {
+		return JobApprovePermission
+	}
+	return inf.Config.Jobs.ApprovalPermission
+}
+
+// cdnRequiresApproval tells whether the approval_required_cdns configuration
+// option includes the named CDN.
+func cdnRequiresApproval(inf *api.APIInfo, cdnName string) bool {
+	if inf.Config == nil {
+		return false
+	}
+	for _, cdn := range inf.Config.Jobs.ApprovalRequiredCDNs {
+		if cdn == cdnName {
+			return true
+		}
+	}
+	return false
+}
+
+// needsApproval tells whether jobs being created on the Delivery Service
+// identified by 'dsid' must wait for approval before taking effect: either
+// because the request asked for it, which is only supported in API version
+// 5.0 and later, or because the Delivery Service's CDN requires it.
+//
+// This returns, in order, the answer, a user-facing error, a system error, and
+// an HTTP status code, as authorizeJobModification does.
+func needsApproval(inf *api.APIInfo, dsid uint, requested bool) (bool, error, error, int) {
+	if requested {
+		if inf.Version == nil || inf.Version.Major < 5 {
+			return false, errors.New("pendingApproval is not supported before API version 5.0"), nil, http.StatusBadRequest
+		}
+		return true, nil, nil, http.StatusOK
+	}
+	if inf.Config == nil || len(inf.Config.Jobs.ApprovalRequiredCDNs) == 0 {
+		return false, nil, nil, http.StatusOK
+	}
+	_, cdnName, _, err := dbhelpers.GetDSNameAndCDNFromID(inf.Tx.Tx, int(dsid))
+	if err != nil {
+		return false, nil, fmt.Errorf("getting CDN of Delivery Service #%d: %v", dsid, err), http.StatusInternalServerError
+	}
+	return cdnRequiresApproval(inf, string(cdnName)), nil, nil, http.StatusOK
+}
+
+// markPendingApproval puts the identified, newly created jobs into the
+// pending approval state on behalf of the user identified by 'requestedBy'.
+func markPendingApproval(tx *sql.Tx, requestedBy int, ids ...uint64) error {
+	_, err := tx.Exec(markPendingApprovalQuery, requestedBy, pq.Array(ids))
+	return err
+}
+
+// approvalState returns the approval state of a newly created job.
+func approvalState(pending bool) string {
+	if pending {
+		return tc.InvalidationJobPendingApproval
+	}
+	return tc.InvalidationJobApproved
+}
+
+// approvalChangeLog returns the part of a change log entry about a newly
+// created job that records that it's pending approval, which is empty if it
+// isn't.
+func approvalChangeLog(pending bool) string {
+	if !pending {
+		return ""
+	}
+	return " APPROVAL: " + tc.InvalidationJobPendingApproval
+}
+
+// pendingApprovalAlert returns the alert that tells the user that the jobs
+// they created won't take effect until approved.
+func pendingApprovalAlert(inf *api.APIInfo) tc.Alert {
+	return tc.Alert{
+		Text:  fmt.Sprintf("the job will not take effect until it is approved by another user with the %s Permission", approvalPermission(inf)),
+		Level: tc.InfoLevel.String(),
+	}
+}
+
+// approvalFilter returns the condition to add to the WHERE clause of a query
+// for jobs to implement the 'approvalState' query string parameter - which is
+// only supported in API version 5.0 and later - adding the named parameter it
+// uses to queryValues. Without it, only approved jobs are matched, so that
+// clients that generate configuration for cache servers never see jobs that
+// are pending approval. The returned error is suitable for showing to the
+// user.
+func approvalFilter(inf *api.APIInfo, queryValues map[string]interface{}) (string, error) {
+	state := tc.InvalidationJobApproved
+	if inf.Version != nil && inf.Version.Major >= 5 {
+		if param, ok := inf.Params["approvalState"]; ok {
+			if param != tc.InvalidationJobApproved && param != tc.InvalidationJobPendingApproval {
+				return "", fmt.Errorf("approvalState: must be one of %s or %s", tc.InvalidationJobApproved, tc.InvalidationJobPendingApproval)
+			}
+			state = param
+		}
+	}
+	queryValues["approvalState"] = state
+	return ` AND job.approval_state = :approvalState `, nil
+}
+
+// Approve is the handler for POST requests to /jobs/{id}/approve in API
+// version 5.0 and later. It puts a Content Invalidation Job that's pending
+// approval into effect, then flags the Delivery Service's servers for
+// revalidation. The approving user must have the approval Permission, and
+// must be neither the user who created the job nor the one it's attributed
+// to.
+func Approve(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, []string{"id"}, []string{"id"})
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+	tx := inf.Tx.Tx
+
+	jobID := inf.IntParams["id"]
+	var dsid uint
+	var jobUser uint
+	var requestedBy sql.NullInt64
+	var state string
+	if err := tx.QueryRow(selectApproveInfoQuery, jobID).Scan(&dsid, &jobUser, &requestedBy, &state); err == sql.ErrNoRows {
+		api.HandleErr(w, r, tx, http.StatusNotFound, tc.NewCodedError(tc.AlertCodeNotFound, fmt.Errorf("No job by id '%d'!", jobID)), nil)
+		return
+	} else if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("getting info for job #%d: %v", jobID, err))
+		return
+	}
+
+	if userErr, sysErr, errCode = authorizeJobModification(inf, dsid, nil); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+		return
+	}
+
+	perm := approvalPermission(inf)
+	if !(inf.Config.RoleBasedPermissions && inf.User.Can(perm)) && inf.User.PrivLevel != auth.PrivLevelAdmin {
+		api.HandleErr(w, r, tx, http.StatusForbidden, tc.NewCodedError(tc.AlertCodeNotAuthorized, fmt.Errorf("approving jobs requires the %s Permission", perm)), nil)
+		return
+	}
+
+	if state != tc.InvalidationJobPendingApproval {
+		api.HandleErr(w, r, tx, http.StatusConflict, tc.NewCodedError(tc.AlertCodeConflict, errors.New("job is not pending approval")), nil)
+		return
+	}
+	if uint(inf.User.ID) == jobUser || (requestedBy.Valid && requestedBy.Int64 == int64(inf.User.ID)) {
+		api.HandleErr(w, r, tx, http.StatusForbidden, tc.NewCodedError(tc.AlertCodeNotAuthorized, errors.New("jobs must be approved by a user other than the one who created them")), nil)
+		return
+	}
+
+	if userErr, sysErr, errCode = recheckDSCDN(inf, dsid); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+		return
+	}
+
+	result := tc.InvalidationJobV5{}
+	err := tx.QueryRow(approveJobQuery, jobID, inf.User.ID).Scan(
+		&result.ID,
+		&result.AssetURL,
+		&result.CreatedBy,
+		&result.DeliveryService,
+		&result.TTLHours,
+		&result.InvalidationType,
+		&result.StartTime,
+		&result.Comment,
+		&result.Priority,
+		labelsColumn{&result.Labels},
+		&result.ApprovalState)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("approving job #%d: %v", jobID, err))
+		return
+	}
+	result.EndTime = jobEndTime(result.StartTime, result.TTLHours)
+
+	alerts := tc.Alerts{}
+	alerts.AddNewAlert(tc.SuccessLevel, "Content invalidation job was approved")
+	if revalWarning, err := setJobRevalFlags(tx, jobID, dsid, revalFlagsDisabled(inf)); err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("setting reval_pending after approving job #%d: %v", jobID, err))
+		return
+	} else if revalWarning != "" {
+		alerts.AddNewAlert(tc.WarnLevel, revalWarning)
+	}
+
+	changeLogMsg := fmt.Sprintf("%s content invalidation job - ID: %d DSXMLID: %s ASSET_URL: '%s' TTLHRs: %d INVALIDATION: %s CREATED_BY: '%s'",
+		api.Approved,
+		result.ID,
+		result.DeliveryService,
+		assetURLChangeLog(inf, result.AssetURL),
+		result.TTLHours,
+		result.InvalidationType,
+		result.CreatedBy,
+	)
+	api.CreateChangeLogRawTx(api.ApiChange, changeLogMsg, inf.User, tx)
+	api.WriteAlertsObj(w, r, http.StatusOK, alerts, result)
+}
@@ -0,0 +1,231 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+)
+
+// Selects what's needed to decide whether a job may be deleted, and to
+// recompute revalidation afterward, locking it against concurrent
+// modification and its Delivery Service against being moved to another CDN.
+const selectBulkDeleteInfoQuery = `
+SELECT job.job_deliveryservice, job.job_user, job.reval_cachegroup, job.reval_server_type, cdn.name
+FROM job
+JOIN deliveryservice ds ON ds.id = job.job_deliveryservice
+JOIN cdn ON cdn.id = ds.cdn_id
+WHERE job.id = $1
+FOR UPDATE OF job
+FOR SHARE OF ds
+`
+
+// equal tells whether two scopes limit the flagged servers identically.
+func (s revalScope) equal(other revalScope) bool {
+	eq := func(a, b *int) bool {
+		return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+	}
+	return eq(s.CacheGroupID, other.CacheGroupID) && eq(s.ServerTypeID, other.ServerTypeID)
+}
+
+// bulkReval accumulates the scopes of the jobs deleted from one Delivery
+// Service, so that its servers are only flagged once: within the jobs' scope
+// if they all share one, and otherwise all of them.
+type bulkReval struct {
+	scope revalScope
+	mixed bool
+}
+
+// add includes the scope of another deleted job.
+func (b *bulkReval) add(scope revalScope) {
+	if !b.scope.equal(scope) {
+		b.mixed = true
+	}
+}
+
+// effective returns the scope within which to flag servers.
+func (b bulkReval) effective() revalScope {
+	if b.mixed {
+		return revalScope{}
+	}
+	return b.scope
+}
+
+// BulkDelete is the handler for POST requests to /jobs/bulk_delete in API
+// version 5.0 and later. It deletes each of the Content Invalidation Jobs with
+// the given IDs that the user may delete - skipping, rather than failing on,
+// the rest, including all of those on any CDN the user may not modify - then
+// flags the servers of each affected Delivery Service for revalidation once.
+// The response has a result for each requested ID, and an alert for each CDN
+// touched.
+func BulkDelete(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, nil, nil)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+	tx := inf.Tx.Tx
+	logger := newJobLogger(inf, "BulkDelete")
+
+	if userErr, sysErr, errCode = checkContentType(inf, r); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+		return
+	}
+	limitBody(w, r, inf)
+
+	var req tc.InvalidationJobBulkDelete
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if tooLarge := bodyTooLarge(err); tooLarge != nil {
+			api.HandleErr(w, r, tx, http.StatusRequestEntityTooLarge, tooLarge, nil)
+			return
+		}
+		api.HandleErr(w, r, tx, http.StatusBadRequest, errors.New("Unable to parse bulk deletion request"), fmt.Errorf("parsing jobs/bulk_delete POST: %v", err))
+		return
+	}
+	if len(req.IDs) == 0 {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, errors.New("ids: must contain at least one ID"), nil)
+		return
+	}
+	if len(req.IDs) > tc.MaxInvalidationJobBulkDeleteIDs {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, fmt.Errorf("ids: must contain no more than %d IDs", tc.MaxInvalidationJobBulkDeleteIDs), nil)
+		return
+	}
+
+	results := make([]tc.InvalidationJobBulkDeleteResult, 0, len(req.IDs))
+	revals := map[uint]*bulkReval{}
+	cdns := newCDNAuthorizer(inf)
+	deleted := 0
+	for _, id := range req.IDs {
+		result := tc.InvalidationJobBulkDeleteResult{ID: id}
+		var dsid uint
+		var createdBy uint
+		var cacheGroup, serverType sql.NullInt64
+		var cdnName string
+		if err := tx.QueryRow(selectBulkDeleteInfoQuery, id).Scan(&dsid, &createdBy, &cacheGroup, &serverType, &cdnName); err == sql.ErrNoRows {
+			result.Reason = "no such job"
+			results = append(results, result)
+			continue
+		} else if err != nil {
+			api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("getting info for job #%d: %v", id, err))
+			return
+		}
+
+		if userErr, sysErr, errCode := authorizeJobTenancy(inf, dsid, &createdBy); sysErr != nil {
+			api.HandleErr(w, r, tx, errCode, nil, sysErr)
+			return
+		} else if userErr != nil {
+			// Jobs the user can't see at all look like they don't exist, as
+			// they do when deleted one at a time.
+			result.Reason = "no such job"
+			if errCode != http.StatusNotFound {
+				result.Reason = userErr.Error()
+			}
+			results = append(results, result)
+			continue
+		}
+
+		result.CDN = cdnName
+		if userErr, sysErr := cdns.authorize(cdnName); sysErr != nil {
+			api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, sysErr)
+			return
+		} else if userErr != nil {
+			result.Reason = userErr.Error()
+			results = append(results, result)
+			continue
+		}
+
+		scope, err := getJobRevalScope(tx, id)
+		if err != nil {
+			api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("getting revalidation scope of job #%d: %v", id, err))
+			return
+		}
+
+		job := tc.InvalidationJobV5{}
+		err = tx.QueryRow(deleteQueryV4, id).Scan(
+			&job.ID,
+			&job.AssetURL,
+			&job.CreatedBy,
+			&job.DeliveryService,
+			&job.TTLHours,
+			&job.InvalidationType,
+			&job.StartTime,
+			&job.Priority)
+		if err != nil {
+			api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("deleting job #%d: %v", id, err))
+			return
+		}
+		job.EndTime = jobEndTime(job.StartTime, job.TTLHours)
+		logger.Event("job_deleted", "job", job.ID, "ds", job.DeliveryService, "asset_url", job.AssetURL)
+
+		if reval, ok := revals[dsid]; ok {
+			reval.add(scope)
+		} else {
+			revals[dsid] = &bulkReval{scope: scope}
+		}
+		result.Deleted = true
+		result.Job = &job
+		results = append(results, result)
+		deleted++
+
+		changeLogMsg := fmt.Sprintf("%s content invalidation job - ID: %d DSXMLID: %s ASSET_URL: '%s' TTLHRs: %d INVALIDATION: %s (bulk)",
+			api.Deleted,
+			job.ID,
+			job.DeliveryService,
+			assetURLChangeLog(inf, job.AssetURL),
+			job.TTLHours,
+			job.InvalidationType,
+		)
+		api.CreateChangeLogRawTx(api.ApiChange, changeLogMsg, inf.User, tx)
+	}
+
+	alerts := tc.Alerts{}
+	alerts.AddNewAlert(tc.SuccessLevel, fmt.Sprintf("Deleted %d of %d content invalidation jobs", deleted, len(req.IDs)))
+	for _, alert := range cdns.alerts("deleted") {
+		alerts.AddAlert(alert)
+	}
+
+	// In a consistent order, so that concurrent requests flag servers in the
+	// same order.
+	dsIDs := make([]uint, 0, len(revals))
+	for dsid := range revals {
+		dsIDs = append(dsIDs, dsid)
+	}
+	sort.Slice(dsIDs, func(i, j int) bool { return dsIDs[i] < dsIDs[j] })
+	for _, dsid := range dsIDs {
+		revalWarning, err := setScopedRevalFlags(dsid, revals[dsid].effective(), tx, revalFlagsDisabled(inf))
+		if err != nil {
+			api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("setting reval_pending for Delivery Service #%d after deleting jobs: %v", dsid, err))
+			return
+		}
+		if revalWarning != "" {
+			alerts.AddNewAlert(tc.WarnLevel, revalWarning)
+		}
+	}
+
+	api.WriteAlertsObj(w, r, http.StatusOK, alerts, results)
+}
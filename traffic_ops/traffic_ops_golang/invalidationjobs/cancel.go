@@ -0,0 +1,155 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+)
+
+// Selects what's needed to decide whether a job may be cancelled, locking it
+// against concurrent modification.
+const selectCancelInfoQuery = `
+SELECT job_deliveryservice, job_user, start_time, ttl_hr
+FROM job
+WHERE id = $1
+FOR UPDATE
+`
+
+// Shortens the TTL of a started job to the whole number of hours that have
+// elapsed since it started, so that it has already ended as far as the
+// regex_revalidate.config files generated for cache servers are concerned.
+const cancelJobQuery = `
+UPDATE job
+SET ttl_hr = floor(extract(epoch FROM now() - start_time) / 3600)::integer
+WHERE job.id = $1
+RETURNING job.id,
+	job.asset_url,
+	(
+		SELECT tm_user.username
+		FROM tm_user
+		WHERE tm_user.id=job.job_user
+	) AS created_by,
+	(
+		SELECT deliveryservice.xml_id
+		FROM deliveryservice
+		WHERE deliveryservice.id=job.job_deliveryservice
+	) AS deliveryservice,
+	job.ttl_hr,
+	job.invalidation_type,
+	job.start_time,
+	job.comment,
+	job.priority,
+	job.labels
+`
+
+// Cancel is the handler for POST requests to /jobs/{id}/cancel in API version
+// 5.0 and later. It ends a Content Invalidation Job that has already started
+// but hasn't yet ended by shortening its TTL so that it has already expired,
+// then flags the Delivery Service's servers for revalidation so that they
+// promptly drop it from their regex_revalidate.config. Jobs that haven't
+// started yet should simply be deleted instead.
+func Cancel(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, []string{"id"}, []string{"id"})
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+	tx := inf.Tx.Tx
+
+	jobID := inf.IntParams["id"]
+	var dsid uint
+	var createdBy uint
+	var start time.Time
+	var ttlHours uint
+	if err := tx.QueryRow(selectCancelInfoQuery, jobID).Scan(&dsid, &createdBy, &start, &ttlHours); err == sql.ErrNoRows {
+		api.HandleErr(w, r, tx, http.StatusNotFound, tc.NewCodedError(tc.AlertCodeNotFound, fmt.Errorf("No job by id '%d'!", jobID)), nil)
+		return
+	} else if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("getting info for job #%d: %v", jobID, err))
+		return
+	}
+
+	if userErr, sysErr, errCode = authorizeJobModification(inf, dsid, &createdBy); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+		return
+	}
+
+	now := time.Now()
+	if start.After(now) {
+		api.HandleErr(w, r, tx, http.StatusConflict, tc.NewCodedError(tc.AlertCodeConflict, errors.New("job has not started yet; delete it instead")), nil)
+		return
+	}
+	if !start.Add(time.Duration(ttlHours) * time.Hour).After(now) {
+		api.HandleErr(w, r, tx, http.StatusConflict, tc.NewCodedError(tc.AlertCodeConflict, errors.New("job has already ended")), nil)
+		return
+	}
+
+	if userErr, sysErr, errCode = recheckDSCDN(inf, dsid); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+		return
+	}
+
+	result := tc.InvalidationJobV5{}
+	err := tx.QueryRow(cancelJobQuery, jobID).Scan(
+		&result.ID,
+		&result.AssetURL,
+		&result.CreatedBy,
+		&result.DeliveryService,
+		&result.TTLHours,
+		&result.InvalidationType,
+		&result.StartTime,
+		&result.Comment,
+		&result.Priority,
+		labelsColumn{&result.Labels})
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("cancelling job #%d: %v", jobID, err))
+		return
+	}
+	result.EndTime = jobEndTime(result.StartTime, result.TTLHours)
+
+	alerts := tc.Alerts{}
+	alerts.AddNewAlert(tc.SuccessLevel, "Content invalidation job was cancelled")
+	if revalWarning, err := setJobRevalFlags(tx, jobID, dsid, revalFlagsDisabled(inf)); err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("setting reval_pending after cancelling job #%d: %v", jobID, err))
+		return
+	} else if revalWarning != "" {
+		alerts.AddNewAlert(tc.WarnLevel, revalWarning)
+	}
+
+	changeLogMsg := fmt.Sprintf("%s content invalidation job - ID: %d DSXMLID: %s ASSET_URL: '%s' TTLHRs: %d (was %d) INVALIDATION: %s",
+		api.Cancelled,
+		result.ID,
+		result.DeliveryService,
+		assetURLChangeLog(inf, result.AssetURL),
+		result.TTLHours,
+		ttlHours,
+		result.InvalidationType,
+	)
+	api.CreateChangeLogRawTx(api.ApiChange, changeLogMsg, inf.User, tx)
+	api.WriteAlertsObj(w, r, http.StatusOK, alerts, result)
+}
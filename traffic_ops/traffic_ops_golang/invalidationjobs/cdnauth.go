@@ -0,0 +1,107 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/dbhelpers"
+)
+
+// cdnOutcome is what became of the jobs on one of the CDNs touched by a
+// request that spans several.
+type cdnOutcome struct {
+	// denied is why the user may not modify the CDN, or nil if they may.
+	denied error
+	// jobs is how many of the request's jobs are on the CDN.
+	jobs int
+}
+
+// cdnAuthorizer checks whether the current user may modify each of the CDNs
+// touched by a request that spans several - e.g. one that deletes jobs of many
+// Delivery Services - checking each only once. The jobs on CDNs the user may
+// not modify are meant to be skipped, rather than failing the whole request,
+// and the outcome reported per CDN.
+type cdnAuthorizer struct {
+	tx       *sql.Tx
+	user     string
+	outcomes map[string]*cdnOutcome
+}
+
+// newCDNAuthorizer returns a cdnAuthorizer for the user making the request
+// described by 'inf'.
+func newCDNAuthorizer(inf *api.APIInfo) *cdnAuthorizer {
+	return &cdnAuthorizer{
+		tx:       inf.Tx.Tx,
+		user:     inf.User.UserName,
+		outcomes: map[string]*cdnOutcome{},
+	}
+}
+
+// authorize checks whether the user may modify the named CDN - e.g. that it
+// isn't locked by someone else - on behalf of one more of the request's jobs.
+// This returns a user-facing error if they may not, or a system error if that
+// couldn't be determined.
+func (a *cdnAuthorizer) authorize(cdn string) (error, error) {
+	outcome, ok := a.outcomes[cdn]
+	if !ok {
+		userErr, sysErr, _ := dbhelpers.CheckIfCurrentUserCanModifyCDN(a.tx, cdn, a.user)
+		if sysErr != nil {
+			return nil, fmt.Errorf("checking whether user %s may modify CDN '%s': %v", a.user, cdn, sysErr)
+		}
+		outcome = &cdnOutcome{denied: tc.NewCodedError(tc.AlertCodeNotAuthorized, userErr)}
+		a.outcomes[cdn] = outcome
+	}
+	outcome.jobs++
+	return outcome.denied, nil
+}
+
+// alerts returns an alert for each CDN checked, in order by name, saying how
+// many of the request's jobs on it were - as described by 'done', e.g.
+// "deleted" - or were skipped because the user may not modify it.
+func (a *cdnAuthorizer) alerts(done string) []tc.Alert {
+	cdns := make([]string, 0, len(a.outcomes))
+	for cdn := range a.outcomes {
+		cdns = append(cdns, cdn)
+	}
+	sort.Strings(cdns)
+
+	alerts := make([]tc.Alert, 0, len(cdns))
+	for _, cdn := range cdns {
+		outcome := a.outcomes[cdn]
+		if outcome.denied == nil {
+			alerts = append(alerts, tc.Alert{
+				Text:  fmt.Sprintf("CDN '%s': %d content invalidation job(s) %s", cdn, outcome.jobs, done),
+				Level: tc.InfoLevel.String(),
+			})
+			continue
+		}
+		alerts = append(alerts, tc.Alert{
+			Text:  fmt.Sprintf("CDN '%s': skipped %d content invalidation job(s): %v", cdn, outcome.jobs, outcome.denied),
+			Level: tc.WarnLevel.String(),
+			Code:  tc.AlertCodeNotAuthorized,
+		})
+	}
+	return alerts
+}
@@ -0,0 +1,85 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+)
+
+const selectJobsCountQuery = `
+SELECT COUNT(job.id)
+FROM job
+JOIN tm_user u ON job.job_user = u.id
+JOIN deliveryservice ds ON job.job_deliveryservice = ds.id
+`
+
+// countLegacyJobs counts the jobs visible to the user's Tenant that match the
+// same query string parameters as GET requests to /jobs before API version
+// 4.0 accept. Pagination parameters are ignored.
+//
+// This returns, in order, the count, a user-facing error, a system error, and
+// an HTTP status code.
+func countLegacyJobs(inf *api.APIInfo) (uint64, error, error, int) {
+	where, _, _, queryValues, userErr, sysErr, errCode := legacyReadFilters(inf)
+	if userErr != nil || sysErr != nil {
+		return 0, userErr, sysErr, errCode
+	}
+
+	rows, err := inf.Tx.NamedQuery(selectJobsCountQuery+where, queryValues)
+	if err != nil {
+		return 0, nil, fmt.Errorf("counting jobs: %v", err), http.StatusInternalServerError
+	}
+	defer log.Close(rows, "closing job count rows")
+
+	if !rows.Next() {
+		return 0, nil, errors.New("counting jobs: no rows returned"), http.StatusInternalServerError
+	}
+	var count uint64
+	if err := rows.Scan(&count); err != nil {
+		return 0, nil, fmt.Errorf("scanning job count: %v", err), http.StatusInternalServerError
+	}
+	return count, nil, nil, http.StatusOK
+}
+
+// GetCount is the handler for GET requests to /jobs/count in API versions
+// before 4.0. It responds with the number of Content Invalidation Jobs that a
+// GET request to /jobs with the same filters would list, if it weren't
+// paginated.
+func GetCount(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, nil, nil)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+
+	count, userErr, sysErr, errCode := countLegacyJobs(inf)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	api.WriteResp(w, r, tc.InvalidationJobsCount{Count: count})
+}
@@ -0,0 +1,97 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+)
+
+// csvFields are the properties of jobs written as CSV when the 'fields' query
+// string parameter isn't given.
+var csvFields = []string{"id", "deliveryService", "assetUrl", "createdBy", "startTime", "ttlHours"}
+
+// prefersCSV tells whether the most preferred media type in the given request
+// headers' Accept header is text/csv.
+func prefersCSV(h http.Header) bool {
+	mimes, err := rfc.MimeTypesFromAccept(h.Get(rfc.Accept))
+	if err != nil || len(mimes) == 0 {
+		return false
+	}
+	return mimes[0].Name == rfc.ContentTypeTextCSV
+}
+
+// csvCell returns the CSV representation of the JSON value of a property of a
+// job: strings are written as-is, null as nothing, and anything else - e.g.
+// numbers, or the objects of labels - as JSON.
+func csvCell(value json.RawMessage) string {
+	if value == nil || string(value) == "null" {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		return s
+	}
+	return string(value)
+}
+
+// writeJobsCSV writes the given jobs - or projections of them - to w as CSV,
+// with a header line naming the given properties, and one column for each.
+func writeJobsCSV(w io.Writer, jobs []interface{}, fields []string) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(fields); err != nil {
+		return err
+	}
+	record := make([]string, len(fields))
+	for _, job := range jobs {
+		projected, err := projectFields(job, fields)
+		if err != nil {
+			return err
+		}
+		for i, field := range fields {
+			record[i] = csvCell(projected[field])
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// CSV implements the api.CSVWriter interface; it's only set after Read.
+func (job *InvalidationJobV4) CSV() bool {
+	return job.csv
+}
+
+// WriteCSV implements the api.CSVWriter interface, writing the given results
+// of Read with the properties named by the 'fields' query string parameter,
+// or csvFields if it wasn't given.
+func (job *InvalidationJobV4) WriteCSV(w io.Writer, results []interface{}) error {
+	fields := job.csvFields
+	if fields == nil {
+		fields = csvFields
+	}
+	return writeJobsCSV(w, results, fields)
+}
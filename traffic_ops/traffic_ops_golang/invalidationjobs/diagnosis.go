@@ -0,0 +1,199 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+)
+
+// revalStatuses are the Statuses of the servers that queueUpdateOrRevalQuery
+// flags; they must match revalServersCondition.
+var revalStatuses = []tc.CacheStatus{tc.CacheStatusOnline, tc.CacheStatusReported, tc.CacheStatusAdminDown}
+
+const selectDiagnosisDSQuery = `
+SELECT cdn.name
+FROM deliveryservice ds
+JOIN cdn ON cdn.id = ds.cdn_id
+WHERE ds.xml_id = $1
+`
+
+// Selects everything about the servers with the given host name that
+// revalServersCondition and queueUpdateOrRevalQuery check.
+const selectDiagnosisServersQuery = `
+SELECT s.id,
+	s.host_name,
+	cdn.name,
+	st.name,
+	p.name,
+	EXISTS (
+		SELECT 1
+		FROM profile_parameter pp
+		JOIN parameter ON parameter.id = pp.parameter
+		WHERE pp.profile = s.profile
+		AND parameter.name = 'location'
+		AND parameter.config_file = 'regex_revalidate.config'
+	)
+FROM server s
+JOIN cdn ON cdn.id = s.cdn_id
+JOIN status st ON st.id = s.status
+JOIN profile p ON p.id = s.profile
+WHERE s.host_name = $1
+ORDER BY s.id
+`
+
+// revalServer holds the properties of a server that decide whether it's
+// flagged for revalidation.
+type revalServer struct {
+	ID          int
+	HostName    string
+	CDN         string
+	Status      string
+	Profile     string
+	HasLocation bool
+}
+
+// diagnoseReval explains whether or not a job on the Delivery Service with the
+// given XMLID, on the named CDN, would flag the given server, by setting the
+// given flag, when setting flags is or isn't disabled.
+func diagnoseReval(ds string, dsCDN string, server revalServer, flag string, disabled bool) tc.InvalidationJobRevalDiagnosis {
+	diagnosis := tc.InvalidationJobRevalDiagnosis{
+		DeliveryService: ds,
+		ServerID:        server.ID,
+		HostName:        server.HostName,
+		Flag:            flag,
+		Checks:          make([]tc.InvalidationJobRevalCheck, 0, 4),
+	}
+
+	cdn := tc.InvalidationJobRevalCheck{Name: "cdn", Passed: server.CDN == dsCDN}
+	if cdn.Passed {
+		cdn.Detail = fmt.Sprintf("the server and the Delivery Service are both on CDN '%s'", dsCDN)
+	} else {
+		cdn.Detail = fmt.Sprintf("the server is on CDN '%s', but the Delivery Service is on CDN '%s'", server.CDN, dsCDN)
+	}
+
+	status := tc.InvalidationJobRevalCheck{Name: "status", Detail: fmt.Sprintf("the server's Status is '%s'", server.Status)}
+	for _, s := range revalStatuses {
+		if string(s) == server.Status {
+			status.Passed = true
+		}
+	}
+	if !status.Passed {
+		status.Detail += fmt.Sprintf("; only servers with the Statuses %v are flagged", revalStatuses)
+	}
+
+	location := tc.InvalidationJobRevalCheck{Name: "locationParameter", Passed: server.HasLocation}
+	if location.Passed {
+		location.Detail = fmt.Sprintf("the server's Profile '%s' has a 'location' Parameter for 'regex_revalidate.config'", server.Profile)
+	} else {
+		location.Detail = fmt.Sprintf("the server's Profile '%s' has no 'location' Parameter for 'regex_revalidate.config'", server.Profile)
+	}
+
+	enabled := tc.InvalidationJobRevalCheck{Name: "revalFlagsEnabled", Passed: !disabled}
+	if enabled.Passed {
+		enabled.Detail = "setting revalidation flags is enabled"
+	} else {
+		enabled.Detail = "setting revalidation flags is disabled in this Traffic Ops instance's configuration"
+	}
+
+	diagnosis.Checks = append(diagnosis.Checks, cdn, status, location, enabled)
+	diagnosis.Flagged = true
+	for _, check := range diagnosis.Checks {
+		diagnosis.Flagged = diagnosis.Flagged && check.Passed
+	}
+	return diagnosis
+}
+
+// GetRevalDiagnosis is the handler for GET requests to /jobs/reval_diagnosis in
+// API version 5.0 and later. For each server with the host name given by the
+// 'hostName' query string parameter, it explains which of the conditions for
+// being flagged for revalidation by a Content Invalidation Job on the Delivery
+// Service with the XMLID given by 'deliveryService' it meets and which it
+// doesn't. Nothing is modified.
+func GetRevalDiagnosis(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, []string{"deliveryService", "hostName"}, nil)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+	tx := inf.Tx.Tx
+
+	ds := inf.Params["deliveryService"]
+	hostName := inf.Params["hostName"]
+	noSuchDS := tc.NewCodedError(tc.AlertCodeNotFound, fmt.Errorf("delivery service \"%s\" does not exist", ds))
+
+	var dsCDN string
+	if err := tx.QueryRow(selectDiagnosisDSQuery, ds).Scan(&dsCDN); err == sql.ErrNoRows {
+		api.HandleErr(w, r, tx, http.StatusNotFound, noSuchDS, nil)
+		return
+	} else if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("getting CDN of Delivery Service '%s': %v", ds, err))
+		return
+	}
+	if ok, err := IsUserAuthorizedToViewDSXMLID(inf, ds); err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("checking user permissions on DS %s: %v", ds, err))
+		return
+	} else if !ok {
+		api.HandleErr(w, r, tx, http.StatusNotFound, noSuchDS, nil)
+		return
+	}
+
+	column, err := revalFlagColumn(tx)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("getting revalidation flag column: %v", err))
+		return
+	}
+	flag := "revalPending"
+	if column == "config_update_time" {
+		flag = "updPending"
+	}
+
+	rows, err := tx.Query(selectDiagnosisServersQuery, hostName)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("querying servers with host name '%s': %v", hostName, err))
+		return
+	}
+	defer rows.Close()
+
+	diagnoses := []tc.InvalidationJobRevalDiagnosis{}
+	for rows.Next() {
+		var server revalServer
+		if err := rows.Scan(&server.ID, &server.HostName, &server.CDN, &server.Status, &server.Profile, &server.HasLocation); err != nil {
+			api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("scanning servers with host name '%s': %v", hostName, err))
+			return
+		}
+		diagnoses = append(diagnoses, diagnoseReval(ds, dsCDN, server, flag, revalFlagsDisabled(inf)))
+	}
+	if err := rows.Err(); err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("iterating over servers with host name '%s': %v", hostName, err))
+		return
+	}
+	if len(diagnoses) == 0 {
+		api.HandleErr(w, r, tx, http.StatusNotFound, tc.NewCodedError(tc.AlertCodeNotFound, fmt.Errorf("no server with host name '%s'", hostName)), nil)
+		return
+	}
+
+	api.WriteResp(w, r, diagnoses)
+}
@@ -0,0 +1,176 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/tenant"
+
+	"github.com/lib/pq"
+)
+
+// DefaultExpiredJobRetentionDays is the number of days for which a Content
+// Invalidation Job is kept after it has expired, when a request to purge
+// expired jobs doesn't specify a retention window.
+const DefaultExpiredJobRetentionDays = 30
+
+// A job has expired once its start time plus its TTL is in the past; jobs that
+// have not yet started or are still in effect are never matched. Matches the
+// jobs that expired more than $1 days ago and before the cutoff $2 (if not
+// NULL), on Delivery Services of the Tenants $3 - and only the one with the ID
+// $4, if that isn't NULL.
+const expiredJobsCondition = `
+job.start_time + (job.ttl_hr * INTERVAL '1 hour') < LEAST(NOW() - ($1 * INTERVAL '1 day'), COALESCE($2::timestamptz, 'infinity'))
+AND job.job_deliveryservice IN (
+	SELECT deliveryservice.id
+	FROM deliveryservice
+	WHERE deliveryservice.tenant_id = ANY($3::bigint[])
+)
+AND ($4::bigint IS NULL OR job.job_deliveryservice = $4::bigint)
+`
+
+const deleteExpiredQuery = `
+DELETE
+FROM job
+WHERE ` + expiredJobsCondition
+
+const countExpiredQuery = `
+SELECT COUNT(*)
+FROM job
+WHERE ` + expiredJobsCondition
+
+// expiredJobsFilter is which expired jobs a request to purge them matches.
+type expiredJobsFilter struct {
+	retentionDays int
+	before        *time.Time
+	dsID          *int
+}
+
+// getExpiredJobsFilter reads the retentionDays, before, and deliveryServiceId
+// query string parameters of a request to purge expired jobs. Unless 'before'
+// is given, jobs must have expired more than 'retentionDays' days ago
+// (DefaultExpiredJobRetentionDays if not given); the two are mutually
+// exclusive. The returned error is suitable for showing to the user.
+func getExpiredJobsFilter(inf *api.APIInfo) (expiredJobsFilter, error) {
+	filter := expiredJobsFilter{retentionDays: DefaultExpiredJobRetentionDays}
+	days, hasDays := inf.IntParams["retentionDays"]
+	if hasDays {
+		if days < 0 {
+			return filter, errors.New("retentionDays cannot be negative")
+		}
+		filter.retentionDays = days
+	}
+	if param, ok := inf.Params["before"]; ok {
+		if hasDays {
+			return filter, errors.New("retentionDays and before are mutually exclusive")
+		}
+		before, err := time.Parse(time.RFC3339, param)
+		if err != nil {
+			return filter, errors.New("before: must be an RFC3339 timestamp")
+		}
+		filter.retentionDays = 0
+		filter.before = &before
+	}
+	if dsID, ok := inf.IntParams["deliveryServiceId"]; ok {
+		filter.dsID = &dsID
+	}
+	return filter, nil
+}
+
+// describe returns a description of the jobs the filter matches, for the
+// change log.
+func (f expiredJobsFilter) describe() string {
+	desc := fmt.Sprintf("that expired more than %d days ago", f.retentionDays)
+	if f.before != nil {
+		desc = "that expired before " + f.before.Format(time.RFC3339)
+	}
+	if f.dsID != nil {
+		desc += fmt.Sprintf(" on Delivery Service #%d", *f.dsID)
+	}
+	return desc
+}
+
+// DeleteExpired is the handler for DELETE requests to /jobs/expired in API
+// version 5.0 and later. It deletes every Content Invalidation Job - on a
+// Delivery Service within the user's Tenancy, or only the one given by
+// 'deliveryServiceId' - that expired more than 'retentionDays' days ago
+// (DefaultExpiredJobRetentionDays if not given), or before the time given by
+// 'before'. If 'dryRun' is true, the jobs are only counted, not deleted.
+func DeleteExpired(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, nil, []string{"retentionDays", "deliveryServiceId"})
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+
+	filter, err := getExpiredJobsFilter(inf)
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, err, nil)
+		return
+	}
+	dryRun, err := boolParam(inf, "dryRun")
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, err, nil)
+		return
+	}
+
+	tenantIDs, err := tenant.GetUserTenantIDListTx(inf.Tx.Tx, inf.User.TenantID)
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting tenant list for user: %v", err))
+		return
+	}
+
+	if dryRun {
+		var count uint64
+		if err := inf.Tx.Tx.QueryRow(countExpiredQuery, filter.retentionDays, filter.before, pq.Array(tenantIDs), filter.dsID).Scan(&count); err != nil {
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("counting expired jobs: %v", err))
+			return
+		}
+		msg := fmt.Sprintf("Would purge %d expired content invalidation jobs (dry run)", count)
+		api.WriteRespAlertObj(w, r, tc.InfoLevel, msg, tc.ExpiredInvalidationJobsPurged{Count: count, DryRun: true})
+		return
+	}
+
+	res, err := inf.Tx.Tx.Exec(deleteExpiredQuery, filter.retentionDays, filter.before, pq.Array(tenantIDs), filter.dsID)
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("deleting expired jobs: %v", err))
+		return
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting number of deleted expired jobs: %v", err))
+		return
+	}
+
+	if count > 0 {
+		changeLogMsg := fmt.Sprintf("%s %d content invalidation jobs %s", api.Deleted, count, filter.describe())
+		api.CreateChangeLogRawTx(api.ApiChange, changeLogMsg, inf.User, inf.Tx.Tx)
+	}
+
+	msg := fmt.Sprintf("Purged %d expired content invalidation jobs", count)
+	api.WriteRespAlertObj(w, r, tc.SuccessLevel, msg, tc.ExpiredInvalidationJobsPurged{Count: uint64(count)})
+}
@@ -0,0 +1,112 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/auth"
+)
+
+// JobExplicitOriginPermission is the Permission a user needs in order to give
+// the Origin of the Content Invalidation Jobs they create explicitly.
+const JobExplicitOriginPermission = "JOB:CREATE-EXPLICIT-ORIGIN"
+
+// parseExplicitOrigin parses the explicitly given Origin of a job, which must
+// be the base URL of an http or https Origin - a scheme, a host name or IPv4
+// address, and optionally a port - with nothing else. The returned error is
+// suitable for showing to the user.
+func parseExplicitOrigin(origin string) (originInfo, error) {
+	var o originInfo
+	invalid := errors.New("origin: must be an http or https URL with only a host and optionally a port, e.g. 'https://origin.example.com:8443'")
+	u, err := url.Parse(origin)
+	if err != nil || !u.IsAbs() || u.Hostname() == "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" || u.ForceQuery || (u.Path != "" && u.Path != "/") {
+		return o, invalid
+	}
+	if err := tc.ValidateInvalidationJobOriginProtocol(u.Scheme); err != nil {
+		return o, invalid
+	}
+	// IPv6 addresses can't be written into asset URLs unbracketed.
+	if strings.Contains(u.Hostname(), ":") {
+		return o, invalid
+	}
+	o.Protocol = u.Scheme
+	o.FQDN = strings.ToLower(u.Hostname())
+	if u.Port() != "" {
+		port, err := strconv.Atoi(u.Port())
+		if err != nil || port < 1 || port > 65535 {
+			return o, invalid
+		}
+		o.Port = &port
+	}
+	return o, nil
+}
+
+// explicitOrigin checks that the current user (identified in the APIInfo) may
+// create a Content Invalidation Job on the Delivery Service identified by
+// 'dsid' for the Origin explicitly given by the request, and returns that
+// Origin if so. That's only supported in API version 5.0 and later, requires
+// JobExplicitOriginPermission, and is only allowed for Delivery Services that
+// have no primary Origin, so that it can't be used to get around one.
+//
+// This returns, in order, the Origin, a user-facing error, a system error, and
+// an HTTP status code, as authorizeJobModification does.
+func explicitOrigin(inf *api.APIInfo, job tc.InvalidationJobCreateV4, dsid uint) (originInfo, error, error, int) {
+	if inf.Version == nil || inf.Version.Major < 5 {
+		return originInfo{}, errors.New("origin is not supported before API version 5.0"), nil, http.StatusBadRequest
+	}
+	if job.AllOrigins {
+		return originInfo{}, errors.New("origin and allOrigins are mutually exclusive"), nil, http.StatusBadRequest
+	}
+	if !(inf.Config.RoleBasedPermissions && inf.User.Can(JobExplicitOriginPermission)) && inf.User.PrivLevel != auth.PrivLevelAdmin {
+		return originInfo{}, tc.NewCodedError(tc.AlertCodeNotAuthorized, fmt.Errorf("giving the origin of jobs explicitly requires the %s Permission", JobExplicitOriginPermission)), nil, http.StatusForbidden
+	}
+
+	origin, err := parseExplicitOrigin(*job.Origin)
+	if err != nil {
+		return originInfo{}, err, nil, http.StatusBadRequest
+	}
+
+	primary, hasPrimary, err := getPrimaryOrigin(inf.Tx.Tx, dsid)
+	if err != nil {
+		return originInfo{}, nil, fmt.Errorf("getting primary Origin of Delivery Service #%d: %v", dsid, err), http.StatusInternalServerError
+	}
+	if hasPrimary {
+		return originInfo{}, tc.NewCodedError(tc.AlertCodeConflict, fmt.Errorf("delivery service \"%s\" has a primary Origin (%s); origin may only be given for Delivery Services that have none", job.DeliveryService, primary.URL())), nil, http.StatusConflict
+	}
+	return origin, nil, nil, http.StatusOK
+}
+
+// explicitOriginChangeLog returns the part of a change log entry about a newly
+// created job that records that its Origin was given explicitly, which is
+// empty if it wasn't.
+func explicitOriginChangeLog(job tc.InvalidationJobCreateV4) string {
+	if job.Origin == nil {
+		return ""
+	}
+	return " ORIGIN: explicit"
+}
@@ -0,0 +1,99 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// The names that may be given in the 'fields' query string parameter of reads
+// of jobs in API version 5.0 and later, in API version 4, and in earlier
+// versions, respectively.
+var (
+	jobV5Fields = jsonFieldNames(reflect.TypeOf(tc.InvalidationJobV5{}))
+	jobV4Fields = jsonFieldNames(reflect.TypeOf(tc.InvalidationJobV4{}))
+	jobFields   = jsonFieldNames(reflect.TypeOf(tc.InvalidationJob{}))
+)
+
+// jsonFieldNames returns the names of the JSON properties of the given struct
+// type, which are the names allowed in the 'fields' query string parameter of
+// reads of jobs of that type.
+func jsonFieldNames(t reflect.Type) map[string]struct{} {
+	names := map[string]struct{}{}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			names[name] = struct{}{}
+		}
+	}
+	return names
+}
+
+// parseFields parses the value of a 'fields' query string parameter - a
+// comma-separated list of property names - checking that each is one of the
+// allowed names. The returned error is suitable for showing to the user.
+func parseFields(param string, allowed map[string]struct{}) ([]string, error) {
+	fields := []string{}
+	unknown := []string{}
+	for _, field := range strings.Split(param, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if _, ok := allowed[field]; !ok {
+			unknown = append(unknown, field)
+			continue
+		}
+		fields = append(fields, field)
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("fields: unknown field(s): %s", strings.Join(unknown, ", "))
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("fields: must name at least one field")
+	}
+	return fields, nil
+}
+
+// projectFields returns the JSON representation of the given job restricted
+// to the named properties. Properties that the job omits - e.g. a 'comment'
+// when it has none - are omitted from the result as well.
+func projectFields(job interface{}, fields []string) (map[string]json.RawMessage, error) {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	all := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, err
+	}
+	projected := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			projected[field] = value
+		}
+	}
+	return projected, nil
+}
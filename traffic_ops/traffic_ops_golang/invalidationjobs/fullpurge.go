@@ -0,0 +1,80 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+)
+
+// fullPurgeProbes are paths of dissimilar assets; a regular expression that
+// matches all of them is taken to match every asset.
+var fullPurgeProbes = []string{
+	"/index.html",
+	"/a/b/c/d.png",
+	"/Z9_-~.%20/x.y?q=1&r=2",
+	"/.well-known/x",
+}
+
+// isCatchAllRegex tells whether the given regular expression of a job matches
+// every asset of its Origin. Rather than recognizing particular spellings,
+// this checks it against fullPurgeProbes the way that asset URLs are matched:
+// from the start of the path, but not necessarily to its end. So it catches
+// "/" as well as "/.*", "\/.+", "^/(.*)$", "(?i)/", and so on.
+func isCatchAllRegex(regex string) bool {
+	re, err := regexp.Compile("^(?:" + regex + ")")
+	if err != nil {
+		return false
+	}
+	for _, probe := range fullPurgeProbes {
+		if !re.MatchString(probe) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkFullPurge refuses a request to create or modify a job with a regular
+// expression that matches every asset of its Origin - which can overwhelm it
+// with revalidation traffic - unless the request's 'confirmFullPurge' query
+// string parameter is true. The returned error is suitable for showing to the
+// user.
+func checkFullPurge(inf *api.APIInfo, regex string) error {
+	if !isCatchAllRegex(regex) {
+		return nil
+	}
+	confirmed, err := boolParam(inf, "confirmFullPurge")
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		return fmt.Errorf("regex '%s' matches every asset of the Delivery Service's Origin, which may overwhelm it with revalidation traffic; to do that anyway, set the confirmFullPurge query string parameter to true", regex)
+	}
+	return nil
+}
+
+// checkAssetURLFullPurge is like checkFullPurge, but for an asset URL on the
+// given Origin, as a job is modified with.
+func checkAssetURLFullPurge(inf *api.APIInfo, origin originInfo, assetURL string) error {
+	return checkFullPurge(inf, strings.TrimPrefix(assetURL, origin.URL()))
+}
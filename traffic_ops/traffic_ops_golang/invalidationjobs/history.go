@@ -0,0 +1,110 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+)
+
+// Selects the change log entries whose messages match the given (POSIX)
+// regular expression, oldest first.
+const selectJobHistoryQuery = `
+SELECT l.id, l.level, l.message, u.username AS user, l.ticketnum, l.last_updated
+FROM "log" AS l
+JOIN tm_user AS u ON l.tm_user = u.id
+WHERE l.message ~ $1
+ORDER BY l.last_updated, l.id
+`
+
+// jobChangeLogPattern returns a regular expression - valid both in Go and in
+// PostgreSQL - that matches the change log messages written when the job with
+// the given ID is created, updated, or deleted.
+func jobChangeLogPattern(id uint64) string {
+	return fmt.Sprintf(`content invalidation job (\(duplicate\) )?- ID: %d( |$)`, id)
+}
+
+// jobChangeLogDSPattern extracts the Delivery Service XMLID from a job's change
+// log message; legacy API versions label it "DS", newer ones "DSXMLID".
+var jobChangeLogDSPattern = regexp.MustCompile(` DS(?:XMLID)?: (\S+)`)
+
+// GetHistory is the handler for GET requests to /jobs/{id}/history in API
+// version 5.0 and later. It responds with the change log entries recording the
+// creation, updates, and deletion of the identified Content Invalidation Job,
+// oldest first. Since the job may no longer exist, the Delivery Service whose
+// Tenancy is checked is taken from those entries.
+func GetHistory(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, []string{"id"}, []string{"id"})
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+
+	jobID := uint64(inf.IntParams["id"])
+	notFound := tc.NewCodedError(tc.AlertCodeNotFound, fmt.Errorf("No job by id '%d'!", jobID))
+
+	rows, err := inf.Tx.Tx.Query(selectJobHistoryQuery, jobChangeLogPattern(jobID))
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("querying change log of job #%d: %v", jobID, err))
+		return
+	}
+	defer rows.Close()
+
+	history := []tc.Log{}
+	ds := ""
+	for rows.Next() {
+		var entry tc.Log
+		if err := rows.Scan(&entry.ID, &entry.Level, &entry.Message, &entry.User, &entry.TicketNum, &entry.LastUpdated); err != nil {
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("scanning change log of job #%d: %v", jobID, err))
+			return
+		}
+		if entry.Message != nil {
+			if match := jobChangeLogDSPattern.FindStringSubmatch(*entry.Message); match != nil {
+				ds = match[1]
+			}
+		}
+		history = append(history, entry)
+	}
+	if err := rows.Err(); err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("iterating over change log of job #%d: %v", jobID, err))
+		return
+	}
+
+	if ds == "" {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusNotFound, notFound, nil)
+		return
+	}
+	// This also conceals the history of jobs on Delivery Services that have
+	// since been deleted, since their Tenancy can't be checked.
+	if ok, err := IsUserAuthorizedToViewDSXMLID(inf, ds); err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("checking user permissions on DS %s: %v", ds, err))
+		return
+	} else if !ok {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusNotFound, notFound, nil)
+		return
+	}
+
+	api.WriteResp(w, r, history)
+}
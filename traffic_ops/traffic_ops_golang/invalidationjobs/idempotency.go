@@ -0,0 +1,251 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+
+	"github.com/lib/pq"
+)
+
+// DefaultIdempotencyKeyTTL is how long the Idempotency-Key of a request to
+// create Content Invalidation Jobs is remembered by default.
+const DefaultIdempotencyKeyTTL = time.Hour
+
+// maxIdempotencyKeyLength is the longest allowed Idempotency-Key.
+const maxIdempotencyKeyLength = 255
+
+const deleteExpiredIdempotencyKeysQuery = `
+DELETE FROM job_idempotency_key
+WHERE tm_user = $1
+AND created < now() - ($2 * INTERVAL '1 second')
+`
+
+// Claims an Idempotency-Key for the user. If another transaction has claimed
+// the same key and hasn't finished yet, this waits for it to, so that the jobs
+// it created can be returned instead of being created again.
+const claimIdempotencyKeyQuery = `
+INSERT INTO job_idempotency_key (tm_user, idempotency_key, request_hash)
+VALUES ($1, $2, $3)
+ON CONFLICT (tm_user, idempotency_key) DO NOTHING
+`
+
+const selectIdempotencyKeyQuery = `
+SELECT request_hash, jobs
+FROM job_idempotency_key
+WHERE tm_user = $1
+AND idempotency_key = $2
+FOR UPDATE
+`
+
+const recordIdempotencyKeyQuery = `
+UPDATE job_idempotency_key
+SET request_hash = $3,
+	jobs = $4
+WHERE tm_user = $1
+AND idempotency_key = $2
+`
+
+const selectJobsByIDQuery = `
+SELECT job.id,
+	job.asset_url,
+	u.username,
+	ds.xml_id,
+	job.ttl_hr,
+	job.invalidation_type,
+	job.start_time,
+	job.recurrence_interval_hr,
+	job.recurrence_end,
+	job.comment,
+	job.priority,
+	job.labels,
+	job.approval_state,
+	(SELECT cachegroup.name FROM cachegroup WHERE cachegroup.id = job.reval_cachegroup),
+	(SELECT type.name FROM type WHERE type.id = job.reval_server_type)
+FROM job
+JOIN tm_user u ON u.id = job.job_user
+JOIN deliveryservice ds ON ds.id = job.job_deliveryservice
+WHERE job.id = ANY($1)
+ORDER BY job.id
+`
+
+// idempotencyKey is an Idempotency-Key claimed by a request to create Content
+// Invalidation Jobs.
+type idempotencyKey struct {
+	userID int
+	key    string
+	hash   string
+}
+
+// idempotencyKeyTTL returns how long Idempotency-Keys are remembered,
+// according to the configuration.
+func idempotencyKeyTTL(inf *api.APIInfo) time.Duration {
+	if inf.Config != nil && inf.Config.Jobs.IdempotencyKeyTTLSec > 0 {
+		return time.Duration(inf.Config.Jobs.IdempotencyKeyTTLSec) * time.Second
+	}
+	return DefaultIdempotencyKeyTTL
+}
+
+// requestHash returns a digest of a request to create Content Invalidation
+// Jobs, so that reuses of an Idempotency-Key for different requests can be
+// told apart from retries.
+func requestHash(job tc.InvalidationJobCreateV4) (string, error) {
+	// A start time resolved from startIn or immediate differs between
+	// retries of the same request.
+	if job.StartIn != nil || job.Immediate {
+		job.StartTime = time.Time{}
+	}
+	b, err := json.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// claimIdempotencyKey reads the Idempotency-Key header of a request to create
+// Content Invalidation Jobs - which is only supported in API version 5.0 and
+// later - and claims it for the requesting user. If the user already used the
+// key, within its TTL, for a request that created jobs, those jobs are
+// returned, and no new ones should be created. Otherwise, the returned key -
+// which is nil if none was given - should record the jobs that are created.
+//
+// This returns, in order, the key, the existing jobs, a user-facing error, a
+// system error, and an HTTP status code, as authorizeJobModification does.
+func claimIdempotencyKey(inf *api.APIInfo, r *http.Request, job tc.InvalidationJobCreateV4) (*idempotencyKey, []tc.InvalidationJobV5, error, error, int) {
+	header := r.Header.Get(rfc.IdempotencyKey)
+	if header == "" || inf.Version == nil || inf.Version.Major < 5 {
+		return nil, nil, nil, nil, http.StatusOK
+	}
+	if len(header) > maxIdempotencyKeyLength {
+		return nil, nil, fmt.Errorf("%s must be no longer than %d characters", rfc.IdempotencyKey, maxIdempotencyKeyLength), nil, http.StatusBadRequest
+	}
+	hash, err := requestHash(job)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("hashing request: %v", err), http.StatusInternalServerError
+	}
+	key := &idempotencyKey{userID: inf.User.ID, key: header, hash: hash}
+
+	tx := inf.Tx.Tx
+	if _, err := tx.Exec(deleteExpiredIdempotencyKeysQuery, key.userID, idempotencyKeyTTL(inf).Seconds()); err != nil {
+		return nil, nil, nil, fmt.Errorf("deleting expired Idempotency-Keys: %v", err), http.StatusInternalServerError
+	}
+	if _, err := tx.Exec(claimIdempotencyKeyQuery, key.userID, key.key, key.hash); err != nil {
+		return nil, nil, nil, fmt.Errorf("claiming Idempotency-Key: %v", err), http.StatusInternalServerError
+	}
+	var storedHash string
+	var ids []int64
+	if err := tx.QueryRow(selectIdempotencyKeyQuery, key.userID, key.key).Scan(&storedHash, pq.Array(&ids)); err != nil {
+		return nil, nil, nil, fmt.Errorf("getting Idempotency-Key: %v", err), http.StatusInternalServerError
+	}
+	// A request that created nothing - e.g. because of ifNotExists - may
+	// simply be repeated.
+	if len(ids) == 0 {
+		return key, nil, nil, nil, http.StatusOK
+	}
+	if storedHash != key.hash {
+		return nil, nil, tc.NewCodedError(tc.AlertCodeConflict, fmt.Errorf("%s was already used for a different request", rfc.IdempotencyKey)), nil, http.StatusUnprocessableEntity
+	}
+
+	existing, err := getJobsByID(tx, ids)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("getting jobs created with Idempotency-Key: %v", err), http.StatusInternalServerError
+	}
+	if len(existing) == 0 {
+		return nil, nil, tc.NewCodedError(tc.AlertCodeConflict, errors.New("the jobs created by the request with this "+rfc.IdempotencyKey+" have since been deleted")), nil, http.StatusConflict
+	}
+	return key, existing, nil, nil, http.StatusOK
+}
+
+// record remembers that the identified jobs were created by the request that
+// claimed the key. It does nothing if the key is nil.
+func (k *idempotencyKey) record(tx *sql.Tx, ids ...uint64) error {
+	if k == nil {
+		return nil
+	}
+	_, err := tx.Exec(recordIdempotencyKeyQuery, k.userID, k.key, k.hash, pq.Array(ids))
+	return err
+}
+
+// getJobsByID returns the identified jobs that still exist, in order of ID.
+func getJobsByID(tx *sql.Tx, ids []int64) ([]tc.InvalidationJobV5, error) {
+	rows, err := tx.Query(selectJobsByIDQuery, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []tc.InvalidationJobV5{}
+	for rows.Next() {
+		var job tc.InvalidationJobV5
+		var recurrence recurrenceColumns
+		err := rows.Scan(&job.ID,
+			&job.AssetURL,
+			&job.CreatedBy,
+			&job.DeliveryService,
+			&job.TTLHours,
+			&job.InvalidationType,
+			&job.StartTime,
+			&recurrence.IntervalHours,
+			&recurrence.End,
+			&job.Comment,
+			&job.Priority,
+			labelsColumn{&job.Labels},
+			&job.ApprovalState,
+			&job.CacheGroup,
+			&job.ServerType)
+		if err != nil {
+			return nil, err
+		}
+		job.Recurrence, job.NextRun = recurrence.value(job.StartTime)
+		job.EndTime = jobEndTime(job.StartTime, job.TTLHours)
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// writeIdempotentReplay writes the response to a retried request to create
+// Content Invalidation Jobs, which is the jobs the original request created:
+// all of them if it was for allOrigins, and otherwise the only one.
+func writeIdempotentReplay(w http.ResponseWriter, r *http.Request, inf *api.APIInfo, job tc.InvalidationJobCreateV4, existing []tc.InvalidationJobV5) {
+	alerts := tc.Alerts{}
+	alerts.AddAlert(tc.Alert{
+		Text:  fmt.Sprintf("this %s was already used to create the requested Content Invalidation Jobs; no new jobs were created", rfc.IdempotencyKey),
+		Level: tc.InfoLevel.String(),
+		Code:  tc.AlertCodeAlreadyExists,
+	})
+	if job.AllOrigins {
+		api.WriteAlertsObj(w, r, http.StatusOK, alerts, existing)
+		return
+	}
+	w.Header().Set(http.CanonicalHeaderKey("location"), jobLocation(inf, r, existing[0].ID))
+	api.WriteAlertsObj(w, r, http.StatusOK, alerts, existing[0])
+}
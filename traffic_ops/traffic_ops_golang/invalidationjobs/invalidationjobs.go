@@ -20,12 +20,18 @@ package invalidationjobs
  */
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -35,6 +41,7 @@ import (
 	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/lib/go-util"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/auth"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/dbhelpers"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/tenant"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/util/ims"
@@ -53,6 +60,16 @@ type InvalidationJob struct {
 type InvalidationJobV4 struct {
 	api.APIInfoImpl `json:"-"`
 	tc.InvalidationJobV4
+	etag string
+	// csv is whether Read's results are to be written as CSV, with the
+	// properties csvFields names, if it isn't nil.
+	csv       bool
+	csvFields []string
+}
+
+// ETag implements the api.ETagger interface; it's only set after Read.
+func (job *InvalidationJobV4) ETag() string {
+	return job.etag
 }
 
 // Deprecated, only to be used with versions below 4.0
@@ -64,7 +81,12 @@ INSERT INTO job (
 	entered_time,
 	job_user,
 	job_deliveryservice,
-	invalidation_type)
+	invalidation_type,
+	recurrence_interval_hr,
+	recurrence_end,
+	comment,
+	priority,
+	labels)
 VALUES (
 	$1,
 	(
@@ -77,7 +99,12 @@ VALUES (
 	$5,
 	$6,
 	$7,
-	$8
+	$8,
+	$9,
+	$10,
+	$11,
+	$12,
+	$13::jsonb
 )
 RETURNING
 	asset_url,
@@ -91,7 +118,7 @@ RETURNING
 		FROM tm_user
 		WHERE tm_user.id=job_user) AS createdBy,
 	'PURGE' AS keyword,
-	CONCAT('TTL:', ttl_hr, 'h') AS parameters,
+	ttl_hr AS parameters,
 	start_time
 `
 
@@ -104,7 +131,12 @@ INSERT INTO job (
 	entered_time,
 	job_user,
 	job_deliveryservice,
-	invalidation_type)
+	invalidation_type,
+	recurrence_interval_hr,
+	recurrence_end,
+	comment,
+	priority,
+	labels)
 VALUES (
 	$1,
 	(
@@ -117,7 +149,12 @@ VALUES (
 	$5,
 	$6,
 	$7,
-	$8
+	$8,
+	$9,
+	$10,
+	$11,
+	$12,
+	$13::jsonb
 )
 RETURNING
 	id,
@@ -132,13 +169,19 @@ RETURNING
 		WHERE deliveryservice.id=job_deliveryservice) AS deliveryServiceXML,
 	ttl_hr as ttlHrs,
 	invalidation_type as invalidationType,
-	start_time as startTime
+	start_time as startTime,
+	recurrence_interval_hr,
+	recurrence_end,
+	comment,
+	priority,
+	labels
 `
 
-const queueUpdateOrRevalQuery = `
-UPDATE public.server
-SET %s = now()
-WHERE server.status IN (
+// revalServersCondition is the condition that the servers flagged for
+// revalidation by queueUpdateOrRevalQuery must meet - besides being on the CDN
+// of the Delivery Service in question, and within the job's revalScope.
+const revalServersCondition = `
+server.status IN (
 		SELECT status.id
 		FROM status
 		WHERE name IN ('ONLINE', 'REPORTED', 'ADMIN_DOWN')
@@ -153,11 +196,19 @@ WHERE server.status IN (
 			AND parameter.config_file='regex_revalidate.config'
 			)
 		)
+`
+
+const queueUpdateOrRevalQuery = `
+UPDATE public.server
+SET %s = now()
+WHERE ` + revalServersCondition + `
      AND server.cdn_id  =  (
 		SELECT deliveryservice.cdn_id
 		FROM deliveryservice
 		WHERE deliveryservice.%s=$1
-		);
+		)
+     AND ($2::bigint IS NULL OR server.cachegroup = $2::bigint)
+     AND ($3::bigint IS NULL OR server.type = $3::bigint)
 `
 
 const updateQuery = `
@@ -179,10 +230,21 @@ RETURNING asset_url,
 	) AS delivery_service,
 	job.id,
 	'PURGE' as keyword,
-	CONCAT('TTL:', ttl_hr, 'h') AS parameters,
+	ttl_hr AS parameters,
 	start_time
 `
 
+// lockDSCDNQuery gets the name of the CDN to which a Delivery Service belongs,
+// and prevents the Delivery Service from being moved to a different CDN for the
+// remainder of the transaction.
+const lockDSCDNQuery = `
+SELECT cdn.name
+FROM deliveryservice
+JOIN cdn ON cdn.id = deliveryservice.cdn_id
+WHERE deliveryservice.id=$1
+FOR SHARE OF deliveryservice
+`
+
 // Almost the same as updateQuery, but returns appropriate values for API 4.0+
 const updateQueryV4 = `
 UPDATE job
@@ -205,7 +267,8 @@ RETURNING asset_url,
 	job.id,
 	ttl_hr,
 	start_time,
-	invalidation_type
+	invalidation_type,
+	priority
 `
 
 // Deprecated, only to be used with versions below 4.0
@@ -216,9 +279,11 @@ SELECT job.id AS id,
 	job.job_deliveryservice AS dsid,
 	deliveryservice.xml_id AS dsxmlid,
 	job.asset_url AS assetURL,
-	CONCAT('TTL:', ttl_hr, 'h') AS parameters,
+	ttl_hr AS parameters,
 	job.start_time AS start_time,
-	origin.protocol || '://' || origin.fqdn || rtrim(concat(':', origin.port), ':') AS OFQDN
+	origin.protocol AS originProtocol,
+	origin.fqdn AS originFQDN,
+	origin.port AS originPort
 FROM job
 INNER JOIN origin ON origin.deliveryservice=job.job_deliveryservice AND origin.is_primary
 INNER JOIN tm_user ON tm_user.id=job.job_user
@@ -237,7 +302,9 @@ SELECT job.id AS id,
 	job.ttl_hr AS ttlhrs,
 	job.start_time AS start_time,
 	job.invalidation_type as invalidationType,
-	origin.protocol || '://' || origin.fqdn || rtrim(concat(':', origin.port), ':') AS OFQDN
+	origin.protocol AS originProtocol,
+	origin.fqdn AS originFQDN,
+	origin.port AS originPort
 FROM job
 INNER JOIN origin ON origin.deliveryservice=job.job_deliveryservice AND origin.is_primary
 INNER JOIN tm_user ON tm_user.id=job.job_user
@@ -263,7 +330,7 @@ RETURNING job.asset_url,
 	) AS deliveryservice,
 	job.id,
 	'PURGE' as keyword,
-	CONCAT('TTL:', ttl_hr, 'h') AS parameters,
+	ttl_hr AS parameters,
 	job.start_time
 `
 
@@ -287,9 +354,48 @@ RETURNING
 	) AS deliveryservice,
 	ttl_hr,
 	job.invalidation_type,
-	job.start_time
+	job.start_time,
+	job.priority
 `
 
+// originInfo holds the parts of a Delivery Service's primary Origin needed to
+// check a Content Invalidation Job's asset URL against it.
+type originInfo struct {
+	Protocol string
+	FQDN     string
+	Port     *int
+}
+
+// URL returns the URL of the Origin, as used as the prefix of asset URLs.
+func (o originInfo) URL() string {
+	return tc.BuildAssetURL(o.Protocol, o.FQDN, o.Port, "")
+}
+
+// validate checks that asset URLs can be built from the Origin: that its
+// protocol is supported, and that its port - if it has one - is in range.
+// Both come from the Origin's stored data, so this guards against that being
+// bad rather than against bad requests.
+func (o originInfo) validate() error {
+	if err := tc.ValidateInvalidationJobOriginProtocol(o.Protocol); err != nil {
+		return err
+	}
+	return tc.ValidateInvalidationJobOriginPort(o.Port)
+}
+
+// matches returns whether or not the given asset URL refers to the Origin,
+// i.e. it starts with the Origin's URL and that's followed by either nothing
+// or a path (which, being a regular expression, may have its leading slash
+// escaped). This stops e.g. "http://origin.example" from matching an asset
+// URL on "http://origin.example.evil".
+func (o originInfo) matches(assetURL string) bool {
+	prefix := o.URL()
+	if !strings.HasPrefix(assetURL, prefix) {
+		return false
+	}
+	rest := assetURL[len(prefix):]
+	return rest == "" || strings.HasPrefix(rest, "/") || strings.HasPrefix(rest, `\/`)
+}
+
 type apiResponse struct {
 	Alerts   []tc.Alert         `json:"alerts,omitempty"`
 	Response tc.InvalidationJob `json:"response,omitempty"`
@@ -300,6 +406,74 @@ type apiResponseV4 struct {
 	Response tc.InvalidationJobV4 `json:"response,omitempty"`
 }
 
+type apiResponseV5 struct {
+	Alerts   []tc.Alert           `json:"alerts,omitempty"`
+	Response tc.InvalidationJobV5 `json:"response,omitempty"`
+}
+
+// newAPIResponse returns the response to a request that acted on the given
+// job, which represents it as the API version of the request does.
+func newAPIResponse(inf *api.APIInfo, alerts []tc.Alert, job tc.InvalidationJobV5) interface{} {
+	if inf.Version == nil || inf.Version.Major < 5 {
+		return apiResponseV4{alerts, job.Downgrade()}
+	}
+	return apiResponseV5{alerts, job}
+}
+
+// selectETagInfoQuery selects everything that determines whether the jobs
+// matched by 'where' could have changed: how many there are, the last time
+// any of them or their Delivery Services (whose Tenants decide visibility)
+// changed, and the last time any job was deleted.
+func selectETagInfoQuery(where string) string {
+	return `SELECT COUNT(job.id),
+	COALESCE(MAX(job.last_updated), 'epoch'),
+	COALESCE(MAX(ds.last_updated), 'epoch'),
+	(SELECT COALESCE(MAX(l.last_updated), 'epoch') FROM last_deleted l WHERE l.table_name='job'),
+	COALESCE(md5(string_agg(job.id::text, ',' ORDER BY job.id)), ''),
+	COALESCE(md5(string_agg(job.id::text, ',' ORDER BY job.id) FILTER (WHERE job.approval_state = 'APPROVED' AND ` + jobActiveCondition + `)), '')
+FROM job
+JOIN tm_user u ON job.job_user = u.id
+JOIN deliveryservice ds ON job.job_deliveryservice = ds.id ` + where
+}
+
+// readETag computes a strong ETag for the jobs matched by 'where', written as
+// CSV or not, which changes whenever the result of the same request by the
+// same user could.
+func readETag(inf *api.APIInfo, where string, queryValues map[string]interface{}, tenants []int, asCSV bool) (string, error) {
+	rows, err := inf.Tx.NamedQuery(selectETagInfoQuery(where), queryValues)
+	if err != nil {
+		return "", err
+	}
+	defer log.Close(rows, "closing ETag info rows")
+
+	if !rows.Next() {
+		return "", errors.New("no rows returned")
+	}
+	var count uint64
+	var maxJob, maxDS, maxDeleted time.Time
+	// Which jobs match - and which of them are active - can change with
+	// nothing being modified, as time passes.
+	var matched, active string
+	if err := rows.Scan(&count, &maxJob, &maxDS, &maxDeleted, &matched, &active); err != nil {
+		return "", err
+	}
+
+	params := make([]string, 0, len(inf.Params))
+	for k, v := range inf.Params {
+		params = append(params, k+"="+v)
+	}
+	sort.Strings(params)
+	sortedTenants := append([]int(nil), tenants...)
+	sort.Ints(sortedTenants)
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d|%d|%d|%d|%s|%s|%v|%s", count, maxJob.UnixNano(), maxDS.UnixNano(), maxDeleted.UnixNano(), matched, active, sortedTenants, strings.Join(params, "&"))
+	if asCSV {
+		fmt.Fprint(hash, "|csv")
+	}
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`, nil
+}
+
 func selectMaxLastUpdatedQuery(where string) string {
 	return `SELECT max(t) from (
 		SELECT max(job.last_updated) as t FROM job
@@ -313,7 +487,7 @@ func selectMaxLastUpdatedQuery(where string) string {
 const readQuery = `
 SELECT job.id,
 	'PURGE' AS keyword,
-	CONCAT('TTL::', ttl_hr, 'h') AS parameters,
+	ttl_hr AS parameters,
 	asset_url,
 	start_time,
 	u.username as createdBy,
@@ -331,15 +505,59 @@ SELECT job.id,
 	ds.xml_id,
 	ttl_hr,
 	invalidation_type,
-	start_time
+	start_time,
+	job.recurrence_interval_hr,
+	job.recurrence_end,
+	job.last_updated,
+	job.comment,
+	job.priority,
+	job.labels,
+	job.approval_state,
+	(SELECT cachegroup.name FROM cachegroup WHERE cachegroup.id = job.reval_cachegroup),
+	(SELECT type.name FROM type WHERE type.id = job.reval_server_type),
+	(job.approval_state = 'APPROVED' AND ` + jobActiveCondition + `)
 FROM job
 JOIN tm_user u ON job.job_user = u.id
 JOIN deliveryservice ds ON job.job_deliveryservice = ds.id
 `
 
+// jobEndTimeColumn is the SQL expression for the time at which a job stops
+// being in effect, by which jobs may be ordered and filtered.
+const jobEndTimeColumn = `(job.start_time + (job.ttl_hr * INTERVAL '1 hour'))`
+
+// isRFC3339 checks that the value of a query string parameter is a time in
+// RFC3339 format.
+func isRFC3339(s string) error {
+	if _, err := time.Parse(time.RFC3339, s); err != nil {
+		return errors.New("must be a time in RFC3339 format")
+	}
+	return nil
+}
+
+// startingWithinFilter returns the condition to add to the WHERE clause of a
+// query for jobs to implement the 'startingWithin' query string parameter -
+// which is only supported in API version 5.0 and later - adding the named
+// parameter it uses to queryValues. It matches the jobs that start between now
+// and the given duration (e.g. "1h") from now, by the database's clock. The
+// returned error is suitable for showing to the user.
+func startingWithinFilter(inf *api.APIInfo, queryValues map[string]interface{}) (string, error) {
+	param, ok := inf.Params["startingWithin"]
+	if !ok || inf.Version == nil || inf.Version.Major < 5 {
+		return "", nil
+	}
+	d, err := time.ParseDuration(param)
+	if err != nil || d <= 0 {
+		return "", errors.New("startingWithin: must be a positive duration, e.g. '1h' or '30m'")
+	}
+	queryValues["startingWithin"] = d.Seconds()
+	return ` AND job.start_time BETWEEN NOW() AND NOW() + (:startingWithin * INTERVAL '1 second') `, nil
+}
+
 // Used by GET requests to `/jobs`, simply returns a filtered list of
 // content invalidation jobs according to the provided query parameters.
 func (job *InvalidationJobV4) Read(h http.Header, useIMS bool) ([]interface{}, error, error, int, *time.Time) {
+	logger := newJobLogger(job.APIInfo(), "InvalidationJobV4.Read")
+	version := job.APIInfo().Version
 	var maxTime time.Time
 	var runSecond bool
 	queryParamsToSQLCols := map[string]dbhelpers.WhereColumnInfo{
@@ -352,11 +570,36 @@ func (job *InvalidationJobV4) Read(h http.Header, useIMS bool) ([]interface{}, e
 		"dsId":             dbhelpers.WhereColumnInfo{Column: "job.job_deliveryservice", Checker: api.IsInt},
 		"invalidationType": dbhelpers.WhereColumnInfo{Column: "invalidation_type"},
 	}
+	if version != nil && version.Major >= 5 {
+		queryParamsToSQLCols["endTime"] = dbhelpers.WhereColumnInfo{Column: jobEndTimeColumn, Checker: isRFC3339}
+	}
 
 	where, orderBy, pagination, queryValues, errs := dbhelpers.BuildWhereAndOrderByAndPagination(job.APIInfo().Params, queryParamsToSQLCols)
 	if len(errs) > 0 {
 		return nil, util.JoinErrs(errs), nil, http.StatusBadRequest, nil
 	}
+	if orderBy != "" {
+		// Jobs often share start times - and so end times - so without a
+		// tiebreaker their order, and so which are on which page, could
+		// change from one request to the next.
+		orderBy += ", job.id"
+	}
+
+	var fields []string
+	var err error
+	if param, ok := job.APIInfo().Params["fields"]; ok {
+		allowed := jobV4Fields
+		if version != nil && version.Major >= 5 {
+			allowed = jobV5Fields
+		}
+		if fields, err = parseFields(param, allowed); err != nil {
+			return nil, err, nil, http.StatusBadRequest, nil
+		}
+	}
+	if version != nil && version.Major >= 5 && prefersCSV(h) {
+		job.csv = true
+		job.csvFields = fields
+	}
 
 	accessibleTenants, err := tenant.GetUserTenantIDListTx(job.APIInfo().Tx.Tx, job.APIInfo().User.TenantID)
 	if err != nil {
@@ -367,6 +610,18 @@ func (job *InvalidationJobV4) Read(h http.Header, useIMS bool) ([]interface{}, e
 		queryValues["cdn"] = cdnName
 		cdn = ` AND ds.cdn_id = (SELECT id FROM cdn WHERE name = :cdn) `
 	}
+	labels, err := labelFilter(job.APIInfo().Params, queryValues)
+	if err != nil {
+		return nil, err, nil, http.StatusBadRequest, nil
+	}
+	approval, err := approvalFilter(job.APIInfo(), queryValues)
+	if err != nil {
+		return nil, err, nil, http.StatusBadRequest, nil
+	}
+	startingWithin, err := startingWithinFilter(job.APIInfo(), queryValues)
+	if err != nil {
+		return nil, err, nil, http.StatusBadRequest, nil
+	}
 	maxDays := ""
 	if _, ok := job.APIInfo().Params["maxRevalDurationDays"]; ok {
 		// jobs started within the last $maxRevalDurationDays days (defaulting to 90 days if the parameter doesn't exist)
@@ -381,27 +636,39 @@ func (job *InvalidationJobV4) Read(h http.Header, useIMS bool) ([]interface{}, e
                                                        || ' days' AS INTERVAL) `
 	}
 	if len(where) > 0 {
-		where += " AND ds.tenant_id = ANY(:tenants) " + maxDays + cdn
+		where += " AND ds.tenant_id = ANY(:tenants) " + maxDays + cdn + labels + approval + startingWithin
 	} else {
-		where = dbhelpers.BaseWhere + " ds.tenant_id = ANY(:tenants) " + maxDays + cdn
+		where = dbhelpers.BaseWhere + " ds.tenant_id = ANY(:tenants) " + maxDays + cdn + labels + approval + startingWithin
 	}
 	queryValues["tenants"] = pq.Array(accessibleTenants)
 
+	if version != nil && version.Major >= 5 {
+		job.etag, err = readETag(job.APIInfo(), where, queryValues, accessibleTenants, job.csv)
+		if err != nil {
+			return nil, nil, fmt.Errorf("computing ETag: %v", err), http.StatusInternalServerError, nil
+		}
+		if rfc.ETagMatchesIfNoneMatch(h, job.etag) {
+			return []interface{}{}, nil, nil, http.StatusNotModified, nil
+		}
+	}
+
 	if useIMS {
 		runSecond, maxTime = ims.TryIfModifiedSinceQuery(job.APIInfo().Tx, h, queryValues, selectMaxLastUpdatedQuery(where))
 		if !runSecond {
-			log.Debugln("IMS HIT")
+			logger.Debugf("event=ims_hit")
 			return []interface{}{}, nil, nil, http.StatusNotModified, &maxTime
 		}
-		log.Debugln("IMS MISS")
+		logger.Debugf("event=ims_miss")
 	} else {
-		log.Debugln("Non IMS request")
+		logger.Debugf("event=non_ims_request")
 	}
 
 	query := readQueryV4 + where + orderBy + pagination
-	log.Debugln("generated job query: " + query)
-	log.Debugf("executing with values: %++v\n", queryValues)
+	logger.Debugf("event=query_generated %s", kv("query", query))
+	logger.Debugf("event=query_executing values=%+v", queryValues)
 
+	// Never nil, so that no matches are serialized as an empty array rather
+	// than null.
 	returnable := []interface{}{}
 	rows, err := job.APIInfo().Tx.NamedQuery(query, queryValues)
 	if err != nil {
@@ -410,34 +677,62 @@ func (job *InvalidationJobV4) Read(h http.Header, useIMS bool) ([]interface{}, e
 	defer rows.Close()
 
 	for rows.Next() {
-		job := tc.InvalidationJobV4{}
+		job := tc.InvalidationJobV5{}
+		var recurrence recurrenceColumns
+		var active bool
 		if err := rows.Scan(&job.ID,
 			&job.AssetURL,
 			&job.CreatedBy,
 			&job.DeliveryService,
 			&job.TTLHours,
 			&job.InvalidationType,
-			&job.StartTime); err != nil {
+			&job.StartTime,
+			&recurrence.IntervalHours,
+			&recurrence.End,
+			&job.LastUpdated,
+			&job.Comment,
+			&job.Priority,
+			labelsColumn{&job.Labels},
+			&job.ApprovalState,
+			&job.CacheGroup,
+			&job.ServerType,
+			&active); err != nil {
 			return nil, nil, fmt.Errorf("parsing db response: %v", err), http.StatusInternalServerError, nil
 		}
+		job.Recurrence, job.NextRun = recurrence.value(job.StartTime)
+		var versioned interface{} = job.Downgrade()
+		if version != nil && version.Major >= 5 {
+			job.Active = util.BoolPtr(active)
+			versioned = job
+		}
 
-		returnable = append(returnable, job)
+		if fields != nil {
+			projected, err := projectFields(versioned, fields)
+			if err != nil {
+				return nil, nil, fmt.Errorf("projecting fields of job #%d: %v", job.ID, err), http.StatusInternalServerError, nil
+			}
+			returnable = append(returnable, projected)
+			continue
+		}
+		returnable = append(returnable, versioned)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, nil, fmt.Errorf("Parsing db responses: %v", err), http.StatusInternalServerError, nil
 	}
 
+	logger.Debugf("event=read_complete jobs=%d", len(returnable))
 	return returnable, nil, nil, http.StatusOK, &maxTime
 }
 
-// Used by GET requests to `/jobs`, simply returns a filtered list of
-// content invalidation jobs according to the provided query parameters.
+// legacyReadFilters builds the WHERE, ORDER BY, and pagination clauses - and
+// the values of their named parameters - that select the jobs matching the
+// query string parameters of a request before API version 4.0, limited to
+// those visible to the user's Tenant.
 //
-// Deprecated. To be used only with versions less than 4.0
-func (job *InvalidationJob) Read(h http.Header, useIMS bool) ([]interface{}, error, error, int, *time.Time) {
-	var maxTime time.Time
-	var runSecond bool
+// This returns, in order, the clauses, the parameter values, a user-facing
+// error, a system error, and an HTTP status code.
+func legacyReadFilters(inf *api.APIInfo) (string, string, string, map[string]interface{}, error, error, int) {
 	queryParamsToSQLCols := map[string]dbhelpers.WhereColumnInfo{
 		"id":              dbhelpers.WhereColumnInfo{Column: "job.id", Checker: api.IsInt},
 		"keyword":         dbhelpers.WhereColumnInfo{Column: "keyword"},
@@ -449,22 +744,30 @@ func (job *InvalidationJob) Read(h http.Header, useIMS bool) ([]interface{}, err
 		"dsId":            dbhelpers.WhereColumnInfo{Column: "job.job_deliveryservice", Checker: api.IsInt},
 	}
 
-	where, orderBy, pagination, queryValues, errs := dbhelpers.BuildWhereAndOrderByAndPagination(job.APIInfo().Params, queryParamsToSQLCols)
+	where, orderBy, pagination, queryValues, errs := dbhelpers.BuildWhereAndOrderByAndPagination(inf.Params, queryParamsToSQLCols)
 	if len(errs) > 0 {
-		return nil, util.JoinErrs(errs), nil, http.StatusBadRequest, nil
+		return "", "", "", nil, util.JoinErrs(errs), nil, http.StatusBadRequest
 	}
 
-	accessibleTenants, err := tenant.GetUserTenantIDListTx(job.APIInfo().Tx.Tx, job.APIInfo().User.TenantID)
+	accessibleTenants, err := tenant.GetUserTenantIDListTx(inf.Tx.Tx, inf.User.TenantID)
 	if err != nil {
-		return nil, nil, fmt.Errorf("getting accessible tenants for user - %v", err), http.StatusInternalServerError, nil
+		return "", "", "", nil, nil, fmt.Errorf("getting accessible tenants for user - %v", err), http.StatusInternalServerError
 	}
 	cdn := ""
-	if cdnName, ok := job.APIInfo().Params["cdn"]; ok {
+	if cdnName, ok := inf.Params["cdn"]; ok {
 		queryValues["cdn"] = cdnName
 		cdn = ` AND ds.cdn_id = (SELECT id FROM cdn WHERE name = :cdn) `
 	}
+	labels, err := labelFilter(inf.Params, queryValues)
+	if err != nil {
+		return "", "", "", nil, err, nil, http.StatusBadRequest
+	}
+	approval, err := approvalFilter(inf, queryValues)
+	if err != nil {
+		return "", "", "", nil, err, nil, http.StatusBadRequest
+	}
 	maxDays := ""
-	if _, ok := job.APIInfo().Params["maxRevalDurationDays"]; ok {
+	if _, ok := inf.Params["maxRevalDurationDays"]; ok {
 		// jobs started within the last $maxRevalDurationDays days (defaulting to 90 days if the parameter doesn't exist)
 		maxDays = ` AND job.start_time >= NOW() - CAST(
                                                        (SELECT COALESCE(
@@ -477,27 +780,53 @@ func (job *InvalidationJob) Read(h http.Header, useIMS bool) ([]interface{}, err
                                                        || ' days' AS INTERVAL) `
 	}
 	if len(where) > 0 {
-		where += " AND ds.tenant_id = ANY(:tenants) " + maxDays + cdn
+		where += " AND ds.tenant_id = ANY(:tenants) " + maxDays + cdn + labels + approval
 	} else {
-		where = dbhelpers.BaseWhere + " ds.tenant_id = ANY(:tenants) " + maxDays + cdn
+		where = dbhelpers.BaseWhere + " ds.tenant_id = ANY(:tenants) " + maxDays + cdn + labels + approval
 	}
 	queryValues["tenants"] = pq.Array(accessibleTenants)
 
+	return where, orderBy, pagination, queryValues, nil, nil, http.StatusOK
+}
+
+// Used by GET requests to `/jobs`, simply returns a filtered list of
+// content invalidation jobs according to the provided query parameters.
+//
+// Deprecated. To be used only with versions less than 4.0
+func (job *InvalidationJob) Read(h http.Header, useIMS bool) ([]interface{}, error, error, int, *time.Time) {
+	logger := newJobLogger(job.APIInfo(), "InvalidationJob.Read")
+	var maxTime time.Time
+	var runSecond bool
+	where, orderBy, pagination, queryValues, userErr, sysErr, errCode := legacyReadFilters(job.APIInfo())
+	if userErr != nil || sysErr != nil {
+		return nil, userErr, sysErr, errCode, nil
+	}
+
+	var fields []string
+	var err error
+	if param, ok := job.APIInfo().Params["fields"]; ok {
+		if fields, err = parseFields(param, jobFields); err != nil {
+			return nil, err, nil, http.StatusBadRequest, nil
+		}
+	}
+
 	if useIMS {
 		runSecond, maxTime = ims.TryIfModifiedSinceQuery(job.APIInfo().Tx, h, queryValues, selectMaxLastUpdatedQuery(where))
 		if !runSecond {
-			log.Debugln("IMS HIT")
+			logger.Debugf("event=ims_hit")
 			return []interface{}{}, nil, nil, http.StatusNotModified, &maxTime
 		}
-		log.Debugln("IMS MISS")
+		logger.Debugf("event=ims_miss")
 	} else {
-		log.Debugln("Non IMS request")
+		logger.Debugf("event=non_ims_request")
 	}
 
 	query := readQuery + where + orderBy + pagination
-	log.Debugln("generated job query: " + query)
-	log.Debugf("executing with values: %++v\n", queryValues)
+	logger.Debugf("event=query_generated %s", kv("query", query))
+	logger.Debugf("event=query_executing values=%+v", queryValues)
 
+	// Never nil, so that no matches are serialized as an empty array rather
+	// than null.
 	returnable := []interface{}{}
 	rows, err := job.APIInfo().Tx.NamedQuery(query, queryValues)
 	if err != nil {
@@ -509,7 +838,7 @@ func (job *InvalidationJob) Read(h http.Header, useIMS bool) ([]interface{}, err
 		j := tc.InvalidationJob{}
 		err := rows.Scan(&j.ID,
 			&j.Keyword,
-			&j.Parameters,
+			ttlParameter{&j.Parameters},
 			&j.AssetURL,
 			&j.StartTime,
 			&j.CreatedBy,
@@ -518,6 +847,14 @@ func (job *InvalidationJob) Read(h http.Header, useIMS bool) ([]interface{}, err
 			return nil, nil, fmt.Errorf("parsing db response: %v", err), http.StatusInternalServerError, nil
 		}
 
+		if fields != nil {
+			projected, err := projectFields(j, fields)
+			if err != nil {
+				return nil, nil, fmt.Errorf("projecting fields of job: %v", err), http.StatusInternalServerError, nil
+			}
+			returnable = append(returnable, projected)
+			continue
+		}
 		returnable = append(returnable, j)
 	}
 
@@ -525,6 +862,7 @@ func (job *InvalidationJob) Read(h http.Header, useIMS bool) ([]interface{}, err
 		return nil, nil, fmt.Errorf("Parsing db responses: %v", err), http.StatusInternalServerError, nil
 	}
 
+	logger.Debugf("event=read_complete jobs=%d", len(returnable))
 	return returnable, nil, nil, http.StatusOK, &maxTime
 }
 
@@ -537,12 +875,45 @@ func CreateV40(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer inf.Close()
+	logger := newJobLogger(inf, "CreateV40")
+
+	if userErr, sysErr, errCode = checkContentType(inf, r); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	limitBody(w, r, inf)
 
 	job := tc.InvalidationJobCreateV4{}
 	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+		if tooLarge := bodyTooLarge(err); tooLarge != nil {
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusRequestEntityTooLarge, tooLarge, nil)
+			return
+		}
 		api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, errors.New("Unable to parse Invalidation Job"), fmt.Errorf("parsing jobs/ POST: %v", err))
 		return
 	}
+	job.Comment = sanitizeComment(job.Comment)
+	if err := expandRegexTemplate(inf, &job); err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, err, nil)
+		return
+	}
+	if userErr, sysErr, errCode = resolveStartIn(inf, &job); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	if userErr, sysErr, errCode = resolveImmediate(inf, &job); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defaultTTL := false
+	if job.TTLHours == 0 {
+		hours, ok, err := getDefaultTTL(inf.Tx.Tx, job.DeliveryService)
+		if err != nil {
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting default TTL of Delivery Service '%s': %v", job.DeliveryService, err))
+			return
+		}
+		job.TTLHours, defaultTTL = hours, ok
+	}
 
 	// Check if request object is valid
 	w.Header().Set(rfc.ContentType, rfc.ApplicationJSON)
@@ -567,6 +938,11 @@ func CreateV40(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := checkFullPurge(inf, job.Regex); err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, err, nil)
+		return
+	}
+
 	// Check if authorized
 	if ok, err := IsUserAuthorizedToModifyDSXMLID(inf, job.DeliveryService); err != nil {
 		sysErr = fmt.Errorf("failed checking current user permissions for DS #%s: %v", job.DeliveryService, err)
@@ -574,7 +950,7 @@ func CreateV40(w http.ResponseWriter, r *http.Request) {
 		api.HandleErr(w, r, inf.Tx.Tx, errCode, nil, sysErr)
 		return
 	} else if !ok {
-		userErr = fmt.Errorf("failed to authorize based on tenancy")
+		userErr = tc.NewCodedError(tc.AlertCodeNotAuthorized, errors.New("failed to authorize based on tenancy"))
 		errCode = http.StatusNotFound
 		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
 		return
@@ -589,54 +965,170 @@ func CreateV40(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if !exists {
-		userErr = fmt.Errorf("delivery service \"%v\" does not exist", job.DeliveryService)
+		userErr = tc.NewCodedError(tc.AlertCodeNotFound, fmt.Errorf("delivery service \"%v\" does not exist", job.DeliveryService))
 		errCode = http.StatusNotFound
 		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
 		return
 	}
 
-	row := inf.Tx.Tx.QueryRow(insertQueryV4,
-		job.TTLHours,
-		dsid, // Used in inner select for deliveryservice
-		job.Regex,
-		job.StartTime,
-		time.Now(),
-		inf.User.ID,
-		dsid,
-		job.InvalidationType) // Defaults for all api versions below 4.0
+	if userErr, sysErr, errCode = checkDSAcceptsJobs(inf, uint(dsid)); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
 
-	result := tc.InvalidationJobV4{}
-	err = row.Scan(
-		&result.ID,
-		&result.AssetURL,
-		&result.CreatedBy,
-		&result.DeliveryService,
-		&result.TTLHours,
-		&result.InvalidationType,
-		&result.StartTime)
+	jobUserID := inf.User.ID
+	if job.OnBehalfOf != nil {
+		if jobUserID, userErr, sysErr, errCode = onBehalfOfUser(inf, *job.OnBehalfOf, uint(dsid)); userErr != nil || sysErr != nil {
+			api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+			return
+		}
+	}
+
+	pending, userErr, sysErr, errCode := needsApproval(inf, uint(dsid), job.PendingApproval)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+
+	scope, userErr, sysErr, errCode := resolveRevalScope(inf, job, uint(dsid))
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+
+	revalColumn, userErr, errCode := revalColumnOverride(inf)
+	if userErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
+		return
+	}
+
+	if err := validateExpiryWebhook(inf, job); err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, err, nil)
+		return
+	}
+
+	uniqueness, err := getJobUniqueness(inf)
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, err, nil)
+		return
+	}
+
+	key, replay, userErr, sysErr, errCode := claimIdempotencyKey(inf, r, job)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	if replay != nil {
+		logger.Event("idempotent_replay", "ds", job.DeliveryService, "jobs", len(replay))
+		writeIdempotentReplay(w, r, inf, job, replay)
+		return
+	}
+
+	var explicit *originInfo
+	if job.Origin != nil {
+		origin, userErr, sysErr, errCode := explicitOrigin(inf, job, uint(dsid))
+		if userErr != nil || sysErr != nil {
+			api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+			return
+		}
+		explicit = &origin
+	}
+
+	if job.AllOrigins {
+		if inf.Version == nil || inf.Version.Major < 5 {
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, errors.New("allOrigins is not supported before API version 5.0"), nil)
+			return
+		}
+		createForAllOrigins(w, r, inf, job, uint(dsid), jobUserID, uniqueness, pending, scope, revalColumn, key, defaultTTL)
+		return
+	}
+
+	origin, hasOrigin, err := getPrimaryOrigin(inf.Tx.Tx, uint(dsid))
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting primary Origin of Delivery Service #%d: %v", dsid, err))
+		return
+	}
+	if explicit != nil {
+		origin, hasOrigin = *explicit, true
+	}
+	// Without a primary Origin, the insertion below fails anyway.
+	originURL := ""
+	if hasOrigin {
+		if err := origin.validate(); err != nil {
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, err, nil)
+			return
+		}
+		originURL = origin.URL()
+		if err := checkAssetURLLength(inf, originURL+job.Regex); err != nil {
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, err, nil)
+			return
+		}
+	}
+
+	if uniqueness.checked() {
+		if originURL != "" {
+			existing, err := getOverlappingJobs(inf.Tx.Tx, uint(dsid), originURL+job.Regex, job.StartTime, uint(job.TTLHours))
+			if err != nil {
+				api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting jobs overlapping new job on Delivery Service #%d: %v", dsid, err))
+				return
+			}
+			if len(existing) > 0 && !uniqueness.ifNotExists {
+				writeConflicts(w, r, existing)
+				return
+			}
+			if len(existing) > 0 {
+				w.Header().Set(http.CanonicalHeaderKey("location"), jobLocation(inf, r, existing[0].ID))
+				api.WriteAlertsObj(w, r, http.StatusOK, tc.Alerts{Alerts: []tc.Alert{existingJobAlert(existing[0])}}, existing[0])
+				return
+			}
+		}
+	}
+
+	var result tc.InvalidationJobV5
+	if explicit != nil {
+		result, err = insertJob(inf.Tx.Tx, job, originURL+job.Regex, time.Now(), jobUserID, uint(dsid), pending)
+	} else {
+		recurrenceInterval, recurrenceEnd := recurrenceArgs(job.Recurrence)
+		result, err = scanInsertedJob(inf.Tx.Tx.QueryRow(insertQueryV4,
+			job.TTLHours,
+			dsid, // Used in inner select for deliveryservice
+			job.Regex,
+			job.StartTime,
+			time.Now(),
+			jobUserID,
+			dsid,
+			job.InvalidationType, // Defaults for all api versions below 4.0
+			recurrenceInterval,
+			recurrenceEnd,
+			job.Comment,
+			jobPriority(job.Priority),
+			labelsValue(job.Labels)), job, pending)
+	}
 	if err != nil {
 		userErr, sysErr, errCode = api.ParseDBError(err)
 		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
 		return
 	}
+	logger.Event("job_created", "job", result.ID, "ds", result.DeliveryService, "asset_url", result.AssetURL, "ttl_hours", result.TTLHours, "type", result.InvalidationType, "approval", result.ApprovalState)
 
-	if err := setRevalFlags(uint(dsid), inf.Tx.Tx); err != nil {
-		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("setting reval flags: %v", err))
+	revalWarning, err := finishCreatedJobs(inf, job, uint(dsid), pending, scope, revalColumn, key, result.ID)
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("job #%d: %v", result.ID, err))
 		return
 	}
+	if !pending {
+		logger.revalFlags(result.DeliveryService, revalWarning)
+	}
 
 	conflicts := tc.ValidateJobUniqueness(inf.Tx.Tx, uint(dsid), result.StartTime, result.AssetURL, result.TTLHours)
-	response := apiResponseV4{
-		make([]tc.Alert, len(conflicts)+1),
-		result,
-	}
+	alerts := make([]tc.Alert, len(conflicts)+1)
 	for i, conflict := range conflicts {
-		response.Alerts[i] = tc.Alert{
+		alerts[i] = tc.Alert{
 			Text:  conflict,
 			Level: tc.WarnLevel.String(),
 		}
 	}
-	response.Alerts[len(conflicts)] = tc.Alert{
+	alerts[len(conflicts)] = tc.Alert{
 		Text: fmt.Sprintf("Invalidation (%s) request created for %v, start:%v end %v",
 			result.InvalidationType,
 			result.AssetURL,
@@ -644,7 +1136,16 @@ func CreateV40(w http.ResponseWriter, r *http.Request) {
 			result.StartTime.Add(time.Hour*time.Duration(job.TTLHours))),
 		Level: tc.SuccessLevel.String(),
 	}
-	resp, err := json.Marshal(response)
+	if revalWarning != "" {
+		alerts = append(alerts, tc.Alert{Text: revalWarning, Level: tc.WarnLevel.String()})
+	}
+	if pending {
+		alerts = append(alerts, pendingApprovalAlert(inf))
+	}
+	if defaultTTL {
+		alerts = append(alerts, defaultTTLAlert(result.TTLHours))
+	}
+	resp, err := json.Marshal(newAPIResponse(inf, alerts, result))
 
 	if err != nil {
 		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("Marshaling JSON: %v", err))
@@ -656,51 +1157,170 @@ func CreateV40(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set(http.CanonicalHeaderKey("location"), fmt.Sprintf("%s://%s/api/%d.%d/jobs?id=%d",
-		inf.Config.URL.Scheme,
-		r.Host,
-		inf.Version.Major,
-		inf.Version.Minor,
-		result.ID))
+	w.Header().Set(http.CanonicalHeaderKey("location"), jobLocation(inf, r, result.ID))
 	w.WriteHeader(http.StatusOK)
 	api.WriteAndLogErr(w, r, append(resp, '\n'))
 
-	duplicate := ""
-	if len(conflicts) > 0 {
-		duplicate = "(duplicate) "
-	}
-	changeLogMsg := fmt.Sprintf("%s content invalidation job %s- ID: %d DSXMLID: %s ASSET_URL: '%s' TTLHRs: %d INVALIDATION: %s",
-		api.Created,
-		duplicate,
-		result.ID,
-		result.DeliveryService,
-		result.AssetURL,
-		result.TTLHours,
-		result.InvalidationType,
-	)
+	changeLogMsg := createdJobChangeLog(inf, job, result, pending, revalColumn, len(conflicts) > 0)
 	api.CreateChangeLogRawTx(api.ApiChange,
 		changeLogMsg,
 		inf.User,
 		inf.Tx.Tx)
+	logger.Event("changelog_written", "job", result.ID, "duplicate", len(conflicts) > 0)
 }
 
-// Used by POST requests to `/jobs`, creates a new content invalidation job
-// from the provided request body.
-//
-// Deprecated. To be used only with versions less than 4.0
-func Create(w http.ResponseWriter, r *http.Request) {
-	inf, userErr, sysErr, errCode := api.NewInfo(r, nil, nil)
-	if userErr != nil || sysErr != nil {
-		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
-		return
+// insertJob inserts a job with the given asset URL, created by 'job' on behalf
+// of the user identified by 'jobUserID', and returns it as the API represents
+// it.
+func insertJob(tx *sql.Tx, job tc.InvalidationJobCreateV4, assetURL string, createdAt time.Time, jobUserID int, dsid uint, pending bool) (tc.InvalidationJobV5, error) {
+	recurrenceInterval, recurrenceEnd := recurrenceArgs(job.Recurrence)
+	return scanInsertedJob(tx.QueryRow(insertAssetURLQueryV4,
+		job.TTLHours,
+		assetURL,
+		job.StartTime,
+		createdAt,
+		jobUserID,
+		dsid,
+		job.InvalidationType,
+		recurrenceInterval,
+		recurrenceEnd,
+		job.Comment,
+		jobPriority(job.Priority),
+		labelsValue(job.Labels),
+	), job, pending)
+}
+
+// scanInsertedJob scans the job returned by inserting one - as insertJob
+// does - that was created by 'job'.
+func scanInsertedJob(row *sql.Row, job tc.InvalidationJobCreateV4, pending bool) (tc.InvalidationJobV5, error) {
+	result := tc.InvalidationJobV5{}
+	var recurrence recurrenceColumns
+	err := row.Scan(
+		&result.ID,
+		&result.AssetURL,
+		&result.CreatedBy,
+		&result.DeliveryService,
+		&result.TTLHours,
+		&result.InvalidationType,
+		&result.StartTime,
+		&recurrence.IntervalHours,
+		&recurrence.End,
+		&result.Comment,
+		&result.Priority,
+		labelsColumn{&result.Labels})
+	if err != nil {
+		return result, err
+	}
+	result.Recurrence, result.NextRun = recurrence.value(result.StartTime)
+	result.EndTime = jobEndTime(result.StartTime, result.TTLHours)
+	result.ApprovalState = approvalState(pending)
+	result.CacheGroup = job.CacheGroup
+	result.ServerType = job.ServerType
+	return result, nil
+}
+
+// finishCreatedJobs records what the insertion of the identified, newly
+// created jobs doesn't - their revalidation scope, expiry webhook, and the
+// Idempotency-Key that created them - and then either marks them pending
+// approval or flags the servers they affect for revalidation. It returns the
+// warning about flagging servers, if any.
+func finishCreatedJobs(inf *api.APIInfo, job tc.InvalidationJobCreateV4, dsid uint, pending bool, scope revalScope, revalColumn string, key *idempotencyKey, ids ...uint64) (string, error) {
+	tx := inf.Tx.Tx
+	if err := setJobRevalScope(tx, scope, ids...); err != nil {
+		return "", fmt.Errorf("setting revalidation scope of jobs: %v", err)
+	}
+	if err := setExpiryWebhook(tx, job.ExpiryWebhook, ids...); err != nil {
+		return "", fmt.Errorf("setting expiry webhook of jobs: %v", err)
+	}
+	if err := key.record(tx, ids...); err != nil {
+		return "", fmt.Errorf("recording Idempotency-Key of jobs: %v", err)
 	}
-	defer inf.Close()
+
+	// Jobs pending approval have no effect on servers until they're approved,
+	// at which point revalidation is triggered instead.
+	if pending {
+		if err := markPendingApproval(tx, inf.User.ID, ids...); err != nil {
+			return "", fmt.Errorf("marking jobs pending approval: %v", err)
+		}
+		return "", nil
+	}
+	revalWarning, err := setScopedRevalFlagsInColumn(dsid, scope, revalColumn, tx, revalFlagsDisabled(inf))
+	if err != nil {
+		return "", fmt.Errorf("setting reval flags: %v", err)
+	}
+	return revalWarning, nil
+}
+
+// logCreatedJobs adds warnings about the jobs that conflict with each of the
+// given, newly created ones to 'alerts', and writes a change log entry for
+// each.
+func logCreatedJobs(inf *api.APIInfo, job tc.InvalidationJobCreateV4, dsid uint, pending bool, revalColumn string, created []tc.InvalidationJobV5, alerts *tc.Alerts) {
+	for _, result := range created {
+		conflicts := tc.ValidateJobUniqueness(inf.Tx.Tx, dsid, result.StartTime, result.AssetURL, result.TTLHours)
+		for _, conflict := range conflicts {
+			alerts.AddNewAlert(tc.WarnLevel, conflict)
+		}
+		changeLogMsg := createdJobChangeLog(inf, job, result, pending, revalColumn, len(conflicts) > 0)
+		api.CreateChangeLogRawTx(api.ApiChange, changeLogMsg, inf.User, inf.Tx.Tx)
+	}
+}
+
+// createdJobChangeLog returns the change log entry for a newly created job,
+// created by 'job'. 'duplicate' tells whether it conflicts with others.
+func createdJobChangeLog(inf *api.APIInfo, job tc.InvalidationJobCreateV4, result tc.InvalidationJobV5, pending bool, revalColumn string, duplicate bool) string {
+	dup := ""
+	if duplicate {
+		dup = "(duplicate) "
+	}
+	return fmt.Sprintf("%s content invalidation job %s- ID: %d DSXMLID: %s ASSET_URL: '%s' TTLHRs: %d INVALIDATION: %s%s%s%s%s%s%s%s%s%s",
+		api.Created,
+		dup,
+		result.ID,
+		result.DeliveryService,
+		assetURLChangeLog(inf, result.AssetURL),
+		result.TTLHours,
+		result.InvalidationType,
+		commentChangeLog(result.Comment),
+		labelsChangeLog(result.Labels),
+		onBehalfOfChangeLog(job.OnBehalfOf),
+		approvalChangeLog(pending),
+		scopeChangeLog(job),
+		immediateChangeLog(job, result.StartTime),
+		expiryWebhookChangeLog(job),
+		explicitOriginChangeLog(job),
+		revalColumnChangeLog(revalColumn),
+	)
+}
+
+// Used by POST requests to `/jobs`, creates a new content invalidation job
+// from the provided request body.
+//
+// Deprecated. To be used only with versions less than 4.0
+func Create(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, nil, nil)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+	logger := newJobLogger(inf, "Create")
+
+	if userErr, sysErr, errCode = checkContentType(inf, r); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	limitBody(w, r, inf)
 
 	job := tc.InvalidationJobInput{}
 	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+		if tooLarge := bodyTooLarge(err); tooLarge != nil {
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusRequestEntityTooLarge, tooLarge, nil)
+			return
+		}
 		api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, errors.New("Unable to parse Invalidation Job"), fmt.Errorf("parsing jobs/ POST: %v", err))
 		return
 	}
+	job.Comment = sanitizeComment(job.Comment)
 
 	w.Header().Set(rfc.ContentType, rfc.ApplicationJSON)
 	if err := job.Validate(inf.Tx.Tx); err != nil {
@@ -724,6 +1344,11 @@ func Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := checkFullPurge(inf, *job.Regex); err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, err, nil)
+		return
+	}
+
 	// Validate() would have already checked for deliveryservice existence and
 	// parsed the ttl, so if either of these throws an error now, something
 	// weird has happened
@@ -742,28 +1367,37 @@ func Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if ok, err := IsUserAuthorizedToModifyDSID(inf, dsid); err != nil {
-		sysErr = fmt.Errorf("Checking current user permissions for DS #%d: %v", dsid, err)
-		errCode = http.StatusInternalServerError
-		api.HandleErr(w, r, inf.Tx.Tx, errCode, nil, sysErr)
-		return
-	} else if !ok {
-		userErr = fmt.Errorf("No such Delivery Service!")
-		errCode = http.StatusNotFound
-		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
+	if userErr, sysErr, errCode = authorizeJobModification(inf, dsid, nil); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
 		return
 	}
 
-	_, cdnName, _, err := dbhelpers.GetDSNameAndCDNFromID(inf.Tx.Tx, int(dsid))
-	if err != nil {
-		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, errors.New("getting delivery service and CDN name from ID: "+err.Error()))
+	if userErr, sysErr, errCode = checkDSAcceptsJobs(inf, dsid); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
 		return
 	}
-	userErr, sysErr, statusCode := dbhelpers.CheckIfCurrentUserCanModifyCDN(inf.Tx.Tx, string(cdnName), inf.User.UserName)
+
+	pending, userErr, sysErr, errCode := needsApproval(inf, dsid, false)
 	if userErr != nil || sysErr != nil {
-		api.HandleErr(w, r, inf.Tx.Tx, statusCode, userErr, sysErr)
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
 		return
 	}
+
+	if origin, ok, err := getPrimaryOrigin(inf.Tx.Tx, dsid); err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting primary Origin of Delivery Service #%d: %v", dsid, err))
+		return
+	} else if ok {
+		if err := origin.validate(); err != nil {
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, err, nil)
+			return
+		}
+		if err := checkAssetURLLength(inf, origin.URL()+*job.Regex); err != nil {
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, err, nil)
+			return
+		}
+	}
+
+	recurrenceInterval, recurrenceEnd := recurrenceArgs(job.Recurrence)
 	row := inf.Tx.Tx.QueryRow(insertQuery,
 		ttl,
 		dsid, // Used in inner select for deliveryservice
@@ -772,7 +1406,12 @@ func Create(w http.ResponseWriter, r *http.Request) {
 		time.Now(),
 		inf.User.ID,
 		dsid,
-		tc.REFRESH) // Defaults for all api versions below 4.0
+		tc.REFRESH, // Defaults for all api versions below 4.0
+		recurrenceInterval,
+		recurrenceEnd,
+		job.Comment,
+		jobPriority(job.Priority),
+		labelsValue(job.Labels))
 
 	result := tc.InvalidationJob{}
 	err = row.Scan(&result.AssetURL,
@@ -780,7 +1419,7 @@ func Create(w http.ResponseWriter, r *http.Request) {
 		&result.ID,
 		&result.CreatedBy,
 		&result.Keyword,
-		&result.Parameters,
+		ttlParameter{&result.Parameters},
 		&result.StartTime)
 	if err != nil {
 		userErr, sysErr, errCode = api.ParseDBError(err)
@@ -788,9 +1427,21 @@ func Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := setRevalFlags(dsid, inf.Tx.Tx); err != nil {
-		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("setting reval flags: %v", err))
-		return
+	logger.Event("job_created", "job", *result.ID, "ds", result.DeliveryService, "asset_url", result.AssetURL, "parameters", result.Parameters)
+
+	revalWarning := ""
+	if pending {
+		if err := markPendingApproval(inf.Tx.Tx, inf.User.ID, *result.ID); err != nil {
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("marking job #%d pending approval: %v", *result.ID, err))
+			return
+		}
+	} else {
+		revalWarning, err = setRevalFlagsByDSID(dsid, inf.Tx.Tx, revalFlagsDisabled(inf))
+		if err != nil {
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("setting reval flags: %v", err))
+			return
+		}
+		logger.revalFlags(result.DeliveryService, revalWarning)
 	}
 
 	conflicts := tc.ValidateJobUniqueness(inf.Tx.Tx, dsid, job.StartTime.Time, *result.AssetURL, ttl)
@@ -809,6 +1460,12 @@ func Create(w http.ResponseWriter, r *http.Request) {
 			job.StartTime.Add(time.Hour*time.Duration(ttl))),
 		Level: tc.SuccessLevel.String(),
 	}
+	if revalWarning != "" {
+		response.Alerts = append(response.Alerts, tc.Alert{Text: revalWarning, Level: tc.WarnLevel.String()})
+	}
+	if pending {
+		response.Alerts = append(response.Alerts, pendingApprovalAlert(inf))
+	}
 	resp, err := json.Marshal(response)
 
 	if err != nil {
@@ -821,7 +1478,7 @@ func Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set(http.CanonicalHeaderKey("location"), fmt.Sprintf("%s://%s/api/%d.%d/jobs?id=%d", inf.Config.URL.Scheme, r.Host, inf.Version.Major, inf.Version.Minor, *result.ID))
+	w.Header().Set(http.CanonicalHeaderKey("location"), jobLocation(inf, r, *result.ID))
 	w.WriteHeader(http.StatusOK)
 	api.WriteAndLogErr(w, r, append(resp, '\n'))
 
@@ -830,8 +1487,9 @@ func Create(w http.ResponseWriter, r *http.Request) {
 		duplicate = "(duplicate) "
 	}
 	api.CreateChangeLogRawTx(api.ApiChange, api.Created+" content invalidation job "+duplicate+"- ID: "+
-		strconv.FormatUint(*result.ID, 10)+" DS: "+*result.DeliveryService+" URL: '"+*result.AssetURL+
-		"' Params: '"+*result.Parameters+"'", inf.User, inf.Tx.Tx)
+		strconv.FormatUint(*result.ID, 10)+" DS: "+*result.DeliveryService+" URL: '"+assetURLChangeLog(inf, *result.AssetURL)+
+		"' Params: '"+*result.Parameters+"'"+commentChangeLog(job.Comment)+labelsChangeLog(job.Labels)+approvalChangeLog(pending), inf.User, inf.Tx.Tx)
+	logger.Event("changelog_written", "job", *result.ID, "duplicate", len(conflicts) > 0)
 }
 
 // Used by PUT requests to `/jobs`, replaces an existing content invalidation job
@@ -843,11 +1501,12 @@ func UpdateV40(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer inf.Close()
+	logger := newJobLogger(inf, "UpdateV40")
 
-	var oFQDN string
+	var origin originInfo
 	var dsid uint
 	var uid uint
-	job := tc.InvalidationJobV4{}
+	job := tc.InvalidationJobV5{}
 	row := inf.Tx.Tx.QueryRow(putInfoQueryV4, inf.Params["id"])
 	err := row.Scan(&job.ID,
 		&job.CreatedBy,
@@ -858,10 +1517,12 @@ func UpdateV40(w http.ResponseWriter, r *http.Request) {
 		&job.TTLHours,
 		&job.StartTime,
 		&job.InvalidationType,
-		&oFQDN)
+		&origin.Protocol,
+		&origin.FQDN,
+		&origin.Port)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			userErr = fmt.Errorf("No job by id '%s'!", inf.Params["id"])
+			userErr = tc.NewCodedError(tc.AlertCodeNotFound, fmt.Errorf("No job by id '%s'!", inf.Params["id"]))
 			errCode = http.StatusNotFound
 		} else {
 			sysErr = fmt.Errorf("fetching job update info: %v", err)
@@ -871,32 +1532,24 @@ func UpdateV40(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if ok, err := IsUserAuthorizedToModifyDSID(inf, dsid); err != nil {
-		sysErr = fmt.Errorf("Checking user permissions on DS #%d: %v", dsid, err)
-		errCode = http.StatusInternalServerError
-		api.HandleErr(w, r, inf.Tx.Tx, errCode, nil, sysErr)
-		return
-	} else if !ok {
-		userErr = errors.New("No such Delivery Service!")
-		errCode = http.StatusNotFound
-		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
+	// The CDN lock is only checked once the request has been validated.
+	if userErr, sysErr, errCode = authorizeJobTenancy(inf, dsid, &uid); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
 		return
 	}
 
-	if ok, err := IsUserAuthorizedToModifyJobsMadeByUsername(inf, job.CreatedBy); err != nil {
-		sysErr = fmt.Errorf("Checking user permissions against user %s: %v", job.CreatedBy, err)
-		errCode = http.StatusInternalServerError
-		api.HandleErr(w, r, inf.Tx.Tx, errCode, nil, sysErr)
-		return
-	} else if !ok {
-		userErr = fmt.Errorf("No job by id '%s'!", inf.Params["id"])
-		errCode = http.StatusNotFound
-		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
+	if userErr, sysErr, errCode = checkContentType(inf, r); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
 		return
 	}
+	limitBody(w, r, inf)
 
 	input := tc.InvalidationJobV4{}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		if tooLarge := bodyTooLarge(err); tooLarge != nil {
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusRequestEntityTooLarge, tooLarge, nil)
+			return
+		}
 		userErr = fmt.Errorf("Unable to parse input: %v", err)
 		sysErr = fmt.Errorf("parsing input to PUT jobs?id=%s: %v", inf.Params["id"], err)
 		errCode = http.StatusBadRequest
@@ -904,20 +1557,30 @@ func UpdateV40(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	defaultOmittedFieldsV4(&input, job.Downgrade())
+
 	if err := validateInvalidationJobV4(input); err != nil {
 		api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, err, nil)
 		return
 	}
 
-	if !strings.HasPrefix(input.AssetURL, oFQDN) {
-		userErr = fmt.Errorf("Cannot set asset URL that does not start with Delivery Service origin URL: %s", oFQDN)
+	if !origin.matches(input.AssetURL) {
+		userErr = fmt.Errorf("Cannot set asset URL that does not start with Delivery Service origin URL: %s", origin.URL())
 		errCode = http.StatusBadRequest
 		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
 		return
 	}
+	if err := checkAssetURLLength(inf, input.AssetURL); err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, err, nil)
+		return
+	}
+	if err := checkAssetURLFullPurge(inf, origin, input.AssetURL); err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, err, nil)
+		return
+	}
 
 	if job.StartTime.Before(time.Now()) {
-		userErr = errors.New("Cannot modify a job that has already started!")
+		userErr = tc.NewCodedError(tc.AlertCodeAlreadyStarted, errors.New("Cannot modify a job that has already started!"))
 		errCode = http.StatusMethodNotAllowed
 		w.Header().Set(http.CanonicalHeaderKey("allow"), "GET,HEAD,DELETE")
 		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
@@ -925,21 +1588,21 @@ func UpdateV40(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if job.DeliveryService != input.DeliveryService {
-		userErr = errors.New("Cannot change 'deliveryService' of existing invalidation job!")
+		userErr = tc.NewCodedError(tc.AlertCodeConflict, errors.New("Cannot change 'deliveryService' of existing invalidation job!"))
 		errCode = http.StatusConflict
 		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
 		return
 	}
 
 	if job.CreatedBy != input.CreatedBy {
-		userErr = errors.New("Cannot change 'createdBy' of existing invalidation jobs!")
+		userErr = tc.NewCodedError(tc.AlertCodeConflict, errors.New("Cannot change 'createdBy' of existing invalidation jobs!"))
 		errCode = http.StatusConflict
 		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
 		return
 	}
 
 	if job.ID != input.ID {
-		userErr = errors.New("Cannot change an invalidation job 'id'!")
+		userErr = tc.NewCodedError(tc.AlertCodeConflict, errors.New("Cannot change an invalidation job 'id'!"))
 		errCode = http.StatusConflict
 		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
 		return
@@ -954,6 +1617,13 @@ func UpdateV40(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// The Delivery Service may have been moved to another CDN since
+	// authorization was checked.
+	if userErr, sysErr, errCode = recheckDSCDN(inf, dsid); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+
 	row = inf.Tx.Tx.QueryRow(updateQueryV4,
 		input.AssetURL,
 		input.TTLHours,
@@ -966,7 +1636,8 @@ func UpdateV40(w http.ResponseWriter, r *http.Request) {
 		&job.ID,
 		&job.TTLHours,
 		&job.StartTime,
-		&job.InvalidationType)
+		&job.InvalidationType,
+		&job.Priority)
 	if err != nil {
 		sysErr = fmt.Errorf("Updating a job: %v", err)
 		errCode = http.StatusInternalServerError
@@ -974,23 +1645,24 @@ func UpdateV40(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = setRevalFlags(job.DeliveryService, inf.Tx.Tx); err != nil {
+	logger.Event("job_updated", "job", job.ID, "ds", job.DeliveryService, "asset_url", job.AssetURL, "ttl_hours", job.TTLHours, "type", job.InvalidationType)
+
+	revalWarning, err := setJobRevalFlags(inf.Tx.Tx, job.ID, dsid, revalFlagsDisabled(inf))
+	if err != nil {
 		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("Setting reval flags: %v", err))
 		return
 	}
+	logger.revalFlags(job.DeliveryService, revalWarning)
 
 	conflicts := tc.ValidateJobUniqueness(inf.Tx.Tx, dsid, input.StartTime, input.AssetURL, input.TTLHours)
-	response := apiResponseV4{
-		make([]tc.Alert, len(conflicts)+1),
-		job,
-	}
+	alerts := make([]tc.Alert, len(conflicts)+1)
 	for i, conflict := range conflicts {
-		response.Alerts[i] = tc.Alert{
+		alerts[i] = tc.Alert{
 			Text:  conflict,
 			Level: tc.WarnLevel.String(),
 		}
 	}
-	response.Alerts[len(conflicts)] = tc.Alert{
+	alerts[len(conflicts)] = tc.Alert{
 		Text: fmt.Sprintf("Invalidation request created for %s, start: %v end: %v invalidation type: %v",
 			job.AssetURL,
 			job.StartTime,
@@ -998,8 +1670,11 @@ func UpdateV40(w http.ResponseWriter, r *http.Request) {
 			job.InvalidationType),
 		Level: tc.SuccessLevel.String(),
 	}
+	if revalWarning != "" {
+		alerts = append(alerts, tc.Alert{Text: revalWarning, Level: tc.WarnLevel.String()})
+	}
 
-	resp, err := json.Marshal(response)
+	resp, err := json.Marshal(newAPIResponse(inf, alerts, job))
 	if err != nil {
 		sysErr = fmt.Errorf("encoding response: %v", err)
 		errCode = http.StatusInternalServerError
@@ -1014,7 +1689,7 @@ func UpdateV40(w http.ResponseWriter, r *http.Request) {
 		api.Updated,
 		input.ID,
 		input.DeliveryService,
-		input.AssetURL,
+		assetURLChangeLog(inf, input.AssetURL),
 		input.TTLHours,
 		input.InvalidationType,
 	)
@@ -1022,6 +1697,7 @@ func UpdateV40(w http.ResponseWriter, r *http.Request) {
 		changeLogMsg,
 		inf.User,
 		inf.Tx.Tx)
+	logger.Event("changelog_written", "job", job.ID)
 }
 
 // Used by PUT requests to `/jobs`, replaces an existing content invalidation job
@@ -1035,8 +1711,9 @@ func Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer inf.Close()
+	logger := newJobLogger(inf, "Update")
 
-	var oFQDN string
+	var origin originInfo
 	var dsid uint
 	var uid uint
 	job := tc.InvalidationJob{}
@@ -1047,12 +1724,14 @@ func Update(w http.ResponseWriter, r *http.Request) {
 		&dsid,
 		&job.DeliveryService,
 		&job.AssetURL,
-		&job.Parameters,
+		ttlParameter{&job.Parameters},
 		&job.StartTime,
-		&oFQDN)
+		&origin.Protocol,
+		&origin.FQDN,
+		&origin.Port)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			userErr = fmt.Errorf("No job by id '%s'!", inf.Params["id"])
+			userErr = tc.NewCodedError(tc.AlertCodeNotFound, fmt.Errorf("No job by id '%s'!", inf.Params["id"]))
 			errCode = http.StatusNotFound
 		} else {
 			sysErr = fmt.Errorf("fetching job update info: %v", err)
@@ -1062,32 +1741,24 @@ func Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if ok, err := IsUserAuthorizedToModifyDSID(inf, dsid); err != nil {
-		sysErr = fmt.Errorf("Checking user permissions on DS #%d: %v", dsid, err)
-		errCode = http.StatusInternalServerError
-		api.HandleErr(w, r, inf.Tx.Tx, errCode, nil, sysErr)
-		return
-	} else if !ok {
-		userErr = errors.New("No such Delivery Service!")
-		errCode = http.StatusNotFound
-		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
+	// The CDN lock is only checked once the request has been validated.
+	if userErr, sysErr, errCode = authorizeJobTenancy(inf, dsid, &uid); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
 		return
 	}
 
-	if ok, err := IsUserAuthorizedToModifyJobsMadeByUsername(inf, *job.CreatedBy); err != nil {
-		sysErr = fmt.Errorf("Checking user permissions against user %s: %v", *job.CreatedBy, err)
-		errCode = http.StatusInternalServerError
-		api.HandleErr(w, r, inf.Tx.Tx, errCode, nil, sysErr)
-		return
-	} else if !ok {
-		userErr = fmt.Errorf("No job by id '%s'!", inf.Params["id"])
-		errCode = http.StatusNotFound
-		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
+	if userErr, sysErr, errCode = checkContentType(inf, r); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
 		return
 	}
+	limitBody(w, r, inf)
 
 	input := tc.InvalidationJob{}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		if tooLarge := bodyTooLarge(err); tooLarge != nil {
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusRequestEntityTooLarge, tooLarge, nil)
+			return
+		}
 		userErr = fmt.Errorf("Unable to parse input: %v", err)
 		sysErr = fmt.Errorf("parsing input to PUT jobs?id=%s: %v", inf.Params["id"], err)
 		errCode = http.StatusBadRequest
@@ -1095,20 +1766,30 @@ func Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	defaultOmittedFields(&input, job)
+
 	if err := input.Validate(); err != nil {
 		api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, err, nil)
 		return
 	}
 
-	if !strings.HasPrefix(*input.AssetURL, oFQDN) {
-		userErr = fmt.Errorf("Cannot set asset URL that does not start with Delivery Service origin URL: %s", oFQDN)
+	if !origin.matches(*input.AssetURL) {
+		userErr = fmt.Errorf("Cannot set asset URL that does not start with Delivery Service origin URL: %s", origin.URL())
 		errCode = http.StatusBadRequest
 		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
 		return
 	}
+	if err := checkAssetURLLength(inf, *input.AssetURL); err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, err, nil)
+		return
+	}
+	if err := checkAssetURLFullPurge(inf, origin, *input.AssetURL); err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, err, nil)
+		return
+	}
 
 	if job.StartTime.Before(time.Now()) {
-		userErr = errors.New("Cannot modify a job that has already started!")
+		userErr = tc.NewCodedError(tc.AlertCodeAlreadyStarted, errors.New("Cannot modify a job that has already started!"))
 		errCode = http.StatusMethodNotAllowed
 		w.Header().Set(http.CanonicalHeaderKey("allow"), "GET,HEAD,DELETE")
 		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
@@ -1116,40 +1797,44 @@ func Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if *job.DeliveryService != *input.DeliveryService {
-		userErr = errors.New("Cannot change 'deliveryService' of existing invalidation job!")
+		userErr = tc.NewCodedError(tc.AlertCodeConflict, errors.New("Cannot change 'deliveryService' of existing invalidation job!"))
 		errCode = http.StatusConflict
 		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
 		return
 	}
 
 	if *job.CreatedBy != *input.CreatedBy {
-		userErr = errors.New("Cannot change 'createdBy' of existing invalidation jobs!")
+		userErr = tc.NewCodedError(tc.AlertCodeConflict, errors.New("Cannot change 'createdBy' of existing invalidation jobs!"))
 		errCode = http.StatusConflict
 		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
 		return
 	}
 
 	if *job.ID != *input.ID {
-		userErr = errors.New("Cannot change an invalidation job 'id'!")
+		userErr = tc.NewCodedError(tc.AlertCodeConflict, errors.New("Cannot change an invalidation job 'id'!"))
 		errCode = http.StatusConflict
 		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
 		return
 	}
 
-	_, cdnName, _, err := dbhelpers.GetDSNameAndCDNFromID(inf.Tx.Tx, int(dsid))
+	ttlHours, err := tc.ParseTTLParameter(*input.Parameters)
 	if err != nil {
-		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, errors.New("getting delivery service and CDN name from ID: "+err.Error()))
+		userErr = fmt.Errorf("parameters: %v", err)
+		errCode = http.StatusBadRequest
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
 		return
 	}
-	userErr, sysErr, statusCode := dbhelpers.CheckIfCurrentUserCanModifyCDN(inf.Tx.Tx, string(cdnName), inf.User.UserName)
-	if userErr != nil || sysErr != nil {
-		api.HandleErr(w, r, inf.Tx.Tx, statusCode, userErr, sysErr)
+
+	// This also locks the Delivery Service against being moved to another CDN
+	// until the job is written.
+	if userErr, sysErr, errCode = recheckDSCDN(inf, dsid); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
 		return
 	}
 
 	row = inf.Tx.Tx.QueryRow(updateQuery,
 		input.AssetURL,
-		strings.TrimSuffix(strings.TrimPrefix(*input.Parameters, "TTL:"), "h"), // Strip TTL: and h from 'TTL:##h'
+		ttlHours,
 		input.StartTime.Time,
 		*job.ID)
 	err = row.Scan(&job.AssetURL,
@@ -1157,7 +1842,7 @@ func Update(w http.ResponseWriter, r *http.Request) {
 		&job.DeliveryService,
 		&job.ID,
 		&job.Keyword,
-		&job.Parameters,
+		ttlParameter{&job.Parameters},
 		&job.StartTime)
 	if err != nil {
 		sysErr = fmt.Errorf("Updating a job: %v", err)
@@ -1166,12 +1851,15 @@ func Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = setRevalFlags(*job.DeliveryService, inf.Tx.Tx); err != nil {
+	logger.Event("job_updated", "job", *job.ID, "ds", job.DeliveryService, "asset_url", job.AssetURL, "parameters", job.Parameters)
+
+	revalWarning, err := setJobRevalFlags(inf.Tx.Tx, *job.ID, dsid, revalFlagsDisabled(inf))
+	if err != nil {
 		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("Setting reval flags: %v", err))
 		return
 	}
+	logger.revalFlags(job.DeliveryService, revalWarning)
 
-	ttlHours := input.TTLHours()
 	conflicts := tc.ValidateJobUniqueness(inf.Tx.Tx, dsid, input.StartTime.Time, *input.AssetURL, ttlHours)
 	response := apiResponse{
 		make([]tc.Alert, len(conflicts)+1),
@@ -1188,6 +1876,9 @@ func Update(w http.ResponseWriter, r *http.Request) {
 			job.StartTime.Add(time.Hour*time.Duration(ttlHours))),
 		Level: tc.SuccessLevel.String(),
 	}
+	if revalWarning != "" {
+		response.Alerts = append(response.Alerts, tc.Alert{Text: revalWarning, Level: tc.WarnLevel.String()})
+	}
 
 	resp, err := json.Marshal(response)
 	if err != nil {
@@ -1200,7 +1891,8 @@ func Update(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set(http.CanonicalHeaderKey("content-type"), rfc.ApplicationJSON)
 	api.WriteAndLogErr(w, r, append(resp, '\n'))
 
-	api.CreateChangeLogRawTx(api.ApiChange, api.Updated+" content invalidation job - ID: "+strconv.FormatUint(*job.ID, 10)+" DS: "+*job.DeliveryService+" URL: '"+*job.AssetURL+"' Params: '"+*job.Parameters+"'", inf.User, inf.Tx.Tx)
+	api.CreateChangeLogRawTx(api.ApiChange, api.Updated+" content invalidation job - ID: "+strconv.FormatUint(*job.ID, 10)+" DS: "+*job.DeliveryService+" URL: '"+assetURLChangeLog(inf, *job.AssetURL)+"' Params: '"+*job.Parameters+"'", inf.User, inf.Tx.Tx)
+	logger.Event("changelog_written", "job", *job.ID)
 }
 
 // Used by DELETE requests to `/jobs`, deletes an existing content invalidation job
@@ -1211,13 +1903,26 @@ func DeleteV40(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer inf.Close()
+	logger := newJobLogger(inf, "DeleteV40")
+
+	// Deferred revalidations can only be flushed in API 5.0+, so deferring
+	// isn't possible in earlier versions.
+	deferReval := false
+	if d, ok := inf.Params["defer"]; ok && inf.Version != nil && inf.Version.Major >= 5 {
+		b, err := strconv.ParseBool(d)
+		if err != nil {
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, errors.New("'defer' must be a boolean"), nil)
+			return
+		}
+		deferReval = b
+	}
 
 	var dsid uint
 	var createdBy uint
 	row := inf.Tx.Tx.QueryRow(`SELECT job_deliveryservice, job_user FROM job WHERE id=$1`, inf.Params["id"])
 	if err := row.Scan(&dsid, &createdBy); err != nil {
 		if err == sql.ErrNoRows {
-			userErr = fmt.Errorf("No job by id '%s'!", inf.Params["id"])
+			userErr = tc.NewCodedError(tc.AlertCodeNotFound, fmt.Errorf("No job by id '%s'!", inf.Params["id"]))
 			errCode = http.StatusNotFound
 		} else {
 			sysErr = fmt.Errorf("Getting info for job #%s: %v", inf.Params["id"], err)
@@ -1227,40 +1932,29 @@ func DeleteV40(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if ok, err := IsUserAuthorizedToModifyDSID(inf, dsid); err != nil {
-		sysErr = fmt.Errorf("Checking user permissions on DS #%d: %v", dsid, err)
-		errCode = http.StatusInternalServerError
-		api.HandleErr(w, r, inf.Tx.Tx, errCode, nil, sysErr)
-		return
-	} else if !ok {
-		userErr = errors.New("No such Delivery Service!")
-		errCode = http.StatusNotFound
-		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
+	if userErr, sysErr, errCode = authorizeJobModification(inf, dsid, &createdBy); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
 		return
 	}
 
-	if ok, err := IsUserAuthorizedToModifyJobsMadeByUserID(inf, createdBy); err != nil {
-		sysErr = fmt.Errorf("Checking user permissions against user %v: %v", createdBy, err)
-		errCode = http.StatusInternalServerError
-		api.HandleErr(w, r, inf.Tx.Tx, errCode, nil, sysErr)
-		return
-	} else if !ok {
-		userErr = fmt.Errorf("No job by id '%s'!", inf.Params["id"])
-		errCode = http.StatusNotFound
-		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
+	// The scope has to be read before the job is gone.
+	scope, err := getJobRevalScope(inf.Tx.Tx, inf.Params["id"])
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting revalidation scope of job #%s: %v", inf.Params["id"], err))
 		return
 	}
 
-	result := tc.InvalidationJobV4{}
+	result := tc.InvalidationJobV5{}
 	row = inf.Tx.Tx.QueryRow(deleteQueryV4, inf.Params["id"])
-	err := row.Scan(
+	err = row.Scan(
 		&result.ID,
 		&result.AssetURL,
 		&result.CreatedBy,
 		&result.DeliveryService,
 		&result.TTLHours,
 		&result.InvalidationType,
-		&result.StartTime)
+		&result.StartTime,
+		&result.Priority)
 	if err != nil {
 		sysErr = fmt.Errorf("deleting job #%s: %v", inf.Params["id"], err)
 		errCode = http.StatusInternalServerError
@@ -1268,19 +1962,33 @@ func DeleteV40(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = setRevalFlags(dsid, inf.Tx.Tx); err != nil {
+	logger.Event("job_deleted", "job", result.ID, "ds", result.DeliveryService, "asset_url", result.AssetURL)
+
+	alerts := []tc.Alert{
+		{Text: "Content invalidation job was deleted", Level: tc.SuccessLevel.String()},
+	}
+	if deferReval {
+		if err = deferRevalFlags(dsid, inf.Tx.Tx); err != nil {
+			sysErr = fmt.Errorf("deferring reval_pending after deleting job #%s: %v", inf.Params["id"], err)
+			errCode = http.StatusInternalServerError
+			api.HandleErr(w, r, inf.Tx.Tx, errCode, nil, sysErr)
+			return
+		}
+		alerts = append(alerts, tc.Alert{Text: "Revalidation of the Delivery Service's servers was deferred until the next POST to jobs/flush_reval", Level: tc.InfoLevel.String()})
+		logger.Event("reval_flags_deferred", "ds", result.DeliveryService)
+	} else if revalWarning, err := setScopedRevalFlags(dsid, scope, inf.Tx.Tx, revalFlagsDisabled(inf)); err != nil {
 		sysErr = fmt.Errorf("setting reval_pending after deleting job #%s: %v", inf.Params["id"], err)
 		errCode = http.StatusInternalServerError
 		api.HandleErr(w, r, inf.Tx.Tx, errCode, nil, sysErr)
 		return
+	} else {
+		logger.revalFlags(result.DeliveryService, revalWarning)
+		if revalWarning != "" {
+			alerts = append(alerts, tc.Alert{Text: revalWarning, Level: tc.WarnLevel.String()})
+		}
 	}
 
-	response := apiResponseV4{[]tc.Alert{
-		{Text: "Content invalidation job was deleted", Level: tc.SuccessLevel.String()},
-	},
-		result,
-	}
-	resp, err := json.Marshal(response)
+	resp, err := json.Marshal(newAPIResponse(inf, alerts, result))
 	if err != nil {
 		sysErr = fmt.Errorf("encoding response: %v", err)
 		errCode = http.StatusInternalServerError
@@ -1295,7 +2003,7 @@ func DeleteV40(w http.ResponseWriter, r *http.Request) {
 		api.Deleted,
 		result.ID,
 		result.DeliveryService,
-		result.AssetURL,
+		assetURLChangeLog(inf, result.AssetURL),
 		result.TTLHours,
 		result.InvalidationType,
 	)
@@ -1303,6 +2011,7 @@ func DeleteV40(w http.ResponseWriter, r *http.Request) {
 		changeLogMsg,
 		inf.User,
 		inf.Tx.Tx)
+	logger.Event("changelog_written", "job", result.ID)
 }
 
 // Used by DELETE requests to `/jobs`, deletes an existing content invalidation job
@@ -1315,13 +2024,14 @@ func Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer inf.Close()
+	logger := newJobLogger(inf, "Delete")
 
 	var dsid uint
 	var createdBy uint
 	row := inf.Tx.Tx.QueryRow(`SELECT job_deliveryservice, job_user FROM job WHERE id=$1`, inf.Params["id"])
 	if err := row.Scan(&dsid, &createdBy); err != nil {
 		if err == sql.ErrNoRows {
-			userErr = fmt.Errorf("No job by id '%s'!", inf.Params["id"])
+			userErr = tc.NewCodedError(tc.AlertCodeNotFound, fmt.Errorf("No job by id '%s'!", inf.Params["id"]))
 			errCode = http.StatusNotFound
 		} else {
 			sysErr = fmt.Errorf("Getting info for job #%s: %v", inf.Params["id"], err)
@@ -1331,38 +2041,15 @@ func Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if ok, err := IsUserAuthorizedToModifyDSID(inf, dsid); err != nil {
-		sysErr = fmt.Errorf("Checking user permissions on DS #%d: %v", dsid, err)
-		errCode = http.StatusInternalServerError
-		api.HandleErr(w, r, inf.Tx.Tx, errCode, nil, sysErr)
-		return
-	} else if !ok {
-		userErr = errors.New("No such Delivery Service!")
-		errCode = http.StatusNotFound
-		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
-		return
-	}
-
-	if ok, err := IsUserAuthorizedToModifyJobsMadeByUserID(inf, createdBy); err != nil {
-		sysErr = fmt.Errorf("Checking user permissions against user %v: %v", createdBy, err)
-		errCode = http.StatusInternalServerError
-		api.HandleErr(w, r, inf.Tx.Tx, errCode, nil, sysErr)
-		return
-	} else if !ok {
-		userErr = fmt.Errorf("No job by id '%s'!", inf.Params["id"])
-		errCode = http.StatusNotFound
-		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, nil)
+	if userErr, sysErr, errCode = authorizeJobModification(inf, dsid, &createdBy); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
 		return
 	}
 
-	_, cdnName, _, err := dbhelpers.GetDSNameAndCDNFromID(inf.Tx.Tx, int(dsid))
+	// The scope has to be read before the job is gone.
+	scope, err := getJobRevalScope(inf.Tx.Tx, inf.Params["id"])
 	if err != nil {
-		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, errors.New("getting delivery service and CDN name from ID: "+err.Error()))
-		return
-	}
-	userErr, sysErr, statusCode := dbhelpers.CheckIfCurrentUserCanModifyCDN(inf.Tx.Tx, string(cdnName), inf.User.UserName)
-	if userErr != nil || sysErr != nil {
-		api.HandleErr(w, r, inf.Tx.Tx, statusCode, userErr, sysErr)
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting revalidation scope of job #%s: %v", inf.Params["id"], err))
 		return
 	}
 
@@ -1373,7 +2060,7 @@ func Delete(w http.ResponseWriter, r *http.Request) {
 		&result.DeliveryService,
 		&result.ID,
 		&result.Keyword,
-		&result.Parameters,
+		ttlParameter{&result.Parameters},
 		&result.StartTime)
 	if err != nil {
 		sysErr = fmt.Errorf("deleting job #%s: %v", inf.Params["id"], err)
@@ -1382,14 +2069,21 @@ func Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = setRevalFlags(dsid, inf.Tx.Tx); err != nil {
+	logger.Event("job_deleted", "job", *result.ID, "ds", result.DeliveryService, "asset_url", result.AssetURL)
+
+	revalWarning, err := setScopedRevalFlags(dsid, scope, inf.Tx.Tx, revalFlagsDisabled(inf))
+	if err != nil {
 		sysErr = fmt.Errorf("setting reval_pending after deleting job #%s: %v", inf.Params["id"], err)
 		errCode = http.StatusInternalServerError
 		api.HandleErr(w, r, inf.Tx.Tx, errCode, nil, sysErr)
 		return
 	}
+	logger.revalFlags(result.DeliveryService, revalWarning)
 
 	response := apiResponse{[]tc.Alert{tc.Alert{Text: "Content invalidation job was deleted", Level: tc.SuccessLevel.String()}}, result}
+	if revalWarning != "" {
+		response.Alerts = append(response.Alerts, tc.Alert{Text: revalWarning, Level: tc.WarnLevel.String()})
+	}
 	resp, err := json.Marshal(response)
 	if err != nil {
 		sysErr = fmt.Errorf("encoding response: %v", err)
@@ -1401,7 +2095,8 @@ func Delete(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set(http.CanonicalHeaderKey("content-type"), rfc.ApplicationJSON)
 	api.WriteAndLogErr(w, r, append(resp, '\n'))
 
-	api.CreateChangeLogRawTx(api.ApiChange, api.Deleted+" content invalidation job - ID: "+strconv.FormatUint(*result.ID, 10)+" DS: "+*result.DeliveryService+" URL: '"+*result.AssetURL+"' Params: '"+*result.Parameters+"'", inf.User, inf.Tx.Tx)
+	api.CreateChangeLogRawTx(api.ApiChange, api.Deleted+" content invalidation job - ID: "+strconv.FormatUint(*result.ID, 10)+" DS: "+*result.DeliveryService+" URL: '"+assetURLChangeLog(inf, *result.AssetURL)+"' Params: '"+*result.Parameters+"'", inf.User, inf.Tx.Tx)
+	logger.Event("changelog_written", "job", *result.ID)
 }
 
 // Validates the fields submitted for an InvalidationJobCreateV40. These errors
@@ -1431,7 +2126,10 @@ func validateJobCreateV4(job tc.InvalidationJobCreateV4, tx *sql.Tx) error {
 		errs = append(errs, "regex: is not a valid Regular Expression: "+err.Error())
 	}
 
-	if job.StartTime.Before(time.Now()) {
+	// A start time resolved from startIn or immediate may be "now", which has
+	// already passed by the time it's validated; it can't actually be in the
+	// past.
+	if job.StartIn == nil && !job.Immediate && job.StartTime.Before(time.Now()) {
 		errs = append(errs, "startTime: must be in the future")
 	}
 
@@ -1447,6 +2145,24 @@ func validateJobCreateV4(job tc.InvalidationJobCreateV4, tx *sql.Tx) error {
 		errs = append(errs, "InvalidationType is invalid")
 	}
 
+	if job.Recurrence != nil {
+		if err := job.Recurrence.Validate(job.StartTime); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if err := tc.ValidateInvalidationJobComment(job.Comment); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if err := tc.ValidateInvalidationJobPriority(job.Priority); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if err := tc.ValidateInvalidationJobLabels(job.Labels); err != nil {
+		errs = append(errs, err.Error())
+	}
+
 	if len(errs) > 0 {
 		return errors.New(strings.Join(errs, ", "))
 	}
@@ -1454,6 +2170,125 @@ func validateJobCreateV4(job tc.InvalidationJobCreateV4, tx *sql.Tx) error {
 	return nil
 }
 
+// resolveStartIn sets the start time of a job to be created from its relative
+// start time (startIn), if it has one, counting from the database's current
+// time - as resolveImmediate does - so that the clock of Traffic Ops doesn't
+// matter. That's only supported in API version 5.0 and later, and is mutually
+// exclusive with giving an absolute start time.
+//
+// This returns, in order, a user-facing error, a system error, and an HTTP
+// status code, as authorizeJobModification does.
+func resolveStartIn(inf *api.APIInfo, job *tc.InvalidationJobCreateV4) (error, error, int) {
+	if job.StartIn == nil {
+		return nil, nil, http.StatusOK
+	}
+	if inf.Version == nil || inf.Version.Major < 5 {
+		return errors.New("startIn is not supported before API version 5.0"), nil, http.StatusBadRequest
+	}
+	if !job.StartTime.IsZero() {
+		return errors.New("startIn and startTime are mutually exclusive"), nil, http.StatusBadRequest
+	}
+	d, err := tc.ParseInvalidationJobStartIn(*job.StartIn)
+	if err != nil {
+		return err, nil, http.StatusBadRequest
+	}
+	var now time.Time
+	if err := inf.Tx.Tx.QueryRow(`SELECT now()`).Scan(&now); err != nil {
+		return nil, fmt.Errorf("getting current time: %v", err), http.StatusInternalServerError
+	}
+	job.StartTime = now.Add(d)
+	return nil, nil, http.StatusOK
+}
+
+// resolveImmediate sets the start time of a job to be created with
+// 'immediate', if it was, to the database's current time, so that it comes
+// into effect as soon as it's created regardless of the clock of the client
+// (or of Traffic Ops). That's only supported in API version 5.0 and later,
+// and is mutually exclusive with giving any other start time.
+//
+// This returns, in order, a user-facing error, a system error, and an HTTP
+// status code, as authorizeJobModification does.
+func resolveImmediate(inf *api.APIInfo, job *tc.InvalidationJobCreateV4) (error, error, int) {
+	if !job.Immediate {
+		return nil, nil, http.StatusOK
+	}
+	if inf.Version == nil || inf.Version.Major < 5 {
+		return errors.New("immediate is not supported before API version 5.0"), nil, http.StatusBadRequest
+	}
+	if !job.StartTime.IsZero() || job.StartIn != nil {
+		return errors.New("immediate is mutually exclusive with startTime and startIn"), nil, http.StatusBadRequest
+	}
+	if err := inf.Tx.Tx.QueryRow(`SELECT now()`).Scan(&job.StartTime); err != nil {
+		return nil, fmt.Errorf("getting current time: %v", err), http.StatusInternalServerError
+	}
+	return nil, nil, http.StatusOK
+}
+
+// immediateChangeLog returns the part of a change log entry about a newly
+// created job that records that it was started immediately, at the given
+// time, which is empty if it wasn't.
+func immediateChangeLog(job tc.InvalidationJobCreateV4, start time.Time) string {
+	if !job.Immediate {
+		return ""
+	}
+	return " START: " + start.Format(time.RFC3339) + " (immediate)"
+}
+
+// defaultOmittedFieldsV4 sets each field of a job in the body of a PUT request
+// that was omitted (i.e. has its zero value) to its value in the current job,
+// so that e.g. a job's TTL can be changed without also re-sending its start
+// time.
+func defaultOmittedFieldsV4(input *tc.InvalidationJobV4, current tc.InvalidationJobV4) {
+	if input.ID == 0 {
+		input.ID = current.ID
+	}
+	if input.AssetURL == "" {
+		input.AssetURL = current.AssetURL
+	}
+	if input.CreatedBy == "" {
+		input.CreatedBy = current.CreatedBy
+	}
+	if input.DeliveryService == "" {
+		input.DeliveryService = current.DeliveryService
+	}
+	if input.TTLHours == 0 {
+		input.TTLHours = current.TTLHours
+	}
+	if input.InvalidationType == "" {
+		input.InvalidationType = current.InvalidationType
+	}
+	if input.StartTime.IsZero() {
+		input.StartTime = current.StartTime
+	}
+}
+
+// defaultOmittedFields is like defaultOmittedFieldsV4, but for the legacy job
+// representation, in which omitted fields are nil.
+func defaultOmittedFields(input *tc.InvalidationJob, current tc.InvalidationJob) {
+	if input.ID == nil {
+		input.ID = current.ID
+	}
+	if input.AssetURL == nil {
+		input.AssetURL = current.AssetURL
+	}
+	if input.CreatedBy == nil {
+		input.CreatedBy = current.CreatedBy
+	}
+	if input.DeliveryService == nil {
+		input.DeliveryService = current.DeliveryService
+	}
+	if input.Keyword == nil {
+		// The only keyword there has ever been, which isn't stored.
+		input.Keyword = util.StrPtr("PURGE")
+	}
+	if input.Parameters == nil {
+		input.Parameters = current.Parameters
+	}
+	if input.StartTime == nil {
+		input.StartTime = current.StartTime
+	}
+}
+
 // validateInvalidationJobV4 checks that the InvalidationJob is valid, by ensuring all of its fields are well-defined.
 // This returns an error describing any and all problematic fields encountered during validation.
 func validateInvalidationJobV4(job tc.InvalidationJobV4) error {
@@ -1504,6 +2339,46 @@ func validateTLLHours(ttlHours uint32, tx *sql.Tx) (bool, error) {
 	return true, nil
 }
 
+// Selects the value of the Parameter giving the default TTL of new jobs on the
+// Delivery Service with the XMLID $1, from its Profile.
+const selectDefaultTTLQuery = `
+SELECT parameter.value
+FROM deliveryservice ds
+JOIN profile_parameter pp ON pp.profile = ds.profile
+JOIN parameter ON parameter.id = pp.parameter
+WHERE ds.xml_id = $1
+AND parameter.name = $2
+AND parameter.config_file = 'regex_revalidate.config'
+ORDER BY parameter.id
+LIMIT 1
+`
+
+// getDefaultTTL returns the TTL, in hours, given to new Content Invalidation
+// Jobs on the Delivery Service with the given XMLID that are created without
+// one, and whether it has one - which it doesn't if it doesn't exist.
+func getDefaultTTL(tx *sql.Tx, xmlID string) (uint32, bool, error) {
+	var value string
+	if err := tx.QueryRow(selectDefaultTTLQuery, xmlID, tc.DefaultJobTTLParameterName).Scan(&value); err == sql.ErrNoRows {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	hours, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+	if err != nil || hours == 0 {
+		return 0, false, fmt.Errorf("the %s Parameter's value '%s' is not a positive integer", tc.DefaultJobTTLParameterName, value)
+	}
+	return uint32(hours), true, nil
+}
+
+// defaultTTLAlert returns the alert that tells the user that the job they
+// created without a TTL was given its Delivery Service's default.
+func defaultTTLAlert(hours uint) tc.Alert {
+	return tc.Alert{
+		Text:  fmt.Sprintf("no TTL was given, so the Delivery Service's default of %d hours was used", hours),
+		Level: tc.InfoLevel.String(),
+	}
+}
+
 // refetchAllowed checks whether Refetch is allowed and enabled in the parameter table
 func refetchAllowed(tx *sql.Tx) bool {
 	refetchEnabled := false
@@ -1516,44 +2391,509 @@ func refetchAllowed(tx *sql.Tx) bool {
 	return refetchEnabled
 }
 
-// API versions below 4.0 allowed for either the Delivery Service ID (uint) OR Delivery Service XML-ID (string).
-// This can be refactored once api versions below 4.0 are removed to take a Delivery Service XML-ID (string), rather
-// than an empty interface {}.
-func setRevalFlags(d interface{}, tx *sql.Tx) error {
+// Selects the value of the global use_reval_pending Parameter and how many
+// such Parameters there are. There should only be one, but nothing stops there
+// being duplicates, in which case the oldest is used.
+const selectUseRevalPendingQuery = `
+SELECT value, COUNT(*) OVER ()
+FROM parameter
+WHERE name = $1
+AND config_file = $2
+ORDER BY id
+LIMIT 1
+`
+
+// revalFlagColumn returns the column of the server table that must be set to
+// trigger revalidation: revalidate_update_time, unless the global
+// use_reval_pending Parameter disables that in favor of config_update_time.
+func revalFlagColumn(tx *sql.Tx) (string, error) {
 	var useReval string
-	row := tx.QueryRow(`SELECT value FROM parameter WHERE name=$1 AND config_file=$2`, tc.UseRevalPendingParameterName, tc.GlobalConfigFileName)
-	if err := row.Scan(&useReval); err != nil {
+	var count int
+	row := tx.QueryRow(selectUseRevalPendingQuery, tc.UseRevalPendingParameterName, tc.GlobalConfigFileName)
+	if err := row.Scan(&useReval, &count); err != nil {
 		if err != sql.ErrNoRows {
-			return err
+			return "", err
 		}
 		useReval = "0"
 	}
+	if count > 1 {
+		log.Warnf("found %d '%s' Parameters in config file '%s'; using the value '%s' of the oldest", count, tc.UseRevalPendingParameterName, tc.GlobalConfigFileName, useReval)
+	}
 
-	column := "revalidate_update_time"
 	if useReval == "0" {
-		column = "config_update_time"
+		return "config_update_time", nil
+	}
+	return "revalidate_update_time", nil
+}
+
+// revalLocationParameterExistsQuery checks whether any server on the CDN of a
+// Delivery Service has a Profile with the Parameter that queueUpdateOrRevalQuery
+// requires of the servers it flags.
+const revalLocationParameterExistsQuery = `
+SELECT EXISTS (
+	SELECT 1
+	FROM public.server
+	JOIN profile_parameter ON profile_parameter.profile = server.profile
+	JOIN parameter ON parameter.id = profile_parameter.parameter
+	WHERE parameter.name='location'
+	AND parameter.config_file='regex_revalidate.config'
+	AND server.cdn_id = (
+		SELECT deliveryservice.cdn_id
+		FROM deliveryservice
+		WHERE deliveryservice.%s=$1
+	)
+)
+`
+
+// revalFlagsDisabledWarning is the warning returned instead of triggering
+// revalidation when that's disabled in the configuration.
+const revalFlagsDisabledWarning = "no servers were flagged for revalidation, because setting revalidation flags is disabled in this Traffic Ops instance's configuration"
+
+// setRevalFlagsByDSID triggers revalidation on the servers of the CDN of the
+// Delivery Service with the given ID. If that flags no servers because none of
+// them have a regex_revalidate.config location Parameter, it returns a
+// warning saying so, since that's a misconfiguration that would otherwise
+// make the job silently have no effect.
+//
+// If 'skip' is true, no servers are flagged, and a warning saying so is
+// returned instead.
+func setRevalFlagsByDSID(dsid uint, tx *sql.Tx, skip bool) (string, error) {
+	return setScopedRevalFlagsInColumn(dsid, revalScope{}, "", tx, skip)
+}
+
+// setScopedRevalFlags is like setRevalFlagsByDSID, but only flags the servers
+// within the given scope.
+func setScopedRevalFlags(dsid uint, scope revalScope, tx *sql.Tx, skip bool) (string, error) {
+	return setScopedRevalFlagsInColumn(dsid, scope, "", tx, skip)
+}
+
+// setScopedRevalFlagsInColumn is like setScopedRevalFlags, but sets the given
+// server column - as returned by revalColumnOverride - rather than the one
+// revalFlagColumn chooses, unless it's empty.
+func setScopedRevalFlagsInColumn(dsid uint, scope revalScope, column string, tx *sql.Tx, skip bool) (string, error) {
+	if skip {
+		log.Infof("skipped setting revalidation flags for the CDN of the Delivery Service #%d, because that's disabled in the configuration", dsid)
+		return revalFlagsDisabledWarning, nil
+	}
+	if column == "" {
+		var err error
+		if column, err = revalFlagColumn(tx); err != nil {
+			return "", err
+		}
+	}
+	update, exists := revalFlagQueries("id", column)
+	res, err := tx.Exec(update, dsid, scope.CacheGroupID, scope.ServerTypeID)
+	if err != nil {
+		return "", err
 	}
+	flagged, err := res.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	return revalFlagsWarning(flagged, scope, func(found *bool) error {
+		return tx.QueryRow(exists, dsid).Scan(found)
+	})
+}
 
-	var q string
-	switch t := d.(type) {
-	case uint:
-		q = fmt.Sprintf(queueUpdateOrRevalQuery, column, "id")
-	case string:
-		q = fmt.Sprintf(queueUpdateOrRevalQuery, column, "xml_id")
-	default:
-		return fmt.Errorf("invalid type passed to 'setRevalFlags': %v", t)
+// revalFlagQueries builds, in order, the query that sets the given server
+// column for revalidation and the query that checks for a
+// regex_revalidate.config location Parameter, both identifying the Delivery
+// Service by the given column of the deliveryservice table. Neither column may
+// come from user input.
+func revalFlagQueries(dsColumn, column string) (string, string) {
+	return fmt.Sprintf(queueUpdateOrRevalQuery, column, dsColumn), fmt.Sprintf(revalLocationParameterExistsQuery, dsColumn)
+}
+
+// revalFlagsWarning returns the warning, if any, for having flagged the given
+// number of servers within the given scope for revalidation.
+// 'locationParameterExists' is only called - to scan whether any server has a
+// regex_revalidate.config location Parameter into its argument - when no
+// servers were flagged.
+func revalFlagsWarning(flagged int64, scope revalScope, locationParameterExists func(*bool) error) (string, error) {
+	if flagged > 0 {
+		return "", nil
 	}
 
-	row = tx.QueryRow(q, d)
-	if err := row.Scan(); err != nil && err != sql.ErrNoRows {
-		return err
+	var exists bool
+	if err := locationParameterExists(&exists); err != nil {
+		return "", fmt.Errorf("checking for regex_revalidate.config location Parameter: %v", err)
+	}
+	if exists && !scope.empty() {
+		return "no servers were flagged for revalidation, because none of the eligible servers on the Delivery Service's CDN are in the job's Cache Group and of its server Type", nil
+	}
+	if exists {
+		return "", nil
+	}
+	return "no servers were flagged for revalidation, because none of the servers on the Delivery Service's CDN have a Profile with a 'location' Parameter for 'regex_revalidate.config'; the job will have no effect until one is added", nil
+}
+
+// authorizeJobModification checks that the current user (identified in the
+// APIInfo) may modify content invalidation jobs on the Delivery Service
+// identified by `dsid`. In order, it verifies that the user's tenant may modify
+// the Delivery Service, that the user's tenant may modify jobs created by the
+// user identified by `createdByUserID` (skipped if that's nil, as it is for
+// newly created jobs), and that the user may modify the Delivery Service's CDN
+// (i.e. it isn't locked by someone else).
+//
+// This returns, in order, a user-facing error, a system error, and an HTTP
+// status code appropriate for the failure, if any.
+func authorizeJobModification(inf *api.APIInfo, dsid uint, createdByUserID *uint) (error, error, int) {
+	if userErr, sysErr, errCode := authorizeJobTenancy(inf, dsid, createdByUserID); userErr != nil || sysErr != nil {
+		return userErr, sysErr, errCode
+	}
+
+	_, cdnName, _, err := dbhelpers.GetDSNameAndCDNFromID(inf.Tx.Tx, int(dsid))
+	if err != nil {
+		return nil, errors.New("getting delivery service and CDN name from ID: " + err.Error()), http.StatusInternalServerError
+	}
+	userErr, sysErr, errCode := dbhelpers.CheckIfCurrentUserCanModifyCDN(inf.Tx.Tx, string(cdnName), inf.User.UserName)
+	return tc.NewCodedError(tc.AlertCodeNotAuthorized, userErr), sysErr, errCode
+}
+
+// authorizeJobTenancy performs the checks of authorizeJobModification that
+// concern Tenancy, leaving out the one of the Delivery Service's CDN - for
+// requests that span several CDNs, which use a cdnAuthorizer instead.
+func authorizeJobTenancy(inf *api.APIInfo, dsid uint, createdByUserID *uint) (error, error, int) {
+	if ok, err := IsUserAuthorizedToModifyDSID(inf, dsid); err != nil {
+		return nil, fmt.Errorf("Checking user permissions on DS #%d: %v", dsid, err), http.StatusInternalServerError
+	} else if !ok {
+		return tc.NewCodedError(tc.AlertCodeNotFound, errors.New("No such Delivery Service!")), nil, http.StatusNotFound
+	}
+
+	if createdByUserID != nil {
+		if ok, err := IsUserAuthorizedToModifyJobsMadeByUserID(inf, *createdByUserID); err != nil {
+			return nil, fmt.Errorf("Checking user permissions against user %v: %v", *createdByUserID, err), http.StatusInternalServerError
+		} else if !ok {
+			return tc.NewCodedError(tc.AlertCodeNotFound, fmt.Errorf("No job by id '%s'!", inf.Params["id"])), nil, http.StatusNotFound
+		}
+	}
+	return nil, nil, http.StatusOK
+}
+
+// recheckDSCDN checks, immediately before a job is written, that the current
+// user may still modify the CDN to which the identified Delivery Service
+// belongs. The Delivery Service is locked against being moved to another CDN
+// until the transaction ends, so the result holds for the write that follows.
+//
+// This returns, in order, a user-facing error, a system error, and an HTTP
+// status code, as authorizeJobModification does.
+func recheckDSCDN(inf *api.APIInfo, dsid uint) (error, error, int) {
+	var cdnName string
+	if err := inf.Tx.Tx.QueryRow(lockDSCDNQuery, dsid).Scan(&cdnName); err == sql.ErrNoRows {
+		return tc.NewCodedError(tc.AlertCodeNotFound, errors.New("No such Delivery Service!")), nil, http.StatusNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("locking CDN of Delivery Service #%d: %v", dsid, err), http.StatusInternalServerError
+	}
+	userErr, sysErr, errCode := dbhelpers.CheckIfCurrentUserCanModifyCDN(inf.Tx.Tx, cdnName, inf.User.UserName)
+	return tc.NewCodedError(tc.AlertCodeNotAuthorized, userErr), sysErr, errCode
+}
+
+// sanitizeComment returns a sanitized copy of the given job comment, or nil if
+// there's no comment or nothing is left of it after sanitization.
+func sanitizeComment(comment *string) *string {
+	if comment == nil {
+		return nil
+	}
+	sanitized := tc.SanitizeInvalidationJobComment(*comment)
+	if sanitized == "" {
+		return nil
+	}
+	return &sanitized
+}
+
+// commentChangeLog returns the part of a change log entry about a job that
+// gives its comment, which is empty if it has none.
+func commentChangeLog(comment *string) string {
+	if comment == nil {
+		return ""
+	}
+	return " COMMENT: '" + *comment + "'"
+}
+
+// onBehalfOfChangeLog returns the part of a changelog message for a newly
+// created job that records the user it was created on behalf of, if any.
+func onBehalfOfChangeLog(onBehalfOf *string) string {
+	if onBehalfOf == nil {
+		return ""
+	}
+	return " ON_BEHALF_OF: '" + *onBehalfOf + "'"
+}
+
+// JobOnBehalfOfPermission is the Permission a user needs in order to
+// attribute the Content Invalidation Jobs they create to other users.
+const JobOnBehalfOfPermission = "JOB:CREATE-ON-BEHALF"
+
+// onBehalfOfUser checks that the current user (identified in the APIInfo) may
+// create a Content Invalidation Job on the Delivery Service identified by
+// 'dsid' on behalf of the user with the given username, and returns that
+// user's ID if so. The current user must have JobOnBehalfOfPermission, and
+// the other user must be within the current user's Tenancy and must itself
+// have access to the Delivery Service.
+//
+// This returns, in order, the ID, a user-facing error, a system error, and an
+// HTTP status code, as authorizeJobModification does.
+func onBehalfOfUser(inf *api.APIInfo, username string, dsid uint) (int, error, error, int) {
+	if inf.Version == nil || inf.Version.Major < 5 {
+		return 0, errors.New("onBehalfOf is not supported before API version 5.0"), nil, http.StatusBadRequest
+	}
+	if !(inf.Config.RoleBasedPermissions && inf.User.Can(JobOnBehalfOfPermission)) && inf.User.PrivLevel != auth.PrivLevelAdmin {
+		return 0, tc.NewCodedError(tc.AlertCodeNotAuthorized, fmt.Errorf("creating jobs on behalf of other users requires the %s Permission", JobOnBehalfOfPermission)), nil, http.StatusForbidden
+	}
+
+	noSuchUser := fmt.Errorf("onBehalfOf: no such user '%s'", username)
+	var userID, userTenantID int
+	if err := inf.Tx.Tx.QueryRow(`SELECT id, tenant_id FROM tm_user WHERE username = $1`, username).Scan(&userID, &userTenantID); err == sql.ErrNoRows {
+		return 0, noSuchUser, nil, http.StatusBadRequest
+	} else if err != nil {
+		return 0, nil, fmt.Errorf("getting user '%s': %v", username, err), http.StatusInternalServerError
+	}
+	if ok, err := tenant.IsResourceAuthorizedToUserTx(userTenantID, inf.User, inf.Tx.Tx); err != nil {
+		return 0, nil, fmt.Errorf("checking tenancy of user '%s': %v", username, err), http.StatusInternalServerError
+	} else if !ok {
+		// Don't reveal the existence of users outside the current user's
+		// Tenancy.
+		return 0, noSuchUser, nil, http.StatusBadRequest
+	}
+
+	var dsTenantID int
+	if err := inf.Tx.Tx.QueryRow(`SELECT tenant_id FROM deliveryservice WHERE id = $1`, dsid).Scan(&dsTenantID); err != nil {
+		return 0, nil, fmt.Errorf("getting tenant of Delivery Service #%d: %v", dsid, err), http.StatusInternalServerError
+	}
+	if ok, err := tenant.IsResourceAuthorizedToUserTx(dsTenantID, &auth.CurrentUser{TenantID: userTenantID}, inf.Tx.Tx); err != nil {
+		return 0, nil, fmt.Errorf("checking tenancy of Delivery Service #%d for user '%s': %v", dsid, username, err), http.StatusInternalServerError
+	} else if !ok {
+		return 0, tc.NewCodedError(tc.AlertCodeNotAuthorized, fmt.Errorf("onBehalfOf: user '%s' does not have access to the Delivery Service", username)), nil, http.StatusForbidden
+	}
+
+	return userID, nil, nil, http.StatusOK
+}
+
+// jobPriority returns the given job priority, or the default priority if it's
+// nil.
+func jobPriority(priority *int) int {
+	if priority == nil {
+		return tc.MinInvalidationJobPriority
+	}
+	return *priority
+}
+
+// jobEndTime returns the time at which a job that starts at 'start' and has
+// the given TTL stops being in effect.
+func jobEndTime(start time.Time, ttlHours uint) *time.Time {
+	end := start.Add(time.Duration(ttlHours) * time.Hour)
+	return &end
+}
+
+// checkContentType checks that the request body is declared to be JSON, which
+// is the only kind of body the job handlers can parse - unless that check is
+// disabled in the configuration, for legacy clients that don't set the
+// Content-Type header properly. It returns a user-facing error, a system
+// error, and an HTTP status code, as authorizeJobModification does.
+func checkContentType(inf *api.APIInfo, r *http.Request) (error, error, int) {
+	if inf.Config != nil && inf.Config.Jobs.AllowAnyContentType {
+		return nil, nil, http.StatusOK
+	}
+	contentType := r.Header.Get(rfc.ContentType)
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType == rfc.ApplicationJSON {
+		return nil, nil, http.StatusOK
+	}
+	return fmt.Errorf("unsupported Content-Type '%s'; request bodies must be %s", contentType, rfc.ApplicationJSON), nil, http.StatusUnsupportedMediaType
+}
+
+// revalFlagsDisabled tells whether setting revalidation flags on servers is
+// disabled in the configuration, as it may be for non-production instances
+// that share a database with production.
+func revalFlagsDisabled(inf *api.APIInfo) bool {
+	return inf.Config != nil && inf.Config.Jobs.DisableRevalFlags
+}
+
+// DefaultMaxRequestBodyBytes is the default largest allowed size, in bytes, of
+// the bodies of requests to create or update Content Invalidation Jobs.
+const DefaultMaxRequestBodyBytes = 64 * 1024
+
+// limitBody restricts the request body to the size allowed by the
+// configuration (DefaultMaxRequestBodyBytes if that isn't set), so that
+// oversized bodies can't exhaust memory while they're decoded. Decoding
+// errors can be checked with bodyTooLarge to see if that limit was hit.
+func limitBody(w http.ResponseWriter, r *http.Request, inf *api.APIInfo) {
+	limit := int64(DefaultMaxRequestBodyBytes)
+	if inf.Config != nil && inf.Config.Jobs.MaxRequestBodyBytes > 0 {
+		limit = inf.Config.Jobs.MaxRequestBodyBytes
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+}
+
+// DefaultMaxAssetURLLength is the default longest allowed asset URL of a
+// Content Invalidation Job, including its Origin URL prefix. It leaves room
+// for the rest of the line within the 2048 bytes that some versions of the ATS
+// regex_revalidate plugin read from each line of regex_revalidate.config;
+// longer lines are truncated or rejected, which can break revalidation for
+// every job in the file.
+const DefaultMaxAssetURLLength = 2000
+
+// maxAssetURLLength returns the longest allowed asset URL of a Content
+// Invalidation Job, according to the configuration.
+func maxAssetURLLength(inf *api.APIInfo) int {
+	if inf.Config != nil && inf.Config.Jobs.MaxAssetURLLength > 0 {
+		return inf.Config.Jobs.MaxAssetURLLength
+	}
+	return DefaultMaxAssetURLLength
+}
+
+// checkAssetURLLength returns an error suitable for showing to the user if the
+// given asset URL - which must include the Origin URL prefix - is longer than
+// maxAssetURLLength allows.
+func checkAssetURLLength(inf *api.APIInfo, assetURL string) error {
+	if max := maxAssetURLLength(inf); len(assetURL) > max {
+		return fmt.Errorf("asset URL, including the Delivery Service's Origin URL, is %d characters long; it must be no longer than %d (the max_asset_url_length limit)", len(assetURL), max)
 	}
 	return nil
 }
 
+// bodyTooLarge checks whether an error reading a request body was caused by
+// it exceeding the limit imposed by limitBody, and if so returns a
+// user-facing error saying so. Otherwise, it returns nil.
+func bodyTooLarge(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		return nil
+	}
+	return fmt.Errorf("request body too large; must be no more than %d bytes", maxBytesErr.Limit)
+}
+
+// jobLocation returns the URL of the identified Content Invalidation Job, for
+// use in Location headers. Normally it's built from the scheme on which
+// Traffic Ops listens and the request's Host, but when the request comes from
+// one of the configured trusted proxies, its X-Forwarded-Proto and
+// X-Forwarded-Host headers take precedence, since they reflect the URL that
+// the client actually used.
+func jobLocation(inf *api.APIInfo, r *http.Request, id uint64) string {
+	scheme := inf.Config.URL.Scheme
+	host := r.Host
+	if fromTrustedProxy(inf, r) {
+		if proto := strings.ToLower(firstForwardedValue(r.Header.Get("X-Forwarded-Proto"))); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if fwdHost := firstForwardedValue(r.Header.Get("X-Forwarded-Host")); fwdHost != "" {
+			if u, err := url.Parse("//" + fwdHost); err == nil && u.Host == fwdHost {
+				host = fwdHost
+			}
+		}
+	}
+	return fmt.Sprintf("%s://%s/api/%d.%d/jobs?id=%d", scheme, host, inf.Version.Major, inf.Version.Minor, id)
+}
+
+// firstForwardedValue returns the first of the comma-separated values of an
+// X-Forwarded-* header, which is the one set by the proxy closest to the
+// client.
+func firstForwardedValue(header string) string {
+	return strings.TrimSpace(strings.SplitN(header, ",", 2)[0])
+}
+
+// fromTrustedProxy checks whether the request was made directly by one of the
+// trusted proxies in the configuration.
+func fromTrustedProxy(inf *api.APIInfo, r *http.Request) bool {
+	if inf.Config == nil || len(inf.Config.Jobs.TrustedProxies) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range inf.Config.Jobs.TrustedProxies {
+		if proxyIP := net.ParseIP(proxy); proxyIP != nil {
+			if proxyIP.Equal(ip) {
+				return true
+			}
+		} else if _, network, err := net.ParseCIDR(proxy); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDSAcceptsJobs checks that the Delivery Service identified by 'dsid' is
+// in a state in which Content Invalidation Jobs for it have any effect, i.e.
+// that it's not INACTIVE - unless that check is disabled in the configuration.
+// It returns a user-facing error, a system error, and an HTTP status code, as
+// authorizeJobModification does.
+func checkDSAcceptsJobs(inf *api.APIInfo, dsid uint) (error, error, int) {
+	if inf.Config != nil && inf.Config.Jobs.AllowInactiveDeliveryServices {
+		return nil, nil, http.StatusOK
+	}
+
+	var xmlID string
+	var active tc.DeliveryServiceActiveState
+	if err := inf.Tx.Tx.QueryRow(`SELECT xml_id, active FROM deliveryservice WHERE id=$1`, dsid).Scan(&xmlID, &active); err != nil {
+		return nil, fmt.Errorf("getting active state of Delivery Service #%d: %v", dsid, err), http.StatusInternalServerError
+	}
+	if active == tc.DSActiveStateInactive {
+		return tc.NewCodedError(tc.AlertCodeConflict, fmt.Errorf("Delivery Service '%s' is %s, so a content invalidation job for it would have no effect; set it to %s or %s first", xmlID, active, tc.DSActiveStateActive, tc.DSActiveStatePrimed)), nil, http.StatusConflict
+	}
+	return nil, nil, http.StatusOK
+}
+
+// selectDSTenantByIDQuery and selectDSTenantByXMLIDQuery select the Tenant of
+// the Delivery Service with the given ID or XMLID, respectively.
+const (
+	selectDSTenantByIDQuery    = `SELECT tenant_id FROM deliveryservice WHERE id=$1`
+	selectDSTenantByXMLIDQuery = `SELECT tenant_id FROM deliveryservice WHERE xml_id=$1`
+)
+
+// isUserAuthorizedToViewDS tells whether the current user's Tenant can see
+// the Delivery Service selected by 'query' with the argument 'ds', which is
+// one of selectDSTenantByIDQuery or selectDSTenantByXMLIDQuery.
+func isUserAuthorizedToViewDS(inf *api.APIInfo, query string, ds interface{}) (bool, error) {
+	var t int
+	if err := inf.Tx.Tx.QueryRow(query, ds).Scan(&t); err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	tenants, err := tenant.GetUserTenantIDListTx(inf.Tx.Tx, inf.User.TenantID)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range tenants {
+		if id == t {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// IsUserAuthorizedToViewDSID checks if the current user's (identified in the
+// APIInfo) Tenant can see a Delivery Service - and so its Content
+// Invalidation Jobs - using the same Tenancy rules by which reads of jobs
+// filter them. `ds` is expected to be the integral, unique identifier of the
+// Delivery Service in question.
+//
+// This is for requests that only reveal information, e.g. about a single job;
+// those that create, modify, or delete jobs must use
+// IsUserAuthorizedToModifyDSID instead, even though the two currently agree,
+// so that writes can be restricted further without also restricting reads.
+//
+// Note: If no such delivery service exists, the return values shall indicate
+// that the user isn't authorized.
+func IsUserAuthorizedToViewDSID(inf *api.APIInfo, ds uint) (bool, error) {
+	return isUserAuthorizedToViewDS(inf, selectDSTenantByIDQuery, ds)
+}
+
+// IsUserAuthorizedToViewDSXMLID is like IsUserAuthorizedToViewDSID, but `ds`
+// is expected to be the "xml_id" of the Delivery Service in question. Writes
+// must use IsUserAuthorizedToModifyDSXMLID instead.
+func IsUserAuthorizedToViewDSXMLID(inf *api.APIInfo, ds string) (bool, error) {
+	return isUserAuthorizedToViewDS(inf, selectDSTenantByXMLIDQuery, ds)
+}
+
 // Checks if the current user's (identified in the APIInfo) tenant has permissions to
 // edit a Delivery Service. `ds` is expected to be the integral, unique identifer of the
-// Delivery Service in question.
+// Delivery Service in question. This is for writes; requests that only reveal
+// information should use IsUserAuthorizedToViewDSID instead.
 //
 // This returns, in order, a boolean that indicates whether or not the current user
 // has the required tenancy to modify the indicated Delivery Service, and an error
@@ -1577,7 +2917,8 @@ func IsUserAuthorizedToModifyDSID(inf *api.APIInfo, ds uint) (bool, error) {
 
 // Checks if the current user's (identified in the APIInfo) tenant has permissions to
 // edit a Delivery Service. `ds` is expected to be the "xml_id" of the
-// Delivery Service in question.
+// Delivery Service in question. This is for writes; requests that only reveal
+// information should use IsUserAuthorizedToViewDSXMLID instead.
 //
 // This returns, in order, a boolean that indicates whether or not the current user
 // has the required tenancy to modify the indicated Delivery Service, and an error
@@ -1646,3 +2987,24 @@ func IsUserAuthorizedToModifyJobsMadeByUsername(inf *api.APIInfo, u string) (boo
 
 	return tenant.IsResourceAuthorizedToUserTx(int(t), inf.User, inf.Tx.Tx)
 }
+
+// ttlParameter is a sql.Scanner that reads a job's ttl_hr column into the
+// legacy 'TTL:##h' Parameters representation.
+type ttlParameter struct {
+	dest **string
+}
+
+// Scan implements the database/sql.Scanner interface.
+func (t ttlParameter) Scan(src interface{}) error {
+	var hours sql.NullInt64
+	if err := hours.Scan(src); err != nil {
+		return err
+	}
+	if !hours.Valid {
+		*t.dest = nil
+		return nil
+	}
+	param := tc.FormatTTLParameter(uint(hours.Int64))
+	*t.dest = &param
+	return nil
+}
@@ -0,0 +1,103 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// labelsColumn scans a job's labels column - a JSON object - into the map it
+// points to, which is left nil if the job has no labels.
+type labelsColumn struct {
+	dest *map[string]string
+}
+
+// Scan implements the database/sql.Scanner interface.
+func (l labelsColumn) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*l.dest = nil
+		return nil
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into job labels", src)
+	}
+
+	labels := map[string]string{}
+	if err := json.Unmarshal(raw, &labels); err != nil {
+		return fmt.Errorf("parsing job labels: %v", err)
+	}
+	if len(labels) == 0 {
+		labels = nil
+	}
+	*l.dest = labels
+	return nil
+}
+
+// labelsValue returns the value to store in a job's labels column for the
+// given labels.
+func labelsValue(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "{}"
+	}
+	// Marshaling a map of strings can't fail.
+	b, _ := json.Marshal(labels)
+	return string(b)
+}
+
+// labelFilter returns the condition to add to the WHERE clause of a query for
+// jobs to implement the 'label' query string parameter, if it was given,
+// adding the named parameter it uses to queryValues. The returned error is
+// suitable for showing to the user.
+func labelFilter(params map[string]string, queryValues map[string]interface{}) (string, error) {
+	filter, ok := params["label"]
+	if !ok {
+		return "", nil
+	}
+	labels, err := tc.ParseInvalidationJobLabelFilter(filter)
+	if err != nil {
+		return "", err
+	}
+	queryValues["label"] = labelsValue(labels)
+	return ` AND job.labels @> CAST(:label AS jsonb) `, nil
+}
+
+// labelsChangeLog returns the part of a change log entry about a job that
+// gives its labels, which is empty if it has none.
+func labelsChangeLog(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+":"+value)
+	}
+	sort.Strings(pairs)
+	return " LABELS: '" + strings.Join(pairs, ",") + "'"
+}
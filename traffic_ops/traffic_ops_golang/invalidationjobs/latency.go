@@ -0,0 +1,284 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+)
+
+// ApplyLatencyWindow is how long after its start time a Content Invalidation
+// Job may finish being applied and still be observed by the apply latency
+// histogram.
+const ApplyLatencyWindow = 24 * time.Hour
+
+// applyLatencyMetric is the name of the histogram of the time from the start
+// of Content Invalidation Jobs to when the last of the servers they flagged
+// applied them.
+const applyLatencyMetric = "traffic_ops_job_apply_latency_seconds"
+
+// applyLatencyBuckets are the upper bounds, in seconds, of the buckets of the
+// apply latency histogram.
+var applyLatencyBuckets = []float64{15, 30, 60, 120, 300, 600, 1800, 3600, 7200, 21600, 86400}
+
+// Selects, for each approved job that started within the last $1 seconds,
+// the number of servers it flags - as queueUpdateOrRevalQuery would, on the
+// Delivery Service's CDN and within the job's scope - and each of those that
+// has applied an update since the job flagged it, with the time it last did.
+// The format verb is replaced by the column holding that time.
+const selectJobAppliesQuery = `
+SELECT job.id, cdn.name, job.start_time, eligible.total, server.id, server.%[1]s
+FROM job
+JOIN deliveryservice ds ON ds.id = job.job_deliveryservice
+JOIN cdn ON cdn.id = ds.cdn_id
+CROSS JOIN LATERAL (
+	SELECT COUNT(*) AS total
+	FROM public.server
+	WHERE ` + revalServersCondition + `
+	AND server.cdn_id = ds.cdn_id
+	AND (job.reval_cachegroup IS NULL OR server.cachegroup = job.reval_cachegroup)
+	AND (job.reval_server_type IS NULL OR server.type = job.reval_server_type)
+) AS eligible
+JOIN public.server ON server.cdn_id = ds.cdn_id
+	AND (job.reval_cachegroup IS NULL OR server.cachegroup = job.reval_cachegroup)
+	AND (job.reval_server_type IS NULL OR server.type = job.reval_server_type)
+	AND server.%[1]s >= GREATEST(job.start_time, job.entered_time)
+WHERE job.approval_state = 'APPROVED'
+AND job.start_time <= now()
+AND job.start_time > now() - ($1 * INTERVAL '1 second')
+AND ` + revalServersCondition + `
+`
+
+// applyingJob is a job that not every server it flagged has been seen to
+// apply yet.
+type applyingJob struct {
+	start time.Time
+	// firstApplies holds the earliest time each server has been seen to have
+	// applied an update since the job flagged it, by server ID.
+	firstApplies map[uint64]time.Time
+}
+
+// latencyHistogram is a Prometheus-style histogram of apply latencies,
+// labeled by CDN, which observes each job at most once.
+type latencyHistogram struct {
+	mu sync.Mutex
+	// buckets are the upper bounds of the buckets, in ascending order.
+	buckets []float64
+	// counts holds, for each CDN, the number of observations in each bucket
+	// (not cumulatively), with a final one for those above every bound.
+	counts map[string][]uint64
+	sums   map[string]float64
+	// observed holds the start times of the jobs that have been observed, by
+	// ID, so that they aren't observed again.
+	observed map[uint64]time.Time
+	// applying holds the jobs that haven't been observed yet, by ID.
+	applying map[uint64]*applyingJob
+}
+
+func newLatencyHistogram(buckets []float64) *latencyHistogram {
+	return &latencyHistogram{
+		buckets:  buckets,
+		counts:   map[string][]uint64{},
+		sums:     map[string]float64{},
+		observed: map[uint64]time.Time{},
+		applying: map[uint64]*applyingJob{},
+	}
+}
+
+// applyLatencies is the apply latency histogram of this Traffic Ops instance.
+var applyLatencies = newLatencyHistogram(applyLatencyBuckets)
+
+// applied notes that the identified server, one of the 'eligible' servers
+// flagged by the identified job on the named CDN, has applied an update since
+// the job flagged it, most recently at the given time. Only the first time
+// that's noted for each server counts, since the server may have applied
+// other updates since. Once every flagged server has applied the job, its
+// apply latency - until the last of their first applies - is observed.
+func (h *latencyHistogram) applied(jobID uint64, cdn string, start time.Time, eligible int, serverID uint64, at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.observed[jobID]; ok {
+		return
+	}
+	job, ok := h.applying[jobID]
+	if !ok {
+		job = &applyingJob{start: start, firstApplies: map[uint64]time.Time{}}
+		h.applying[jobID] = job
+	}
+	if _, ok := job.firstApplies[serverID]; !ok {
+		job.firstApplies[serverID] = at
+	}
+	if len(job.firstApplies) < eligible {
+		return
+	}
+
+	var last time.Time
+	for _, first := range job.firstApplies {
+		if first.After(last) {
+			last = first
+		}
+	}
+	delete(h.applying, jobID)
+	h.observeLocked(jobID, cdn, start, last.Sub(start))
+}
+
+// observe records the apply latency of the identified job on the named CDN,
+// unless it's already been recorded.
+func (h *latencyHistogram) observe(jobID uint64, cdn string, start time.Time, latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.observeLocked(jobID, cdn, start, latency)
+}
+
+// observeLocked is observe, for callers that hold the lock.
+func (h *latencyHistogram) observeLocked(jobID uint64, cdn string, start time.Time, latency time.Duration) {
+	if _, ok := h.observed[jobID]; ok {
+		return
+	}
+	h.observed[jobID] = start
+
+	counts, ok := h.counts[cdn]
+	if !ok {
+		counts = make([]uint64, len(h.buckets)+1)
+		h.counts[cdn] = counts
+	}
+	seconds := latency.Seconds()
+	i := sort.SearchFloat64s(h.buckets, seconds)
+	counts[i]++
+	h.sums[cdn] += seconds
+}
+
+// forget stops remembering the jobs that started before the given time, which
+// can no longer be selected for observation.
+func (h *latencyHistogram) forget(before time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for id, start := range h.observed {
+		if start.Before(before) {
+			delete(h.observed, id)
+		}
+	}
+	for id, job := range h.applying {
+		if job.start.Before(before) {
+			delete(h.applying, id)
+		}
+	}
+}
+
+// write writes the histogram in the Prometheus text exposition format.
+func (h *latencyHistogram) write(buf *bytes.Buffer, name string, help string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buf, "# TYPE %s histogram\n", name)
+	cdns := make([]string, 0, len(h.counts))
+	for cdn := range h.counts {
+		cdns = append(cdns, cdn)
+	}
+	sort.Strings(cdns)
+	for _, cdn := range cdns {
+		label := escapeLabelValue(cdn)
+		var cumulative uint64
+		for i, count := range h.counts[cdn] {
+			cumulative += count
+			le := "+Inf"
+			if i < len(h.buckets) {
+				le = strconv.FormatFloat(h.buckets[i], 'g', -1, 64)
+			}
+			fmt.Fprintf(buf, "%s_bucket{cdn=\"%s\",le=\"%s\"} %d\n", name, label, le, cumulative)
+		}
+		fmt.Fprintf(buf, "%s_sum{cdn=\"%s\"} %s\n", name, label, strconv.FormatFloat(h.sums[cdn], 'g', -1, 64))
+		fmt.Fprintf(buf, "%s_count{cdn=\"%s\"} %d\n", name, label, cumulative)
+	}
+}
+
+// escapeLabelValue escapes a label value for the Prometheus text exposition
+// format.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// sampleApplyLatencies notes which servers have applied each recent job, and
+// observes the apply latency of each job that's finished being applied since
+// the last sample.
+func sampleApplyLatencies(tx *sql.Tx, h *latencyHistogram) error {
+	column, err := revalFlagColumn(tx)
+	if err != nil {
+		return fmt.Errorf("getting reval flag column: %v", err)
+	}
+	h.forget(time.Now().Add(-ApplyLatencyWindow))
+
+	rows, err := tx.Query(fmt.Sprintf(selectJobAppliesQuery, revalApplyColumns[column]), int64(ApplyLatencyWindow.Seconds()))
+	if err != nil {
+		return fmt.Errorf("querying job applies: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, serverID uint64
+		var cdn string
+		var start, at time.Time
+		var eligible int
+		if err := rows.Scan(&id, &cdn, &start, &eligible, &serverID, &at); err != nil {
+			return fmt.Errorf("scanning job apply: %v", err)
+		}
+		h.applied(id, cdn, start, eligible, serverID, at)
+	}
+	return rows.Err()
+}
+
+// GetApplyLatencyMetrics is the handler for GET requests to /jobs/metrics in
+// API version 5.0 and later. It responds, in the Prometheus text exposition
+// format, with a histogram of the time from the start of Content Invalidation
+// Jobs to when the last of the servers they flagged applied them, labeled by
+// CDN. Jobs are sampled when this is requested, so the histogram only grows
+// while something is scraping it, and each server's first apply of a job is
+// only as precise as the interval between scrapes. The histogram is kept in
+// memory, so each Traffic Ops instance has its own, covering only the samples
+// it took; it starts over whenever the instance restarts.
+func GetApplyLatencyMetrics(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, nil, nil)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+
+	if err := sampleApplyLatencies(inf.Tx.Tx, applyLatencies); err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("sampling job apply latencies: %v", err))
+		return
+	}
+
+	var buf bytes.Buffer
+	applyLatencies.write(&buf, applyLatencyMetric, "Time from the start of a content invalidation job until the last server it flagged applied it.")
+	w.Header().Set(rfc.ContentType, "text/plain; version=0.0.4; charset=utf-8")
+	api.WriteAndLogErr(w, r, buf.Bytes())
+}
@@ -0,0 +1,102 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+)
+
+// jobLogger logs messages about the handling of a single request, prefixed
+// with key=value pairs that identify the request - its ID and the requesting
+// user - so that everything logged while handling it can be found together.
+type jobLogger struct {
+	prefix string
+}
+
+// newJobLogger returns a jobLogger for the request described by inf, being
+// handled by the named handler. A nil inf gives a logger that identifies only
+// the handler.
+func newJobLogger(inf *api.APIInfo, handler string) jobLogger {
+	fields := []string{"handler=" + handler}
+	if inf != nil {
+		fields = append(fields, "reqid="+strconv.FormatUint(inf.ReqID, 10))
+		if inf.User != nil {
+			fields = append(fields, "user="+strconv.Quote(inf.User.UserName))
+		}
+	}
+	return jobLogger{prefix: strings.Join(fields, " ") + " "}
+}
+
+// kv formats alternating keys and values as space-separated key=value pairs.
+// String values are quoted so that spaces in them can't be confused with the
+// separators.
+func kv(pairs ...interface{}) string {
+	fields := make([]string, 0, (len(pairs)+1)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		if i+1 >= len(pairs) {
+			fields = append(fields, fmt.Sprintf("%v=<missing>", pairs[i]))
+			break
+		}
+		v := pairs[i+1]
+		switch val := v.(type) {
+		case string:
+			v = strconv.Quote(val)
+		case *string:
+			if val == nil {
+				v = "<nil>"
+			} else {
+				v = strconv.Quote(*val)
+			}
+		}
+		fields = append(fields, fmt.Sprintf("%v=%v", pairs[i], v))
+	}
+	return strings.Join(fields, " ")
+}
+
+// Debugf logs a debug-level message.
+func (l jobLogger) Debugf(format string, v ...interface{}) {
+	log.Debugf(l.prefix+format, v...)
+}
+
+// Event logs an info-level message consisting of the given event name and
+// key=value pairs.
+func (l jobLogger) Event(event string, pairs ...interface{}) {
+	if len(pairs) == 0 {
+		log.Infof("%sevent=%s", l.prefix, event)
+		return
+	}
+	log.Infof("%sevent=%s %s", l.prefix, event, kv(pairs...))
+}
+
+// revalFlags logs the outcome of setting the revalidation flags of the CDN of
+// the identified Delivery Service, including the warning setting them
+// returned, if any.
+func (l jobLogger) revalFlags(ds interface{}, warning string) {
+	if warning != "" {
+		l.Event("reval_flags_set", "ds", ds, "warning", warning)
+		return
+	}
+	l.Event("reval_flags_set", "ds", ds)
+}
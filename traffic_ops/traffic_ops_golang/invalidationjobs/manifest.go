@@ -0,0 +1,288 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/dbhelpers"
+)
+
+// maxCombinedManifestRegexLength is the longest that the regular expression of
+// a job combining all of the paths in a manifest may be. Manifests that would
+// need a longer one get one job per path instead.
+const maxCombinedManifestRegexLength = 4096
+
+// validateManifestPath checks that a path from a manifest - with its leading
+// slash already removed - is a plain relative path.
+func validateManifestPath(path string) error {
+	if strings.Contains(path, "://") {
+		return fmt.Errorf("'%s' must be relative to the Delivery Service's Origin, not a full URL", path)
+	}
+	for _, r := range path {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return fmt.Errorf("'%s' must not contain whitespace or control characters", path)
+		}
+	}
+	return nil
+}
+
+// manifestRegexes returns the regular expressions of the jobs to create for
+// the given manifest paths: either one that matches all of them, if 'combine'
+// is true and it's no longer than 'maxCombined' (nor
+// maxCombinedManifestRegexLength), or else one for each. It also returns
+// whether or not the paths were combined.
+func manifestRegexes(paths []string, combine bool, maxCombined int) ([]string, bool) {
+	quoted := make([]string, 0, len(paths))
+	for _, path := range paths {
+		quoted = append(quoted, regexp.QuoteMeta(path))
+	}
+
+	if combine && len(quoted) > 1 {
+		combined := "/(?:" + strings.Join(quoted, "|") + ")"
+		if len(combined) <= maxCombinedManifestRegexLength && len(combined) <= maxCombined {
+			return []string{combined}, true
+		}
+	}
+
+	regexes := make([]string, 0, len(quoted))
+	for _, q := range quoted {
+		regexes = append(regexes, "/"+q)
+	}
+	return regexes, len(regexes) == 1
+}
+
+// CreateFromManifest is the handler for POST requests to /jobs/manifest in
+// API version 5.0 and later. It creates Content Invalidation Jobs on the
+// Delivery Service's primary Origin for each of the literal paths in the
+// request's manifest - or a single job covering all of them, if requested -
+// all sharing one start time, TTL, and type. Either every job is created, or
+// none are. Revalidation is triggered only once, after all of the jobs have
+// been created, unless the jobs are left pending approval.
+//
+// The jobs are recorded just as CreateV40 records them, but Idempotency-Keys
+// aren't supported, since a retry couldn't be told apart from a different
+// manifest starting with the same path.
+func CreateFromManifest(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, nil, nil)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+	tx := inf.Tx.Tx
+
+	if userErr, sysErr, errCode = checkContentType(inf, r); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+		return
+	}
+	if r.Header.Get(rfc.IdempotencyKey) != "" {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, fmt.Errorf("%s is not supported for Invalidation Job manifests", rfc.IdempotencyKey), nil)
+		return
+	}
+	limitBody(w, r, inf)
+
+	var manifest tc.InvalidationJobManifest
+	if err := json.NewDecoder(r.Body).Decode(&manifest); err != nil {
+		if tooLarge := bodyTooLarge(err); tooLarge != nil {
+			api.HandleErr(w, r, tx, http.StatusRequestEntityTooLarge, tooLarge, nil)
+			return
+		}
+		api.HandleErr(w, r, tx, http.StatusBadRequest, errors.New("Unable to parse Invalidation Job manifest"), fmt.Errorf("parsing jobs/manifest POST: %v", err))
+		return
+	}
+
+	paths, err := manifest.Paths()
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, err, nil)
+		return
+	}
+	if len(paths) == 0 {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, errors.New("manifest: must contain at least one path"), nil)
+		return
+	}
+	if len(paths) > tc.MaxInvalidationJobManifestPaths {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, fmt.Errorf("manifest: must contain no more than %d paths", tc.MaxInvalidationJobManifestPaths), nil)
+		return
+	}
+	errs := []string{}
+	for _, path := range paths {
+		if err := validateManifestPath(path); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, errors.New("manifest: "+strings.Join(errs, ", ")), nil)
+		return
+	}
+
+	job := tc.InvalidationJobCreateV4{
+		DeliveryService:  manifest.DeliveryService,
+		Regex:            "/" + regexp.QuoteMeta(paths[0]),
+		StartTime:        manifest.StartTime,
+		TTLHours:         manifest.TTLHours,
+		InvalidationType: manifest.InvalidationType,
+		Comment:          sanitizeComment(manifest.Comment),
+		Priority:         manifest.Priority,
+		Labels:           manifest.Labels,
+		OnBehalfOf:       manifest.OnBehalfOf,
+		PendingApproval:  manifest.PendingApproval,
+		CacheGroup:       manifest.CacheGroup,
+		ServerType:       manifest.ServerType,
+		ExpiryWebhook:    manifest.ExpiryWebhook,
+	}
+	if err := validateJobCreateV4(job, tx); err != nil {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, err, nil)
+		return
+	}
+
+	dsid, exists, err := dbhelpers.GetDSIDFromXMLID(tx, job.DeliveryService)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("failed to match XML ID to int ID for Delivery Service %s: %v", job.DeliveryService, err))
+		return
+	}
+	if !exists {
+		api.HandleErr(w, r, tx, http.StatusNotFound, tc.NewCodedError(tc.AlertCodeNotFound, fmt.Errorf("delivery service \"%v\" does not exist", job.DeliveryService)), nil)
+		return
+	}
+	if userErr, sysErr, errCode = authorizeJobModification(inf, uint(dsid), nil); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+		return
+	}
+	if userErr, sysErr, errCode = checkDSAcceptsJobs(inf, uint(dsid)); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+		return
+	}
+
+	jobUserID := inf.User.ID
+	if job.OnBehalfOf != nil {
+		if jobUserID, userErr, sysErr, errCode = onBehalfOfUser(inf, *job.OnBehalfOf, uint(dsid)); userErr != nil || sysErr != nil {
+			api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+			return
+		}
+	}
+
+	pending, userErr, sysErr, errCode := needsApproval(inf, uint(dsid), job.PendingApproval)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+		return
+	}
+
+	scope, userErr, sysErr, errCode := resolveRevalScope(inf, job, uint(dsid))
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+		return
+	}
+
+	revalColumn, userErr, errCode := revalColumnOverride(inf)
+	if userErr != nil {
+		api.HandleErr(w, r, tx, errCode, userErr, nil)
+		return
+	}
+
+	if err := validateExpiryWebhook(inf, job); err != nil {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, err, nil)
+		return
+	}
+
+	origins, err := getDSOrigins(inf, uint(dsid))
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("getting Origins of Delivery Service #%d: %v", dsid, err))
+		return
+	}
+	if len(origins) == 0 {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, fmt.Errorf("delivery service \"%s\" has no Origins", job.DeliveryService), nil)
+		return
+	}
+	// getDSOrigins lists the primary Origin first.
+	origin := origins[0]
+	if err := origin.validate(); err != nil {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, err, nil)
+		return
+	}
+
+	// Paths are only combined if the resulting asset URL isn't too long.
+	regexes, combined := manifestRegexes(paths, manifest.Combine, maxAssetURLLength(inf)-len(origin.URL()))
+
+	now := time.Now()
+	summary := tc.InvalidationJobManifestSummary{
+		DeliveryService: job.DeliveryService,
+		Paths:           len(paths),
+		Combined:        combined,
+		Jobs:            make([]tc.InvalidationJobV5, 0, len(regexes)),
+	}
+	for _, regex := range regexes {
+		assetURL := origin.URL() + regex
+		if !origin.matches(assetURL) {
+			api.HandleErr(w, r, tx, http.StatusBadRequest, fmt.Errorf("manifest: asset URL '%s' does not start with Delivery Service origin URL: %s", assetURL, origin.URL()), nil)
+			return
+		}
+		if err := checkAssetURLLength(inf, assetURL); err != nil {
+			api.HandleErr(w, r, tx, http.StatusBadRequest, errors.New("manifest: "+err.Error()), nil)
+			return
+		}
+
+		result, err := insertJob(tx, job, assetURL, now, jobUserID, uint(dsid), pending)
+		if err != nil {
+			userErr, sysErr, errCode := api.ParseDBError(err)
+			api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+			return
+		}
+		summary.Jobs = append(summary.Jobs, result)
+	}
+
+	ids := make([]uint64, 0, len(summary.Jobs))
+	for _, result := range summary.Jobs {
+		ids = append(ids, result.ID)
+	}
+	revalWarning, err := finishCreatedJobs(inf, job, uint(dsid), pending, scope, revalColumn, nil, ids...)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, err)
+		return
+	}
+	alerts := tc.Alerts{}
+	if pending {
+		alerts.AddAlert(pendingApprovalAlert(inf))
+	} else if revalWarning != "" {
+		alerts.AddNewAlert(tc.WarnLevel, revalWarning)
+	}
+	if manifest.Combine && !combined {
+		alerts.AddNewAlert(tc.WarnLevel, "the manifest's paths were too many or too long to combine, so one job was created for each")
+	}
+	logCreatedJobs(inf, job, uint(dsid), pending, revalColumn, summary.Jobs, &alerts)
+	alerts.AddNewAlert(tc.SuccessLevel, fmt.Sprintf("Invalidation (%s) requests created for %d paths of %s in %d jobs, start:%v end %v",
+		job.InvalidationType,
+		len(paths),
+		job.DeliveryService,
+		len(summary.Jobs),
+		job.StartTime,
+		job.StartTime.Add(time.Hour*time.Duration(job.TTLHours))))
+	api.WriteAlertsObj(w, r, http.StatusOK, alerts, summary)
+}
@@ -0,0 +1,83 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/dbhelpers"
+)
+
+// effectiveMaxRevalDuration returns the maximum duration, in days, of the jobs
+// in regex_revalidate.config exactly as t3c determines it: from the
+// maxRevalDurationDays Parameter, or atscfg.DefaultMaxRevalDurationDays if
+// that doesn't exist or isn't a positive integer, in which case the returned
+// boolean is true.
+func effectiveMaxRevalDuration(tx *sql.Tx) (int, bool, error) {
+	days, err := maxRevalDurationDays(tx)
+	if err != nil {
+		return 0, false, err
+	}
+	if days <= 0 {
+		return atscfg.DefaultMaxRevalDurationDays, true, nil
+	}
+	return days, false, nil
+}
+
+// GetMaxRevalDuration is the handler for GET requests to
+// /jobs/max_reval_duration in API version 5.0 and later. It responds with the
+// effective maximum duration of the Content Invalidation Jobs on the CDN named
+// by the 'cdn' query string parameter, so that clients can cap the TTLs of new
+// jobs before submitting them. The maxRevalDurationDays Parameter is global,
+// so that's currently the same for every CDN.
+func GetMaxRevalDuration(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, []string{"cdn"}, nil)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+
+	cdnName := inf.Params["cdn"]
+	if _, ok, err := dbhelpers.GetCDNIDFromName(inf.Tx.Tx, tc.CDNName(cdnName)); err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting ID of CDN '%s': %v", cdnName, err))
+		return
+	} else if !ok {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusNotFound, tc.NewCodedError(tc.AlertCodeNotFound, fmt.Errorf("no such CDN '%s'", cdnName)), nil)
+		return
+	}
+
+	days, isDefault, err := effectiveMaxRevalDuration(inf.Tx.Tx)
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting maxRevalDurationDays Parameter: %v", err))
+		return
+	}
+	api.WriteResp(w, r, tc.InvalidationJobMaxRevalDuration{
+		CDN:                  cdnName,
+		MaxRevalDurationDays: days,
+		MaxTTLHours:          days * 24,
+		IsDefault:            isDefault,
+	})
+}
@@ -0,0 +1,201 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+)
+
+// Selects every Origin of a Delivery Service, primary first.
+const selectDSOriginsQuery = `
+SELECT protocol, fqdn, port
+FROM origin
+WHERE deliveryservice = $1
+ORDER BY is_primary DESC, id
+`
+
+// Like insertQueryV4, but the asset URL is given in full rather than being
+// built from the Delivery Service's primary Origin.
+const insertAssetURLQueryV4 = `
+INSERT INTO job (
+	ttl_hr,
+	asset_url,
+	start_time,
+	entered_time,
+	job_user,
+	job_deliveryservice,
+	invalidation_type,
+	recurrence_interval_hr,
+	recurrence_end,
+	comment,
+	priority,
+	labels)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12::jsonb)
+RETURNING
+	id,
+	asset_url,
+	(
+		SELECT tm_user.username
+		FROM tm_user
+		WHERE tm_user.id=job_user) AS createdBy,
+	(
+		SELECT deliveryservice.xml_id
+		FROM deliveryservice
+		WHERE deliveryservice.id=job_deliveryservice) AS deliveryServiceXML,
+	ttl_hr as ttlHrs,
+	invalidation_type as invalidationType,
+	start_time as startTime,
+	recurrence_interval_hr,
+	recurrence_end,
+	comment,
+	priority,
+	labels
+`
+
+func getDSOrigins(inf *api.APIInfo, dsid uint) ([]originInfo, error) {
+	rows, err := inf.Tx.Tx.Query(selectDSOriginsQuery, dsid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	origins := []originInfo{}
+	for rows.Next() {
+		var o originInfo
+		if err := rows.Scan(&o.Protocol, &o.FQDN, &o.Port); err != nil {
+			return nil, err
+		}
+		origins = append(origins, o)
+	}
+	return origins, rows.Err()
+}
+
+// createForAllOrigins handles a request to create a Content Invalidation Job
+// with allOrigins set, by creating one job for the requested regular
+// expression on each of the Delivery Service's Origins. Revalidation is
+// triggered only once, after all of the jobs have been created. The jobs are
+// attributed to the user with the ID 'jobUserID'. The response is the list of
+// all of the created jobs. Existing jobs that overlap the new ones are treated
+// as 'uniqueness' says: with ifNotExists, no job is created for an Origin that
+// already has an identical one in effect at an overlapping time, and the
+// existing job is listed in the response instead; otherwise, with strict, no
+// job is created for any Origin if any of them has one. If 'pending' is true,
+// the new jobs are left pending approval, and revalidation isn't triggered;
+// otherwise, only the servers within 'scope' are flagged. The created jobs are
+// recorded for the request's Idempotency-Key, 'key', if it has one. If
+// 'defaultTTL' is true, the job's TTL is the Delivery Service's default, which
+// the response says.
+func createForAllOrigins(w http.ResponseWriter, r *http.Request, inf *api.APIInfo, job tc.InvalidationJobCreateV4, dsid uint, jobUserID int, uniqueness jobUniqueness, pending bool, scope revalScope, revalColumn string, key *idempotencyKey, defaultTTL bool) {
+	tx := inf.Tx.Tx
+	origins, err := getDSOrigins(inf, dsid)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("getting Origins of Delivery Service #%d: %v", dsid, err))
+		return
+	}
+	if len(origins) == 0 {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, fmt.Errorf("delivery service \"%s\" has no Origins", job.DeliveryService), nil)
+		return
+	}
+
+	for _, origin := range origins {
+		if err := origin.validate(); err != nil {
+			api.HandleErr(w, r, tx, http.StatusBadRequest, fmt.Errorf("%s: %v", origin.URL(), err), nil)
+			return
+		}
+		if err := checkAssetURLLength(inf, origin.URL()+job.Regex); err != nil {
+			api.HandleErr(w, r, tx, http.StatusBadRequest, err, nil)
+			return
+		}
+	}
+
+	// The existing jobs overlapping the new one for each Origin, by index.
+	existing := make([][]tc.InvalidationJobV5, len(origins))
+	if uniqueness.checked() {
+		conflicts := []tc.InvalidationJobV5{}
+		for i, origin := range origins {
+			if existing[i], err = getOverlappingJobs(tx, dsid, origin.URL()+job.Regex, job.StartTime, uint(job.TTLHours)); err != nil {
+				api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("getting jobs overlapping new job on Delivery Service #%d: %v", dsid, err))
+				return
+			}
+			conflicts = append(conflicts, existing[i]...)
+		}
+		if len(conflicts) > 0 && !uniqueness.ifNotExists {
+			writeConflicts(w, r, conflicts)
+			return
+		}
+	}
+
+	now := time.Now()
+	results := make([]tc.InvalidationJobV5, 0, len(origins))
+	created := make([]tc.InvalidationJobV5, 0, len(origins))
+	alerts := tc.Alerts{}
+	for i, origin := range origins {
+		if len(existing[i]) > 0 {
+			alerts.AddAlert(existingJobAlert(existing[i][0]))
+			results = append(results, existing[i][0])
+			continue
+		}
+
+		result, err := insertJob(tx, job, origin.URL()+job.Regex, now, jobUserID, dsid, pending)
+		if err != nil {
+			userErr, sysErr, errCode := api.ParseDBError(err)
+			api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+			return
+		}
+		results = append(results, result)
+		created = append(created, result)
+	}
+
+	if len(created) == 0 {
+		api.WriteAlertsObj(w, r, http.StatusOK, alerts, results)
+		return
+	}
+
+	ids := make([]uint64, 0, len(created))
+	for _, result := range created {
+		ids = append(ids, result.ID)
+	}
+	revalWarning, err := finishCreatedJobs(inf, job, dsid, pending, scope, revalColumn, key, ids...)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, err)
+		return
+	}
+	if pending {
+		alerts.AddAlert(pendingApprovalAlert(inf))
+	} else if revalWarning != "" {
+		alerts.AddNewAlert(tc.WarnLevel, revalWarning)
+	}
+	logCreatedJobs(inf, job, dsid, pending, revalColumn, created, &alerts)
+	alerts.AddNewAlert(tc.SuccessLevel, fmt.Sprintf("Invalidation (%s) request created for %d Origins of %s, start:%v end %v",
+		job.InvalidationType,
+		len(created),
+		job.DeliveryService,
+		created[0].StartTime,
+		created[0].StartTime.Add(time.Hour*time.Duration(job.TTLHours))))
+	if defaultTTL {
+		alerts.AddAlert(defaultTTLAlert(uint(job.TTLHours)))
+	}
+	api.WriteAlertsObj(w, r, http.StatusOK, alerts, results)
+}
@@ -0,0 +1,138 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+)
+
+// Selects the host names of the servers that queueUpdateOrRevalQuery flags for
+// the Delivery Service with the given ID which haven't yet applied the last
+// update they were flagged for. If any of the Delivery Service's active,
+// approved jobs are limited to a Cache Group and/or server Type, only the
+// servers within the scope of at least one of its active, approved jobs are
+// selected - otherwise, all of them are.
+const selectRevalPendingServersQuery = `
+SELECT server.host_name
+FROM public.server
+WHERE ` + revalServersCondition + `
+AND server.cdn_id = (
+	SELECT deliveryservice.cdn_id
+	FROM deliveryservice
+	WHERE deliveryservice.id = $1
+)
+AND server.%s > server.%s
+AND (
+	NOT EXISTS (
+		SELECT 1
+		FROM job
+		WHERE job.job_deliveryservice = $1
+		AND job.approval_state = 'APPROVED'
+		AND ` + jobActiveCondition + `
+		AND (job.reval_cachegroup IS NOT NULL OR job.reval_server_type IS NOT NULL)
+	)
+	OR EXISTS (
+		SELECT 1
+		FROM job
+		WHERE job.job_deliveryservice = $1
+		AND job.approval_state = 'APPROVED'
+		AND ` + jobActiveCondition + `
+		AND (job.reval_cachegroup IS NULL OR job.reval_cachegroup = server.cachegroup)
+		AND (job.reval_server_type IS NULL OR job.reval_server_type = server.type)
+	)
+)
+ORDER BY server.host_name
+`
+
+// getRevalPendingServers gets the host names of the servers flagged in the
+// given column for the Delivery Service with the given ID which haven't yet
+// applied the update they were flagged for.
+func getRevalPendingServers(tx *sql.Tx, dsID int, column string) ([]string, error) {
+	rows, err := tx.Query(fmt.Sprintf(selectRevalPendingServersQuery, column, revalApplyColumns[column]), dsID)
+	if err != nil {
+		return nil, err
+	}
+	defer log.Close(rows, "closing reval pending server rows")
+
+	hostNames := []string{}
+	for rows.Next() {
+		var hostName string
+		if err := rows.Scan(&hostName); err != nil {
+			return nil, fmt.Errorf("scanning: %v", err)
+		}
+		hostNames = append(hostNames, hostName)
+	}
+	return hostNames, rows.Err()
+}
+
+// GetRevalPendingServers is the handler for GET requests to
+// /deliveryservices/{id}/reval_pending_servers in API version 5.0 and later.
+// It responds with the host names of the servers that Content Invalidation
+// Jobs on the identified Delivery Service flag for revalidation (or for
+// updates, depending on the use_reval_pending Parameter) which haven't yet
+// applied it. When the Delivery Service's active jobs are limited to Cache
+// Groups and/or server Types, only the servers within their scopes are
+// included.
+func GetRevalPendingServers(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, []string{"id"}, []string{"id"})
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+
+	dsID := inf.IntParams["id"]
+	var tenantID int
+	if err := inf.Tx.Tx.QueryRow(`SELECT tenant_id FROM deliveryservice WHERE id = $1`, dsID).Scan(&tenantID); err == sql.ErrNoRows {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusNotFound, fmt.Errorf("no Delivery Service exists with ID %d", dsID), nil)
+		return
+	} else if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting tenant of Delivery Service #%d: %v", dsID, err))
+		return
+	}
+	if ok, err := inf.IsResourceAuthorizedToCurrentUser(tenantID); err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("checking tenancy of Delivery Service #%d: %v", dsID, err))
+		return
+	} else if !ok {
+		// Don't reveal the existence of Delivery Services outside the user's
+		// Tenancy.
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusNotFound, fmt.Errorf("no Delivery Service exists with ID %d", dsID), nil)
+		return
+	}
+
+	column, err := revalFlagColumn(inf.Tx.Tx)
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting reval flag column: %v", err))
+		return
+	}
+
+	hostNames, err := getRevalPendingServers(inf.Tx.Tx, dsID, column)
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting reval pending servers of Delivery Service #%d: %v", dsID, err))
+		return
+	}
+
+	api.WriteResp(w, r, hostNames)
+}
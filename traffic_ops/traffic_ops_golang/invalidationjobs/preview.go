@@ -0,0 +1,190 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/dbhelpers"
+)
+
+// Selects the maxRevalDurationDays Parameter the way t3c chooses among
+// several of them: the lowest, compared as strings.
+const selectMaxRevalDurationDaysQuery = `
+SELECT value
+FROM parameter
+WHERE name = $1
+AND config_file = $2
+ORDER BY value
+LIMIT 1
+`
+
+// maxRevalDurationDays returns the value of the maxRevalDurationDays
+// Parameter, which caps the TTLs of jobs in regex_revalidate.config, or 0 if
+// it doesn't exist or isn't an integer, in which case t3c uses a default.
+func maxRevalDurationDays(tx *sql.Tx) (int, error) {
+	var value string
+	if err := tx.QueryRow(selectMaxRevalDurationDaysQuery, atscfg.RegexRevalidateMaxRevalDurationDaysParamName, atscfg.RegexRevalidateFileName).Scan(&value); err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, nil
+	}
+	return days, nil
+}
+
+// previewJob builds the job whose line of regex_revalidate.config is
+// previewed from the query string parameters of a request to
+// /jobs/reval_preview: either an existing job, by 'id', or a proposed one.
+//
+// This returns, in order, the job, a user-facing error, a system error, and
+// an HTTP status code, as authorizeJobModification does.
+func previewJob(inf *api.APIInfo) (tc.InvalidationJobV5, error, error, int) {
+	tx := inf.Tx.Tx
+	if id, ok := inf.IntParams["id"]; ok {
+		jobs, err := getJobsByID(tx, []int64{int64(id)})
+		if err != nil {
+			return tc.InvalidationJobV5{}, nil, fmt.Errorf("getting job #%d: %v", id, err), http.StatusInternalServerError
+		}
+		noSuchJob := tc.NewCodedError(tc.AlertCodeNotFound, fmt.Errorf("No job by id '%d'!", id))
+		if len(jobs) == 0 {
+			return tc.InvalidationJobV5{}, noSuchJob, nil, http.StatusNotFound
+		}
+		if ok, err := IsUserAuthorizedToViewDSXMLID(inf, jobs[0].DeliveryService); err != nil {
+			return tc.InvalidationJobV5{}, nil, fmt.Errorf("checking user permissions on DS %s: %v", jobs[0].DeliveryService, err), http.StatusInternalServerError
+		} else if !ok {
+			return tc.InvalidationJobV5{}, noSuchJob, nil, http.StatusNotFound
+		}
+		return jobs[0], nil, nil, http.StatusOK
+	}
+
+	for _, param := range []string{"deliveryService", "regex", "ttlHours"} {
+		if _, ok := inf.Params[param]; !ok {
+			return tc.InvalidationJobV5{}, fmt.Errorf("either 'id' or '%s' is required", param), nil, http.StatusBadRequest
+		}
+	}
+	job := tc.InvalidationJobV5{
+		DeliveryService:  inf.Params["deliveryService"],
+		InvalidationType: tc.REFRESH,
+		StartTime:        time.Now(),
+	}
+	ttl, err := strconv.ParseUint(inf.Params["ttlHours"], 10, 32)
+	if err != nil || ttl == 0 {
+		return job, errors.New("'ttlHours' must be a positive integer"), nil, http.StatusBadRequest
+	}
+	job.TTLHours = uint(ttl)
+	if t, ok := inf.Params["invalidationType"]; ok {
+		if t != tc.REFRESH && t != tc.REFETCH {
+			return job, fmt.Errorf("'invalidationType' must be %s or %s", tc.REFRESH, tc.REFETCH), nil, http.StatusBadRequest
+		}
+		job.InvalidationType = t
+	}
+	if start, ok := inf.Params["startTime"]; ok {
+		t, err := time.Parse(time.RFC3339, start)
+		if err != nil {
+			return job, errors.New("'startTime' must be in RFC3339 format"), nil, http.StatusBadRequest
+		}
+		job.StartTime = t
+	}
+
+	noSuchDS := tc.NewCodedError(tc.AlertCodeNotFound, fmt.Errorf("delivery service \"%s\" does not exist", job.DeliveryService))
+	dsid, exists, err := dbhelpers.GetDSIDFromXMLID(tx, job.DeliveryService)
+	if err != nil {
+		return job, nil, fmt.Errorf("getting ID of Delivery Service %s: %v", job.DeliveryService, err), http.StatusInternalServerError
+	}
+	if !exists {
+		return job, noSuchDS, nil, http.StatusNotFound
+	}
+	if ok, err := IsUserAuthorizedToViewDSXMLID(inf, job.DeliveryService); err != nil {
+		return job, nil, fmt.Errorf("checking user permissions on DS %s: %v", job.DeliveryService, err), http.StatusInternalServerError
+	} else if !ok {
+		return job, noSuchDS, nil, http.StatusNotFound
+	}
+
+	origin, hasOrigin, err := getPrimaryOrigin(tx, uint(dsid))
+	if err != nil {
+		return job, nil, fmt.Errorf("getting primary Origin of Delivery Service #%d: %v", dsid, err), http.StatusInternalServerError
+	}
+	if !hasOrigin {
+		return job, fmt.Errorf("delivery service \"%s\" has no primary Origin", job.DeliveryService), nil, http.StatusBadRequest
+	}
+	if err := origin.validate(); err != nil {
+		return job, err, nil, http.StatusBadRequest
+	}
+	job.AssetURL = origin.URL() + inf.Params["regex"]
+	return job, nil, nil, http.StatusOK
+}
+
+// renderRevalPreview returns the text of a preview of the given job's line of
+// regex_revalidate.config, which includes comments explaining why it's
+// missing or won't appear yet, if that's the case.
+func renderRevalPreview(job tc.InvalidationJobV5, maxDays int) string {
+	txt := ""
+	if job.ApprovalState == tc.InvalidationJobPendingApproval {
+		txt += "# this job is pending approval; this line won't appear until it's approved\n"
+	}
+	line, ok := atscfg.MakeRegexRevalidateLine(atscfg.InvalidationJob(job), maxDays)
+	if !ok {
+		return txt + "# this job produces no line, because it has ended or it started longer ago than the maxRevalDurationDays Parameter allows\n"
+	}
+	return txt + line + "\n"
+}
+
+// GetRevalPreview is the handler for GET requests to /jobs/reval_preview in
+// API version 5.0 and later. It responds, as plain text, with the line of
+// regex_revalidate.config that a Content Invalidation Job produces - either an
+// existing one, identified by the 'id' query string parameter, or one that
+// would be created with the given 'deliveryService', 'regex', 'ttlHours', and
+// optionally 'invalidationType' and 'startTime'. Nothing is created.
+func GetRevalPreview(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, nil, []string{"id"})
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+	tx := inf.Tx.Tx
+
+	job, userErr, sysErr, errCode := previewJob(inf)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, tx, errCode, userErr, sysErr)
+		return
+	}
+	maxDays, err := maxRevalDurationDays(tx)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("getting maxRevalDurationDays Parameter: %v", err))
+		return
+	}
+
+	w.Header().Set(rfc.ContentType, rfc.ContentTypeTextPlain)
+	api.WriteAndLogErr(w, r, []byte(renderRevalPreview(job, maxDays)))
+}
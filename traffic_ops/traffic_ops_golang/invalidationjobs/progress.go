@@ -0,0 +1,260 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultRevalProgressTimeout is how long the stream of a Content Invalidation
+// Job's revalidation progress lasts at most, if the request doesn't specify.
+const DefaultRevalProgressTimeout = 5 * time.Minute
+
+// RevalProgressPollInterval is how often the revalidation progress of a
+// Content Invalidation Job is checked while it's being streamed.
+const RevalProgressPollInterval = 2 * time.Second
+
+// revalApplyColumns maps each column of the server table that revalFlagColumn
+// can return to the column holding the time of the last update that a server
+// applied.
+var revalApplyColumns = map[string]string{
+	"config_update_time":     "config_apply_time",
+	"revalidate_update_time": "revalidate_apply_time",
+}
+
+const selectJobRevalInfoQuery = `
+SELECT ds.tenant_id, ds.cdn_id, job.entered_time, job.reval_cachegroup, job.reval_server_type
+FROM job
+JOIN deliveryservice ds ON job.job_deliveryservice = ds.id
+WHERE job.id = $1
+`
+
+// Selects the servers that queueUpdateOrRevalQuery flags on a CDN within a
+// job's scope, and whether each has applied an update at least as recent as
+// the given time.
+const selectRevalProgressQuery = `
+SELECT server.host_name, server.%s >= $2
+FROM public.server
+WHERE ` + revalServersCondition + `
+AND server.cdn_id = $1
+AND ($3::bigint IS NULL OR server.cachegroup = $3::bigint)
+AND ($4::bigint IS NULL OR server.type = $4::bigint)
+ORDER BY server.host_name
+`
+
+// maxRevalProgressTimeout returns the longest that the stream of a job's
+// revalidation progress may be asked to last, which is limited because the
+// route applies no request timeout of its own and the database is polled
+// throughout.
+func maxRevalProgressTimeout(inf *api.APIInfo) time.Duration {
+	if inf.Config != nil && inf.Config.Jobs.RevalProgressMaxTimeoutSec > 0 {
+		return time.Duration(inf.Config.Jobs.RevalProgressMaxTimeoutSec) * time.Second
+	}
+	return DefaultRevalProgressTimeout
+}
+
+// revalProgressTimeout returns how long the stream of a job's revalidation
+// progress lasts at most: the request's 'timeout' query string parameter, in
+// seconds, which must be positive and at most maxRevalProgressTimeout, or
+// DefaultRevalProgressTimeout - capped by the maximum - if it isn't given. The
+// returned error is suitable for showing to the user.
+func revalProgressTimeout(inf *api.APIInfo) (time.Duration, error) {
+	max := maxRevalProgressTimeout(inf)
+	seconds, ok := inf.IntParams["timeout"]
+	if !ok {
+		if DefaultRevalProgressTimeout > max {
+			return max, nil
+		}
+		return DefaultRevalProgressTimeout, nil
+	}
+	if seconds <= 0 {
+		return 0, errors.New("timeout must be positive")
+	}
+	if timeout := time.Duration(seconds) * time.Second; timeout <= max {
+		return timeout, nil
+	}
+	return 0, fmt.Errorf("timeout cannot be more than %d seconds", int(max/time.Second))
+}
+
+// GetRevalProgress is the handler for GET requests to /jobs/{id}/reval_progress
+// in API version 5.0 and later. It streams the progress of the servers
+// flagged for revalidation by the identified Content Invalidation Job as
+// server-sent events, until either all of them have revalidated or
+// 'timeout' seconds (DefaultRevalProgressTimeout if not given) have passed.
+func GetRevalProgress(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, []string{"id"}, []string{"id", "timeout"})
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+
+	timeout, err := revalProgressTimeout(inf)
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, err, nil)
+		return
+	}
+
+	jobID := inf.IntParams["id"]
+	var tenantID, cdnID int
+	var entered time.Time
+	var scope revalScope
+	if err := inf.Tx.Tx.QueryRow(selectJobRevalInfoQuery, jobID).Scan(&tenantID, &cdnID, &entered, &scope.CacheGroupID, &scope.ServerTypeID); err == sql.ErrNoRows {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusNotFound, fmt.Errorf("no job exists with ID %d", jobID), nil)
+		return
+	} else if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting job #%d: %v", jobID, err))
+		return
+	}
+	if ok, err := inf.IsResourceAuthorizedToCurrentUser(tenantID); err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("checking tenancy of job #%d: %v", jobID, err))
+		return
+	} else if !ok {
+		// Don't reveal the existence of jobs outside the user's Tenancy.
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusNotFound, fmt.Errorf("no job exists with ID %d", jobID), nil)
+		return
+	}
+
+	column, err := revalFlagColumn(inf.Tx.Tx)
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting reval flag column: %v", err))
+		return
+	}
+	query := fmt.Sprintf(selectRevalProgressQuery, revalApplyColumns[column])
+
+	db, err := api.GetDB(r.Context())
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting database: %v", err))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, errors.New("response writer doesn't support streaming"))
+		return
+	}
+	dbTimeout := time.Duration(inf.Config.DBQueryTimeoutSeconds) * time.Second
+
+	// Don't hold the transaction open for as long as the stream lasts.
+	inf.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(RevalProgressPollInterval)
+	defer ticker.Stop()
+
+	lastApplied := -1
+	for {
+		progress, err := getRevalProgress(r.Context(), db, dbTimeout, query, cdnID, entered, scope)
+		if err != nil {
+			log.Errorf("getting revalidation progress of job #%d: %v", jobID, err)
+			return
+		}
+		progress.JobID = uint64(jobID)
+
+		event := ""
+		if progress.Applied == progress.Total {
+			event = tc.InvalidationJobRevalCompleteEvent
+		} else if progress.Applied != lastApplied {
+			event = tc.InvalidationJobRevalProgressEvent
+		}
+		lastApplied = progress.Applied
+		if event != "" {
+			if err := writeEvent(w, flusher, event, progress); err != nil {
+				log.Warnf("writing revalidation progress of job #%d: %v", jobID, err)
+				return
+			}
+		}
+		if event == tc.InvalidationJobRevalCompleteEvent {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-deadline.C:
+			if err := writeEvent(w, flusher, tc.InvalidationJobRevalTimeoutEvent, progress); err != nil {
+				log.Warnf("writing revalidation progress of job #%d: %v", jobID, err)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// getRevalProgress gets the revalidation progress of the servers on the CDN
+// with the given ID, for a job entered at the given time and limited to the
+// given scope.
+func getRevalProgress(ctx context.Context, db *sqlx.DB, timeout time.Duration, query string, cdnID int, entered time.Time, scope revalScope) (tc.InvalidationJobRevalProgress, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	progress := tc.InvalidationJobRevalProgress{Pending: []string{}}
+	rows, err := db.QueryContext(ctx, query, cdnID, entered, scope.CacheGroupID, scope.ServerTypeID)
+	if err != nil {
+		return progress, err
+	}
+	defer log.Close(rows, "closing revalidation progress rows")
+
+	for rows.Next() {
+		var hostName string
+		var applied bool
+		if err := rows.Scan(&hostName, &applied); err != nil {
+			return progress, err
+		}
+		progress.Total++
+		if applied {
+			progress.Applied++
+		} else {
+			progress.Pending = append(progress.Pending, hostName)
+		}
+	}
+	return progress, rows.Err()
+}
+
+// writeEvent writes a server-sent event with the given name and the JSON
+// encoding of 'data', and flushes it to the client.
+func writeEvent(w io.Writer, flusher http.Flusher, event string, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("encoding %s event: %v", event, err)
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, encoded); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
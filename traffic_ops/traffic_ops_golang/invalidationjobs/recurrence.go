@@ -0,0 +1,223 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// DefaultRecurrenceCheckInterval is how often the scheduler of recurring jobs
+// checks for occurrences that have started, if not configured otherwise.
+const DefaultRecurrenceCheckInterval = time.Minute
+
+// recurrenceColumns holds the (nullable) recurrence columns of a job row.
+type recurrenceColumns struct {
+	IntervalHours *uint
+	End           *time.Time
+}
+
+// value returns the recurrence of a job with these columns that starts at the
+// given time - or nil if it's not recurring - and the start time of its next
+// occurrence, if there is one.
+func (c recurrenceColumns) value(start time.Time) (*tc.InvalidationJobRecurrence, *time.Time) {
+	if c.IntervalHours == nil || c.End == nil {
+		return nil, nil
+	}
+	r := tc.InvalidationJobRecurrence{IntervalHours: *c.IntervalHours, EndTime: *c.End}
+	return &r, r.NextRun(start)
+}
+
+// recurrenceArgs returns the values to insert into the recurrence columns of
+// a job with the given recurrence (which may be nil).
+func recurrenceArgs(r *tc.InvalidationJobRecurrence) (*uint, *time.Time) {
+	if r == nil {
+		return nil, nil
+	}
+	return &r.IntervalHours, &r.EndTime
+}
+
+// materializeRecurrencesQuery creates the next occurrence of every recurring
+// job that has started, and stops those jobs from recurring themselves, so
+// each occurrence is only ever materialized once. If the scheduler hasn't run
+// for longer than a job's interval, occurrences that would already have
+// started are skipped. Jobs pending approval don't recur until they're
+// approved. Occurrences keep the revalidation scope of the job they recur. It
+// returns the Delivery Services of the new jobs.
+const materializeRecurrencesQuery = `
+WITH started AS (
+	UPDATE job
+	SET recurrence_interval_hr = NULL,
+		recurrence_end = NULL
+	FROM (
+		SELECT id, recurrence_interval_hr, recurrence_end
+		FROM job
+		WHERE recurrence_interval_hr IS NOT NULL
+		AND start_time <= now()
+		AND approval_state = 'APPROVED'
+		FOR UPDATE
+	) AS recurring
+	WHERE job.id = recurring.id
+	RETURNING job.ttl_hr,
+		job.asset_url,
+		job.start_time,
+		job.job_user,
+		job.job_deliveryservice,
+		job.invalidation_type,
+		job.comment,
+		job.priority,
+		job.labels,
+		job.reval_cachegroup,
+		job.reval_server_type,
+		recurring.recurrence_interval_hr,
+		recurring.recurrence_end
+), next AS (
+	SELECT started.*,
+		started.start_time + (
+			floor(extract(epoch FROM now() - started.start_time) / (started.recurrence_interval_hr * 3600)) + 1
+		) * started.recurrence_interval_hr * INTERVAL '1 hour' AS next_start
+	FROM started
+)
+INSERT INTO job (
+	ttl_hr,
+	asset_url,
+	start_time,
+	entered_time,
+	job_user,
+	job_deliveryservice,
+	invalidation_type,
+	comment,
+	priority,
+	labels,
+	reval_cachegroup,
+	reval_server_type,
+	recurrence_interval_hr,
+	recurrence_end)
+SELECT ttl_hr,
+	asset_url,
+	next_start,
+	now(),
+	job_user,
+	job_deliveryservice,
+	invalidation_type,
+	comment,
+	priority,
+	labels,
+	reval_cachegroup,
+	reval_server_type,
+	recurrence_interval_hr,
+	recurrence_end
+FROM next
+WHERE next_start <= recurrence_end
+RETURNING id, job_deliveryservice
+`
+
+var recurrenceSchedulerOnce sync.Once
+
+// InitRecurrenceScheduler starts the scheduler of recurring Content
+// Invalidation Jobs, which every 'interval' (DefaultRecurrenceCheckInterval if
+// that isn't positive) creates the next occurrence of each recurring job that
+// has started. If 'skipRevalFlags' is true, the new occurrences don't flag
+// any servers for revalidation. It only does anything the first time it's
+// called.
+func InitRecurrenceScheduler(interval time.Duration, db *sql.DB, timeout time.Duration, skipRevalFlags bool) {
+	recurrenceSchedulerOnce.Do(func() {
+		if interval <= 0 {
+			interval = DefaultRecurrenceCheckInterval
+		}
+		go func() {
+			for {
+				if err := materializeRecurrences(db, timeout, skipRevalFlags); err != nil {
+					log.Errorf("scheduling recurring content invalidation jobs: %v", err)
+				}
+				time.Sleep(interval)
+			}
+		}()
+	})
+}
+
+// materializeRecurrences creates the next occurrences of all recurring jobs
+// that have started, and triggers revalidation of the servers within their
+// scopes.
+func materializeRecurrences(db *sql.DB, timeout time.Duration, skipRevalFlags bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %v", err)
+	}
+	commit := false
+	defer func() {
+		if !commit {
+			if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+				log.Errorf("rolling back recurring job transaction: %v", err)
+			}
+		}
+	}()
+
+	rows, err := tx.Query(materializeRecurrencesQuery)
+	if err != nil {
+		return fmt.Errorf("creating next occurrences: %v", err)
+	}
+	type occurrence struct {
+		id   uint64
+		dsID uint
+	}
+	occurrences := []occurrence{}
+	for rows.Next() {
+		var o occurrence
+		if err := rows.Scan(&o.id, &o.dsID); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning next occurrence: %v", err)
+		}
+		occurrences = append(occurrences, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterating over next occurrences: %v", err)
+	}
+
+	// Each occurrence flags only the servers within the scope it copied from
+	// the job it recurs.
+	for _, o := range occurrences {
+		warning, err := setJobRevalFlags(tx, o.id, o.dsID, skipRevalFlags)
+		if err != nil {
+			return fmt.Errorf("setting reval flags for job #%d on Delivery Service #%d: %v", o.id, o.dsID, err)
+		}
+		if warning != "" {
+			log.Warnf("recurring content invalidation job #%d on Delivery Service #%d: %s", o.id, o.dsID, warning)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing: %v", err)
+	}
+	commit = true
+	if len(occurrences) > 0 {
+		log.Infof("created the next occurrence of %d recurring content invalidation jobs", len(occurrences))
+	}
+	return nil
+}
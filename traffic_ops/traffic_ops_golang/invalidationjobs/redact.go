@@ -0,0 +1,67 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+)
+
+// redactedText replaces the parts of asset URLs that are masked in change log
+// entries.
+const redactedText = "REDACTED"
+
+// assetURLChangeLog returns the given asset URL as it should be given in
+// change log entries: with its query string masked if the
+// changelog_redact_query_strings configuration option is set, and with the
+// matches of the changelog_redact_pattern configuration option masked, if
+// it's given.
+//
+// Since asset URLs are regular expressions, the query string is taken to be
+// everything after the first '?', whether or not it's escaped. That masks too
+// much of a URL that uses '?' as a quantifier before its query string, which
+// is the safer mistake to make.
+func assetURLChangeLog(inf *api.APIInfo, assetURL string) string {
+	if inf.Config == nil {
+		return assetURL
+	}
+
+	if inf.Config.Jobs.ChangeLogRedactQueryStrings {
+		if i := strings.Index(assetURL, "?"); i >= 0 && i < len(assetURL)-1 {
+			assetURL = assetURL[:i+1] + redactedText
+		}
+	}
+
+	if inf.Config.Jobs.ChangeLogRedactPattern == "" {
+		return assetURL
+	}
+	pattern, err := regexp.Compile(inf.Config.Jobs.ChangeLogRedactPattern)
+	if err != nil {
+		// This is checked when the configuration is loaded, so it shouldn't
+		// happen - but if it does, nothing of the URL can be trusted to be
+		// safe to record.
+		log.Errorf("compiling jobs.changelog_redact_pattern: %v", err)
+		return redactedText
+	}
+	return pattern.ReplaceAllLiteralString(assetURL, redactedText)
+}
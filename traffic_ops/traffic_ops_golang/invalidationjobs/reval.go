@@ -0,0 +1,320 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/dbhelpers"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/tenant"
+
+	"github.com/lib/pq"
+)
+
+const deferRevalQuery = `
+INSERT INTO job_deferred_reval (deliveryservice)
+VALUES ($1)
+ON CONFLICT (deliveryservice) DO UPDATE SET last_updated = now()
+`
+
+const flushDeferredRevalQuery = `
+DELETE
+FROM job_deferred_reval
+WHERE job_deferred_reval.deliveryservice IN (
+	SELECT deliveryservice.id
+	FROM deliveryservice
+	WHERE deliveryservice.tenant_id = ANY($1::bigint[])
+)
+RETURNING job_deferred_reval.deliveryservice,
+	(
+		SELECT deliveryservice.xml_id
+		FROM deliveryservice
+		WHERE deliveryservice.id=job_deferred_reval.deliveryservice
+	) AS xml_id
+`
+
+// deferRevalFlags records that the revalidation flags of the servers of the
+// Delivery Service identified by 'dsid' need to be set, without setting them
+// - that's done for all such Delivery Services at once by FlushDeferredReval.
+func deferRevalFlags(dsid uint, tx *sql.Tx) error {
+	_, err := tx.Exec(deferRevalQuery, dsid)
+	return err
+}
+
+// FlushDeferredReval is the handler for POST requests to /jobs/flush_reval.
+// It sets the revalidation flags on the servers of every Delivery Service -
+// within the user's Tenancy - that had them deferred by deleting a Content
+// Invalidation Job with 'defer=true', once per Delivery Service.
+func FlushDeferredReval(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, nil, nil)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+
+	tenantIDs, err := tenant.GetUserTenantIDListTx(inf.Tx.Tx, inf.User.TenantID)
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting tenant list for user: %v", err))
+		return
+	}
+
+	rows, err := inf.Tx.Tx.Query(flushDeferredRevalQuery, pq.Array(tenantIDs))
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("removing deferred revalidations: %v", err))
+		return
+	}
+	dsIDs := []uint{}
+	flushed := tc.DeferredRevalFlushed{DeliveryServices: []string{}}
+	for rows.Next() {
+		var dsID uint
+		var xmlID string
+		if err := rows.Scan(&dsID, &xmlID); err != nil {
+			rows.Close()
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("scanning deferred revalidation: %v", err))
+			return
+		}
+		dsIDs = append(dsIDs, dsID)
+		flushed.DeliveryServices = append(flushed.DeliveryServices, xmlID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("iterating over deferred revalidations: %v", err))
+		return
+	}
+
+	alerts := tc.Alerts{}
+	for i, dsID := range dsIDs {
+		warning, err := setRevalFlagsByDSID(dsID, inf.Tx.Tx, revalFlagsDisabled(inf))
+		if err != nil {
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("setting reval_pending for deferred Delivery Service %s: %v", flushed.DeliveryServices[i], err))
+			return
+		}
+		if warning != "" {
+			alerts.AddNewAlert(tc.WarnLevel, flushed.DeliveryServices[i]+": "+warning)
+		}
+	}
+
+	if len(dsIDs) > 0 {
+		changeLogMsg := fmt.Sprintf("Flushed deferred content invalidation revalidations for %d Delivery Services", len(dsIDs))
+		api.CreateChangeLogRawTx(api.ApiChange, changeLogMsg, inf.User, inf.Tx.Tx)
+	}
+
+	alerts.AddNewAlert(tc.SuccessLevel, fmt.Sprintf("Set revalidation flags for %d Delivery Services", len(dsIDs)))
+	api.WriteAlertsObj(w, r, http.StatusOK, alerts, flushed)
+}
+
+// selectActiveJobsOnCDNQuery gets the approved jobs in effect on the Delivery
+// Services on the CDN with the ID $1 within the Tenants $2, with their
+// revalidation scopes.
+const selectActiveJobsOnCDNQuery = `
+SELECT job.id,
+	job.job_deliveryservice,
+	ds.xml_id,
+	job.reval_cachegroup,
+	job.reval_server_type
+FROM job
+JOIN deliveryservice ds ON ds.id = job.job_deliveryservice
+WHERE ds.cdn_id = $1
+AND ds.tenant_id = ANY($2::bigint[])
+AND job.approval_state = $3
+AND ` + jobActiveCondition + `
+ORDER BY job.id
+`
+
+// reflagActiveJobs sets the revalidation flags again for every approved job in
+// effect on the Delivery Services within the given Tenants on the CDN with the
+// given ID, flagging the servers in each job's scope exactly as creating it
+// did. Jobs with the same Delivery Service and scope flag the same servers,
+// so each such group is only flagged once. Setting the flags again is
+// harmless, so this can safely be repeated.
+//
+// It returns the number of jobs and of distinct servers flagged, and any
+// warnings from setting the flags, prefixed with the XMLIDs of the Delivery
+// Services they're about.
+func reflagActiveJobs(tx *sql.Tx, cdnID int, tenants []int, skip bool) (tc.InvalidationJobRevalReflagged, []string, error) {
+	var reflagged tc.InvalidationJobRevalReflagged
+	rows, err := tx.Query(selectActiveJobsOnCDNQuery, cdnID, pq.Array(tenants), tc.InvalidationJobApproved)
+	if err != nil {
+		return reflagged, nil, fmt.Errorf("getting active jobs: %v", err)
+	}
+	type target struct {
+		dsID  uint
+		xmlID string
+		scope revalScope
+	}
+	targets := []target{}
+	seen := map[string]struct{}{}
+	for rows.Next() {
+		var jobID uint64
+		var t target
+		var cacheGroup, serverType sql.NullInt64
+		if err := rows.Scan(&jobID, &t.dsID, &t.xmlID, &cacheGroup, &serverType); err != nil {
+			rows.Close()
+			return reflagged, nil, fmt.Errorf("scanning active job: %v", err)
+		}
+		reflagged.Jobs++
+		if cacheGroup.Valid {
+			id := int(cacheGroup.Int64)
+			t.scope.CacheGroupID = &id
+		}
+		if serverType.Valid {
+			id := int(serverType.Int64)
+			t.scope.ServerTypeID = &id
+		}
+		key := fmt.Sprintf("%d/%d/%d", t.dsID, cacheGroup.Int64, serverType.Int64)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		targets = append(targets, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return reflagged, nil, fmt.Errorf("iterating over active jobs: %v", err)
+	}
+
+	if skip && len(targets) > 0 {
+		log.Infof("skipped setting revalidation flags again for %d active jobs on CDN #%d, because that's disabled in the configuration", reflagged.Jobs, cdnID)
+		return reflagged, []string{revalFlagsDisabledWarning}, nil
+	}
+
+	if len(targets) == 0 {
+		return reflagged, []string{}, nil
+	}
+	column, err := revalFlagColumn(tx)
+	if err != nil {
+		return reflagged, nil, fmt.Errorf("getting revalidation flag column: %v", err)
+	}
+
+	warnings := []string{}
+	warned := map[string]struct{}{}
+	// Delivery Services on the same CDN flag many of the same servers.
+	flagged := map[uint64]struct{}{}
+	for _, t := range targets {
+		servers, warning, err := flagScopedRevalServers(t.dsID, t.scope, column, tx)
+		if err != nil {
+			return reflagged, nil, fmt.Errorf("setting revalidation flags for Delivery Service %s: %v", t.xmlID, err)
+		}
+		for _, id := range servers {
+			flagged[id] = struct{}{}
+		}
+		if warning == "" {
+			continue
+		}
+		warning = t.xmlID + ": " + warning
+		if _, ok := warned[warning]; !ok {
+			warned[warning] = struct{}{}
+			warnings = append(warnings, warning)
+		}
+	}
+	reflagged.Servers = len(flagged)
+	return reflagged, warnings, nil
+}
+
+// flagScopedRevalServers is like setScopedRevalFlagsInColumn - except that it
+// can't be skipped, and 'column' must be given - but also returns the IDs of
+// the servers it flagged, as reported by the update itself.
+func flagScopedRevalServers(dsid uint, scope revalScope, column string, tx *sql.Tx) ([]uint64, string, error) {
+	update, exists := revalFlagQueries("id", column)
+	rows, err := tx.Query(update+"RETURNING server.id", dsid, scope.CacheGroupID, scope.ServerTypeID)
+	if err != nil {
+		return nil, "", err
+	}
+	ids := []uint64{}
+	for rows.Next() {
+		var id uint64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, "", err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	warning, err := revalFlagsWarning(int64(len(ids)), scope, func(found *bool) error {
+		return tx.QueryRow(exists, dsid).Scan(found)
+	})
+	return ids, warning, err
+}
+
+// ReflagRevals is the handler for POST requests to /jobs/reflag_reval in API
+// version 5.0 and later. It sets the revalidation flags again for every
+// approved Content Invalidation Job in effect on the CDN named by the 'cdn'
+// query string parameter - on the Delivery Services within the user's Tenancy
+// - so that servers that missed them, e.g. because they were OFFLINE when the
+// jobs were created, pick them up. It reports how many jobs and servers that
+// was.
+func ReflagRevals(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, []string{"cdn"}, nil)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+
+	cdnName := inf.Params["cdn"]
+	cdnID, ok, err := dbhelpers.GetCDNIDFromName(inf.Tx.Tx, tc.CDNName(cdnName))
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting ID of CDN '%s': %v", cdnName, err))
+		return
+	}
+	if !ok {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusNotFound, tc.NewCodedError(tc.AlertCodeNotFound, fmt.Errorf("no such CDN '%s'", cdnName)), nil)
+		return
+	}
+	if userErr, sysErr, errCode := dbhelpers.CheckIfCurrentUserCanModifyCDN(inf.Tx.Tx, cdnName, inf.User.UserName); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, tc.NewCodedError(tc.AlertCodeNotAuthorized, userErr), sysErr)
+		return
+	}
+
+	tenantIDs, err := tenant.GetUserTenantIDListTx(inf.Tx.Tx, inf.User.TenantID)
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting tenant list for user: %v", err))
+		return
+	}
+
+	reflagged, warnings, err := reflagActiveJobs(inf.Tx.Tx, cdnID, tenantIDs, revalFlagsDisabled(inf))
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("setting revalidation flags again for CDN '%s': %v", cdnName, err))
+		return
+	}
+	reflagged.CDN = cdnName
+
+	alerts := tc.Alerts{}
+	for _, warning := range warnings {
+		alerts.AddNewAlert(tc.WarnLevel, warning)
+	}
+	if reflagged.Jobs > 0 {
+		changeLogMsg := fmt.Sprintf("Set revalidation flags again on %d servers of CDN %s for %d active content invalidation jobs", reflagged.Servers, cdnName, reflagged.Jobs)
+		api.CreateChangeLogRawTx(api.ApiChange, changeLogMsg, inf.User, inf.Tx.Tx)
+	}
+
+	alerts.AddNewAlert(tc.SuccessLevel, fmt.Sprintf("Set revalidation flags on %d servers for %d active Content Invalidation Jobs", reflagged.Servers, reflagged.Jobs))
+	api.WriteAlertsObj(w, r, http.StatusOK, alerts, reflagged)
+}
@@ -0,0 +1,81 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/auth"
+)
+
+// JobRevalColumnOverridePermission is the Permission a user needs in order to
+// choose which server column the Content Invalidation Jobs they create set to
+// flag servers for revalidation.
+const JobRevalColumnOverridePermission = "JOB:OVERRIDE-REVAL-COLUMN"
+
+// revalColumns are the server columns that can be set to flag servers for
+// revalidation, as revalFlagColumn chooses between them.
+var revalColumns = map[string]struct{}{
+	"revalidate_update_time": {},
+	"config_update_time":     {},
+}
+
+// revalColumnOverride returns the server column that the request's
+// 'revalColumn' query string parameter asks to be set to flag servers for
+// revalidation instead of the one revalFlagColumn chooses, or an empty string
+// if it doesn't ask for one. That's only allowed in API version 5.0 and later,
+// when the configuration allows it, for users with
+// JobRevalColumnOverridePermission.
+//
+// This returns, in order, the column, a user-facing error, and an HTTP status
+// code.
+func revalColumnOverride(inf *api.APIInfo) (string, error, int) {
+	column, ok := inf.Params["revalColumn"]
+	if !ok {
+		return "", nil, http.StatusOK
+	}
+	if inf.Version == nil || inf.Version.Major < 5 {
+		return "", errors.New("revalColumn is not supported before API version 5.0"), http.StatusBadRequest
+	}
+	if inf.Config == nil || !inf.Config.Jobs.AllowRevalColumnOverride {
+		return "", errors.New("revalColumn is not allowed by this Traffic Ops instance's configuration"), http.StatusBadRequest
+	}
+	if !(inf.Config.RoleBasedPermissions && inf.User.Can(JobRevalColumnOverridePermission)) && inf.User.PrivLevel != auth.PrivLevelAdmin {
+		return "", tc.NewCodedError(tc.AlertCodeNotAuthorized, fmt.Errorf("revalColumn requires the %s Permission", JobRevalColumnOverridePermission)), http.StatusForbidden
+	}
+	if _, ok := revalColumns[column]; !ok {
+		return "", fmt.Errorf("revalColumn: must be one of 'revalidate_update_time' or 'config_update_time', got '%s'", column), http.StatusBadRequest
+	}
+	return column, nil, http.StatusOK
+}
+
+// revalColumnChangeLog returns the part of a change log entry about a newly
+// created job that records the server column it was made to set, which is
+// empty if that wasn't overridden.
+func revalColumnChangeLog(column string) string {
+	if column == "" {
+		return ""
+	}
+	return " REVAL_COLUMN: " + column
+}
@@ -0,0 +1,177 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+
+	"github.com/lib/pq"
+)
+
+// Selects the ID of the named Cache Group, and whether it has any servers on
+// the CDN of the Delivery Service with the ID $2.
+const selectScopeCacheGroupQuery = `
+SELECT cg.id,
+	EXISTS (
+		SELECT 1
+		FROM server s
+		WHERE s.cachegroup = cg.id
+		AND s.cdn_id = (
+			SELECT deliveryservice.cdn_id
+			FROM deliveryservice
+			WHERE deliveryservice.id = $2
+		)
+	)
+FROM cachegroup cg
+WHERE cg.name = $1
+`
+
+const selectScopeServerTypeQuery = `
+SELECT id
+FROM type
+WHERE name = $1
+AND use_in_table = 'server'
+`
+
+const setJobRevalScopeQuery = `
+UPDATE job
+SET reval_cachegroup = $1,
+	reval_server_type = $2
+WHERE id = ANY($3)
+`
+
+const selectJobRevalScopeQuery = `
+SELECT reval_cachegroup, reval_server_type
+FROM job
+WHERE id = $1
+`
+
+// revalScope limits the servers that a Content Invalidation Job flags for
+// revalidation to those in a Cache Group and/or of a Type. The zero value
+// doesn't limit them at all.
+type revalScope struct {
+	CacheGroupID *int
+	ServerTypeID *int
+}
+
+// empty tells whether the scope doesn't limit the flagged servers.
+func (s revalScope) empty() bool {
+	return s.CacheGroupID == nil && s.ServerTypeID == nil
+}
+
+// resolveRevalScope looks up the Cache Group and server Type to which a new
+// job on the Delivery Service identified by 'dsid' is limited, which is only
+// supported in API version 5.0 and later. The Cache Group must have servers on
+// the Delivery Service's CDN, or else the job would flag nothing.
+//
+// This returns, in order, the scope, a user-facing error, a system error, and
+// an HTTP status code, as authorizeJobModification does.
+func resolveRevalScope(inf *api.APIInfo, job tc.InvalidationJobCreateV4, dsid uint) (revalScope, error, error, int) {
+	var scope revalScope
+	if job.CacheGroup == nil && job.ServerType == nil {
+		return scope, nil, nil, http.StatusOK
+	}
+	if inf.Version == nil || inf.Version.Major < 5 {
+		return scope, errors.New("cacheGroup and serverType are not supported before API version 5.0"), nil, http.StatusBadRequest
+	}
+
+	tx := inf.Tx.Tx
+	if job.CacheGroup != nil {
+		var id int
+		var onCDN bool
+		if err := tx.QueryRow(selectScopeCacheGroupQuery, *job.CacheGroup, dsid).Scan(&id, &onCDN); err == sql.ErrNoRows {
+			return scope, fmt.Errorf("cacheGroup: no Cache Group named '%s'", *job.CacheGroup), nil, http.StatusBadRequest
+		} else if err != nil {
+			return scope, nil, fmt.Errorf("getting Cache Group '%s': %v", *job.CacheGroup, err), http.StatusInternalServerError
+		}
+		if !onCDN {
+			return scope, fmt.Errorf("cacheGroup: Cache Group '%s' has no servers on the Delivery Service's CDN", *job.CacheGroup), nil, http.StatusBadRequest
+		}
+		scope.CacheGroupID = &id
+	}
+	if job.ServerType != nil {
+		var id int
+		if err := tx.QueryRow(selectScopeServerTypeQuery, *job.ServerType).Scan(&id); err == sql.ErrNoRows {
+			return scope, fmt.Errorf("serverType: no server Type named '%s'", *job.ServerType), nil, http.StatusBadRequest
+		} else if err != nil {
+			return scope, nil, fmt.Errorf("getting server Type '%s': %v", *job.ServerType, err), http.StatusInternalServerError
+		}
+		scope.ServerTypeID = &id
+	}
+	return scope, nil, nil, http.StatusOK
+}
+
+// setJobRevalScope records the scope of the identified, newly created jobs, so
+// that later modifications of them flag the same servers.
+func setJobRevalScope(tx *sql.Tx, scope revalScope, ids ...uint64) error {
+	if scope.empty() {
+		return nil
+	}
+	_, err := tx.Exec(setJobRevalScopeQuery, scope.CacheGroupID, scope.ServerTypeID, pq.Array(ids))
+	return err
+}
+
+// getJobRevalScope returns the scope of the identified job. It must be called
+// before the job is deleted.
+func getJobRevalScope(tx *sql.Tx, jobID interface{}) (revalScope, error) {
+	var cacheGroup, serverType sql.NullInt64
+	if err := tx.QueryRow(selectJobRevalScopeQuery, jobID).Scan(&cacheGroup, &serverType); err != nil {
+		return revalScope{}, err
+	}
+	var scope revalScope
+	if cacheGroup.Valid {
+		id := int(cacheGroup.Int64)
+		scope.CacheGroupID = &id
+	}
+	if serverType.Valid {
+		id := int(serverType.Int64)
+		scope.ServerTypeID = &id
+	}
+	return scope, nil
+}
+
+// scopeChangeLog returns the part of a change log entry about a newly created
+// job that records the servers it's limited to, which is empty if it isn't.
+func scopeChangeLog(job tc.InvalidationJobCreateV4) string {
+	s := ""
+	if job.CacheGroup != nil {
+		s += fmt.Sprintf(" CACHEGROUP: '%s'", *job.CacheGroup)
+	}
+	if job.ServerType != nil {
+		s += fmt.Sprintf(" SERVER_TYPE: '%s'", *job.ServerType)
+	}
+	return s
+}
+
+// setJobRevalFlags is like setScopedRevalFlags, but uses the recorded scope of
+// the identified, existing job on the Delivery Service identified by 'dsid'.
+func setJobRevalFlags(tx *sql.Tx, jobID interface{}, dsid uint, skip bool) (string, error) {
+	scope, err := getJobRevalScope(tx, jobID)
+	if err != nil {
+		return "", fmt.Errorf("getting revalidation scope of job #%v: %v", jobID, err)
+	}
+	return setScopedRevalFlags(dsid, scope, tx, skip)
+}
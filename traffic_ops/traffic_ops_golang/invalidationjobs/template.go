@@ -0,0 +1,125 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+)
+
+// templateVariableName matches the names of the variables that may be
+// referenced in the regular expression of a new job.
+var templateVariableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// expandTemplate substitutes the given variables for each of the "{name}"
+// placeholders in the regular expression 'regex' - except those whose opening
+// brace is escaped - quoting their values so that they're matched literally.
+// It also returns the names of the variables that were used. The returned
+// error is suitable for showing to the user.
+func expandTemplate(regex string, variables map[string]string) (string, map[string]bool, error) {
+	var expanded strings.Builder
+	used := map[string]bool{}
+	escaped := false
+	for i := 0; i < len(regex); i++ {
+		c := regex[i]
+		if c != '{' || escaped {
+			escaped = c == '\\' && !escaped
+			expanded.WriteByte(c)
+			continue
+		}
+		end := strings.IndexByte(regex[i:], '}')
+		if end < 0 || !templateVariableName.MatchString(regex[i+1:i+end]) {
+			// Not a placeholder, e.g. the repetition in "a{2,3}".
+			expanded.WriteByte(c)
+			continue
+		}
+		name := regex[i+1 : i+end]
+		value, ok := variables[name]
+		if !ok {
+			return "", nil, fmt.Errorf("regex: variable '%s' has no value", name)
+		}
+		expanded.WriteString(regexp.QuoteMeta(value))
+		used[name] = true
+		i += end
+	}
+	return expanded.String(), used, nil
+}
+
+// expandRegexTemplate replaces the regular expression of a request to create
+// Content Invalidation Jobs with the result of substituting the request's
+// variables into it, if it has any. That's only supported in API version 5.0
+// and later, for the variables allowed by the template_variables
+// configuration option. Every variable given must be used, and the result
+// must still be a valid regular expression. The returned error is suitable
+// for showing to the user.
+func expandRegexTemplate(inf *api.APIInfo, job *tc.InvalidationJobCreateV4) error {
+	if len(job.Variables) == 0 {
+		return nil
+	}
+	if inf.Version == nil || inf.Version.Major < 5 {
+		return errors.New("variables is not supported before API version 5.0")
+	}
+
+	allowed := map[string]bool{}
+	if inf.Config != nil {
+		for _, name := range inf.Config.Jobs.TemplateVariables {
+			allowed[name] = true
+		}
+	}
+	names := make([]string, 0, len(job.Variables))
+	for name := range job.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !allowed[name] {
+			return fmt.Errorf("variables: '%s' is not an allowed variable", name)
+		}
+		value := job.Variables[name]
+		if value == "" {
+			return fmt.Errorf("variables: '%s' must not be empty", name)
+		}
+		if strings.IndexFunc(value, func(r rune) bool { return unicode.IsSpace(r) || !unicode.IsPrint(r) }) >= 0 {
+			return fmt.Errorf("variables: '%s' must not contain whitespace or non-printable characters", name)
+		}
+	}
+
+	expanded, used, err := expandTemplate(job.Regex, job.Variables)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if !used[name] {
+			return fmt.Errorf("variables: '%s' is not used in regex", name)
+		}
+	}
+	if _, err := regexp.Compile(expanded); err != nil {
+		return fmt.Errorf("regex: substituting variables produced an invalid regular expression: %v", err)
+	}
+	job.Regex = expanded
+	return nil
+}
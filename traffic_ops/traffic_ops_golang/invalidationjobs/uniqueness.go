@@ -0,0 +1,201 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+)
+
+// Selects the primary Origin of a Delivery Service, from which insertQueryV4
+// builds asset URLs.
+const selectPrimaryOriginQuery = `
+SELECT o.protocol::text, o.fqdn, o.port
+FROM origin o
+WHERE o.deliveryservice = $1
+AND o.is_primary
+`
+
+// Selects the approved jobs on the Delivery Service with the ID $1 for exactly
+// the asset URL $2 which are in effect at any time during the window that
+// starts at $3 and lasts $4 hours. Jobs pending approval aren't in effect, so
+// they don't stop new ones from being created.
+const selectOverlappingJobsQuery = `
+SELECT job.id,
+	job.asset_url,
+	u.username,
+	ds.xml_id,
+	job.ttl_hr,
+	job.invalidation_type,
+	job.start_time,
+	job.recurrence_interval_hr,
+	job.recurrence_end,
+	job.comment,
+	job.priority,
+	job.labels
+FROM job
+JOIN tm_user u ON u.id = job.job_user
+JOIN deliveryservice ds ON ds.id = job.job_deliveryservice
+WHERE job.job_deliveryservice = $1
+AND job.asset_url = $2
+AND job.approval_state = 'APPROVED'
+AND job.ttl_hr > 0
+AND job.start_time < $3::timestamptz + ($4 * INTERVAL '1 hour')
+AND job.start_time + (job.ttl_hr * INTERVAL '1 hour') > $3::timestamptz
+ORDER BY job.start_time, job.id
+`
+
+// getPrimaryOrigin returns the identified Delivery Service's primary Origin,
+// and whether or not it has one.
+func getPrimaryOrigin(tx *sql.Tx, dsid uint) (originInfo, bool, error) {
+	var o originInfo
+	if err := tx.QueryRow(selectPrimaryOriginQuery, dsid).Scan(&o.Protocol, &o.FQDN, &o.Port); err == sql.ErrNoRows {
+		return o, false, nil
+	} else if err != nil {
+		return o, false, err
+	}
+	return o, true, nil
+}
+
+// getOverlappingJobs returns the existing, approved jobs on the identified
+// Delivery Service for exactly the given asset URL that are in effect at any time
+// during the window of a job with the given start time and TTL, earliest
+// first.
+func getOverlappingJobs(tx *sql.Tx, dsid uint, assetURL string, start time.Time, ttlHours uint) ([]tc.InvalidationJobV5, error) {
+	rows, err := tx.Query(selectOverlappingJobsQuery, dsid, assetURL, start, ttlHours)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []tc.InvalidationJobV5{}
+	for rows.Next() {
+		var job tc.InvalidationJobV5
+		var recurrence recurrenceColumns
+		err := rows.Scan(&job.ID,
+			&job.AssetURL,
+			&job.CreatedBy,
+			&job.DeliveryService,
+			&job.TTLHours,
+			&job.InvalidationType,
+			&job.StartTime,
+			&recurrence.IntervalHours,
+			&recurrence.End,
+			&job.Comment,
+			&job.Priority,
+			labelsColumn{&job.Labels})
+		if err != nil {
+			return nil, err
+		}
+		job.Recurrence, job.NextRun = recurrence.value(job.StartTime)
+		job.EndTime = jobEndTime(job.StartTime, job.TTLHours)
+		job.ApprovalState = tc.InvalidationJobApproved
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// existingJobAlert returns the alert that tells the user that no job was
+// created because the given one already exists.
+func existingJobAlert(existing tc.InvalidationJobV5) tc.Alert {
+	return tc.Alert{
+		Text:  fmt.Sprintf("an identical Content Invalidation Job (#%d) is already in effect for %s during the requested time; no new job was created", existing.ID, existing.AssetURL),
+		Level: tc.InfoLevel.String(),
+		Code:  tc.AlertCodeAlreadyExists,
+	}
+}
+
+// jobUniqueness is how a request to create Content Invalidation Jobs treats
+// existing jobs that overlap the new ones.
+type jobUniqueness struct {
+	// ifNotExists returns an overlapping existing job instead of creating a
+	// new one.
+	ifNotExists bool
+	// strict refuses to create a job that overlaps existing ones. It has no
+	// effect if ifNotExists is set.
+	strict bool
+}
+
+// checked tells whether overlapping jobs need to be looked for before jobs
+// are created; otherwise, they're only warned about afterward.
+func (u jobUniqueness) checked() bool {
+	return u.ifNotExists || u.strict
+}
+
+// getJobUniqueness reads the ifNotExists and strictUniqueness query string
+// parameters of a request to create Content Invalidation Jobs. If
+// strictUniqueness isn't given, the strict_uniqueness configuration option is
+// used instead. All of that is only supported in API version 5.0 and later;
+// earlier versions only ever warn about overlapping jobs. The returned error
+// is suitable for showing to the user.
+func getJobUniqueness(inf *api.APIInfo) (jobUniqueness, error) {
+	var u jobUniqueness
+	if inf.Version == nil || inf.Version.Major < 5 {
+		return u, nil
+	}
+	if inf.Config != nil {
+		u.strict = inf.Config.Jobs.StrictUniqueness
+	}
+
+	var err error
+	if u.ifNotExists, err = boolParam(inf, "ifNotExists"); err != nil {
+		return u, err
+	}
+	if _, ok := inf.Params["strictUniqueness"]; ok {
+		if u.strict, err = boolParam(inf, "strictUniqueness"); err != nil {
+			return u, err
+		}
+	}
+	return u, nil
+}
+
+// writeConflicts writes a 409 Conflict response refusing to create a job
+// because of the given existing jobs that overlap it.
+func writeConflicts(w http.ResponseWriter, r *http.Request, conflicts []tc.InvalidationJobV5) {
+	alerts := tc.Alerts{}
+	for _, conflict := range conflicts {
+		alerts.AddAlert(tc.Alert{
+			Text:  fmt.Sprintf("Invalidation request duplicate found for %v, start:%v end:%v", conflict.AssetURL, conflict.StartTime, conflict.StartTime.Add(time.Hour*time.Duration(conflict.TTLHours))),
+			Level: tc.ErrorLevel.String(),
+			Code:  tc.AlertCodeConflict,
+		})
+	}
+	api.WriteAlertsObj(w, r, http.StatusConflict, alerts, conflicts)
+}
+
+// boolParam parses the named boolean query string parameter, which defaults to
+// false. The returned error is suitable for showing to the user.
+func boolParam(inf *api.APIInfo, name string) (bool, error) {
+	param, ok := inf.Params[name]
+	if !ok {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(param)
+	if err != nil {
+		return false, fmt.Errorf("'%s' must be a boolean", name)
+	}
+	return b, nil
+}
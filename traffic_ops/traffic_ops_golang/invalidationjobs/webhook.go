@@ -0,0 +1,349 @@
+package invalidationjobs
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+
+	"github.com/lib/pq"
+)
+
+// DefaultExpiryWebhookCheckInterval is how often jobs whose windows have
+// elapsed are checked for expiry webhooks to send, if not configured
+// otherwise.
+const DefaultExpiryWebhookCheckInterval = time.Minute
+
+// DefaultExpiryWebhookMaxPerMinute is the most expiry webhooks that are sent
+// per minute, if not configured otherwise.
+const DefaultExpiryWebhookMaxPerMinute = 60
+
+const (
+	// maxExpiryWebhookAttempts is how many times sending a job's expiry
+	// webhook is tried before giving up.
+	maxExpiryWebhookAttempts = 5
+	// expiryWebhookBackoff is how long after the first failed attempt to send
+	// a job's expiry webhook it's retried; that doubles after each attempt.
+	expiryWebhookBackoff = time.Minute
+	// expiryWebhookTimeout is how long a single attempt may take.
+	expiryWebhookTimeout = 10 * time.Second
+)
+
+const setExpiryWebhookQuery = `
+UPDATE job
+SET expiry_webhook = $1
+WHERE id = ANY($2)
+`
+
+// Claims up to $1 of the approved jobs whose windows have elapsed and whose
+// expiry webhooks are due to be sent, counting the attempt and deferring the
+// next one by the backoff of $2 seconds - doubled for each previous attempt -
+// so that neither another instance of Traffic Ops nor a failure to record the
+// outcome makes it be sent again right away.
+const claimExpiryWebhooksQuery = `
+UPDATE job
+SET expiry_webhook_attempts = job.expiry_webhook_attempts + 1,
+	expiry_webhook_retry_at = now() + ($2 * power(2, job.expiry_webhook_attempts) * INTERVAL '1 second')
+FROM (
+	SELECT id
+	FROM job
+	WHERE expiry_webhook IS NOT NULL
+	AND NOT expiry_webhook_done
+	AND approval_state = 'APPROVED'
+	AND start_time + (ttl_hr * INTERVAL '1 hour') <= now()
+	AND (expiry_webhook_retry_at IS NULL OR expiry_webhook_retry_at <= now())
+	ORDER BY start_time, id
+	LIMIT $1
+	FOR UPDATE SKIP LOCKED
+) AS due
+WHERE job.id = due.id
+RETURNING job.expiry_webhook,
+	job.expiry_webhook_attempts,
+	job.id,
+	job.asset_url,
+	(SELECT tm_user.username FROM tm_user WHERE tm_user.id = job.job_user),
+	(SELECT deliveryservice.xml_id FROM deliveryservice WHERE deliveryservice.id = job.job_deliveryservice),
+	job.ttl_hr,
+	job.invalidation_type,
+	job.start_time,
+	job.comment,
+	job.priority,
+	job.labels
+`
+
+const finishExpiryWebhookQuery = `
+UPDATE job
+SET expiry_webhook_done = TRUE
+WHERE id = $1
+`
+
+// expiryWebhookHostAllowed tells whether the given host is one of the allowed
+// ones, ignoring case.
+func expiryWebhookHostAllowed(allowed []string, host string) bool {
+	for _, a := range allowed {
+		if strings.EqualFold(a, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseExpiryWebhook parses an expiry webhook URL, which must be an absolute
+// http or https URL to one of the allowed hosts. The returned error is
+// suitable for showing to the user.
+func parseExpiryWebhook(webhook string, allowed []string) (*url.URL, error) {
+	if len(webhook) > tc.MaxInvalidationJobExpiryWebhookLength {
+		return nil, fmt.Errorf("expiryWebhook: must be no longer than %d characters", tc.MaxInvalidationJobExpiryWebhookLength)
+	}
+	u, err := url.Parse(webhook)
+	if err != nil || !u.IsAbs() || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return nil, errors.New("expiryWebhook: must be an absolute http or https URL")
+	}
+	if !expiryWebhookHostAllowed(allowed, u.Hostname()) {
+		return nil, fmt.Errorf("expiryWebhook: host '%s' is not allowed", u.Hostname())
+	}
+	return u, nil
+}
+
+// validateExpiryWebhook checks the expiry webhook of a request to create
+// Content Invalidation Jobs, if it has one. That's only supported in API
+// version 5.0 and later, for the hosts allowed by the
+// expiry_webhook_allowed_hosts configuration option. The returned error is
+// suitable for showing to the user.
+func validateExpiryWebhook(inf *api.APIInfo, job tc.InvalidationJobCreateV4) error {
+	if job.ExpiryWebhook == nil {
+		return nil
+	}
+	if inf.Version == nil || inf.Version.Major < 5 {
+		return errors.New("expiryWebhook is not supported before API version 5.0")
+	}
+	var allowed []string
+	if inf.Config != nil {
+		allowed = inf.Config.Jobs.ExpiryWebhookAllowedHosts
+	}
+	_, err := parseExpiryWebhook(*job.ExpiryWebhook, allowed)
+	return err
+}
+
+// setExpiryWebhook records the expiry webhook of the identified, newly
+// created jobs, if there is one.
+func setExpiryWebhook(tx *sql.Tx, webhook *string, ids ...uint64) error {
+	if webhook == nil {
+		return nil
+	}
+	_, err := tx.Exec(setExpiryWebhookQuery, *webhook, pq.Array(ids))
+	return err
+}
+
+// expiryWebhookChangeLog returns the part of a change log entry about a newly
+// created job that records its expiry webhook - without any password - which
+// is empty if it has none.
+func expiryWebhookChangeLog(job tc.InvalidationJobCreateV4) string {
+	if job.ExpiryWebhook == nil {
+		return ""
+	}
+	webhook := *job.ExpiryWebhook
+	if u, err := url.Parse(webhook); err == nil {
+		webhook = u.Redacted()
+	}
+	return " EXPIRY_WEBHOOK: '" + webhook + "'"
+}
+
+// expiryWebhook is a claimed attempt to send a job's expiry webhook.
+type expiryWebhook struct {
+	URL      string
+	Attempts int
+	Job      tc.InvalidationJobV5
+}
+
+// expiryWebhookClient sends expiry webhooks. It doesn't follow redirects,
+// which could lead to hosts that aren't allowed.
+var expiryWebhookClient = &http.Client{
+	Timeout: expiryWebhookTimeout,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// postExpiryWebhook POSTs the given job, as JSON, to the given URL, which must
+// respond with a 2xx status.
+func postExpiryWebhook(client *http.Client, webhook string, job tc.InvalidationJobV5) error {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("encoding job: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(rfc.ContentType, rfc.ApplicationJSON)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("got response status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+var expiryWebhookSchedulerOnce sync.Once
+
+// InitExpiryWebhookScheduler starts the sender of the expiry webhooks of
+// Content Invalidation Jobs, which every 'interval'
+// (DefaultExpiryWebhookCheckInterval if that isn't positive) POSTs each job
+// whose window has elapsed to its expiry webhook, if it has one, sending no
+// more than 'maxPerMinute' (DefaultExpiryWebhookMaxPerMinute if that isn't
+// positive) per minute. Webhooks are only sent to the given allowed hosts. It
+// only does anything the first time it's called.
+func InitExpiryWebhookScheduler(interval time.Duration, maxPerMinute int, allowedHosts []string, db *sql.DB, timeout time.Duration) {
+	expiryWebhookSchedulerOnce.Do(func() {
+		if interval <= 0 {
+			interval = DefaultExpiryWebhookCheckInterval
+		}
+		if maxPerMinute <= 0 {
+			maxPerMinute = DefaultExpiryWebhookMaxPerMinute
+		}
+		go func() {
+			for {
+				if err := sendExpiryWebhooks(db, timeout, expiryWebhookClient, allowedHosts, maxPerMinute); err != nil {
+					log.Errorf("sending content invalidation job expiry webhooks: %v", err)
+				}
+				time.Sleep(interval)
+			}
+		}()
+	})
+}
+
+// claimExpiryWebhooks claims up to 'limit' due expiry webhooks, committing the
+// claim before any of them are sent.
+func claimExpiryWebhooks(db *sql.DB, timeout time.Duration, limit int) ([]expiryWebhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %v", err)
+	}
+	commit := false
+	defer func() {
+		if !commit {
+			if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+				log.Errorf("rolling back expiry webhook transaction: %v", err)
+			}
+		}
+	}()
+
+	rows, err := tx.Query(claimExpiryWebhooksQuery, limit, int64(expiryWebhookBackoff.Seconds()))
+	if err != nil {
+		return nil, fmt.Errorf("claiming due expiry webhooks: %v", err)
+	}
+	defer rows.Close()
+	webhooks := []expiryWebhook{}
+	for rows.Next() {
+		var w expiryWebhook
+		if err := rows.Scan(&w.URL,
+			&w.Attempts,
+			&w.Job.ID,
+			&w.Job.AssetURL,
+			&w.Job.CreatedBy,
+			&w.Job.DeliveryService,
+			&w.Job.TTLHours,
+			&w.Job.InvalidationType,
+			&w.Job.StartTime,
+			&w.Job.Comment,
+			&w.Job.Priority,
+			labelsColumn{&w.Job.Labels}); err != nil {
+			return nil, fmt.Errorf("scanning due expiry webhook: %v", err)
+		}
+		w.Job.EndTime = jobEndTime(w.Job.StartTime, w.Job.TTLHours)
+		w.Job.ApprovalState = tc.InvalidationJobApproved
+		webhooks = append(webhooks, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating over due expiry webhooks: %v", err)
+	}
+	rows.Close()
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("committing: %v", err)
+	}
+	commit = true
+	return webhooks, nil
+}
+
+// sendExpiryWebhooks sends up to 'maxPerMinute' due expiry webhooks, spread
+// over a minute. Each that's sent - or that fails for the last time, or whose
+// host is no longer allowed - isn't sent again; failures are only logged.
+func sendExpiryWebhooks(db *sql.DB, timeout time.Duration, client *http.Client, allowedHosts []string, maxPerMinute int) error {
+	webhooks, err := claimExpiryWebhooks(db, timeout, maxPerMinute)
+	if err != nil {
+		return err
+	}
+	gap := time.Minute / time.Duration(maxPerMinute)
+	for i, w := range webhooks {
+		if i > 0 {
+			time.Sleep(gap)
+		}
+		done := true
+		if u, err := parseExpiryWebhook(w.URL, allowedHosts); err != nil {
+			log.Warnf("not sending expiry webhook of content invalidation job #%d: %v", w.Job.ID, err)
+		} else if err := postExpiryWebhook(client, w.URL, w.Job); err == nil {
+			log.Infof("sent expiry webhook of content invalidation job #%d to %s", w.Job.ID, u.Redacted())
+		} else if w.Attempts >= maxExpiryWebhookAttempts {
+			log.Errorf("giving up sending expiry webhook of content invalidation job #%d to %s after %d attempts: %v", w.Job.ID, u.Redacted(), w.Attempts, err)
+		} else {
+			log.Warnf("sending expiry webhook of content invalidation job #%d to %s (attempt %d of %d): %v", w.Job.ID, u.Redacted(), w.Attempts, maxExpiryWebhookAttempts, err)
+			done = false
+		}
+		if done {
+			if err := finishExpiryWebhook(db, timeout, w.Job.ID); err != nil {
+				log.Errorf("recording expiry webhook of content invalidation job #%d as finished: %v", w.Job.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// finishExpiryWebhook records that the identified job's expiry webhook
+// shouldn't be sent again.
+func finishExpiryWebhook(db *sql.DB, timeout time.Duration, jobID uint64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_, err := db.ExecContext(ctx, finishExpiryWebhookQuery, jobID)
+	return err
+}
@@ -74,6 +74,25 @@ func GetDefault(secret string, requestTimeout time.Duration) []Middleware {
 	return []Middleware{GetWrapAccessLog(secret), TimeOutWrapper(requestTimeout), WrapHeaders, WrapPanicRecover}
 }
 
+// MinGzipSize is the size, in bytes, below which responses of handlers using
+// GetDefaultMinGzipSize aren't gzipped: roughly one TCP segment, below which
+// compressing saves no round trips and costs CPU on both ends.
+const MinGzipSize = 1400
+
+// GetDefaultMinGzipSize returns the default Middlewares, except that responses
+// smaller than minGzipSize bytes aren't gzipped, even if the client accepts
+// it. This is for endpoints whose responses vary from tiny to very large.
+func GetDefaultMinGzipSize(secret string, requestTimeout time.Duration, minGzipSize int) []Middleware {
+	return []Middleware{GetWrapAccessLog(secret), TimeOutWrapper(requestTimeout), WrapHeadersMinGzipSize(minGzipSize), WrapPanicRecover}
+}
+
+// GetStreaming returns the Middlewares for handlers that stream their
+// responses. Unlike the default Middlewares, these don't buffer the response
+// (to hash and compress it) or time the request out.
+func GetStreaming(secret string) []Middleware {
+	return []Middleware{GetWrapAccessLog(secret), WrapPanicRecover}
+}
+
 // Use takes a slice of middlewares, and applies them in reverse order (which is the intuitive behavior) to the given HandlerFunc h.
 // It returns a HandlerFunc which will call all middlewares, and then h.
 func Use(h http.HandlerFunc, middlewares []Middleware) http.HandlerFunc {
@@ -147,6 +166,18 @@ func TimeOutWrapper(timeout time.Duration) Middleware {
 //   - Gzips the response and sets the Content-Encoding header, if the client sent an Accept-Encoding: gzip header.
 //   - Adds the Vary: Accept-Encoding header to the response
 func WrapHeaders(h http.HandlerFunc) http.HandlerFunc {
+	return wrapHeaders(h, 0)
+}
+
+// WrapHeadersMinGzipSize returns a Middleware like WrapHeaders, except that it
+// doesn't gzip responses smaller than minGzipSize bytes.
+func WrapHeadersMinGzipSize(minGzipSize int) Middleware {
+	return func(h http.HandlerFunc) http.HandlerFunc {
+		return wrapHeaders(h, minGzipSize)
+	}
+}
+
+func wrapHeaders(h http.HandlerFunc, minGzipSize int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept, Set-Cookie, Cookie")
@@ -161,6 +192,10 @@ func WrapHeaders(h http.HandlerFunc) http.HandlerFunc {
 		sha := sha512.Sum512(iw.Body())
 		w.Header().Set("Whole-Content-SHA512", base64.StdEncoding.EncodeToString(sha[:]))
 
+		if len(iw.Body()) < minGzipSize {
+			writeResponse(w, r, iw.Body())
+			return
+		}
 		GzipResponse(w, r, iw.Body())
 
 	}
@@ -261,7 +296,12 @@ func GzipResponse(w http.ResponseWriter, r *http.Request, bytes []byte) {
 		}
 		return
 	}
+	writeResponse(w, r, bytes)
+}
 
+// writeResponse writes the status code stored in the Request's context, if
+// any, and then the given bytes, to w.
+func writeResponse(w http.ResponseWriter, r *http.Request, bytes []byte) {
 	ctx := r.Context()
 	val := ctx.Value(tc.StatusKey)
 	status, ok := val.(int)
@@ -156,6 +156,40 @@ func TestGzip(t *testing.T) {
 	}
 }
 
+// TestGzipMinSize checks that responses smaller than the minimum size aren't
+// gzip'd, even if Accept-Encoding contains "gzip"
+func TestGzipMinSize(t *testing.T) {
+	body := ""
+	f := WrapHeadersMinGzipSize(16)(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	})
+
+	r, err := http.NewRequest("", "/", nil)
+	if err != nil {
+		t.Fatal("Error creating new request")
+	}
+	r.Header.Add("Accept-Encoding", "gzip")
+
+	body = "too small"
+	w := httptest.NewRecorder()
+	f(w, r)
+	if !bytes.Equal(w.Body.Bytes(), []byte(body)) || w.Header().Get("Content-Encoding") != "" {
+		t.Error("Expected a body smaller than the minimum size to be NOT gzip'd!")
+	}
+
+	body = strings.Repeat("large enough", 4)
+	w = httptest.NewRecorder()
+	f(w, r)
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Expected a body at least the minimum size to be gzip'd, but reading it failed: %v", err)
+	}
+	unzipped, err := ioutil.ReadAll(zr)
+	if err != nil || string(unzipped) != body || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("Expected a body at least the minimum size to be gzip'd, got: '%s' (error: %v)", unzipped, err)
+	}
+}
+
 func newRWPair(t *testing.T, cookie *http.Cookie) (*httptest.ResponseRecorder, *http.Request) {
 	w := httptest.NewRecorder()
 	r, err := http.NewRequest("", "/api/4.0/blah", nil)
@@ -179,15 +179,21 @@ type PathHandler struct {
 	ID      int
 }
 
+// getRequestTimeout returns the timeout of requests given the configured
+// number of seconds, which uses the default if it isn't positive.
+func getRequestTimeout(reqTimeOutSeconds int) time.Duration {
+	if reqTimeOutSeconds > 0 {
+		return time.Second * time.Duration(reqTimeOutSeconds)
+	}
+	return middleware.DefaultRequestTimeout
+}
+
 // CreateRouteMap returns a map of methods to a slice of paths and handlers; wrapping the handlers in the appropriate middleware. Uses Semantic Versioning: routes are added to every subsequent minor version, but not subsequent major versions. For example, a 1.2 route is added to 1.3 but not 2.1. Also truncates '2.0' to '2', creating succinct major versions.
 // Returns the map of routes, and a map of API versions served.
 func CreateRouteMap(rs []Route, disabledRouteIDs []int, perlHandler http.HandlerFunc, authBase middleware.AuthBase, reqTimeOutSeconds int) (map[string][]PathHandler, map[api.Version]struct{}) {
 	// TODO strong types for method, path
 	versions := getSortedRouteVersions(rs)
-	requestTimeout := middleware.DefaultRequestTimeout
-	if reqTimeOutSeconds > 0 {
-		requestTimeout = time.Second * time.Duration(reqTimeOutSeconds)
-	}
+	requestTimeout := getRequestTimeout(reqTimeOutSeconds)
 	disabledRoutes := GetRouteIDMap(disabledRouteIDs)
 	m := map[string][]PathHandler{}
 	for _, r := range rs {
@@ -16,11 +16,16 @@
 package client
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/traffic_ops/toclientlib"
@@ -33,6 +38,21 @@ func (to *Session) CreateInvalidationJob(job tc.InvalidationJobInput) (tc.Alerts
 	return alerts, reqInf, err
 }
 
+// CreateInvalidationJobFromLegacy creates a new Content Invalidation Job
+// equivalent to the given legacy job - as returned by the deprecated
+// /user/current/jobs API endpoint - starting at startTime. Alerts describing
+// any of the legacy job's fields that were ignored are added to those
+// returned. If the legacy job can't be converted, no request is made.
+func (to *Session) CreateInvalidationJobFromLegacy(job tc.UserInvalidationJob, startTime tc.Time) (tc.Alerts, toclientlib.ReqInf, error) {
+	input, ignored, err := job.ToInvalidationJobInput(startTime)
+	if err != nil {
+		return tc.Alerts{}, toclientlib.ReqInf{}, fmt.Errorf("converting legacy Content Invalidation Job: %w", err)
+	}
+	alerts, reqInf, err := to.CreateInvalidationJob(input)
+	alerts.AddAlerts(tc.CreateAlerts(tc.WarnLevel, ignored...))
+	return alerts, reqInf, err
+}
+
 // Deletes a Content Invalidation Job
 func (to *Session) DeleteInvalidationJob(jobID uint64) (tc.Alerts, toclientlib.ReqInf, error) {
 	var alerts tc.Alerts
@@ -161,3 +181,232 @@ func (to *Session) GetInvalidationJobsWithHdr(ds *interface{}, user *interface{}
 	reqInf, err := to.get(path, hdr, &data)
 	return data.Response, reqInf, err
 }
+
+// StreamInvalidationJobs requests the Content Invalidation Jobs visible to
+// your Tenant that match the given filters - the same as those accepted by
+// GetInvalidationJobsCount - and calls fn with each one as it's decoded from
+// the response, rather than decoding them all into memory at once, so that
+// memory stays bounded for very large listings. params may be nil to list all
+// visible jobs.
+//
+// If fn returns an error, no more jobs are decoded, and that error is
+// returned. Responses are never served from the Session's IMS cache.
+func (to *Session) StreamInvalidationJobs(params url.Values, fn func(tc.InvalidationJob) error) (toclientlib.ReqInf, error) {
+	path := "/jobs"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+
+	stream := &invalidationJobStream{fn: fn}
+	reqInf, err := to.TOClient.Req(http.MethodGet, path, nil, nil, stream)
+	if stream.fnErr != nil {
+		return reqInf, stream.fnErr
+	}
+	return reqInf, err
+}
+
+// invalidationJobStream is a toclientlib.StreamDecoder that decodes the
+// Content Invalidation Jobs in the "response" array of a response one at a
+// time.
+type invalidationJobStream struct {
+	fn    func(tc.InvalidationJob) error
+	fnErr error
+}
+
+// DecodeStream implements the toclientlib.StreamDecoder interface.
+func (s *invalidationJobStream) DecodeStream(body io.Reader) error {
+	dec := json.NewDecoder(body)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if key != "response" {
+			// Skip anything else, e.g. alerts.
+			var skipped json.RawMessage
+			if err := dec.Decode(&skipped); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := expectDelim(dec, '['); err != nil {
+			return err
+		}
+		for dec.More() {
+			var job tc.InvalidationJob
+			if err := dec.Decode(&job); err != nil {
+				return err
+			}
+			if err := s.fn(job); err != nil {
+				s.fnErr = err
+				return err
+			}
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+// expectDelim reads the next JSON token from dec, and returns an error if it
+// isn't the given delimiter.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("expected '%v' in response, got: %v", delim, tok)
+	}
+	return nil
+}
+
+// GetInvalidationJobsCount returns the number of Content Invalidation Jobs
+// visible to your Tenant that match the given filters, which are the same as
+// those accepted by the /jobs listing endpoint (e.g. "dsId", "deliveryService",
+// "userId", "createdBy"). params may be nil to count all visible jobs.
+//
+// This returns an error if the Traffic Ops server is too old to provide job
+// counts.
+func (to *Session) GetInvalidationJobsCount(params url.Values) (int, toclientlib.ReqInf, error) {
+	path := "/jobs/count"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+
+	data := struct {
+		Response struct {
+			Count *int `json:"count"`
+		} `json:"response"`
+	}{}
+	reqInf, err := to.get(path, nil, &data)
+	if reqInf.StatusCode == http.StatusNotFound {
+		return 0, reqInf, errors.New("this Traffic Ops server does not support counting Content Invalidation Jobs")
+	}
+	if err != nil {
+		return 0, reqInf, err
+	}
+	if data.Response.Count == nil {
+		return 0, reqInf, errors.New("Traffic Ops response did not include a count")
+	}
+	return *data.Response.Count, reqInf, nil
+}
+
+// InvalidationJobPollInterval is how often CreateInvalidationJobAndWait checks
+// whether the servers affected by a new Content Invalidation Job have applied
+// it.
+const InvalidationJobPollInterval = 5 * time.Second
+
+// InvalidationJobTimeoutError is returned by CreateInvalidationJobAndWait when
+// not every affected server applied the new Content Invalidation Job before
+// the timeout elapsed. The job itself was created.
+type InvalidationJobTimeoutError struct {
+	// Progress is how far the job had propagated when the timeout elapsed.
+	Progress tc.InvalidationJobRevalProgress
+	// Timeout is how long was waited.
+	Timeout time.Duration
+}
+
+// Error implements the error interface.
+func (e *InvalidationJobTimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %v waiting for Content Invalidation Job #%d to propagate: %d of %d servers applied it; still pending: %s",
+		e.Timeout,
+		e.Progress.JobID,
+		e.Progress.Applied,
+		e.Progress.Total,
+		strings.Join(e.Progress.Pending, ", "))
+}
+
+// CreateInvalidationJobAndWait creates a Content Invalidation Job, then waits
+// until every server of its Delivery Service that had an update or
+// revalidation pending right after it was created has applied it, or until
+// 'timeout' elapses. On timeout, the created job is returned along with an
+// *InvalidationJobTimeoutError describing which servers have yet to apply it.
+//
+// API version 3 has no way to track the servers affected by a particular job,
+// so this is only an approximation of what the job flagged: servers are
+// considered to have applied the job once they no longer have an update or
+// revalidation pending, so a change queued on them while waiting - by this
+// job or any other - may extend the wait, and servers that applied the job
+// before the first check aren't counted at all. In API version 5.0 and later,
+// the /jobs/{id}/reval_progress endpoint tracks a job's servers exactly.
+func (to *Session) CreateInvalidationJobAndWait(input tc.InvalidationJobInput, timeout time.Duration) (tc.InvalidationJob, error) {
+	deadline := time.Now().Add(timeout)
+
+	var created struct {
+		Response tc.InvalidationJob `json:"response"`
+		tc.Alerts
+	}
+	if _, err := to.post(`/jobs`, input, nil, &created); err != nil {
+		return tc.InvalidationJob{}, err
+	}
+	job := created.Response
+	if job.ID == nil || job.DeliveryService == nil {
+		return job, errors.New("Traffic Ops response did not include the created Content Invalidation Job")
+	}
+
+	dses, _, err := to.GetDeliveryServiceByXMLIDNullableWithHdr(*job.DeliveryService, nil)
+	if err != nil {
+		return job, fmt.Errorf("getting Delivery Service '%s' of Content Invalidation Job #%d: %w", *job.DeliveryService, *job.ID, err)
+	}
+	if len(dses) != 1 || dses[0].ID == nil {
+		return job, fmt.Errorf("getting Delivery Service '%s' of Content Invalidation Job #%d: expected exactly one, got %d", *job.DeliveryService, *job.ID, len(dses))
+	}
+	params := url.Values{}
+	params.Set("dsId", strconv.Itoa(*dses[0].ID))
+
+	sleep := to.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	progress := tc.InvalidationJobRevalProgress{JobID: *job.ID}
+	var affected map[string]struct{}
+	for {
+		servers, _, err := to.GetServersWithHdr(&params, nil)
+		if err != nil {
+			return job, fmt.Errorf("getting servers affected by Content Invalidation Job #%d: %w", *job.ID, err)
+		}
+
+		pending := map[string]struct{}{}
+		for _, server := range servers.Response {
+			if server.HostName == nil {
+				continue
+			}
+			if (server.RevalPending != nil && *server.RevalPending) || (server.UpdPending != nil && *server.UpdPending) {
+				pending[*server.HostName] = struct{}{}
+			}
+		}
+		// The servers that the job affected are those that were pending
+		// immediately after it was created.
+		if affected == nil {
+			affected = pending
+		}
+
+		progress.Total = len(affected)
+		progress.Pending = []string{}
+		for hostName := range affected {
+			if _, ok := pending[hostName]; ok {
+				progress.Pending = append(progress.Pending, hostName)
+			}
+		}
+		sort.Strings(progress.Pending)
+		progress.Applied = progress.Total - len(progress.Pending)
+		if len(progress.Pending) == 0 {
+			return job, nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return job, &InvalidationJobTimeoutError{Progress: progress, Timeout: timeout}
+		}
+		if remaining > InvalidationJobPollInterval {
+			remaining = InvalidationJobPollInterval
+		}
+		sleep(remaining)
+	}
+}
@@ -0,0 +1,145 @@
+/*
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// InvalidationJobBuilder builds a tc.InvalidationJobInput - for
+// CreateInvalidationJob or CreateInvalidationJobAndWait - without the caller
+// having to set its pointer fields by hand. Its methods may be chained, e.g.
+//
+//	input, err := NewInvalidationJobBuilder("demo1").
+//		WithRegex(`/images/.*\.png`).
+//		WithTTL(48 * time.Hour).
+//		StartingAt(time.Now().Add(time.Minute)).
+//		Build()
+//
+// Problems with the values given are reported by Build, not by the methods
+// that set them.
+type InvalidationJobBuilder struct {
+	input tc.InvalidationJobInput
+	errs  []string
+	// ttlGiven records that WithTTL was called, even if with a TTL that was
+	// refused.
+	ttlGiven bool
+}
+
+// NewInvalidationJobBuilder returns a builder of a Content Invalidation Job
+// on the Delivery Service with the given XMLID.
+func NewInvalidationJobBuilder(dsXMLID string) *InvalidationJobBuilder {
+	b := &InvalidationJobBuilder{}
+	if dsXMLID == "" {
+		b.errs = append(b.errs, "deliveryService: cannot be blank")
+		return b
+	}
+	var ds interface{} = dsXMLID
+	b.input.DeliveryService = &ds
+	return b
+}
+
+// WithRegex sets the regular expression of the job, which must start with
+// '/' (or '\/').
+func (b *InvalidationJobBuilder) WithRegex(regex string) *InvalidationJobBuilder {
+	b.input.Regex = &regex
+	return b
+}
+
+// WithTTL sets the TTL of the job, which must be at least an hour. Traffic Ops
+// only considers whole hours, so any fraction of an hour is discarded.
+func (b *InvalidationJobBuilder) WithTTL(ttl time.Duration) *InvalidationJobBuilder {
+	b.ttlGiven = true
+	if ttl < time.Hour {
+		b.errs = append(b.errs, "ttl: must be at least one hour")
+		return b
+	}
+	var hours interface{} = float64(ttl / time.Hour)
+	b.input.TTL = &hours
+	return b
+}
+
+// StartingAt sets the time at which the job comes into effect, which must be
+// in the future.
+func (b *InvalidationJobBuilder) StartingAt(startTime time.Time) *InvalidationJobBuilder {
+	b.input.StartTime = &tc.Time{Time: startTime, Valid: true}
+	return b
+}
+
+// WithRecurrence makes the job recur.
+func (b *InvalidationJobBuilder) WithRecurrence(recurrence tc.InvalidationJobRecurrence) *InvalidationJobBuilder {
+	b.input.Recurrence = &recurrence
+	return b
+}
+
+// WithComment sets the note explaining why the job was created.
+func (b *InvalidationJobBuilder) WithComment(comment string) *InvalidationJobBuilder {
+	b.input.Comment = &comment
+	return b
+}
+
+// WithPriority sets the priority of the job.
+func (b *InvalidationJobBuilder) WithPriority(priority int) *InvalidationJobBuilder {
+	b.input.Priority = &priority
+	return b
+}
+
+// WithLabel adds a label to the job.
+func (b *InvalidationJobBuilder) WithLabel(key, value string) *InvalidationJobBuilder {
+	if b.input.Labels == nil {
+		b.input.Labels = map[string]string{}
+	}
+	b.input.Labels[key] = value
+	return b
+}
+
+// Build returns the built job, or an error describing any and all problems
+// with it - including required fields that weren't set - as found by
+// tc.InvalidationJobInput.ValidateSyntax. The Delivery Service isn't checked
+// to exist, and the TTL isn't checked against the maxRevalDurationDays
+// Parameter; Traffic Ops does that when the job is created.
+func (b *InvalidationJobBuilder) Build() (tc.InvalidationJobInput, error) {
+	errs := append([]string{}, b.errs...)
+	if b.input.Regex == nil {
+		errs = append(errs, "regex: must be set with WithRegex")
+	}
+	if !b.ttlGiven {
+		errs = append(errs, "ttl: must be set with WithTTL")
+	}
+	if b.input.StartTime == nil {
+		errs = append(errs, "startTime: must be set with StartingAt")
+	}
+	if len(errs) > 0 {
+		return tc.InvalidationJobInput{}, errors.New(strings.Join(errs, ", "))
+	}
+
+	input := b.input
+	if b.input.Labels != nil {
+		input.Labels = make(map[string]string, len(b.input.Labels))
+		for k, v := range b.input.Labels {
+			input.Labels[k] = v
+		}
+	}
+	if err := input.ValidateSyntax(); err != nil {
+		return tc.InvalidationJobInput{}, fmt.Errorf("invalid Content Invalidation Job: %w", err)
+	}
+	return input, nil
+}
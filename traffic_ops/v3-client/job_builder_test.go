@@ -0,0 +1,117 @@
+/*
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ExampleInvalidationJobBuilder() {
+	input, err := NewInvalidationJobBuilder("demo1").
+		WithRegex(`/images/.*\.png`).
+		WithTTL(48*time.Hour).
+		StartingAt(time.Now().Add(time.Minute)).
+		WithComment("CHG-1234").
+		WithLabel("release", "2026.10").
+		Build()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(*input.DeliveryService, *input.Regex, *input.TTL, *input.Comment, input.Labels["release"])
+	// Output: demo1 /images/.*\.png 48 CHG-1234 2026.10
+}
+
+func ExampleInvalidationJobBuilder_missingFields() {
+	_, err := NewInvalidationJobBuilder("demo1").WithRegex(`/images/.*\.png`).Build()
+	fmt.Println(err)
+	// Output: ttl: must be set with WithTTL, startTime: must be set with StartingAt
+}
+
+func TestInvalidationJobBuilder(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	for _, test := range []struct {
+		name    string
+		builder *InvalidationJobBuilder
+		errs    []string
+	}{
+		{
+			name:    "complete",
+			builder: NewInvalidationJobBuilder("demo1").WithRegex("/.*").WithTTL(90 * time.Minute).StartingAt(future).WithPriority(5),
+		},
+		{
+			name:    "nothing set",
+			builder: NewInvalidationJobBuilder(""),
+			errs:    []string{"deliveryService", "regex", "ttl", "startTime"},
+		},
+		{
+			name:    "short TTL",
+			builder: NewInvalidationJobBuilder("demo1").WithRegex("/.*").WithTTL(time.Minute).StartingAt(future),
+			errs:    []string{"ttl: must be at least one hour"},
+		},
+		{
+			name:    "start in the past",
+			builder: NewInvalidationJobBuilder("demo1").WithRegex("/.*").WithTTL(time.Hour).StartingAt(time.Now().Add(-time.Hour)),
+			errs:    []string{"startTime: must be in the future"},
+		},
+		{
+			name:    "invalid regex",
+			builder: NewInvalidationJobBuilder("demo1").WithRegex("images/(").WithTTL(time.Hour).StartingAt(future),
+			errs:    []string{"regex"},
+		},
+		{
+			name:    "invalid priority",
+			builder: NewInvalidationJobBuilder("demo1").WithRegex("/.*").WithTTL(time.Hour).StartingAt(future).WithPriority(-1),
+			errs:    []string{"priority"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			input, err := test.builder.Build()
+			if len(test.errs) == 0 {
+				if err != nil {
+					t.Fatalf("Unexpected error building job: %v", err)
+				}
+				if ttl, err := input.TTLHours(); err != nil || ttl != 1 {
+					t.Errorf("Expected a TTL of 1 hour, got: %d (error: %v)", ttl, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Expected an error building job, got none")
+			}
+			for _, expected := range test.errs {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("Expected error to mention '%s', got: %v", expected, err)
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidationJobBuilderLabelsNotShared(t *testing.T) {
+	b := NewInvalidationJobBuilder("demo1").WithRegex("/.*").WithTTL(time.Hour).StartingAt(time.Now().Add(time.Hour)).WithLabel("a", "1")
+	input, err := b.Build()
+	if err != nil {
+		t.Fatalf("Unexpected error building job: %v", err)
+	}
+	b.WithLabel("b", "2")
+	if _, ok := input.Labels["b"]; ok {
+		t.Error("Expected labels added after Build not to change the built job")
+	}
+}
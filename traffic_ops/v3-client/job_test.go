@@ -0,0 +1,149 @@
+/*
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+func TestGetInvalidationJobsCount(t *testing.T) {
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/jobs/count") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		query = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"response":{"count":3}}`))
+	}))
+	defer srv.Close()
+
+	to := NewNoAuthSession(srv.URL, false, "test", false, time.Second)
+	count, _, err := to.GetInvalidationJobsCount(url.Values{"dsId": []string{"1"}})
+	if err != nil {
+		t.Fatalf("Unexpected error counting jobs: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected a count of 3, got: %d", count)
+	}
+	if query.Get("dsId") != "1" {
+		t.Errorf("Expected the dsId filter to be sent, got query: %v", query)
+	}
+}
+
+func TestGetInvalidationJobsCountUnsupported(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	to := NewNoAuthSession(srv.URL, false, "test", false, time.Second)
+	_, reqInf, err := to.GetInvalidationJobsCount(nil)
+	if err == nil || !strings.Contains(err.Error(), "does not support") {
+		t.Errorf("Expected an error saying counting isn't supported, got: %v", err)
+	}
+	if reqInf.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status %d, got: %d", http.StatusNotFound, reqInf.StatusCode)
+	}
+}
+
+// waitServer stubs the endpoints used by CreateInvalidationJobAndWait. Each
+// GET request for servers is answered with the next of 'polls', which maps
+// host names to whether they have a revalidation pending.
+func waitServer(t *testing.T, polls []map[string]bool) *httptest.Server {
+	t.Helper()
+	poll := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/jobs"):
+			w.Write([]byte(`{"response":{"id":7,"deliveryService":"demo1"}}`))
+		case strings.HasSuffix(r.URL.Path, "/deliveryservices"):
+			w.Write([]byte(`{"response":[{"id":3,"xmlId":"demo1","cdnId":1}]}`))
+		case strings.HasSuffix(r.URL.Path, "/servers"):
+			if r.URL.Query().Get("dsId") != "3" || r.URL.Query().Get("cdn") != "" {
+				t.Errorf("Expected servers to be limited to the job's Delivery Service, got query: %s", r.URL.RawQuery)
+			}
+			servers := []string{}
+			for hostName, pending := range polls[poll] {
+				servers = append(servers, fmt.Sprintf(`{"hostName":"%s","revalPending":%t,"updPending":false}`, hostName, pending))
+			}
+			if poll < len(polls)-1 {
+				poll++
+			}
+			w.Write([]byte(`{"response":[` + strings.Join(servers, ",") + `]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestCreateInvalidationJobAndWait(t *testing.T) {
+	srv := waitServer(t, []map[string]bool{
+		{"edge1": true, "edge2": true, "edge3": false},
+		{"edge1": false, "edge2": true, "edge3": false},
+		// edge3 being flagged afterwards isn't waited for.
+		{"edge1": false, "edge2": false, "edge3": true},
+	})
+	defer srv.Close()
+
+	to := NewNoAuthSession(srv.URL, false, "test", false, time.Second)
+	slept := 0
+	to.sleep = func(d time.Duration) {
+		if d > InvalidationJobPollInterval {
+			t.Errorf("Expected to wait at most %v between polls, waited %v", InvalidationJobPollInterval, d)
+		}
+		slept++
+	}
+	job, err := to.CreateInvalidationJobAndWait(tc.InvalidationJobInput{}, time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error waiting for job: %v", err)
+	}
+	if job.ID == nil || *job.ID != 7 {
+		t.Errorf("Expected the created job to be returned, got: %+v", job)
+	}
+	if slept != 2 {
+		t.Errorf("Expected to poll 3 times, waiting twice, waited %d times", slept)
+	}
+}
+
+func TestCreateInvalidationJobAndWaitTimeout(t *testing.T) {
+	srv := waitServer(t, []map[string]bool{{"edge1": true, "edge2": false}})
+	defer srv.Close()
+
+	to := NewNoAuthSession(srv.URL, false, "test", false, time.Second)
+	to.sleep = func(time.Duration) {
+		t.Error("Expected not to wait after the timeout elapsed")
+	}
+	_, err := to.CreateInvalidationJobAndWait(tc.InvalidationJobInput{}, 0)
+	var timeoutErr *InvalidationJobTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("Expected an *InvalidationJobTimeoutError, got: %v", err)
+	}
+	if timeoutErr.Progress.JobID != 7 || timeoutErr.Progress.Total != 1 || len(timeoutErr.Progress.Pending) != 1 || timeoutErr.Progress.Pending[0] != "edge1" {
+		t.Errorf("Expected edge1 to be the only server pending, got: %+v", timeoutErr.Progress)
+	}
+}
@@ -17,16 +17,20 @@
 package client
 
 import (
+	"container/list"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/apache/trafficcontrol/lib/go-rfc"
 	"github.com/apache/trafficcontrol/traffic_ops/toclientlib"
 )
 
@@ -40,16 +44,125 @@ func Login(url, user, pass string, opts ClientOpts) (*Session, toclientlib.ReqIn
 	if err != nil {
 		return nil, reqInf, err
 	}
-	return &Session{TOClient: *cl}, reqInf, err
+	return &Session{TOClient: *cl, UseIMSCache: opts.UseIMSCache}, reqInf, err
 }
 
 type ClientOpts struct {
 	toclientlib.ClientOpts
+
+	// UseIMSCache sets the UseIMSCache field of the returned Session.
+	UseIMSCache bool
 }
 
 // Session is a Traffic Ops client.
 type Session struct {
 	toclientlib.TOClient
+
+	// UseIMSCache, if true, causes the Session to remember the Last-Modified
+	// time and body of each successful GET response, and to send that time in
+	// an If-Modified-Since header on subsequent GETs of the same path and
+	// query string. When Traffic Ops responds to such a request with 304 Not
+	// Modified, the remembered body is decoded into the response instead, and
+	// the returned ReqInf's CacheHitStatus is CacheHitStatusHit.
+	//
+	// Requests that already carry an If-Modified-Since header are never
+	// affected.
+	UseIMSCache bool
+
+	// IMSCacheMaxEntries is the most responses that the IMS cache remembers;
+	// when it's full, the least recently used one is forgotten. If it's not
+	// positive, DefaultIMSCacheMaxEntries is used.
+	IMSCacheMaxEntries int
+
+	imsCache     *imsCache
+	imsCacheOnce sync.Once
+
+	// sleep, if not nil, is used instead of time.Sleep to wait between polls.
+	sleep func(time.Duration)
+}
+
+// DefaultIMSCacheMaxEntries is the most responses that a Session's IMS cache
+// remembers, if its IMSCacheMaxEntries isn't set.
+const DefaultIMSCacheMaxEntries = 1000
+
+// imsCache stores the Last-Modified time and raw body of GET responses, keyed
+// by request path and query string (see imsCacheKey), up to a maximum number
+// of entries.
+type imsCache struct {
+	m          sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	// lru holds the keys of the entries, most recently used first.
+	lru *list.List
+}
+
+type imsCacheEntry struct {
+	key          string
+	lastModified string
+	body         []byte
+}
+
+func newIMSCache(maxEntries int) *imsCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultIMSCacheMaxEntries
+	}
+	return &imsCache{
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+func (c *imsCache) load(key string) (imsCacheEntry, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return imsCacheEntry{}, false
+	}
+	c.lru.MoveToFront(elem)
+	return *elem.Value.(*imsCacheEntry), true
+}
+
+func (c *imsCache) store(entry imsCacheEntry) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if elem, ok := c.entries[entry.key]; ok {
+		elem.Value = &entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[entry.key] = c.lru.PushFront(&entry)
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*imsCacheEntry).key)
+	}
+}
+
+// imsCacheKey returns the key of the IMS cache entry for a request path,
+// which includes its query string - with the parameters sorted, so that
+// equivalent requests share an entry.
+func imsCacheKey(path string) string {
+	i := strings.Index(path, "?")
+	if i < 0 {
+		return path
+	}
+	query, err := url.ParseQuery(path[i+1:])
+	if err != nil {
+		return path
+	}
+	return path[:i] + "?" + query.Encode()
+}
+
+// getIMSCache returns the Session's IMS cache, creating it the first time
+// it's needed, since Sessions may be constructed directly rather than through
+// this package.
+func (to *Session) getIMSCache() *imsCache {
+	to.imsCacheOnce.Do(func() {
+		to.imsCache = newIMSCache(to.IMSCacheMaxEntries)
+	})
+	return to.imsCache
 }
 
 func NewSession(user, password, url, userAgent string, client *http.Client, useCache bool) *Session {
@@ -187,7 +300,48 @@ func makeRequestWithHeader(to *Session, method, path string, body interface{}, h
 }
 
 func (to *Session) get(path string, header http.Header, response interface{}) (toclientlib.ReqInf, error) {
-	return to.TOClient.Req(http.MethodGet, path, nil, header, response)
+	if !to.UseIMSCache || header.Get(rfc.IfModifiedSince) != "" {
+		return to.TOClient.Req(http.MethodGet, path, nil, header, response)
+	}
+	return to.getWithIMSCache(path, header, response)
+}
+
+// getWithIMSCache is like get, but uses the Session's IMS cache as described
+// by the UseIMSCache field.
+func (to *Session) getWithIMSCache(path string, header http.Header, response interface{}) (toclientlib.ReqInf, error) {
+	cache := to.getIMSCache()
+	key := imsCacheKey(path)
+	cached, isCached := cache.load(key)
+	if isCached {
+		hdr := http.Header{}
+		for k, v := range header {
+			hdr[k] = v
+		}
+		hdr.Set(rfc.IfModifiedSince, cached.lastModified)
+		header = hdr
+	}
+
+	var bts []byte
+	reqInf, err := to.TOClient.Req(http.MethodGet, path, nil, header, &bts)
+	if reqInf.StatusCode == http.StatusNotModified {
+		if !isCached {
+			return reqInf, err
+		}
+		reqInf.CacheHitStatus = toclientlib.CacheHitStatusHit
+		bts = cached.body
+	} else if lastModified := reqInf.RespHeaders.Get(rfc.LastModified); err == nil && reqInf.StatusCode == http.StatusOK && lastModified != "" {
+		cache.store(imsCacheEntry{key: key, lastModified: lastModified, body: bts})
+	}
+
+	if len(bts) == 0 {
+		return reqInf, err
+	}
+	if btsPtr, isBytes := response.(*[]byte); isBytes {
+		*btsPtr = bts
+	} else if decodeErr := json.Unmarshal(bts, response); decodeErr != nil && err == nil {
+		err = errors.New("decoding response body: " + decodeErr.Error())
+	}
+	return reqInf, err
 }
 
 func (to *Session) post(path string, body interface{}, header http.Header, response interface{}) (toclientlib.ReqInf, error) {
@@ -0,0 +1,170 @@
+/*
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/traffic_ops/toclientlib"
+)
+
+// imsServer responds to each request with a body naming its query string and
+// the number of times it has been modified, as given by 'versions', and a
+// Last-Modified time that changes with that. Requests with an
+// If-Modified-Since header that matches are answered with 304 Not Modified.
+func imsServer(t *testing.T, versions map[string]int) (*httptest.Server, *int) {
+	t.Helper()
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		version := versions[r.URL.RawQuery]
+		lastModified := time.Unix(int64(version)*3600, 0).UTC().Format(rfc.LastModifiedFormat)
+		if r.Header.Get(rfc.IfModifiedSince) == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set(rfc.LastModified, lastModified)
+		w.Header().Set(rfc.ContentType, rfc.ApplicationJSON)
+		w.Write([]byte(`{"response":{"query":"` + r.URL.RawQuery + `","version":` + strconv.Itoa(version) + `}}`))
+	}))
+	return srv, &requests
+}
+
+type imsTestResponse struct {
+	Response struct {
+		Query   string `json:"query"`
+		Version int    `json:"version"`
+	} `json:"response"`
+}
+
+func imsGet(t *testing.T, to *Session, path string) (imsTestResponse, toclientlib.ReqInf) {
+	t.Helper()
+	var resp imsTestResponse
+	reqInf, err := to.get(path, nil, &resp)
+	if err != nil {
+		t.Fatalf("Unexpected error getting %s: %v", path, err)
+	}
+	return resp, reqInf
+}
+
+func TestIMSCache(t *testing.T) {
+	versions := map[string]int{"name=a": 1, "name=b": 1}
+	srv, _ := imsServer(t, versions)
+	defer srv.Close()
+
+	to := NewNoAuthSession(srv.URL, false, "test", false, time.Second)
+	to.UseIMSCache = true
+
+	resp, reqInf := imsGet(t, to, "/things?name=a")
+	if resp.Response.Query != "name=a" || reqInf.CacheHitStatus == toclientlib.CacheHitStatusHit {
+		t.Fatalf("Expected the first request to miss the cache, got %+v with cache status %s", resp, reqInf.CacheHitStatus)
+	}
+
+	// 304 Not Modified is a hit, answered with the remembered body.
+	resp, reqInf = imsGet(t, to, "/things?name=a")
+	if reqInf.StatusCode != http.StatusNotModified || reqInf.CacheHitStatus != toclientlib.CacheHitStatusHit {
+		t.Errorf("Expected a cache hit, got status %d with cache status %s", reqInf.StatusCode, reqInf.CacheHitStatus)
+	}
+	if resp.Response.Query != "name=a" || resp.Response.Version != 1 {
+		t.Errorf("Expected the remembered body, got: %+v", resp)
+	}
+
+	// A different query string doesn't share the entry.
+	resp, reqInf = imsGet(t, to, "/things?name=b")
+	if reqInf.StatusCode != http.StatusOK || resp.Response.Query != "name=b" {
+		t.Errorf("Expected a different query string to miss the cache, got status %d and body %+v", reqInf.StatusCode, resp)
+	}
+
+	// 200 OK refreshes the entry.
+	versions["name=a"] = 2
+	resp, reqInf = imsGet(t, to, "/things?name=a")
+	if reqInf.StatusCode != http.StatusOK || resp.Response.Version != 2 {
+		t.Errorf("Expected a modified response to be returned, got status %d and body %+v", reqInf.StatusCode, resp)
+	}
+	resp, reqInf = imsGet(t, to, "/things?name=a")
+	if reqInf.CacheHitStatus != toclientlib.CacheHitStatusHit || resp.Response.Version != 2 {
+		t.Errorf("Expected a hit on the refreshed entry, got cache status %s and body %+v", reqInf.CacheHitStatus, resp)
+	}
+}
+
+func TestIMSCacheNotShared(t *testing.T) {
+	srv, requests := imsServer(t, map[string]int{"name=a": 1})
+	defer srv.Close()
+
+	first := NewNoAuthSession(srv.URL, false, "test", false, time.Second)
+	first.UseIMSCache = true
+	second := NewNoAuthSession(srv.URL, false, "test", false, time.Second)
+	second.UseIMSCache = true
+
+	imsGet(t, first, "/things?name=a")
+	if _, reqInf := imsGet(t, second, "/things?name=a"); reqInf.StatusCode != http.StatusOK {
+		t.Errorf("Expected Sessions not to share IMS caches, got status %d", reqInf.StatusCode)
+	}
+	if *requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", *requests)
+	}
+}
+
+func TestIMSCacheBounded(t *testing.T) {
+	srv, _ := imsServer(t, map[string]int{})
+	defer srv.Close()
+
+	to := NewNoAuthSession(srv.URL, false, "test", false, time.Second)
+	to.UseIMSCache = true
+	to.IMSCacheMaxEntries = 2
+
+	imsGet(t, to, "/things?name=a")
+	imsGet(t, to, "/things?name=b")
+	imsGet(t, to, "/things?name=a")
+	// This forgets name=b, the least recently used.
+	imsGet(t, to, "/things?name=c")
+
+	if len(to.imsCache.entries) != 2 || to.imsCache.lru.Len() != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(to.imsCache.entries))
+	}
+	for _, test := range []struct {
+		path string
+		hit  bool
+	}{
+		{"/things?name=a", true},
+		{"/things?name=b", false},
+	} {
+		if _, ok := to.imsCache.load(imsCacheKey(test.path)); ok != test.hit {
+			t.Errorf("Expected %s to be remembered: %t, got: %t", test.path, test.hit, ok)
+		}
+	}
+}
+
+func TestIMSCacheKey(t *testing.T) {
+	for _, test := range []struct {
+		path     string
+		expected string
+	}{
+		{"/things", "/things"},
+		{"/things?b=2&a=1", "/things?a=1&b=2"},
+		{"/things?a=1&b=2", "/things?a=1&b=2"},
+		{"/things?a=%zz", "/things?a=%zz"},
+	} {
+		if key := imsCacheKey(test.path); key != test.expected {
+			t.Errorf("Expected the key of %s to be %s, got: %s", test.path, test.expected, key)
+		}
+	}
+}
@@ -65,10 +65,11 @@ func (to *Session) GetCDNSSLKeys(name string, opts RequestOptions) (tc.CDNSSLKey
 }
 
 // QueueUpdatesForCDN set the "updPending" field of a list of servers identified by
-// 'cdnID' and any other query params (type or profile) to the value of 'queueUpdate'
-func (to *Session) QueueUpdatesForCDN(cdnID int, queueUpdate bool, opts RequestOptions) (tc.CDNQueueUpdateResponse, toclientlib.ReqInf, error) {
+// 'cdnID' and any other query params (type or profile) to the value of 'queueUpdate'.
+// The response lists the servers that were affected.
+func (to *Session) QueueUpdatesForCDN(cdnID int, queueUpdate bool, opts RequestOptions) (tc.CDNQueueUpdateAPIResponse, toclientlib.ReqInf, error) {
 	req := tc.CDNQueueUpdateRequest{Action: queueUpdateActions[queueUpdate]}
-	var resp tc.CDNQueueUpdateResponse
+	var resp tc.CDNQueueUpdateAPIResponse
 	if opts.QueryParameters == nil {
 		opts.QueryParameters = url.Values{}
 	}
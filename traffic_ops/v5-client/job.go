@@ -16,8 +16,10 @@ package client
 */
 
 import (
+	"fmt"
 	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/traffic_ops/toclientlib"
@@ -33,6 +35,19 @@ func (to *Session) CreateInvalidationJob(job tc.InvalidationJobCreateV4, opts Re
 	return alerts, reqInf, err
 }
 
+// apiJobsManifest is the API version-relative path to the /jobs/manifest API
+// route.
+const apiJobsManifest = apiJobs + "/manifest"
+
+// CreateInvalidationJobsFromManifest creates Content Invalidation Jobs for
+// each of the paths in the passed manifest, and returns a summary of the jobs
+// that were created.
+func (to *Session) CreateInvalidationJobsFromManifest(manifest tc.InvalidationJobManifest, opts RequestOptions) (tc.InvalidationJobManifestSummaryResponse, toclientlib.ReqInf, error) {
+	var resp tc.InvalidationJobManifestSummaryResponse
+	reqInf, err := to.post(apiJobsManifest, opts, manifest, &resp)
+	return resp, reqInf, err
+}
+
 // DeleteInvalidationJob deletes the Content Invalidation Job identified by
 // 'jobID'.
 func (to *Session) DeleteInvalidationJob(jobID uint64, opts RequestOptions) (tc.Alerts, toclientlib.ReqInf, error) {
@@ -45,9 +60,49 @@ func (to *Session) DeleteInvalidationJob(jobID uint64, opts RequestOptions) (tc.
 	return alerts, reqInf, err
 }
 
+// apiJobsBulkDelete is the API version-relative path to the /jobs/bulk_delete
+// API route.
+const apiJobsBulkDelete = apiJobs + "/bulk_delete"
+
+// DeleteInvalidationJobs deletes the Content Invalidation Jobs with the given
+// IDs in a single request. Jobs that don't exist or that the user may not
+// delete are skipped rather than failing the request; the response has a
+// result for each ID saying which.
+func (to *Session) DeleteInvalidationJobs(ids []uint64, opts RequestOptions) (tc.InvalidationJobBulkDeleteResponse, toclientlib.ReqInf, error) {
+	var resp tc.InvalidationJobBulkDeleteResponse
+	reqInf, err := to.post(apiJobsBulkDelete, opts, tc.InvalidationJobBulkDelete{IDs: ids}, &resp)
+	return resp, reqInf, err
+}
+
+// apiJobsExpired is the API version-relative path to the /jobs/expired API
+// route.
+const apiJobsExpired = apiJobs + "/expired"
+
+// DeleteInvalidationJobsBefore deletes every Content Invalidation Job - within
+// the user's Tenancy - that expired before 'cutoff', or only those of the
+// Delivery Service identified by 'dsID' if that isn't nil. Jobs that are still
+// in effect are never deleted, even if 'cutoff' is in the future. If 'dryRun'
+// is true, nothing is deleted, and the response's Count is how many jobs would
+// have been.
+func (to *Session) DeleteInvalidationJobsBefore(cutoff time.Time, dsID *int, dryRun bool, opts RequestOptions) (tc.ExpiredInvalidationJobsPurgedResponse, toclientlib.ReqInf, error) {
+	if opts.QueryParameters == nil {
+		opts.QueryParameters = url.Values{}
+	}
+	opts.QueryParameters.Set("before", cutoff.Format(time.RFC3339))
+	if dsID != nil {
+		opts.QueryParameters.Set("deliveryServiceId", strconv.Itoa(*dsID))
+	}
+	if dryRun {
+		opts.QueryParameters.Set("dryRun", "true")
+	}
+	var resp tc.ExpiredInvalidationJobsPurgedResponse
+	reqInf, err := to.del(apiJobsExpired, opts, &resp)
+	return resp, reqInf, err
+}
+
 // UpdateInvalidationJob updates the passed Content Invalidation Job (it is
 // expected to have an ID).
-func (to *Session) UpdateInvalidationJob(job tc.InvalidationJobV4, opts RequestOptions) (tc.Alerts, toclientlib.ReqInf, error) {
+func (to *Session) UpdateInvalidationJob(job tc.InvalidationJobV5, opts RequestOptions) (tc.Alerts, toclientlib.ReqInf, error) {
 	var alerts tc.Alerts
 	if opts.QueryParameters == nil {
 		opts.QueryParameters = url.Values{}
@@ -57,10 +112,93 @@ func (to *Session) UpdateInvalidationJob(job tc.InvalidationJobV4, opts RequestO
 	return alerts, reqInf, err
 }
 
+// ApproveInvalidationJob puts the Content Invalidation Job identified by
+// 'jobID', which must be pending approval, into effect. It can't be approved by
+// the user who created it.
+func (to *Session) ApproveInvalidationJob(jobID uint64, opts RequestOptions) (tc.InvalidationJobResponseV5, toclientlib.ReqInf, error) {
+	var data tc.InvalidationJobResponseV5
+	route := fmt.Sprintf("%s/%d/approve", apiJobs, jobID)
+	reqInf, err := to.post(route, opts, nil, &data)
+	return data, reqInf, err
+}
+
+// CancelInvalidationJob ends the already started Content Invalidation Job
+// identified by 'jobID' early, so that cache servers stop revalidating content
+// that matches it.
+func (to *Session) CancelInvalidationJob(jobID uint64, opts RequestOptions) (tc.InvalidationJobResponseV5, toclientlib.ReqInf, error) {
+	var data tc.InvalidationJobResponseV5
+	route := fmt.Sprintf("%s/%d/cancel", apiJobs, jobID)
+	reqInf, err := to.post(route, opts, nil, &data)
+	return data, reqInf, err
+}
+
+// GetInvalidationJobHistory returns the change log entries recording the
+// creation, updates, and deletion of the Content Invalidation Job identified by
+// 'jobID', oldest first.
+func (to *Session) GetInvalidationJobHistory(jobID uint64, opts RequestOptions) (tc.LogsResponse, toclientlib.ReqInf, error) {
+	var data tc.LogsResponse
+	route := fmt.Sprintf("%s/%d/history", apiJobs, jobID)
+	reqInf, err := to.get(route, opts, &data)
+	return data, reqInf, err
+}
+
+// GetInvalidationJobRevalDiagnoses explains, for each server with the given
+// host name, whether or not creating a Content Invalidation Job on the
+// Delivery Service with the given XMLID would flag it for revalidation, and
+// why.
+func (to *Session) GetInvalidationJobRevalDiagnoses(deliveryService, hostName string, opts RequestOptions) (tc.InvalidationJobRevalDiagnosesResponse, toclientlib.ReqInf, error) {
+	if opts.QueryParameters == nil {
+		opts.QueryParameters = url.Values{}
+	}
+	opts.QueryParameters.Set("deliveryService", deliveryService)
+	opts.QueryParameters.Set("hostName", hostName)
+	var data tc.InvalidationJobRevalDiagnosesResponse
+	reqInf, err := to.get(apiJobs+"/reval_diagnosis", opts, &data)
+	return data, reqInf, err
+}
+
 // GetInvalidationJobs returns a list of Content Invalidation Jobs visible to
 // your Tenant.
-func (to *Session) GetInvalidationJobs(opts RequestOptions) (tc.InvalidationJobsResponseV4, toclientlib.ReqInf, error) {
-	var data tc.InvalidationJobsResponseV4
+func (to *Session) GetInvalidationJobs(opts RequestOptions) (tc.InvalidationJobsResponseV5, toclientlib.ReqInf, error) {
+	var data tc.InvalidationJobsResponseV5
 	reqInf, err := to.get(apiJobs, opts, &data)
 	return data, reqInf, err
 }
+
+// GetInvalidationJobActiveDeliveryServices returns the Delivery Services
+// visible to your Tenant that currently have Content Invalidation Jobs in
+// effect, with how many each has. The 'cdn' query string parameter limits
+// them to those on the named CDN.
+func (to *Session) GetInvalidationJobActiveDeliveryServices(opts RequestOptions) (tc.InvalidationJobActiveDeliveryServicesResponse, toclientlib.ReqInf, error) {
+	var data tc.InvalidationJobActiveDeliveryServicesResponse
+	reqInf, err := to.get(apiJobs+"/active_delivery_services", opts, &data)
+	return data, reqInf, err
+}
+
+// ReflagInvalidationJobRevals sets the revalidation flags again for every
+// approved Content Invalidation Job in effect on the named CDN, so that servers
+// that missed them - e.g. because they were OFFLINE when the jobs were created
+// - pick them up.
+func (to *Session) ReflagInvalidationJobRevals(cdn string, opts RequestOptions) (tc.InvalidationJobRevalReflaggedResponse, toclientlib.ReqInf, error) {
+	if opts.QueryParameters == nil {
+		opts.QueryParameters = url.Values{}
+	}
+	opts.QueryParameters.Set("cdn", cdn)
+	var data tc.InvalidationJobRevalReflaggedResponse
+	reqInf, err := to.post(apiJobs+"/reflag_reval", opts, nil, &data)
+	return data, reqInf, err
+}
+
+// GetInvalidationJobMaxRevalDuration returns the effective maximum duration of
+// the Content Invalidation Jobs on the named CDN - from the
+// maxRevalDurationDays Parameter, or its default - so that the TTLs of new jobs
+// can be capped accordingly before they're created.
+func (to *Session) GetInvalidationJobMaxRevalDuration(cdn string, opts RequestOptions) (tc.InvalidationJobMaxRevalDurationResponse, toclientlib.ReqInf, error) {
+	if opts.QueryParameters == nil {
+		opts.QueryParameters = url.Values{}
+	}
+	opts.QueryParameters.Set("cdn", cdn)
+	var data tc.InvalidationJobMaxRevalDurationResponse
+	reqInf, err := to.get(apiJobs+"/max_reval_duration", opts, &data)
+	return data, reqInf, err
+}
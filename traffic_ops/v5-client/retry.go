@@ -0,0 +1,90 @@
+package client
+
+/*
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/apache/trafficcontrol/traffic_ops/toclientlib"
+)
+
+// DefaultRetryMaxElapsed is the longest time spent retrying a request when a
+// Session's RetryMaxElapsed is not set.
+const DefaultRetryMaxElapsed = time.Minute
+
+// maxRetryBackoffShift caps the exponent of the backoff so that it can't
+// overflow.
+const maxRetryBackoffShift = 16
+
+// shouldRetry returns whether or not a request that resulted in the given
+// ReqInf and error is worth retrying.
+func shouldRetry(reqInf toclientlib.ReqInf, err error) bool {
+	if err == nil {
+		return false
+	}
+	switch reqInf.StatusCode {
+	case 0, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryDelay returns how long to wait before the retry following the given
+// (zero-indexed) attempt.
+func (to *Session) retryDelay(attempt int) time.Duration {
+	if attempt > maxRetryBackoffShift {
+		attempt = maxRetryBackoffShift
+	}
+	delay := float64(to.RetryBackoff << uint(attempt))
+	jitter := to.RetryJitter
+	if jitter > 1 {
+		jitter = 1
+	}
+	if jitter > 0 {
+		delay += delay * jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
+
+// withRetry calls 'do' - which should make a single request - and, if
+// retries are enabled for the Session, calls it again with exponential
+// backoff for as long as it fails in a retryable way. The result of the last
+// call is returned.
+func (to *Session) withRetry(do func() (toclientlib.ReqInf, error)) (toclientlib.ReqInf, error) {
+	maxElapsed := to.RetryMaxElapsed
+	if maxElapsed <= 0 {
+		maxElapsed = DefaultRetryMaxElapsed
+	}
+	sleep := to.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		reqInf, err := do()
+		if to.RetryBackoff <= 0 || !shouldRetry(reqInf, err) {
+			return reqInf, err
+		}
+		delay := to.retryDelay(attempt)
+		if time.Since(start)+delay > maxElapsed {
+			return reqInf, err
+		}
+		sleep(delay)
+	}
+}
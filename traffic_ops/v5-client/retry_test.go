@@ -0,0 +1,131 @@
+package client
+
+/*
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failingServer returns a Traffic Ops stand-in that responds to the first
+// 'failures' requests for each distinct path with a 503, and to every other
+// request with an empty success response.
+func failingServer(failures int) *httptest.Server {
+	var mtx sync.Mutex
+	seen := map[string]int{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		mtx.Lock()
+		seen[r.URL.Path]++
+		n := seen[r.URL.Path]
+		mtx.Unlock()
+		if strings.Contains(r.URL.Path, "/queue_update") && n <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"alerts":[{"level":"error","text":"Service Unavailable"}]}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+}
+
+// simulateClients has 'clients' Sessions each make a request that fails
+// 'failures' times, and returns the time - relative to its first attempt - at
+// which each client made each of its retries.
+func simulateClients(t *testing.T, clients, failures int, jitter float64) [][]time.Duration {
+	t.Helper()
+	srv := failingServer(failures)
+	defer srv.Close()
+
+	retries := make([][]time.Duration, clients)
+	for i := 0; i < clients; i++ {
+		var elapsed time.Duration
+		to := NewNoAuthSession(srv.URL, false, "test", false, time.Second)
+		to.RetryBackoff = time.Second
+		to.RetryMaxElapsed = time.Hour
+		to.RetryJitter = jitter
+		to.sleep = func(d time.Duration) {
+			elapsed += d
+			retries[i] = append(retries[i], elapsed)
+		}
+		if _, _, err := to.SetServerQueueUpdate(i, true, RequestOptions{}); err != nil {
+			t.Fatalf("client #%d: expected request to eventually succeed, got: %v", i, err)
+		}
+		if len(retries[i]) != failures {
+			t.Fatalf("client #%d: expected %d retries, got %d", i, failures, len(retries[i]))
+		}
+	}
+	return retries
+}
+
+// distinctMilliseconds returns the number of distinct millisecond-truncated
+// times at which the given clients made the given retry.
+func distinctMilliseconds(retries [][]time.Duration, retry int) int {
+	times := map[time.Duration]struct{}{}
+	for _, r := range retries {
+		times[r[retry].Truncate(time.Millisecond)] = struct{}{}
+	}
+	return len(times)
+}
+
+func TestRetryJitter(t *testing.T) {
+	const clients = 100
+	const failures = 3
+
+	retries := simulateClients(t, clients, failures, 0)
+	for retry := 0; retry < failures; retry++ {
+		if n := distinctMilliseconds(retries, retry); n != 1 {
+			t.Errorf("expected all clients to make retry #%d at the same time without jitter, got %d distinct times", retry+1, n)
+		}
+	}
+
+	retries = simulateClients(t, clients, failures, 0.5)
+	for retry := 0; retry < failures; retry++ {
+		// With a one-second backoff and 50% jitter, the first retry is spread
+		// over a full second, so ~95 distinct milliseconds are expected.
+		if n := distinctMilliseconds(retries, retry); n < clients*8/10 {
+			t.Errorf("expected clients' retry #%d to be spread out with jitter, got only %d distinct milliseconds for %d clients", retry+1, n, clients)
+		}
+		for i, r := range retries {
+			lo := time.Duration(0)
+			if retry > 0 {
+				lo = r[retry-1]
+			}
+			backoff := time.Second << uint(retry)
+			if d := r[retry] - lo; d < backoff/2 || d > backoff*3/2 {
+				t.Errorf("client #%d: expected retry #%d to wait between %s and %s, waited %s", i, retry+1, backoff/2, backoff*3/2, d)
+			}
+		}
+	}
+}
+
+func TestRetryDisabledByDefault(t *testing.T) {
+	srv := failingServer(1)
+	defer srv.Close()
+
+	to := NewNoAuthSession(srv.URL, false, "test", false, time.Second)
+	to.sleep = func(time.Duration) {
+		t.Error("expected no retries when RetryBackoff is not set")
+	}
+	if _, reqInf, err := to.SetServerQueueUpdate(1, true, RequestOptions{}); err == nil {
+		t.Error("expected the failed request not to be retried, but it succeeded")
+	} else if reqInf.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected status code %d, got %d", http.StatusServiceUnavailable, reqInf.StatusCode)
+	}
+}
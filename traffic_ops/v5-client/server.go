@@ -124,6 +124,39 @@ func (to *Session) GetServers(opts RequestOptions) (tc.ServersV4Response, toclie
 	return data, reqInf, err
 }
 
+// GetServerIDByHostname returns the ID of the server with the given host name.
+// It's an error if there isn't exactly one such server. If the Session's
+// CacheServerIDs is true, the ID is cached, and later calls for the same host
+// name return it without making a request (and with a zero-value ReqInf).
+func (to *Session) GetServerIDByHostname(name string, opts RequestOptions) (int, toclientlib.ReqInf, error) {
+	if to.CacheServerIDs {
+		if id, ok := to.serverIDs.Load(name); ok {
+			return id.(int), toclientlib.ReqInf{}, nil
+		}
+	}
+
+	if opts.QueryParameters == nil {
+		opts.QueryParameters = url.Values{}
+	}
+	opts.QueryParameters.Set("hostName", name)
+	servers, reqInf, err := to.GetServers(opts)
+	if err != nil {
+		return 0, reqInf, fmt.Errorf("getting server with host name '%s': %w", name, err)
+	}
+	if len(servers.Response) != 1 {
+		return 0, reqInf, fmt.Errorf("expected exactly one server with host name '%s', found %d", name, len(servers.Response))
+	}
+	if servers.Response[0].ID == nil {
+		return 0, reqInf, fmt.Errorf("server with host name '%s' has no ID", name)
+	}
+
+	id := *servers.Response[0].ID
+	if to.CacheServerIDs {
+		to.serverIDs.Store(name, id)
+	}
+	return id, reqInf, nil
+}
+
 // DeleteServer deletes the Server with the given ID.
 func (to *Session) DeleteServer(id int, opts RequestOptions) (tc.Alerts, toclientlib.ReqInf, error) {
 	route := fmt.Sprintf("%s/%d", apiServers, id)
@@ -165,6 +198,9 @@ func (to *Session) GetServerIDDeliveryServices(server int, opts RequestOptions)
 func (to *Session) GetServerUpdateStatus(hostName string, opts RequestOptions) (tc.ServerUpdateStatusResponseV4, toclientlib.ReqInf, error) {
 	path := apiServers + `/` + url.PathEscape(hostName) + `/update_status`
 	var data tc.ServerUpdateStatusResponseV4
-	reqInf, err := to.get(path, opts, &data)
+	reqInf, err := to.withRetry(func() (toclientlib.ReqInf, error) {
+		data = tc.ServerUpdateStatusResponseV4{}
+		return to.get(path, opts, &data)
+	})
 	return data, reqInf, err
 }
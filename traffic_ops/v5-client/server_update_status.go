@@ -18,27 +18,316 @@ package client
 import (
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-rfc"
 	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
 	"github.com/apache/trafficcontrol/traffic_ops/toclientlib"
 )
 
 // UpdateServerStatus updates the Status of the server identified by
 // 'serverID'.
+//
+// If the request is conditional - see UpdateServerStatusIfUnmodified - and the
+// server has been modified since, the returned error is a
+// *ServerStatusPreconditionFailedError.
 func (to *Session) UpdateServerStatus(serverID int, req tc.ServerPutStatus, opts RequestOptions) (tc.Alerts, toclientlib.ReqInf, error) {
 	path := fmt.Sprintf("servers/%d/status", serverID)
 	var alerts tc.Alerts
-	reqInf, err := to.put(path, opts, req, &alerts)
+	reqInf, err := to.withRetry(func() (toclientlib.ReqInf, error) {
+		alerts = tc.Alerts{}
+		return to.put(path, opts, req, &alerts)
+	})
+	if err != nil && reqInf.StatusCode == http.StatusPreconditionFailed {
+		err = &ServerStatusPreconditionFailedError{ServerID: serverID, Err: err}
+	}
 	return alerts, reqInf, err
 }
 
+// ServerStatusPrecondition is a condition on which the Status of a server is
+// updated by UpdateServerStatusIfUnmodified. Either or both of its fields may
+// be set; if both are, Traffic Ops uses ETag.
+type ServerStatusPrecondition struct {
+	// UnmodifiedSince, if not zero, is sent as the If-Unmodified-Since
+	// header: the server must not have been modified after it.
+	UnmodifiedSince time.Time
+	// ETag, if not empty, is sent as the If-Match header: the server must not
+	// have been modified since it was read with this ETag.
+	ETag string
+}
+
+// header returns a copy of the given header with the precondition's headers
+// set in it.
+func (p ServerStatusPrecondition) header(h http.Header) http.Header {
+	h = h.Clone()
+	if h == nil {
+		h = http.Header{}
+	}
+	if !p.UnmodifiedSince.IsZero() {
+		h.Set(rfc.IfUnmodifiedSince, rfc.FormatHTTPDate(p.UnmodifiedSince.UTC()))
+	}
+	if p.ETag != "" {
+		h.Set(rfc.IfMatch, p.ETag)
+	}
+	return h
+}
+
+// ServerStatusPreconditionFailedError is the error returned when the Status of
+// a server isn't updated because the server was modified since the time - or
+// ETag - given as the precondition of the update. Callers will usually want to
+// read the server again, and retry the update if it still makes sense.
+type ServerStatusPreconditionFailedError struct {
+	ServerID int
+	// Err is the error returned by the request.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *ServerStatusPreconditionFailedError) Error() string {
+	return fmt.Sprintf("server #%d was modified since the precondition of the status update: %v", e.ServerID, e.Err)
+}
+
+// Unwrap returns the error returned by the request.
+func (e *ServerStatusPreconditionFailedError) Unwrap() error {
+	return e.Err
+}
+
+// UpdateServerStatusIfUnmodified updates the Status of the server identified by
+// 'serverID' exactly as UpdateServerStatus does, but only if the server hasn't
+// been modified since the given precondition. If it has, the returned error is
+// a *ServerStatusPreconditionFailedError, e.g.
+//
+//	var modified *client.ServerStatusPreconditionFailedError
+//	if errors.As(err, &modified) {
+//		// re-read the server and decide whether to retry
+//	}
+//
+// Any headers in 'opts' are sent as well, but those of the precondition
+// replace them.
+func (to *Session) UpdateServerStatusIfUnmodified(serverID int, req tc.ServerPutStatus, precondition ServerStatusPrecondition, opts RequestOptions) (tc.Alerts, toclientlib.ReqInf, error) {
+	if precondition.UnmodifiedSince.IsZero() && precondition.ETag == "" {
+		return tc.Alerts{}, toclientlib.ReqInf{}, errors.New("precondition must have an UnmodifiedSince time or an ETag")
+	}
+	opts.Header = precondition.header(opts.Header)
+	return to.UpdateServerStatus(serverID, req, opts)
+}
+
+// UpdateServerStatusByHostname updates the Status of the server with the given
+// host name, exactly as UpdateServerStatus does. The host name is resolved to
+// an ID using GetServerIDByHostname.
+func (to *Session) UpdateServerStatusByHostname(hostName string, req tc.ServerPutStatus, opts RequestOptions) (tc.Alerts, toclientlib.ReqInf, error) {
+	id, reqInf, err := to.GetServerIDByHostname(hostName, RequestOptions{APIVersion: opts.APIVersion})
+	if err != nil {
+		return tc.Alerts{}, reqInf, err
+	}
+	return to.UpdateServerStatus(id, req, opts)
+}
+
+// UpdateServerStatusByName updates the Status of the server identified by
+// 'serverID' to the Status with the given name - e.g. "OFFLINE" - exactly as
+// UpdateServerStatus does, giving 'reason' as its offline reason unless that's
+// empty. The Status name is resolved to an ID using GetStatusIDByName.
+func (to *Session) UpdateServerStatusByName(serverID int, statusName, reason string, opts RequestOptions) (tc.Alerts, toclientlib.ReqInf, error) {
+	statusID, reqInf, err := to.GetStatusIDByName(statusName, RequestOptions{Header: opts.Header, APIVersion: opts.APIVersion})
+	if err != nil {
+		return tc.Alerts{}, reqInf, err
+	}
+	req := tc.ServerPutStatus{Status: util.JSONNameOrIDStr{ID: &statusID}}
+	if reason != "" {
+		req.OfflineReason = &reason
+	}
+	return to.UpdateServerStatus(serverID, req, opts)
+}
+
+// UpdateServerStatusIfHealthy updates the Status of the given server exactly as
+// UpdateServerStatus does, but first - if the Session has a HealthCheck - runs
+// the HealthCheck on the server, and returns its error without changing the
+// server's Status if it fails. This is meant to keep automation from putting
+// a server that's still unhealthy back into rotation.
+func (to *Session) UpdateServerStatusIfHealthy(server tc.ServerV4, req tc.ServerPutStatus, opts RequestOptions) (tc.Alerts, toclientlib.ReqInf, error) {
+	if server.ID == nil {
+		return tc.Alerts{}, toclientlib.ReqInf{}, errors.New("server has no ID")
+	}
+	if to.HealthCheck != nil {
+		if err := to.HealthCheck(server); err != nil {
+			name := strconv.Itoa(*server.ID)
+			if server.HostName != nil {
+				name = *server.HostName
+			}
+			return tc.Alerts{}, toclientlib.ReqInf{}, fmt.Errorf("pre-flight health check of server %s failed, not updating its Status: %w", name, err)
+		}
+	}
+	return to.UpdateServerStatus(*server.ID, req, opts)
+}
+
+// HTTPHealthCheck returns a function suitable for use as a Session's
+// HealthCheck, which makes a GET request to the URL returned by 'healthURL'
+// for the server being checked, using the given HTTP client (or
+// http.DefaultClient if that's nil). The check fails if the request can't be
+// made, or the response has a status code outside the 2XX range.
+func HTTPHealthCheck(client *http.Client, healthURL func(server tc.ServerV4) (string, error)) func(tc.ServerV4) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(server tc.ServerV4) error {
+		u, err := healthURL(server)
+		if err != nil {
+			return fmt.Errorf("building health URL: %w", err)
+		}
+		resp, err := client.Get(u)
+		if err != nil {
+			return fmt.Errorf("requesting %s: %w", u, err)
+		}
+		defer log.Close(resp.Body, "closing health check response body")
+		io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+			return fmt.Errorf("requesting %s: unhealthy response status %d %s", u, resp.StatusCode, http.StatusText(resp.StatusCode))
+		}
+		return nil
+	}
+}
+
+// UpdateServerStatusAndDequeue updates the Status of the server identified by
+// 'serverID' exactly as UpdateServerStatus does, and then - if the new Status
+// is OFFLINE or ADMIN_DOWN - dequeues any pending configuration updates on the
+// server using SetServerQueueUpdate, so that configuration isn't pushed to a
+// server being taken out of service. The Alerts returned by both requests are
+// returned together.
+//
+// If the Status in 'req' is given only by ID, an extra request is made to
+// look up its name.
+func (to *Session) UpdateServerStatusAndDequeue(serverID int, req tc.ServerPutStatus, opts RequestOptions) (tc.Alerts, toclientlib.ReqInf, error) {
+	alerts, reqInf, err := to.UpdateServerStatus(serverID, req, opts)
+	if err != nil {
+		return alerts, reqInf, err
+	}
+
+	var statusName string
+	if req.Status.Name != nil {
+		statusName = *req.Status.Name
+	} else if req.Status.ID != nil {
+		statusOpts := RequestOptions{Header: opts.Header, QueryParameters: url.Values{}, APIVersion: opts.APIVersion}
+		statusOpts.QueryParameters.Set("id", strconv.Itoa(*req.Status.ID))
+		statuses, statusReqInf, err := to.GetStatuses(statusOpts)
+		if err != nil {
+			return alerts, statusReqInf, fmt.Errorf("looking up name of Status #%d: %w", *req.Status.ID, err)
+		}
+		if len(statuses.Response) != 1 {
+			return alerts, statusReqInf, fmt.Errorf("looking up name of Status #%d: expected exactly one Status, got %d", *req.Status.ID, len(statuses.Response))
+		}
+		statusName = statuses.Response[0].Name
+	}
+
+	if tc.CacheStatus(statusName) != tc.CacheStatusOffline && tc.CacheStatus(statusName) != tc.CacheStatusAdminDown {
+		return alerts, reqInf, nil
+	}
+
+	resp, reqInf, err := to.SetServerQueueUpdate(serverID, false, RequestOptions{Header: opts.Header, APIVersion: opts.APIVersion})
+	alerts.AddAlerts(resp.Alerts)
+	if err != nil {
+		return alerts, reqInf, fmt.Errorf("dequeuing updates after setting status to %s: %w", statusName, err)
+	}
+	return alerts, reqInf, nil
+}
+
+// DefaultServerStatusUpdateConcurrency is the number of concurrent requests
+// UpdateServerStatuses makes when it isn't given a concurrency limit.
+const DefaultServerStatusUpdateConcurrency = 10
+
+// ServerStatusUpdateResult is the outcome of updating the Status of a single
+// server as part of a call to UpdateServerStatuses.
+type ServerStatusUpdateResult struct {
+	ServerID int
+	Alerts   tc.Alerts
+	ReqInf   toclientlib.ReqInf
+	Err      error
+}
+
+// ServerStatusUpdateResults is the outcome of a call to UpdateServerStatuses,
+// with one entry per server in the same order as the server IDs given.
+type ServerStatusUpdateResults []ServerStatusUpdateResult
+
+// Failed returns the results of the updates that failed.
+func (results ServerStatusUpdateResults) Failed() ServerStatusUpdateResults {
+	failed := ServerStatusUpdateResults{}
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Err returns an error describing every update that failed, attributed to
+// the server it was for, or nil if all of the updates succeeded.
+func (results ServerStatusUpdateResults) Err() error {
+	errs := []error{}
+	for _, result := range results.Failed() {
+		errs = append(errs, fmt.Errorf("updating status of server #%d: %w", result.ServerID, result.Err))
+	}
+	return util.JoinErrs(errs)
+}
+
+// UpdateServerStatuses updates the Status of each of the servers identified
+// by 'serverIDs' to the one given in 'req' - e.g. to take a whole rack of
+// cache servers OFFLINE at once. The updates are made as by
+// UpdateServerStatus, with at most 'concurrency' requests in flight at any
+// one time (DefaultServerStatusUpdateConcurrency if 'concurrency' isn't
+// positive).
+//
+// A failure to update one server doesn't stop the others from being updated;
+// check the Err (or Failed) method of the returned results to find out which,
+// if any, failed.
+func (to *Session) UpdateServerStatuses(serverIDs []int, req tc.ServerPutStatus, concurrency int, opts RequestOptions) ServerStatusUpdateResults {
+	if concurrency <= 0 {
+		concurrency = DefaultServerStatusUpdateConcurrency
+	}
+	// Pin the API version up-front, so that the concurrent requests don't all
+	// try to negotiate it with Traffic Ops at once.
+	if opts.APIVersion == "" {
+		opts.APIVersion = to.APIVersion()
+	}
+
+	results := make(ServerStatusUpdateResults, len(serverIDs))
+	sem := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+	for i, serverID := range serverIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i, serverID int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			alerts, reqInf, err := to.UpdateServerStatus(serverID, req, opts)
+			results[i] = ServerStatusUpdateResult{ServerID: serverID, Alerts: alerts, ReqInf: reqInf, Err: err}
+		}(i, serverID)
+	}
+	wg.Wait()
+	return results
+}
+
 var queueUpdateActions = map[bool]string{
 	false: "dequeue",
 	true:  "queue",
 }
 
+// SetServerQueueUpdateByHostname queues or dequeues updates on the server with
+// the given host name, exactly as SetServerQueueUpdate does. The host name is
+// resolved to an ID using GetServerIDByHostname.
+func (to *Session) SetServerQueueUpdateByHostname(hostName string, queueUpdate bool, opts RequestOptions) (tc.ServerQueueUpdateResponse, toclientlib.ReqInf, error) {
+	id, reqInf, err := to.GetServerIDByHostname(hostName, RequestOptions{APIVersion: opts.APIVersion})
+	if err != nil {
+		return tc.ServerQueueUpdateResponse{}, reqInf, err
+	}
+	return to.SetServerQueueUpdate(id, queueUpdate, opts)
+}
+
 // SetServerQueueUpdate set the "updPending" field of th eserver identified by
 // 'serverID' to the value of 'queueUpdate - and properly queues updates on
 // parents/children as necessary.
@@ -46,12 +335,39 @@ func (to *Session) SetServerQueueUpdate(serverID int, queueUpdate bool, opts Req
 	req := tc.ServerQueueUpdateRequest{Action: queueUpdateActions[queueUpdate]}
 	var resp tc.ServerQueueUpdateResponse
 	path := fmt.Sprintf("/servers/%d/queue_update", serverID)
-	reqInf, err := to.post(path, opts, req, &resp)
+	reqInf, err := to.withRetry(func() (toclientlib.ReqInf, error) {
+		resp = tc.ServerQueueUpdateResponse{}
+		return to.post(path, opts, req, &resp)
+	})
 	return resp, reqInf, err
 }
 
+// MaxApplyTimeClockSkew is how far in the future (according to the client's
+// clock) an "apply time" passed to SetUpdateServerStatusTimes may be before
+// it is rejected. This allows for some clock skew between the client and
+// Traffic Ops, since apply times are typically copied from the update times
+// Traffic Ops reports.
+const MaxApplyTimeClockSkew = 5 * time.Minute
+
+// validateApplyTime checks that an "apply time" describes a point in time at
+// which an update could actually have been applied.
+func validateApplyTime(name string, t time.Time) error {
+	if t.IsZero() {
+		return fmt.Errorf("%s must not be the zero time", name)
+	}
+	if t.After(time.Now().Add(MaxApplyTimeClockSkew)) {
+		return fmt.Errorf("%s %s is in the future; updates cannot have been applied yet", name, t.Format(time.RFC3339))
+	}
+	return nil
+}
+
 // SetUpdateServerStatusTimes updates a server's config queue status and/or reval status.
 // Each argument individually is optional, however at least one argument must not be nil.
+//
+// Before making any request, the given times are checked for consistency;
+// neither may be the zero time, and neither may be later than the current
+// time plus MaxApplyTimeClockSkew - since an update can't be applied in the
+// future. An error describing the problem is returned if either check fails.
 func (to *Session) SetUpdateServerStatusTimes(serverName string, configApplyTime, revalApplyTime *time.Time, opts RequestOptions) (tc.Alerts, toclientlib.ReqInf, error) {
 	reqInf := toclientlib.ReqInf{CacheHitStatus: toclientlib.CacheHitStatusMiss}
 	var alerts tc.Alerts
@@ -59,6 +375,16 @@ func (to *Session) SetUpdateServerStatusTimes(serverName string, configApplyTime
 	if configApplyTime == nil && revalApplyTime == nil {
 		return alerts, reqInf, errors.New("one must be non-nil (configApplyTime, revalApplyTime); nothing to do")
 	}
+	if configApplyTime != nil {
+		if err := validateApplyTime("configApplyTime", *configApplyTime); err != nil {
+			return alerts, reqInf, err
+		}
+	}
+	if revalApplyTime != nil {
+		if err := validateApplyTime("revalApplyTime", *revalApplyTime); err != nil {
+			return alerts, reqInf, err
+		}
+	}
 
 	if opts.QueryParameters == nil {
 		opts.QueryParameters = url.Values{}
@@ -74,6 +400,50 @@ func (to *Session) SetUpdateServerStatusTimes(serverName string, configApplyTime
 	}
 
 	path := `/servers/` + url.PathEscape(serverName) + `/update`
-	reqInf, err := to.post(path, opts, nil, &alerts)
+	reqInf, err := to.withRetry(func() (toclientlib.ReqInf, error) {
+		alerts = tc.Alerts{}
+		return to.post(path, opts, nil, &alerts)
+	})
 	return alerts, reqInf, err
 }
+
+// GetOutOfSyncServers returns the update statuses of the servers in the CDN
+// with the given ID that have a configuration update or a revalidation queued
+// after they last applied one - see tc.ServerUpdateStatusV40.OutOfSync. The
+// servers of the CDN are fetched in one request, and only those that are out
+// of sync have their update statuses fetched, one request each. The returned
+// ReqInf is that of the last request made.
+//
+// Any query string parameters in 'opts' are used only when fetching the
+// servers, e.g. to narrow them down by type.
+func (to *Session) GetOutOfSyncServers(cdnID int, opts RequestOptions) ([]tc.ServerUpdateStatusV4, toclientlib.ReqInf, error) {
+	serversOpts := RequestOptions{APIVersion: opts.APIVersion, Header: opts.Header, QueryParameters: url.Values{}}
+	for k, v := range opts.QueryParameters {
+		serversOpts.QueryParameters[k] = v
+	}
+	serversOpts.QueryParameters.Set("cdn", strconv.Itoa(cdnID))
+	servers, reqInf, err := to.GetServers(serversOpts)
+	if err != nil {
+		return nil, reqInf, fmt.Errorf("getting servers of CDN #%d: %w", cdnID, err)
+	}
+
+	statuses := []tc.ServerUpdateStatusV4{}
+	for _, server := range servers.Response {
+		if server.HostName == nil || server.ID == nil || !server.OutOfSync() {
+			continue
+		}
+		resp, inf, err := to.GetServerUpdateStatus(*server.HostName, RequestOptions{APIVersion: opts.APIVersion, Header: opts.Header})
+		reqInf = inf
+		if err != nil {
+			return nil, reqInf, fmt.Errorf("getting update status of server '%s': %w", *server.HostName, err)
+		}
+		// Host names aren't unique, so the status of this particular server
+		// has to be picked out by its ID.
+		for _, status := range resp.Response {
+			if status.HostId == *server.ID && status.OutOfSync() {
+				statuses = append(statuses, tc.ServerUpdateStatusV4(status))
+			}
+		}
+	}
+	return statuses, reqInf, nil
+}
@@ -0,0 +1,387 @@
+package client
+
+/*
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+)
+
+func TestUpdateServerStatusIfUnmodified(t *testing.T) {
+	since := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		if ius := r.Header.Get(rfc.IfUnmodifiedSince); ius != rfc.FormatHTTPDate(since) {
+			t.Errorf("Expected %s header '%s', got '%s'", rfc.IfUnmodifiedSince, rfc.FormatHTTPDate(since), ius)
+		}
+		if im := r.Header.Get(rfc.IfMatch); im != `"v1-abc"` {
+			t.Errorf("Expected %s header '\"v1-abc\"', got '%s'", rfc.IfMatch, im)
+		}
+		w.WriteHeader(http.StatusPreconditionFailed)
+		w.Write([]byte(`{"alerts":[{"level":"error","text":"resource was modified"}]}`))
+	}))
+	defer srv.Close()
+
+	to := NewNoAuthSession(srv.URL, false, "test", false, time.Second)
+	to.RetryBackoff = time.Second
+	to.sleep = func(time.Duration) {}
+	req := tc.ServerPutStatus{Status: util.JSONNameOrIDStr{Name: util.StrPtr("ONLINE")}}
+	precondition := ServerStatusPrecondition{UnmodifiedSince: since, ETag: `"v1-abc"`}
+	_, reqInf, err := to.UpdateServerStatusIfUnmodified(7, req, precondition, RequestOptions{})
+
+	var modified *ServerStatusPreconditionFailedError
+	if !errors.As(err, &modified) {
+		t.Fatalf("Expected a *ServerStatusPreconditionFailedError, got: %v", err)
+	}
+	if modified.ServerID != 7 {
+		t.Errorf("Expected the error to be for server #7, got #%d", modified.ServerID)
+	}
+	if reqInf.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("Expected status code %d, got %d", http.StatusPreconditionFailed, reqInf.StatusCode)
+	}
+	if requests != 1 {
+		t.Errorf("Expected a failed precondition not to be retried, got %d requests", requests)
+	}
+
+	if _, _, err := to.UpdateServerStatusIfUnmodified(7, req, ServerStatusPrecondition{}, RequestOptions{}); err == nil {
+		t.Error("Expected an error updating with an empty precondition, got none")
+	}
+}
+
+// stubRequest is a request received by a stubTrafficOps.
+type stubRequest struct {
+	// Route is the request method and path - relative to the API version,
+	// e.g. "PUT servers/7/status".
+	Route string
+	Query url.Values
+	Body  []byte
+}
+
+// stubTrafficOps is a Traffic Ops stand-in that records the requests it
+// receives, and responds to each with the body given for its Route - or with
+// a 404 if there isn't one.
+type stubTrafficOps struct {
+	*httptest.Server
+	mtx       sync.Mutex
+	requests  []stubRequest
+	responses map[string]string
+}
+
+var apiVersionPrefix = regexp.MustCompile(`^/api/[^/]+/+`)
+
+func newStubTrafficOps(responses map[string]string) *stubTrafficOps {
+	stub := &stubTrafficOps{responses: responses}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		route := r.Method + " " + apiVersionPrefix.ReplaceAllString(r.URL.Path, "")
+		stub.mtx.Lock()
+		stub.requests = append(stub.requests, stubRequest{Route: route, Query: r.URL.Query(), Body: body})
+		resp, ok := stub.responses[route]
+		stub.mtx.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"alerts":[{"level":"error","text":"not found"}]}`))
+			return
+		}
+		w.Write([]byte(resp))
+	}))
+	return stub
+}
+
+// routes returns the Routes of the requests received so far, in order.
+func (stub *stubTrafficOps) routes() []string {
+	stub.mtx.Lock()
+	defer stub.mtx.Unlock()
+	routes := make([]string, 0, len(stub.requests))
+	for _, req := range stub.requests {
+		routes = append(routes, req.Route)
+	}
+	return routes
+}
+
+// reset forgets the requests received so far.
+func (stub *stubTrafficOps) reset() {
+	stub.mtx.Lock()
+	defer stub.mtx.Unlock()
+	stub.requests = nil
+}
+
+// request returns the i'th request received.
+func (stub *stubTrafficOps) request(i int) stubRequest {
+	stub.mtx.Lock()
+	defer stub.mtx.Unlock()
+	return stub.requests[i]
+}
+
+func (stub *stubTrafficOps) session() *Session {
+	return NewNoAuthSession(stub.URL, false, "test", false, time.Second)
+}
+
+func expectRoutes(t *testing.T, stub *stubTrafficOps, expected ...string) {
+	t.Helper()
+	if actual := stub.routes(); strings.Join(actual, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("Expected requests %v, got: %v", expected, actual)
+	}
+}
+
+const okAlert = `{"alerts":[{"level":"success","text":"ok"}]}`
+
+func TestUpdateServerStatusAndDequeue(t *testing.T) {
+	stub := newStubTrafficOps(map[string]string{
+		"PUT servers/7/status":        okAlert,
+		"POST servers/7/queue_update": `{"alerts":[{"level":"success","text":"dequeued"}],"response":{"serverId":7,"action":"dequeue"}}`,
+		"GET statuses":                `{"response":[{"id":3,"name":"ADMIN_DOWN"}]}`,
+	})
+	defer stub.Close()
+	to := stub.session()
+
+	offline := tc.ServerPutStatus{Status: util.JSONNameOrIDStr{Name: util.StrPtr("OFFLINE")}}
+	alerts, _, err := to.UpdateServerStatusAndDequeue(7, offline, RequestOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error taking server OFFLINE: %v", err)
+	}
+	expectRoutes(t, stub, "PUT servers/7/status", "POST servers/7/queue_update")
+	if len(alerts.Alerts) != 2 {
+		t.Errorf("Expected the alerts of both requests, got: %+v", alerts.Alerts)
+	}
+	var queue tc.ServerQueueUpdateRequest
+	if err := json.Unmarshal(stub.request(1).Body, &queue); err != nil || queue.Action != "dequeue" {
+		t.Errorf("Expected a dequeue request, got '%s' (%v)", stub.request(1).Body, err)
+	}
+
+	// A Status given by ID is looked up by name first.
+	stub.reset()
+	byID := tc.ServerPutStatus{Status: util.JSONNameOrIDStr{ID: util.IntPtr(3)}}
+	if _, _, err := to.UpdateServerStatusAndDequeue(7, byID, RequestOptions{}); err != nil {
+		t.Fatalf("Unexpected error setting server ADMIN_DOWN by Status ID: %v", err)
+	}
+	expectRoutes(t, stub, "PUT servers/7/status", "GET statuses", "POST servers/7/queue_update")
+	if id := stub.request(1).Query.Get("id"); id != "3" {
+		t.Errorf("Expected the Status to be looked up by its ID (3), got '%s'", id)
+	}
+
+	// Servers put in service keep their updates.
+	stub.reset()
+	online := tc.ServerPutStatus{Status: util.JSONNameOrIDStr{Name: util.StrPtr("ONLINE")}}
+	if _, _, err := to.UpdateServerStatusAndDequeue(7, online, RequestOptions{}); err != nil {
+		t.Fatalf("Unexpected error putting server ONLINE: %v", err)
+	}
+	expectRoutes(t, stub, "PUT servers/7/status")
+}
+
+func TestSetUpdateServerStatusTimes(t *testing.T) {
+	stub := newStubTrafficOps(map[string]string{"POST servers/edge 1/update": okAlert})
+	defer stub.Close()
+	to := stub.session()
+
+	zero := time.Time{}
+	future := time.Now().Add(MaxApplyTimeClockSkew + time.Hour)
+	if _, _, err := to.SetUpdateServerStatusTimes("edge 1", &zero, nil, RequestOptions{}); err == nil {
+		t.Error("Expected an error setting a zero config apply time, got none")
+	}
+	if _, _, err := to.SetUpdateServerStatusTimes("edge 1", nil, &future, RequestOptions{}); err == nil {
+		t.Error("Expected an error setting a reval apply time in the future, got none")
+	}
+	if _, _, err := to.SetUpdateServerStatusTimes("edge 1", nil, nil, RequestOptions{}); err == nil {
+		t.Error("Expected an error setting neither apply time, got none")
+	}
+	expectRoutes(t, stub)
+
+	applied := time.Now().Add(-time.Hour).UTC()
+	skewed := time.Now().Add(MaxApplyTimeClockSkew / 2)
+	if _, _, err := to.SetUpdateServerStatusTimes("edge 1", &applied, &skewed, RequestOptions{}); err != nil {
+		t.Fatalf("Unexpected error setting apply times: %v", err)
+	}
+	if len(stub.routes()) != 1 {
+		t.Fatalf("Expected one request, got: %v", stub.routes())
+	}
+	if cat := stub.request(0).Query.Get("config_apply_time"); cat != applied.Format(time.RFC3339Nano) {
+		t.Errorf("Expected config_apply_time '%s', got '%s'", applied.Format(time.RFC3339Nano), cat)
+	}
+	if rat := stub.request(0).Query.Get("revalidate_apply_time"); rat == "" {
+		t.Error("Expected a revalidate_apply_time within the allowed clock skew to be sent")
+	}
+}
+
+func TestUpdateServerStatuses(t *testing.T) {
+	var inFlight, maxInFlight int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/servers/2/status") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"alerts":[{"level":"error","text":"no such Status"}]}`))
+			return
+		}
+		w.Write([]byte(okAlert))
+	}))
+	defer srv.Close()
+
+	to := NewNoAuthSession(srv.URL, false, "test", false, time.Second)
+	req := tc.ServerPutStatus{Status: util.JSONNameOrIDStr{Name: util.StrPtr("OFFLINE")}}
+	results := to.UpdateServerStatuses([]int{1, 2, 3, 4, 5}, req, 2, RequestOptions{})
+
+	if len(results) != 5 {
+		t.Fatalf("Expected 5 results, got %d", len(results))
+	}
+	for i, result := range results {
+		if result.ServerID != i+1 {
+			t.Errorf("Expected result #%d to be for server #%d, got #%d", i, i+1, result.ServerID)
+		}
+	}
+	if failed := results.Failed(); len(failed) != 1 || failed[0].ServerID != 2 {
+		t.Errorf("Expected only the update of server #2 to fail, got: %+v", failed)
+	}
+	if err := results.Err(); err == nil || !strings.Contains(err.Error(), "server #2") {
+		t.Errorf("Expected an error about server #2, got: %v", err)
+	}
+	if max := atomic.LoadInt32(&maxInFlight); max > 2 {
+		t.Errorf("Expected at most 2 requests in flight, got %d", max)
+	}
+}
+
+func TestUpdateServerStatusIfHealthy(t *testing.T) {
+	stub := newStubTrafficOps(map[string]string{"PUT servers/7/status": okAlert})
+	defer stub.Close()
+	to := stub.session()
+
+	health := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthy" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer health.Close()
+	healthPath := "/healthy"
+	to.HealthCheck = HTTPHealthCheck(health.Client(), func(server tc.ServerV4) (string, error) {
+		return health.URL + healthPath, nil
+	})
+
+	server := tc.ServerV4{}
+	server.ID = util.IntPtr(7)
+	server.HostName = util.StrPtr("edge1")
+	req := tc.ServerPutStatus{Status: util.JSONNameOrIDStr{Name: util.StrPtr("ONLINE")}}
+
+	if _, _, err := to.UpdateServerStatusIfHealthy(server, req, RequestOptions{}); err != nil {
+		t.Fatalf("Unexpected error updating healthy server: %v", err)
+	}
+	expectRoutes(t, stub, "PUT servers/7/status")
+
+	stub.reset()
+	healthPath = "/unhealthy"
+	_, _, err := to.UpdateServerStatusIfHealthy(server, req, RequestOptions{})
+	if err == nil || !strings.Contains(err.Error(), "edge1") || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Expected a failed health check of edge1 with status 503, got: %v", err)
+	}
+	expectRoutes(t, stub)
+
+	if _, _, err := to.UpdateServerStatusIfHealthy(tc.ServerV4{}, req, RequestOptions{}); err == nil {
+		t.Error("Expected an error updating a server without an ID, got none")
+	}
+}
+
+func TestUpdateServerStatusByHostname(t *testing.T) {
+	stub := newStubTrafficOps(map[string]string{
+		"GET servers":                 `{"response":[{"id":9,"hostName":"edge1"}]}`,
+		"PUT servers/9/status":        okAlert,
+		"POST servers/9/queue_update": `{"response":{"serverId":9,"action":"queue"}}`,
+	})
+	defer stub.Close()
+	to := stub.session()
+	to.CacheServerIDs = true
+
+	req := tc.ServerPutStatus{Status: util.JSONNameOrIDStr{Name: util.StrPtr("ONLINE")}}
+	if _, _, err := to.UpdateServerStatusByHostname("edge1", req, RequestOptions{}); err != nil {
+		t.Fatalf("Unexpected error updating server by host name: %v", err)
+	}
+	if hostName := stub.request(0).Query.Get("hostName"); hostName != "edge1" {
+		t.Errorf("Expected the server to be looked up by host name 'edge1', got '%s'", hostName)
+	}
+	// The ID is cached, so it isn't looked up again.
+	if _, _, err := to.SetServerQueueUpdateByHostname("edge1", true, RequestOptions{}); err != nil {
+		t.Fatalf("Unexpected error queuing updates by host name: %v", err)
+	}
+	expectRoutes(t, stub, "GET servers", "PUT servers/9/status", "POST servers/9/queue_update")
+
+	stub.mtx.Lock()
+	stub.responses["GET servers"] = `{"response":[]}`
+	stub.mtx.Unlock()
+	if _, _, err := to.UpdateServerStatusByHostname("edge2", req, RequestOptions{}); err == nil || !strings.Contains(err.Error(), "found 0") {
+		t.Errorf("Expected an error updating a nonexistent server, got: %v", err)
+	}
+}
+
+func TestUpdateServerStatusByName(t *testing.T) {
+	stub := newStubTrafficOps(map[string]string{
+		"GET statuses":         `{"response":[{"id":1,"name":"ONLINE"},{"id":2,"name":"OFFLINE"}]}`,
+		"PUT servers/7/status": okAlert,
+	})
+	defer stub.Close()
+	to := stub.session()
+
+	if _, _, err := to.UpdateServerStatusByName(7, "OFFLINE", "maintenance", RequestOptions{}); err != nil {
+		t.Fatalf("Unexpected error updating server Status by name: %v", err)
+	}
+	var req tc.ServerPutStatus
+	if err := json.Unmarshal(stub.request(1).Body, &req); err != nil {
+		t.Fatalf("Unexpected error decoding the Status update: %v", err)
+	}
+	if req.Status.ID == nil || *req.Status.ID != 2 {
+		t.Errorf("Expected the Status to be given by its ID (2), got: %s", stub.request(1).Body)
+	}
+	if req.OfflineReason == nil || *req.OfflineReason != "maintenance" {
+		t.Errorf("Expected offline reason 'maintenance', got: %s", stub.request(1).Body)
+	}
+
+	// Status IDs are cached, so they aren't looked up again.
+	if _, _, err := to.UpdateServerStatusByName(7, "ONLINE", "", RequestOptions{}); err != nil {
+		t.Fatalf("Unexpected error updating server Status by name: %v", err)
+	}
+	expectRoutes(t, stub, "GET statuses", "PUT servers/7/status", "PUT servers/7/status")
+	if body := string(stub.request(2).Body); strings.Contains(body, `"offlineReason":"`) {
+		t.Errorf("Expected no offline reason, got: %s", body)
+	}
+
+	if _, _, err := to.UpdateServerStatusByName(7, "NOPE", "", RequestOptions{}); err == nil {
+		t.Error("Expected an error updating to a nonexistent Status, got none")
+	}
+}
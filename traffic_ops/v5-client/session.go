@@ -20,8 +20,10 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
+	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/traffic_ops/toclientlib"
 )
 
@@ -32,6 +34,13 @@ type RequestOptions struct {
 	Header http.Header
 	// Any and all query parameters to pass in the request.
 	QueryParameters url.Values
+	// APIVersion, if not empty, is the version of the Traffic Ops API (e.g.
+	// "5.0") to which the request is made, instead of the Session's default.
+	// This is useful when talking to a cluster of Traffic Ops instances that
+	// aren't all running the same version. It must be a version this client
+	// supports, and no fallback to older versions is attempted. The version
+	// actually used is reported in the returned ReqInf's APIVersion.
+	APIVersion string
 }
 
 // NewRequestOptions returns a RequestOptions object with initialized, empty Header
@@ -70,6 +79,45 @@ type Options struct {
 // Session is a Traffic Ops client.
 type Session struct {
 	toclientlib.TOClient
+
+	// RetryBackoff is how long to wait before the first retry of a failed
+	// request made by the methods that report and manipulate server update
+	// and status information (e.g. SetServerQueueUpdate); each subsequent
+	// retry waits twice as long as the one before it. Requests are retried
+	// only if they couldn't be made at all, or Traffic Ops responded with a
+	// 502, 503, or 504 status code. The default of zero disables retries.
+	RetryBackoff time.Duration
+	// RetryMaxElapsed is the longest time that may be spent retrying a
+	// request - a retry that would start after this much time has passed
+	// since the first attempt is not made. If this is zero,
+	// DefaultRetryMaxElapsed is used.
+	RetryMaxElapsed time.Duration
+	// RetryJitter is the fraction - between 0 and 1 - of each retry's
+	// backoff by which it is randomly lengthened or shortened, so that many
+	// clients that failed at the same time don't all retry at the same time.
+	RetryJitter float64
+
+	// HealthCheck, if not nil, is run by UpdateServerStatusIfHealthy before
+	// it changes a server's Status; if it returns an error, the Status is not
+	// changed. HTTPHealthCheck can be used to build one that requests a
+	// health URL of the server.
+	HealthCheck func(server tc.ServerV4) error
+
+	// CacheServerIDs, if true, makes GetServerIDByHostname remember the IDs
+	// it looks up for the lifetime of the Session, so that repeated calls -
+	// including those made by the methods that identify servers by host name,
+	// e.g. UpdateServerStatusByHostname - don't each make a request.
+	CacheServerIDs bool
+	// serverIDs maps host names to the server IDs cached by
+	// GetServerIDByHostname.
+	serverIDs sync.Map
+	// statusIDs maps Status names to the Status IDs cached by
+	// GetStatusIDByName.
+	statusIDs sync.Map
+
+	// sleep, if not nil, is used instead of time.Sleep to wait between
+	// retries.
+	sleep func(time.Duration)
 }
 
 // NewSession constructs a new, unauthenticated Session using the provided information.
@@ -143,5 +191,8 @@ func (to *Session) req(method, path string, opts RequestOptions, body, response
 	if len(opts.QueryParameters) > 0 {
 		path += "?" + opts.QueryParameters.Encode()
 	}
+	if opts.APIVersion != "" {
+		return to.TOClient.ReqWithAPIVersion(opts.APIVersion, method, path, body, opts.Header, response)
+	}
 	return to.TOClient.Req(method, path, body, opts.Header, response)
 }
@@ -47,6 +47,29 @@ func (to *Session) GetStatuses(opts RequestOptions) (tc.StatusesResponse, toclie
 	return data, reqInf, err
 }
 
+// GetStatusIDByName returns the ID of the Status with the given name, e.g.
+// "OFFLINE". Status IDs are cached for the lifetime of the Session, so only
+// the first call - or a call for a name that isn't cached - makes a request,
+// which fetches and caches all of the Statuses at once. It's an error if there
+// is no such Status.
+func (to *Session) GetStatusIDByName(name string, opts RequestOptions) (int, toclientlib.ReqInf, error) {
+	if id, ok := to.statusIDs.Load(name); ok {
+		return id.(int), toclientlib.ReqInf{}, nil
+	}
+
+	statuses, reqInf, err := to.GetStatuses(opts)
+	if err != nil {
+		return 0, reqInf, fmt.Errorf("getting Statuses: %w", err)
+	}
+	for _, status := range statuses.Response {
+		to.statusIDs.Store(status.Name, status.ID)
+	}
+	if id, ok := to.statusIDs.Load(name); ok {
+		return id.(int), reqInf, nil
+	}
+	return 0, reqInf, fmt.Errorf("no Status named '%s'", name)
+}
+
 // DeleteStatus deletes the Status with the given ID.
 func (to *Session) DeleteStatus(id int, opts RequestOptions) (tc.Alerts, toclientlib.ReqInf, error) {
 	route := fmt.Sprintf("%s/%d", apiStatuses, id)